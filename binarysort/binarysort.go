@@ -9,6 +9,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"math"
+	"time"
 )
 
 // Default Base64 encoder string doesn't preserve lexicographic order. This alternative
@@ -90,6 +91,35 @@ func DecodeFloat64(buf []byte) (float64, error) {
 	return math.Float64frombits(x), nil
 }
 
+// TimeSize is the size of the binary representation of a time.
+const TimeSize = 12
+
+// AppendTime takes a time and returns its binary representation:
+// the number of seconds elapsed since January 1, 1970 UTC,
+// followed by the nanoseconds within that second.
+func AppendTime(buf []byte, t time.Time) []byte {
+	buf = AppendInt64(buf, t.Unix())
+
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(t.Nanosecond()))
+	return append(buf, b[:]...)
+}
+
+// DecodeTime takes a byte slice and decodes it into a time, in UTC.
+func DecodeTime(buf []byte) (time.Time, error) {
+	if len(buf) < TimeSize {
+		return time.Time{}, errors.New("cannot decode buffer to time")
+	}
+
+	sec, err := DecodeInt64(buf)
+	if err != nil {
+		return time.Time{}, err
+	}
+	nsec := binary.BigEndian.Uint32(buf[8:])
+
+	return time.Unix(sec, int64(nsec)).UTC(), nil
+}
+
 // AppendBase64 encodes data into a custom base64 encoding. The resulting slice respects
 // natural sort-ordering.
 func AppendBase64(buf []byte, data []byte) ([]byte, error) {
@@ -63,7 +63,10 @@ func NewApp() *cli.App {
 			}
 			defer db.Close()
 
-			return dbutil.ExecSQL(c.Context, db, os.Stdin, os.Stdout)
+			sess := db.NewSession()
+			defer sess.Close()
+
+			return dbutil.ExecSQL(c.Context, sess, os.Stdin, os.Stdout)
 		}
 
 		return shell.Run(c.Context, &shell.Options{
@@ -58,7 +58,10 @@ func NewRestoreCommand() *cli.Command {
 			}
 			defer db.Close()
 
-			return dbutil.ExecSQL(c.Context, db, file, os.Stdout)
+			sess := db.NewSession()
+			defer sess.Close()
+
+			return dbutil.ExecSQL(c.Context, sess, file, os.Stdout)
 		},
 	}
 }
@@ -85,9 +88,12 @@ func executeRestore(ctx context.Context, r io.Reader, e, dbPath string) error {
 	if err != nil {
 		return err
 	}
-	db = db.WithContext(ctx)
 	defer db.Close()
 
+	// the dump is wrapped in a transaction spanning multiple queries.
+	sess := db.WithContext(ctx).NewSession()
+	defer sess.Close()
+
 	scanner := bufio.NewScanner(r)
 
 	// Every query ends with a semicolon.
@@ -107,8 +113,8 @@ func executeRestore(ctx context.Context, r io.Reader, e, dbPath string) error {
 
 	for scanner.Scan() {
 		q := scanner.Text()
-		if err := db.Exec(q); err != nil {
-			_ = db.Exec("ROLLBACK")
+		if err := sess.Exec(q); err != nil {
+			_ = sess.Exec("ROLLBACK")
 			return err
 		}
 	}
@@ -12,6 +12,8 @@ import (
 
 // ExecSQL reads SQL queries from reader and executes them until the reader is exhausted.
 // If the query has results, they will be outputted to w.
+// Transactions opened by the BEGIN statement can only span multiple queries
+// if db was created by genji.DB.NewSession.
 func ExecSQL(ctx context.Context, db *genji.DB, r io.Reader, w io.Writer) error {
 	scanner := bufio.NewScanner(r)
 
@@ -106,9 +106,10 @@ func Run(ctx context.Context, opts *Options) error {
 	if err != nil {
 		return err
 	}
-	sh.db = db.WithContext(ctx)
+	// the session keeps the transaction opened by BEGIN between commands.
+	sh.db = db.WithContext(ctx).NewSession()
 	defer func() {
-		closeErr := sh.db.Close()
+		closeErr := multierr.Append(sh.db.Close(), db.Close())
 		if closeErr != nil {
 			err = multierr.Append(err, closeErr)
 		}
@@ -6,6 +6,7 @@ import (
 	"sync"
 
 	"github.com/genjidb/genji/document"
+	"github.com/genjidb/genji/engine"
 	"github.com/genjidb/genji/stringutil"
 )
 
@@ -65,10 +66,51 @@ func (c *Catalog) Load(tx *Transaction) error {
 		},
 	})
 
+	tables = append(tables, &TableInfo{
+		tableName: statisticsStoreName,
+		storeName: []byte(statisticsStoreName),
+		readOnly:  true,
+		FieldConstraints: []*FieldConstraint{
+			{
+				Path: document.Path{
+					document.PathFragment{
+						FieldName: "table_name",
+					},
+				},
+				Type:         document.TextValue,
+				IsPrimaryKey: true,
+			},
+		},
+	})
+
 	c.cache.load(tables, indexes)
 	return nil
 }
 
+// Version returns a number that changes every time the catalog is modified,
+// including when the statistics of a table are updated.
+// It can be used to detect that information derived from the catalog,
+// like execution plans, is outdated.
+func (c *Catalog) Version() uint64 {
+	return c.cache.Version()
+}
+
+// storeNames returns the name of the stores of every table and index.
+func (c *Catalog) storeNames() []string {
+	c.cache.mu.RLock()
+	defer c.cache.mu.RUnlock()
+
+	names := make([]string, 0, len(c.cache.tables)+len(c.cache.indexes))
+	for _, ti := range c.cache.tables {
+		names = append(names, string(ti.storeName))
+	}
+	for name := range c.cache.indexes {
+		names = append(names, indexStorePrefix+name)
+	}
+
+	return names
+}
+
 // Clone the catalog. Mostly used for testing purposes.
 func (c *Catalog) Clone() *Catalog {
 	var clone Catalog
@@ -108,6 +150,11 @@ func (c *Catalog) GetTable(tx *Transaction, tableName string) (*Table, error) {
 // CreateTable creates a table with the given name.
 // If it already exists, returns ErrTableAlreadyExists.
 func (c *Catalog) CreateTable(tx *Transaction, tableName string, info *TableInfo) error {
+	err := tx.lockSchema()
+	if err != nil {
+		return err
+	}
+
 	if strings.HasPrefix(tableName, internalPrefix) {
 		return stringutil.Errorf("table name must not start with %s", internalPrefix)
 	}
@@ -117,8 +164,6 @@ func (c *Catalog) CreateTable(tx *Transaction, tableName string, info *TableInfo
 	}
 	info.tableName = tableName
 
-	var err error
-
 	// replace user-defined constraints by inferred list of constraints
 	info.FieldConstraints, err = info.FieldConstraints.Infer()
 	if err != nil {
@@ -145,6 +190,11 @@ func (c *Catalog) CreateTable(tx *Transaction, tableName string, info *TableInfo
 
 // DropTable deletes a table from the database.
 func (c *Catalog) DropTable(tx *Transaction, tableName string) error {
+	err := tx.lockSchema()
+	if err != nil {
+		return err
+	}
+
 	ti, removedIndexes, err := c.cache.DeleteTable(tx, tableName)
 	if err != nil {
 		return err
@@ -162,12 +212,22 @@ func (c *Catalog) DropTable(tx *Transaction, tableName string) error {
 		return err
 	}
 
+	err = tx.getStatisticsStore().Delete(tableName)
+	if err != nil {
+		return err
+	}
+
 	return tx.tx.DropStore(ti.storeName)
 }
 
 // CreateIndex creates an index with the given name.
 // If it already exists, returns ErrIndexAlreadyExists.
 func (c *Catalog) CreateIndex(tx *Transaction, opts *IndexInfo) error {
+	err := tx.lockSchema()
+	if err != nil {
+		return err
+	}
+
 	if strings.HasPrefix(opts.IndexName, internalPrefix) {
 		return stringutil.Errorf("table name must not start with %s", internalPrefix)
 	}
@@ -182,7 +242,14 @@ func (c *Catalog) CreateIndex(tx *Transaction, opts *IndexInfo) error {
 		opts.IndexName = stringutil.Sprintf("%sautoindex_%s_%d", internalPrefix, opts.TableName, seq)
 	}
 
-	err := c.cache.AddIndex(tx, opts)
+	// only top-level fields can be included in an index
+	for _, p := range opts.IncludedPaths {
+		if len(p) != 1 || p[0].FieldName == "" {
+			return stringutil.Errorf("cannot include %q in index %q: only top-level fields can be included", p, opts.IndexName)
+		}
+	}
+
+	err = c.cache.AddIndex(tx, opts)
 	if err != nil {
 		return err
 	}
@@ -231,7 +298,12 @@ func (c *Catalog) ListIndexes(tableName string) []string {
 
 // DropIndex deletes an index from the database.
 func (c *Catalog) DropIndex(tx *Transaction, name string) error {
-	_, err := c.cache.DeleteIndex(tx, name)
+	err := tx.lockSchema()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.cache.DeleteIndex(tx, name)
 	if err != nil {
 		return err
 	}
@@ -258,6 +330,11 @@ func (c *Catalog) dropIndex(tx *Transaction, name string) error {
 
 // AddFieldConstraint adds a field constraint to a table.
 func (c *Catalog) AddFieldConstraint(tx *Transaction, tableName string, fc FieldConstraint) error {
+	err := tx.lockSchema()
+	if err != nil {
+		return err
+	}
+
 	newTi, _, err := c.cache.updateTable(tx, tableName, func(clone *TableInfo) error {
 		return clone.FieldConstraints.Add(&fc)
 	})
@@ -271,6 +348,11 @@ func (c *Catalog) AddFieldConstraint(tx *Transaction, tableName string, fc Field
 // RenameTable renames a table.
 // If it doesn't exist, it returns ErrTableNotFound.
 func (c *Catalog) RenameTable(tx *Transaction, oldName, newName string) error {
+	err := tx.lockSchema()
+	if err != nil {
+		return err
+	}
+
 	newTi, newIdxs, err := c.cache.updateTable(tx, oldName, func(clone *TableInfo) error {
 		clone.tableName = newName
 		return nil
@@ -299,12 +381,33 @@ func (c *Catalog) RenameTable(tx *Transaction, oldName, newName string) error {
 		}
 	}
 
+	// Move the statistics, if any.
+	statsStore := tx.getStatisticsStore()
+	stats, err := statsStore.Get(oldName)
+	if err == nil {
+		stats.TableName = newName
+		err = statsStore.Replace(stats)
+		if err != nil {
+			return err
+		}
+
+		err = statsStore.Delete(oldName)
+	}
+	if err != nil && !errors.Is(err, ErrStatisticsNotFound) {
+		return err
+	}
+
 	// Delete the old reference from the tableInfoStore.
 	return tableStore.Delete(tx, oldName)
 }
 
 // ReIndex truncates and recreates selected index from scratch.
 func (c *Catalog) ReIndex(tx *Transaction, indexName string) error {
+	err := tx.lockSchema()
+	if err != nil {
+		return err
+	}
+
 	idx, err := c.GetIndex(tx, indexName)
 	if err != nil {
 		return err
@@ -325,15 +428,17 @@ func (c *Catalog) ReIndex(tx *Transaction, indexName string) error {
 
 func (c *Catalog) buildIndex(tx *Transaction, idx *Index, table *Table) error {
 	return table.Iterate(func(d document.Document) error {
+		// documents without the indexed path are indexed as null,
+		// the same way Table.Insert does, so that every document
+		// of the table is referenced by the index.
 		v, err := idx.Info.Path.GetValueFromDocument(d)
 		if err == document.ErrFieldNotFound {
-			return nil
-		}
-		if err != nil {
+			v = document.NewNullValue()
+		} else if err != nil {
 			return err
 		}
 
-		err = idx.Set(v, d.(document.Keyer).RawKey())
+		err = idx.set(v, d.(document.Keyer).RawKey(), d)
 		if err != nil {
 			return stringutil.Errorf("error while building the index: %w", err)
 		}
@@ -356,10 +461,94 @@ func (c *Catalog) ReIndexAll(tx *Transaction) error {
 	return nil
 }
 
+// Analyze computes the statistics of the table and stores them,
+// replacing the previous ones.
+// Statistics are computed for every indexed path of the table,
+// and the keys of the table are divided into DefaultHistogramBuckets ranges.
+func (c *Catalog) Analyze(tx *Transaction, tableName string) error {
+	tb, err := c.GetTable(tx, tableName)
+	if err != nil {
+		return err
+	}
+
+	if tb.info.readOnly {
+		return stringutil.Errorf("cannot analyze read-only table %q", tableName)
+	}
+
+	stats := TableStatistics{
+		TableName: tableName,
+	}
+
+	ks := newKeySampler(DefaultHistogramBuckets * keySamplesPerBucket)
+	it := tb.Store.Iterator(engine.IteratorOptions{})
+	for it.Seek(nil); it.Valid(); it.Next() {
+		stats.RowCount++
+		ks.add(it.Item().Key())
+	}
+	err = it.Err()
+	it.Close()
+	if err != nil {
+		return err
+	}
+	stats.Keys = ks.split(DefaultHistogramBuckets)
+
+	for _, idx := range tb.Indexes() {
+		// multiple indexes may share the same path
+		if stats.GetPathStatistics(idx.Info.Path) != nil {
+			continue
+		}
+
+		hb := newHistogramBuilder(idx.Info.Path, stats.RowCount, DefaultHistogramBuckets, idx.decodeValue)
+		err = idx.AscendGreaterOrEqual(document.Value{}, func(val, _ []byte) error {
+			return hb.add(val)
+		})
+		if err != nil {
+			return err
+		}
+
+		ps, err := hb.build()
+		if err != nil {
+			return err
+		}
+
+		stats.Paths = append(stats.Paths, ps)
+	}
+
+	err = tx.getStatisticsStore().Replace(&stats)
+	if err != nil {
+		return err
+	}
+
+	c.cache.statisticsChanged(tx)
+	return nil
+}
+
+// AnalyzeAll computes and stores the statistics of every table of the database.
+func (c *Catalog) AnalyzeAll(tx *Transaction) error {
+	for _, tableName := range c.cache.ListTables() {
+		err := c.Analyze(tx, tableName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetTableStatistics returns the statistics of the given table.
+// If the table was never analyzed, it returns ErrStatisticsNotFound.
+func (c *Catalog) GetTableStatistics(tx *Transaction, tableName string) (*TableStatistics, error) {
+	return tx.getStatisticsStore().Get(tableName)
+}
+
 type catalogCache struct {
 	tables           map[string]*TableInfo
 	indexes          map[string]*IndexInfo
 	indexesPerTables map[string][]*IndexInfo
+	// incremented every time the cache is modified.
+	// clones share the version of the cache they were created from,
+	// since they describe the same database.
+	version *uint64
 
 	mu sync.RWMutex
 }
@@ -369,6 +558,7 @@ func newCatalogCache() *catalogCache {
 		tables:           make(map[string]*TableInfo),
 		indexes:          make(map[string]*IndexInfo),
 		indexesPerTables: make(map[string][]*IndexInfo),
+		version:          new(uint64),
 	}
 }
 
@@ -384,10 +574,13 @@ func (c *catalogCache) load(tables []*TableInfo, indexes []*IndexInfo) {
 		c.indexes[i.IndexName] = i
 		c.indexesPerTables[i.TableName] = append(c.indexesPerTables[i.TableName], i)
 	}
+
+	*c.version++
 }
 
 func (c *catalogCache) clone() *catalogCache {
 	clone := newCatalogCache()
+	clone.version = c.version
 
 	for k, v := range c.tables {
 		clone.tables[k] = v
@@ -412,10 +605,14 @@ func (c *catalogCache) AddTable(tx *Transaction, info *TableInfo) error {
 
 	c.tables[info.tableName] = info
 
+	*c.version++
+
 	tx.onRollbackHooks = append(tx.onRollbackHooks, func() {
 		c.mu.Lock()
 		defer c.mu.Unlock()
 
+		*c.version++
+
 		delete(c.tables, info.tableName)
 	})
 
@@ -447,10 +644,14 @@ func (c *catalogCache) DeleteTable(tx *Transaction, tableName string) (*TableInf
 		removedIndexes = append(removedIndexes, idx)
 	}
 
+	*c.version++
+
 	tx.onRollbackHooks = append(tx.onRollbackHooks, func() {
 		c.mu.Lock()
 		defer c.mu.Unlock()
 
+		*c.version++
+
 		c.tables[tableName] = ti
 
 		for _, idx := range removedIndexes {
@@ -465,6 +666,29 @@ func (c *catalogCache) DeleteTable(tx *Transaction, tableName string) (*TableInf
 	return ti, removedIndexes, nil
 }
 
+// statisticsChanged must be called when the statistics of a table are modified.
+func (c *catalogCache) statisticsChanged(tx *Transaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	*c.version++
+
+	tx.onRollbackHooks = append(tx.onRollbackHooks, func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		*c.version++
+	})
+}
+
+// Version returns the current version of the cache.
+func (c *catalogCache) Version() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return *c.version
+}
+
 func (c *catalogCache) GetTable(tableName string) (*TableInfo, error) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -506,10 +730,14 @@ func (c *catalogCache) AddIndex(tx *Transaction, info *IndexInfo) error {
 	previousIndexes := c.indexesPerTables[info.TableName]
 	c.indexesPerTables[info.TableName] = append(c.indexesPerTables[info.TableName], info)
 
+	*c.version++
+
 	tx.onRollbackHooks = append(tx.onRollbackHooks, func() {
 		c.mu.Lock()
 		defer c.mu.Unlock()
 
+		*c.version++
+
 		delete(c.indexes, info.IndexName)
 
 		if len(previousIndexes) == 0 {
@@ -547,10 +775,14 @@ func (c *catalogCache) DeleteIndex(tx *Transaction, indexName string) (*IndexInf
 	oldIndexList := c.indexesPerTables[info.TableName]
 	c.indexesPerTables[info.TableName] = newIndexlist
 
+	*c.version++
+
 	tx.onRollbackHooks = append(tx.onRollbackHooks, func() {
 		c.mu.Lock()
 		defer c.mu.Unlock()
 
+		*c.version++
+
 		c.indexes[indexName] = info
 		c.indexesPerTables[info.TableName] = oldIndexList
 	})
@@ -570,6 +802,22 @@ func (c *catalogCache) GetIndex(indexName string) (*IndexInfo, error) {
 	return info, nil
 }
 
+// ListTables returns the name of every table, except the internal ones.
+func (c *catalogCache) ListTables() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	tables := make([]string, 0, len(c.tables))
+	for name, ti := range c.tables {
+		if ti.readOnly {
+			continue
+		}
+		tables = append(tables, name)
+	}
+
+	return tables
+}
+
 func (c *catalogCache) ListIndexes() []string {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
@@ -625,10 +873,14 @@ func (c *catalogCache) updateTable(tx *Transaction, tableName string, fn func(cl
 
 	c.tables[clone.tableName] = clone
 
+	*c.version++
+
 	tx.onRollbackHooks = append(tx.onRollbackHooks, func() {
 		c.mu.Lock()
 		defer c.mu.Unlock()
 
+		*c.version++
+
 		delete(c.tables, clone.tableName)
 		c.tables[tableName] = ti
 
@@ -0,0 +1,327 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/genjidb/genji/document"
+)
+
+// ErrSubscriptionClosed is returned by Subscription.Next once the subscription
+// or the database is closed.
+var ErrSubscriptionClosed = errors.New("subscription closed")
+
+// ChangeType is the type of a change made to a table.
+type ChangeType uint8
+
+// List of change types.
+const (
+	ChangeInsert ChangeType = iota + 1
+	ChangeUpdate
+	ChangeDelete
+)
+
+func (t ChangeType) String() string {
+	switch t {
+	case ChangeInsert:
+		return "insert"
+	case ChangeUpdate:
+		return "update"
+	case ChangeDelete:
+		return "delete"
+	}
+
+	return "unknown"
+}
+
+// A Change describes a document written to a table by a committed transaction.
+type Change struct {
+	Type ChangeType
+	// Name of the table.
+	Table string
+	// Encoded key of the document.
+	Key []byte
+	// Document before the change. Nil for inserts.
+	Old document.Document
+	// Document after the change. Nil for deletes.
+	New document.Document
+}
+
+// A ChangeSet contains the changes made by a transaction to the tables
+// of a subscription, in the order they were made.
+type ChangeSet struct {
+	// Sequence number of the commit. It increases with every commit
+	// modifying the database.
+	Seq     uint64
+	Changes []Change
+}
+
+// Subscribe returns a subscription receiving the changes made to the given tables
+// by the transactions committed after the subscription was created.
+// If no tables are given, the changes of every table are received.
+// Changes are delivered in the order of the commits, and the changes of each commit
+// in the order they were made. Changes made by transactions already running when Subscribe is
+// called may be missed.
+// Changes are queued until they are read with Next: the subscription must be read
+// or closed to avoid accumulating them in memory.
+func (db *Database) Subscribe(tables ...string) *Subscription {
+	return db.feed.subscribe(tables)
+}
+
+// changeFeed dispatches the changes of the committed transactions to the subscriptions.
+type changeFeed struct {
+	// number of subscriptions, read atomically by the transactions
+	// to avoid recording changes when there are no subscriptions.
+	count int32
+
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+	// sequence number of the next commit to dispatch.
+	next uint64
+	// changes of the commits published before those preceding them.
+	pending map[uint64][]Change
+}
+
+func newChangeFeed(next uint64) *changeFeed {
+	return &changeFeed{
+		subs:    make(map[*Subscription]struct{}),
+		next:    next,
+		pending: make(map[uint64][]Change),
+	}
+}
+
+func (f *changeFeed) subscribe(tables []string) *Subscription {
+	s := Subscription{
+		feed:  f,
+		ready: make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	if len(tables) > 0 {
+		s.tables = make(map[string]struct{}, len(tables))
+		for _, t := range tables {
+			s.tables[t] = struct{}{}
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		s.close()
+		return &s
+	}
+
+	f.subs[&s] = struct{}{}
+	atomic.AddInt32(&f.count, 1)
+	return &s
+}
+
+func (f *changeFeed) unsubscribe(s *Subscription) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.subs[s]; ok {
+		delete(f.subs, s)
+		atomic.AddInt32(&f.count, -1)
+	}
+}
+
+// watches returns whether the changes of the table must be recorded.
+func (f *changeFeed) watches(table string) bool {
+	if atomic.LoadInt32(&f.count) == 0 || strings.HasPrefix(table, internalPrefix) {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for s := range f.subs {
+		if s.watches(table) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// publish the changes of the commit with the given sequence number.
+// Every commit must be published, even if it has no changes, since commits
+// are dispatched in order and the following ones wait for it.
+func (f *changeFeed) publish(seq uint64, changes []Change) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if seq != f.next {
+		f.pending[seq] = changes
+		return
+	}
+
+	for {
+		f.dispatch(seq, changes)
+		f.next++
+
+		seq = f.next
+		var ok bool
+		changes, ok = f.pending[seq]
+		if !ok {
+			return
+		}
+		delete(f.pending, seq)
+	}
+}
+
+// dispatch sends the changes to every subscription watching their tables.
+// It must be called with f.mu held.
+func (f *changeFeed) dispatch(seq uint64, changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+
+	for s := range f.subs {
+		var cs *ChangeSet
+		for _, c := range changes {
+			if !s.watches(c.Table) {
+				continue
+			}
+
+			if cs == nil {
+				cs = &ChangeSet{Seq: seq}
+			}
+			cs.Changes = append(cs.Changes, c)
+		}
+
+		if cs != nil {
+			s.push(cs)
+		}
+	}
+}
+
+// close every subscription.
+func (f *changeFeed) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	for s := range f.subs {
+		s.close()
+		delete(f.subs, s)
+	}
+	atomic.StoreInt32(&f.count, 0)
+}
+
+// A Subscription receives the changes made to a set of tables.
+// It is safe for concurrent use.
+type Subscription struct {
+	feed *changeFeed
+	// nil if every table is watched.
+	tables map[string]struct{}
+
+	mu     sync.Mutex
+	queue  []*ChangeSet
+	closed bool
+	// receives a value when changes are queued.
+	ready chan struct{}
+	// closed when the subscription is closed.
+	done chan struct{}
+}
+
+func (s *Subscription) watches(table string) bool {
+	if s.tables == nil {
+		return !strings.HasPrefix(table, internalPrefix)
+	}
+
+	_, ok := s.tables[table]
+	return ok
+}
+
+func (s *Subscription) push(cs *ChangeSet) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	s.queue = append(s.queue, cs)
+
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Next returns the changes of the next commit, waiting until they are available,
+// ctx is canceled or the subscription is closed.
+func (s *Subscription) Next(ctx context.Context) (*ChangeSet, error) {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil, ErrSubscriptionClosed
+		}
+
+		if len(s.queue) > 0 {
+			cs := s.queue[0]
+			s.queue[0] = nil
+			s.queue = s.queue[1:]
+			if len(s.queue) > 0 {
+				// wake up other callers waiting for changes.
+				select {
+				case s.ready <- struct{}{}:
+				default:
+				}
+			}
+			s.mu.Unlock()
+			return cs, nil
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.done:
+		case <-s.ready:
+		}
+	}
+}
+
+// Close the subscription. Changes that have not been read yet are discarded.
+func (s *Subscription) Close() error {
+	s.feed.unsubscribe(s)
+	s.close()
+	return nil
+}
+
+func (s *Subscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	s.closed = true
+	s.queue = nil
+	close(s.done)
+}
+
+// recordChange records a change made to a table, to be published
+// if the transaction is committed.
+func (tx *Transaction) recordChange(c Change) {
+	tx.changes = append(tx.changes, c)
+}
+
+// publishChanges publishes the changes of the transaction.
+// It is run after a successful commit.
+func (tx *Transaction) publishChanges() {
+	// the transaction didn't modify the database.
+	if tx.mvcc.commitTS == 0 {
+		return
+	}
+
+	tx.db.feed.publish(tx.mvcc.commitTS, tx.changes)
+}
@@ -0,0 +1,273 @@
+package database_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/document"
+	"github.com/stretchr/testify/require"
+)
+
+func nextChanges(t testing.TB, sub *database.Subscription) *database.ChangeSet {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	cs, err := sub.Next(ctx)
+	require.NoError(t, err)
+	return cs
+}
+
+func requireNoChanges(t testing.TB, sub *database.Subscription) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := sub.Next(ctx)
+	require.Equal(t, context.DeadlineExceeded, err)
+}
+
+func fieldA(t testing.TB, d document.Document) string {
+	t.Helper()
+
+	v, err := d.GetByField("fielda")
+	require.NoError(t, err)
+	return v.V.(string)
+}
+
+func TestSubscribe(t *testing.T) {
+	newDB := func(t *testing.T) (*database.Database, func()) {
+		db, cleanup := newTestDB(t)
+
+		update(t, db, func(tx *database.Transaction) error {
+			for _, name := range []string{"a", "b"} {
+				err := tx.CreateTable(name, nil)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		return db, cleanup
+	}
+
+	t.Run("Insert, update and delete", func(t *testing.T) {
+		db, cleanup := newDB(t)
+		defer cleanup()
+
+		sub := db.Subscribe("a")
+		defer sub.Close()
+
+		var key []byte
+		update(t, db, func(tx *database.Transaction) error {
+			tb, err := tx.GetTable("a")
+			if err != nil {
+				return err
+			}
+			d, err := tb.Insert(newDocument())
+			if err != nil {
+				return err
+			}
+			key = d.(document.Keyer).RawKey()
+
+			err = tb.Replace(key, document.NewFieldBuffer().Add("fielda", document.NewTextValue("c")))
+			if err != nil {
+				return err
+			}
+
+			// changes of other tables are ignored
+			tb, err = tx.GetTable("b")
+			if err != nil {
+				return err
+			}
+			_, err = tb.Insert(newDocument())
+			return err
+		})
+
+		update(t, db, func(tx *database.Transaction) error {
+			tb, err := tx.GetTable("a")
+			if err != nil {
+				return err
+			}
+			return tb.Delete(key)
+		})
+
+		cs := nextChanges(t, sub)
+		require.Len(t, cs.Changes, 2)
+
+		c := cs.Changes[0]
+		require.Equal(t, database.ChangeInsert, c.Type)
+		require.Equal(t, "a", c.Table)
+		require.Equal(t, key, c.Key)
+		require.Nil(t, c.Old)
+		require.Equal(t, "a", fieldA(t, c.New))
+		require.Equal(t, key, c.New.(document.Keyer).RawKey())
+
+		c = cs.Changes[1]
+		require.Equal(t, database.ChangeUpdate, c.Type)
+		require.Equal(t, "a", fieldA(t, c.Old))
+		require.Equal(t, "c", fieldA(t, c.New))
+
+		next := nextChanges(t, sub)
+		require.Greater(t, next.Seq, cs.Seq)
+		require.Len(t, next.Changes, 1)
+		c = next.Changes[0]
+		require.Equal(t, database.ChangeDelete, c.Type)
+		require.Equal(t, "c", fieldA(t, c.Old))
+		require.Nil(t, c.New)
+
+		requireNoChanges(t, sub)
+	})
+
+	t.Run("Every table", func(t *testing.T) {
+		db, cleanup := newDB(t)
+		defer cleanup()
+
+		sub := db.Subscribe()
+		defer sub.Close()
+
+		update(t, db, func(tx *database.Transaction) error {
+			err := tx.CreateTable("c", nil)
+			if err != nil {
+				return err
+			}
+
+			for _, name := range []string{"b", "c"} {
+				tb, err := tx.GetTable(name)
+				if err != nil {
+					return err
+				}
+				_, err = tb.Insert(newDocument())
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		// changes made to the catalog are not received.
+		cs := nextChanges(t, sub)
+		require.Len(t, cs.Changes, 2)
+		require.Equal(t, "b", cs.Changes[0].Table)
+		require.Equal(t, "c", cs.Changes[1].Table)
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		db, cleanup := newDB(t)
+		defer cleanup()
+
+		sub := db.Subscribe("a")
+		defer sub.Close()
+
+		update(t, db, func(tx *database.Transaction) error {
+			tb, err := tx.GetTable("a")
+			if err != nil {
+				return err
+			}
+			_, err = tb.Insert(newDocument())
+			if err != nil {
+				return err
+			}
+			return errDontCommit
+		})
+		requireNoChanges(t, sub)
+
+		update(t, db, func(tx *database.Transaction) error {
+			tb, err := tx.GetTable("a")
+			if err != nil {
+				return err
+			}
+			_, err = tb.Insert(newDocument())
+			if err != nil {
+				return err
+			}
+
+			err = tx.Savepoint("sp")
+			if err != nil {
+				return err
+			}
+			err = tb.Truncate()
+			if err != nil {
+				return err
+			}
+			return tx.RollbackToSavepoint("sp")
+		})
+
+		cs := nextChanges(t, sub)
+		require.Len(t, cs.Changes, 1)
+		require.Equal(t, database.ChangeInsert, cs.Changes[0].Type)
+	})
+
+	t.Run("Concurrent commits", func(t *testing.T) {
+		db, cleanup := newDB(t)
+		defer cleanup()
+
+		sub := db.Subscribe("a")
+		defer sub.Close()
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				tx, err := db.Begin(true)
+				if err != nil {
+					errs <- err
+					return
+				}
+				defer tx.Rollback()
+
+				tb, err := tx.GetTable("a")
+				if err == nil {
+					_, err = tb.Insert(newDocument())
+				}
+				if err == nil {
+					err = tx.Commit()
+				}
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		var seq uint64
+		for i := 0; i < 10; i++ {
+			cs := nextChanges(t, sub)
+			require.Greater(t, cs.Seq, seq)
+			seq = cs.Seq
+			require.Len(t, cs.Changes, 1)
+		}
+	})
+
+	t.Run("Close", func(t *testing.T) {
+		db, cleanup := newDB(t)
+		defer cleanup()
+
+		sub := db.Subscribe("a")
+		require.NoError(t, sub.Close())
+		_, err := sub.Next(context.Background())
+		require.Equal(t, database.ErrSubscriptionClosed, err)
+
+		// closing the database closes the subscriptions
+		sub = db.Subscribe("a")
+		done := make(chan error)
+		go func() {
+			_, err := sub.Next(context.Background())
+			done <- err
+		}()
+		require.NoError(t, db.Close())
+		require.Equal(t, database.ErrSubscriptionClosed, <-done)
+	})
+}
@@ -237,6 +237,11 @@ type IndexInfo struct {
 
 	// If set, the index is typed and only accepts that type
 	Type document.ValueType
+
+	// Top-level fields whose values are stored alongside the key
+	// in every index entry, to allow reading them without
+	// fetching the document from the table.
+	IncludedPaths []document.Path
 }
 
 // ToDocument creates a document from an IndexConfig.
@@ -250,6 +255,13 @@ func (i *IndexInfo) ToDocument() document.Document {
 	if i.Type != 0 {
 		buf.Add("type", document.NewIntegerValue(int64(i.Type)))
 	}
+	if len(i.IncludedPaths) > 0 {
+		vbuf := document.NewValueBuffer()
+		for _, p := range i.IncludedPaths {
+			vbuf = vbuf.Append(document.NewArrayValue(pathToArray(p)))
+		}
+		buf.Add("include", document.NewArrayValue(vbuf))
+	}
 	return buf
 }
 
@@ -290,6 +302,25 @@ func (i *IndexInfo) ScanDocument(d document.Document) error {
 		i.Type = document.ValueType(v.V.(int64))
 	}
 
+	v, err = d.GetByField("include")
+	if err != nil && err != document.ErrFieldNotFound {
+		return err
+	}
+	if err == nil {
+		err = v.V.(document.Array).Iterate(func(_ int, value document.Value) error {
+			p, err := arrayToPath(value.V.(document.Array))
+			if err != nil {
+				return err
+			}
+
+			i.IncludedPaths = append(i.IncludedPaths, p)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -298,6 +329,28 @@ func (i IndexInfo) Clone() *IndexInfo {
 	return &i
 }
 
+// Covers returns true if the value at path p can be read directly
+// from the index entries, without fetching the document from the table.
+// This is the case if the first fragment of p is the indexed field or one
+// of the included fields.
+func (i *IndexInfo) Covers(p document.Path) bool {
+	if len(p) == 0 || p[0].FieldName == "" {
+		return false
+	}
+
+	if len(i.Path) == 1 && i.Path[0].FieldName == p[0].FieldName {
+		return true
+	}
+
+	for _, ip := range i.IncludedPaths {
+		if ip[0].FieldName == p[0].FieldName {
+			return true
+		}
+	}
+
+	return false
+}
+
 type indexStore struct {
 	db *Database
 	st engine.Store
@@ -413,6 +413,39 @@ func LosslessNumbersConversion(v document.Value, path document.Path, targetType
 	return v, nil
 }
 
+// mayMatchTimestamps returns true if v is a text which is a valid timestamp,
+// or an array containing one, as used by the IN operator.
+func mayMatchTimestamps(v document.Value) bool {
+	switch v.Type {
+	case document.TextValue:
+		_, err := v.CastAsTimestamp()
+		return err == nil
+	case document.ArrayValue:
+		var ok bool
+		_ = v.V.(document.Array).Iterate(func(i int, v document.Value) error {
+			ok = ok || mayMatchTimestamps(v)
+			return nil
+		})
+		return ok
+	}
+
+	return false
+}
+
+// indexOperandConversion is a ConversionFunc that converts numbers if there is no precision loss
+// and texts compared with timestamps, if they are valid timestamps.
+func indexOperandConversion(v document.Value, path document.Path, targetType document.ValueType) (document.Value, error) {
+	if v.Type == document.TextValue && targetType == document.TimestampValue {
+		if ts, err := v.CastAsTimestamp(); err == nil {
+			return ts, nil
+		}
+
+		return v, nil
+	}
+
+	return LosslessNumbersConversion(v, path, targetType)
+}
+
 // ConvertValueAtPath converts the value using the field constraints that are applicable
 // at the given path.
 func (f FieldConstraints) ConvertValueAtPath(path document.Path, v document.Value, conversionFn ConversionFunc) (document.Value, error) {
@@ -427,6 +460,32 @@ func (f FieldConstraints) ConvertValueAtPath(path document.Path, v document.Valu
 	return f.convertScalarAtPath(path, v, conversionFn)
 }
 
+// ConvertIndexOperand converts v, the operand of a condition on path, so that it can be
+// used to read an index on that path, or the primary key, whose values are of type indexType.
+// Numbers are only converted if the conversion is lossless, and texts are converted
+// to timestamps if they are compared with a timestamp field, like they are during evaluation.
+// It returns false if the converted value cannot be used to read the index.
+func (f FieldConstraints) ConvertIndexOperand(path document.Path, indexType document.ValueType, v document.Value) (document.Value, bool, error) {
+	converted, err := f.ConvertValueAtPath(path, v, indexOperandConversion)
+	if err != nil {
+		return v, false, err
+	}
+
+	// if the index is not typed, any operand can work, except texts which
+	// are valid timestamps if the field isn't typed: they also match timestamps,
+	// which are not stored with the texts in the index.
+	if indexType.IsZero() {
+		if fc := f.Get(path); fc == nil || fc.Type.IsZero() {
+			return converted, !mayMatchTimestamps(converted), nil
+		}
+
+		return converted, true, nil
+	}
+
+	// if the index is typed, it must be of the same type as the converted value
+	return converted, indexType == converted.Type, nil
+}
+
 // convert the value using field constraints type information.
 // if there is a type constraint on a path, apply it.
 // if a value is an integer and has no constraint, convert it to double.
@@ -4,37 +4,97 @@ package database
 import (
 	"context"
 	"errors"
-	"sync"
+	"time"
 
 	"github.com/genjidb/genji/document/encoding"
 	"github.com/genjidb/genji/engine"
+	"github.com/genjidb/genji/stringutil"
 )
 
 // A Database manages a list of tables in an engine.
 type Database struct {
 	ng engine.Engine
 
-	// If this is non-nil, the user is running an explicit transaction
-	// using the BEGIN statement.
-	// Only one attached transaction can be run at a time and any calls to DB.Begin()
-	// will cause an error until that transaction is rolled back or commited.
-	attachedTransaction *Transaction
-	attachedTxMu        sync.Mutex
-
 	// Codec used to encode documents. Defaults to MessagePack.
 	Codec encoding.Codec
 
+	// Maximum number of bytes an operation of a query, such as a sort,
+	// an aggregation or a DISTINCT, can use in memory.
+	// Beyond that limit, the operation writes its data to temporary files.
+	// If zero, every operation is done entirely in memory.
+	WorkMemoryLimit int64
+
+	// Directory in which temporary files are created.
+	// If empty, the default directory for temporary files is used.
+	TempDir string
+
+	// Number of goroutines used to scan tables in read-only queries.
+	// If lower than 2, tables are scanned sequentially.
+	// Tables are split using the statistics computed by ANALYZE:
+	// tables that were never analyzed are scanned sequentially.
+	// The value is read when queries are planned: plans already cached
+	// by prepared statements or by the plan cache are not affected.
+	ParallelWorkers int
+
+	// Resources every statement can use, unless overridden
+	// by its transaction or by the statement itself.
+	Limits Limits
+
+	// if true, read/write transactions are rejected.
+	readOnly bool
+
 	// table and index catalog.
 	catalog *Catalog
 
-	// This controls concurrency on read-only and read/write transactions.
-	txmu sync.RWMutex
+	// cache of the queries run against the database.
+	planCache *PlanCache
+
+	// concurrency control of the read/write transactions.
+	// nil if the database is read-only.
+	mvcc *mvcc
+
+	// dispatches the changes of the committed transactions
+	// to the subscriptions.
+	feed *changeFeed
+
+	// Every transaction holds a read lock. Transactions modifying
+	// the schema upgrade it to a write lock, to get exclusive access
+	// to the database.
+	txlock txLock
+
+	// session of the transactions created with the deprecated
+	// TxOptions.Attached option.
+	attached *Session
 }
 
 type Options struct {
 	Codec encoding.Codec
+	// Maximum number of bytes an operation of a query can use in memory
+	// before writing to temporary files.
+	// If zero, every operation is done entirely in memory.
+	WorkMemoryLimit int64
+	// Directory in which temporary files are created.
+	TempDir string
+	// Number of goroutines used to scan tables in read-only queries.
+	// If lower than 2, tables are scanned sequentially.
+	// Tables are split using the statistics computed by ANALYZE:
+	// tables that were never analyzed are scanned sequentially.
+	ParallelWorkers int
+	// Maximum number of queries kept in the plan cache.
+	// If zero, DefaultPlanCacheSize is used.
+	// If negative, queries are not cached.
+	PlanCacheSize int
+	// Resources every statement can use.
+	Limits Limits
+	// Only allow read-only transactions. The engine must
+	// already contain an initialized database.
+	ReadOnly bool
 }
 
+// ErrReadOnlyDatabase is returned when opening a read/write transaction
+// on a database opened in read-only mode.
+var ErrReadOnlyDatabase = errors.New("database is read-only")
+
 // New initializes the DB using the given engine.
 func New(ctx context.Context, ng engine.Engine, opts Options) (*Database, error) {
 	if opts.Codec == nil {
@@ -42,11 +102,24 @@ func New(ctx context.Context, ng engine.Engine, opts Options) (*Database, error)
 	}
 
 	db := Database{
-		ng:    ng,
-		Codec: opts.Codec,
+		ng:              ng,
+		Codec:           opts.Codec,
+		WorkMemoryLimit: opts.WorkMemoryLimit,
+		TempDir:         opts.TempDir,
+		ParallelWorkers: opts.ParallelWorkers,
+		Limits:          opts.Limits,
+		readOnly:        opts.ReadOnly,
+		// the timestamps of the commits start at one.
+		feed: newChangeFeed(1),
+	}
+
+	db.attached = db.NewSession()
+
+	if !opts.ReadOnly {
+		db.mvcc = newMVCC(ng)
 	}
 
-	tx, err := db.BeginTx(ctx, &TxOptions{})
+	tx, err := db.BeginTx(ctx, &TxOptions{ReadOnly: opts.ReadOnly})
 	if err != nil {
 		return nil, err
 	}
@@ -57,17 +130,29 @@ func New(ctx context.Context, ng engine.Engine, opts Options) (*Database, error)
 		return nil, err
 	}
 
-	err = tx.Commit()
-	if err != nil {
-		return nil, err
+	if !opts.ReadOnly {
+		err = tx.Commit()
+		if err != nil {
+			return nil, err
+		}
+
+		err = db.mvcc.loadSequences(ctx, db.catalog.storeNames())
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	if opts.PlanCacheSize == 0 {
+		opts.PlanCacheSize = DefaultPlanCacheSize
+	}
+	db.planCache = NewPlanCache(db.catalog, opts.PlanCacheSize)
+
 	return &db, nil
 }
 
 func (db *Database) initCatalog(tx *Transaction) error {
 	_, err := tx.tx.GetStore([]byte(tableInfoStoreName))
-	if err == engine.ErrStoreNotFound {
+	if err == engine.ErrStoreNotFound && tx.writable {
 		err = tx.tx.CreateStore([]byte(tableInfoStoreName))
 	}
 	if err != nil {
@@ -75,13 +160,32 @@ func (db *Database) initCatalog(tx *Transaction) error {
 	}
 
 	_, err = tx.tx.GetStore([]byte(indexStoreName))
-	if err == engine.ErrStoreNotFound {
+	if err == engine.ErrStoreNotFound && tx.writable {
 		err = tx.tx.CreateStore([]byte(indexStoreName))
 	}
 	if err != nil {
 		return err
 	}
 
+	_, err = tx.tx.GetStore([]byte(statisticsStoreName))
+	if err == engine.ErrStoreNotFound && tx.writable {
+		err = tx.tx.CreateStore([]byte(statisticsStoreName))
+	}
+	if err != nil {
+		return err
+	}
+
+	// sequences are only used by read/write transactions.
+	if tx.writable {
+		_, err = tx.tx.GetStore([]byte(sequenceStoreName))
+		if err == engine.ErrStoreNotFound {
+			err = tx.tx.CreateStore([]byte(sequenceStoreName))
+		}
+		if err != nil {
+			return err
+		}
+	}
+
 	c := NewCatalog()
 	err = c.Load(tx)
 	if err != nil {
@@ -92,8 +196,14 @@ func (db *Database) initCatalog(tx *Transaction) error {
 	return nil
 }
 
+// PlanCache returns the cache of the queries run against the database.
+func (db *Database) PlanCache() *PlanCache {
+	return db.planCache
+}
+
 // Close the underlying engine.
 func (db *Database) Close() error {
+	db.feed.close()
 	return db.ng.Close()
 }
 
@@ -108,43 +218,106 @@ func (db *Database) Begin(writable bool) (*Transaction, error) {
 // BeginTx starts a new transaction with the given options.
 // If opts is empty, it will use the default options.
 // The returned transaction must be closed either by calling Rollback or Commit.
-// If the Attached option is passed, it opens a database level transaction, which gets
-// attached to the database and prevents any other transaction to be opened afterwards
-// until it gets rolled back or commited.
+// If the Session option is passed, the transaction gets attached to the session
+// and is used by the queries run within that session until it gets rolled back or commited.
+// If the database is locked by a transaction modifying the schema, BeginTx waits
+// until it is done or until ctx is canceled.
 func (db *Database) BeginTx(ctx context.Context, opts *TxOptions) (*Transaction, error) {
+	return db.beginTx(ctx, opts, true)
+}
+
+// TryBegin is like Begin but returns ErrDatabaseLocked instead of waiting
+// if the database is locked by a transaction modifying the schema.
+func (db *Database) TryBegin(writable bool) (*Transaction, error) {
+	return db.TryBeginTx(context.Background(), &TxOptions{
+		ReadOnly: !writable,
+	})
+}
+
+// TryBeginTx is like BeginTx but returns ErrDatabaseLocked instead of waiting
+// if the database is locked by a transaction modifying the schema.
+func (db *Database) TryBeginTx(ctx context.Context, opts *TxOptions) (*Transaction, error) {
+	return db.beginTx(ctx, opts, false)
+}
+
+func (db *Database) beginTx(ctx context.Context, opts *TxOptions, block bool) (*Transaction, error) {
 	if opts == nil {
 		opts = new(TxOptions)
 	}
 
-	if !opts.ReadOnly {
-		db.txmu.Lock()
-	} else {
-		db.txmu.RLock()
+	if !opts.ReadOnly && db.readOnly {
+		return nil, ErrReadOnlyDatabase
 	}
 
-	db.attachedTxMu.Lock()
-	defer db.attachedTxMu.Unlock()
+	session := opts.Session
+	if session == nil && opts.Attached {
+		session = db.attached
+	}
 
-	if db.attachedTransaction != nil {
-		return nil, errors.New("cannot open a transaction within a transaction")
+	// check the session before locking the database, to avoid
+	// waiting for the transaction the session is holding.
+	if session != nil && session.Tx() != nil {
+		return nil, ErrTransactionInProgress
 	}
 
-	ntx, err := db.ng.Begin(ctx, engine.TxOptions{
-		Writable: !opts.ReadOnly,
-	})
+	lockWait, err := db.txlock.rlock(ctx, block)
+	if err == ErrDatabaseLocked {
+		return nil, err
+	}
+	if err != nil {
+		return nil, stringutil.Errorf("waited %s for the database lock: %w", lockWait, err)
+	}
+
+	// the session isn't locked while waiting: another
+	// transaction may have been attached in the meantime.
+	if session != nil {
+		session.mu.Lock()
+		defer session.mu.Unlock()
+
+		if session.tx != nil {
+			db.txlock.runlock()
+			return nil, ErrTransactionInProgress
+		}
+	}
+
+	// transactions read from a snapshot, read/write ones write on commit.
+	// read-only databases are never modified: their transactions read
+	// directly from the engine.
+	var ntx engine.Transaction
+	var mtx *mvccTx
+	if db.mvcc == nil {
+		ntx, err = db.ng.Begin(ctx, engine.TxOptions{})
+	} else {
+		mtx, err = db.mvcc.begin(ctx, opts.ReadOnly)
+		ntx = mtx
+	}
 	if err != nil {
+		db.txlock.runlock()
 		return nil, err
 	}
 
+	undo := undoLog{Transaction: ntx}
+
 	tx := Transaction{
-		db:       db,
-		tx:       ntx,
-		writable: !opts.ReadOnly,
-		attached: opts.Attached,
+		db:        db,
+		ctx:       ctx,
+		tx:        &undo,
+		undo:      &undo,
+		mvcc:      mtx,
+		writable:  !opts.ReadOnly,
+		locked:    true,
+		session:   session,
+		startedAt: time.Now(),
+		lockWait:  lockWait,
+		limits:    limitsFromContext(ctx).merge(opts.Limits),
 	}
 
-	if opts.Attached {
-		db.attachedTransaction = &tx
+	if session != nil {
+		session.tx = &tx
+	}
+
+	if tx.writable {
+		tx.onCommitHooks = append(tx.onCommitHooks, tx.publishChanges)
 	}
 
 	return &tx, nil
@@ -154,22 +327,43 @@ func (db *Database) BeginTx(ctx context.Context, opts *TxOptions) (*Transaction,
 type TxOptions struct {
 	// Open a read-only transaction.
 	ReadOnly bool
-	// Set the transaction as global at the database level.
-	// Any queries run by the database will use that transaction until it is
+	// Attach the transaction to the session.
+	// Any queries run within the session will use that transaction until it is
 	// rolled back or commited.
+	Session *Session
+	// Resources the statements of the transaction can use.
+	// They override the limits of the database and those carried
+	// by the context passed to BeginTx.
+	Limits Limits
+	// Attach the transaction to the session returned by AttachedSession,
+	// used by the deprecated query.Query.Run method. Ignored if Session is set.
+	//
+	// Deprecated: the transaction is shared by every caller of query.Query.Run.
+	// Use Session instead.
 	Attached bool
 }
 
-// GetAttachedTx returns the transaction attached to the database. It returns nil if there is no
-// such transaction.
-// The returned transaction is not thread safe.
-func (db *Database) GetAttachedTx() *Transaction {
-	db.attachedTxMu.Lock()
-	defer db.attachedTxMu.Unlock()
+// AttachedSession returns the session of the transactions created with TxOptions.Attached.
+//
+// Deprecated: it is only used by the deprecated query.Query.Run method.
+// Use NewSession instead.
+func (db *Database) AttachedSession() *Session {
+	return db.attached
+}
 
-	return db.attachedTransaction
+// GetAttachedTx returns the transaction attached to the session returned by AttachedSession.
+// It returns nil if there is no such transaction.
+//
+// Deprecated: use Session.Tx instead.
+func (db *Database) GetAttachedTx() *Transaction {
+	return db.attached.Tx()
 }
 
 func (db *Database) Catalog() *Catalog {
 	return db.catalog
 }
+
+// ReadOnly reports whether the database only allows read-only transactions.
+func (db *Database) ReadOnly() bool {
+	return db.readOnly
+}
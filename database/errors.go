@@ -25,4 +25,7 @@ var (
 	// ErrDuplicateDocument is returned when another document is already associated with a given key, primary key,
 	// or if there is a unique index violation.
 	ErrDuplicateDocument = errors.New("duplicate document")
+
+	// ErrStatisticsNotFound is returned when a table has never been analyzed.
+	ErrStatisticsNotFound = errors.New("statistics not found")
 )
@@ -44,6 +44,12 @@ var errStop = errors.New("stop")
 // possible to associate multiple keys for the same value
 // but a key can be associated to only one value.
 func (idx *Index) Set(v document.Value, k []byte) error {
+	return idx.set(v, k, nil)
+}
+
+// set associates a value with a key. If the index includes other paths,
+// their values are read from d and stored alongside the key.
+func (idx *Index) set(v document.Value, k []byte, d document.Document) error {
 	var err error
 
 	if len(k) == 0 {
@@ -101,7 +107,58 @@ func (idx *Index) Set(v document.Value, k []byte) error {
 		return err
 	}
 
-	return st.Put(buf, k)
+	entry, err := idx.encodeEntry(k, d)
+	if err != nil {
+		return err
+	}
+
+	return st.Put(buf, entry)
+}
+
+// encodeEntry returns the value stored for key k.
+// If the index doesn't include any path, it is the key itself,
+// otherwise the key is prefixed by its length and followed
+// by a document containing the included values of d.
+func (idx *Index) encodeEntry(k []byte, d document.Document) ([]byte, error) {
+	if len(idx.Info.IncludedPaths) == 0 {
+		return k, nil
+	}
+
+	fb := document.NewFieldBuffer()
+	if d != nil {
+		for _, p := range idx.Info.IncludedPaths {
+			v, err := p.GetValueFromDocument(d)
+			if err == document.ErrFieldNotFound {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+
+			fb.Add(p[0].FieldName, v)
+		}
+	}
+
+	included, err := document.NewDocumentValue(fb).MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(k)+len(included))
+	n := binary.PutUvarint(buf, uint64(len(k)))
+	buf = append(buf[:n], k...)
+	return append(buf, included...), nil
+}
+
+// decodeEntry splits an entry encoded with encodeEntry into
+// the key and the encoded included values.
+func (idx *Index) decodeEntry(entry []byte) (k []byte, included []byte) {
+	if len(idx.Info.IncludedPaths) == 0 {
+		return entry, nil
+	}
+
+	l, n := binary.Uvarint(entry)
+	return entry[n : n+int(l)], entry[n+int(l):]
 }
 
 // Delete all the references to the key from the index.
@@ -113,12 +170,12 @@ func (idx *Index) Delete(v document.Value, k []byte) error {
 
 	var toDelete []byte
 	var buf []byte
-	err = idx.iterate(st, v, false, func(item engine.Item) error {
+	err = idx.iterate(st, v, nil, false, func(item engine.Item) error {
 		buf, err = item.ValueCopy(buf[:0])
 		if err != nil {
 			return err
 		}
-		if bytes.Equal(buf, k) {
+		if key, _ := idx.decodeEntry(buf); bytes.Equal(key, k) {
 			toDelete = item.Key()
 			return errStop
 		}
@@ -140,17 +197,100 @@ func (idx *Index) Delete(v document.Value, k []byte) error {
 // If the given function returns an error, the iteration stops and returns that error.
 // If the pivot is empty, starts from the beginning.
 func (idx *Index) AscendGreaterOrEqual(pivot document.Value, fn func(val, key []byte) error) error {
-	return idx.iterateOnStore(pivot, false, fn)
+	return idx.iterateOnStore(pivot, nil, false, func(_, val, key []byte) error {
+		return fn(val, key)
+	})
 }
 
 // DescendLessOrEqual seeks for the pivot and then goes through all the subsequent key value pairs in descreasing order and calls the given function for each pair.
 // If the given function returns an error, the iteration stops and returns that error.
 // If the pivot is empty, starts from the end.
 func (idx *Index) DescendLessOrEqual(pivot document.Value, fn func(val, key []byte) error) error {
-	return idx.iterateOnStore(pivot, true, fn)
+	return idx.iterateOnStore(pivot, nil, true, func(_, val, key []byte) error {
+		return fn(val, key)
+	})
+}
+
+// AscendGreaterOrEqualCovered works like AscendGreaterOrEqual but instead of the key,
+// it passes a document built from the content of the index entry.
+// The document contains the indexed value, if the index path is a top-level field,
+// and the values of the included paths. Its RawKey method returns the key of the
+// original document.
+func (idx *Index) AscendGreaterOrEqualCovered(pivot document.Value, fn func(val []byte, d document.Document) error) error {
+	return idx.iterateCovered(pivot, nil, false, func(_, val []byte, d document.Document) error {
+		return fn(val, d)
+	})
+}
+
+// DescendLessOrEqualCovered works like DescendLessOrEqual but instead of the key,
+// it passes a document built from the content of the index entry.
+// See AscendGreaterOrEqualCovered for more details.
+func (idx *Index) DescendLessOrEqualCovered(pivot document.Value, fn func(val []byte, d document.Document) error) error {
+	return idx.iterateCovered(pivot, nil, true, func(_, val []byte, d document.Document) error {
+		return fn(val, d)
+	})
+}
+
+// IterateAfter works like AscendGreaterOrEqual, or DescendLessOrEqual if reverse is true,
+// but also passes the raw key of each entry, which identifies its position in the index.
+// If after is not nil, the iteration starts right after the entry whose raw key is after,
+// whether that entry still exists or not, and the pivot is only used to stop the iteration
+// after the last value of its type.
+func (idx *Index) IterateAfter(pivot document.Value, after []byte, reverse bool, fn func(entry, val, key []byte) error) error {
+	return idx.iterateOnStore(pivot, after, reverse, fn)
 }
 
-func (idx *Index) iterateOnStore(pivot document.Value, reverse bool, fn func(val, key []byte) error) error {
+// IterateAfterCovered works like IterateAfter but instead of the key,
+// it passes a document built from the content of the index entry.
+// See AscendGreaterOrEqualCovered for more details.
+func (idx *Index) IterateAfterCovered(pivot document.Value, after []byte, reverse bool, fn func(entry, val []byte, d document.Document) error) error {
+	return idx.iterateCovered(pivot, after, reverse, fn)
+}
+
+func (idx *Index) iterateCovered(pivot document.Value, after []byte, reverse bool, fn func(entry, val []byte, d document.Document) error) error {
+	var fb document.FieldBuffer
+
+	return idx.iterateOnStoreEntries(pivot, after, reverse, func(entry, val, key, included []byte) error {
+		fb.Reset()
+		fb.EncodedKey = key
+
+		if len(idx.Info.Path) == 1 && idx.Info.Path[0].FieldName != "" {
+			v, err := idx.decodeValue(val)
+			if err != nil {
+				return err
+			}
+			fb.Add(idx.Info.Path[0].FieldName, v)
+		}
+
+		if len(included) > 0 {
+			v := document.Value{Type: document.DocumentValue}
+			err := v.UnmarshalBinary(included)
+			if err != nil {
+				return err
+			}
+
+			err = v.V.(document.Document).Iterate(func(field string, value document.Value) error {
+				fb.Add(field, value)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return fn(entry, val, &fb)
+	})
+}
+
+func (idx *Index) iterateOnStore(pivot document.Value, after []byte, reverse bool, fn func(entry, val, key []byte) error) error {
+	return idx.iterateOnStoreEntries(pivot, after, reverse, func(entry, val, key, _ []byte) error {
+		return fn(entry, val, key)
+	})
+}
+
+// iterateOnStoreEntries iterates over the entries of the index, starting from the pivot
+// or right after the entry whose raw key is after.
+func (idx *Index) iterateOnStoreEntries(pivot document.Value, after []byte, reverse bool, fn func(entry, val, key, included []byte) error) error {
 	// if index and pivot are typed but not of the same type
 	// return no result
 	if idx.Info.Type != 0 && pivot.Type != 0 && idx.Info.Type != pivot.Type {
@@ -166,10 +306,11 @@ func (idx *Index) iterateOnStore(pivot document.Value, reverse bool, fn func(val
 	}
 
 	var buf []byte
-	return idx.iterate(st, pivot, reverse, func(item engine.Item) error {
+	return idx.iterate(st, pivot, after, reverse, func(item engine.Item) error {
 		var err error
 
-		k := item.Key()
+		entry := item.Key()
+		k := entry
 
 		// the last byte of the key of a non-unique index is the size of the varint.
 		// if that byte is 0, it means that key is not duplicated.
@@ -183,7 +324,8 @@ func (idx *Index) iterateOnStore(pivot document.Value, reverse bool, fn func(val
 			return err
 		}
 
-		return fn(k, buf)
+		key, included := idx.decodeEntry(buf)
+		return fn(entry, k, key, included)
 	})
 }
 
@@ -215,6 +357,17 @@ func (idx *Index) EncodeValue(v document.Value) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// decodeValue decodes a value encoded with EncodeValue.
+func (idx *Index) decodeValue(data []byte) (document.Value, error) {
+	if idx.Info.Type != 0 {
+		v := document.Value{Type: idx.Info.Type}
+		err := v.UnmarshalBinary(data)
+		return v, err
+	}
+
+	return document.DecodeValue(data)
+}
+
 func getOrCreateStore(tx engine.Transaction, name []byte) (engine.Store, error) {
 	st, err := tx.GetStore(name)
 	if err == nil {
@@ -233,7 +386,7 @@ func getOrCreateStore(tx engine.Transaction, name []byte) (engine.Store, error)
 	return tx.GetStore(name)
 }
 
-func (idx *Index) iterate(st engine.Store, pivot document.Value, reverse bool, fn func(item engine.Item) error) error {
+func (idx *Index) iterate(st engine.Store, pivot document.Value, after []byte, reverse bool, fn func(item engine.Item) error) error {
 	var seek []byte
 	var err error
 
@@ -256,12 +409,21 @@ func (idx *Index) iterate(st engine.Store, pivot document.Value, reverse bool, f
 		}
 	}
 
+	if after != nil {
+		seek = after
+	}
+
 	it := st.Iterator(engine.IteratorOptions{Reverse: reverse})
 	defer it.Close()
 
 	for it.Seek(seek); it.Valid(); it.Next() {
 		itm := it.Item()
 
+		// skip the entry the iteration resumes from
+		if after != nil && bytes.Equal(itm.Key(), after) {
+			continue
+		}
+
 		// if index is untyped and pivot is typed, only iterate on values with the same type as pivot
 		if idx.Info.Type == 0 && pivot.Type != 0 && itm.Key()[0] != byte(pivot.Type) {
 			return nil
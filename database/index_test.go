@@ -416,6 +416,65 @@ func TestIndexDescendLessOrEqual(t *testing.T) {
 	}
 }
 
+func TestIndexIterateAfter(t *testing.T) {
+	for _, unique := range []bool{true, false} {
+		text := fmt.Sprintf("Unique: %v, ", unique)
+
+		t.Run(text+"Should iterate from the entry following the given one", func(t *testing.T) {
+			idx, cleanup := getIndex(t, unique)
+			defer cleanup()
+
+			for i := 0; i < 3; i++ {
+				require.NoError(t, idx.Set(document.NewIntegerValue(int64(i)), []byte{'i', 'a' + byte(i)}))
+				require.NoError(t, idx.Set(document.NewTextValue(strconv.Itoa(i)), []byte{'s', 'a' + byte(i)}))
+			}
+
+			entries := make(map[string][]byte)
+			err := idx.IterateAfter(document.Value{}, nil, false, func(entry, val, key []byte) error {
+				entries[string(key)] = append([]byte(nil), entry...)
+				return nil
+			})
+			require.NoError(t, err)
+			require.Len(t, entries, 6)
+
+			var keys []string
+			err = idx.IterateAfter(document.Value{}, entries["ib"], false, func(entry, val, key []byte) error {
+				keys = append(keys, string(key))
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, []string{"ic", "sa", "sb", "sc"}, keys)
+
+			keys = keys[:0]
+			err = idx.IterateAfter(document.Value{}, entries["sb"], true, func(entry, val, key []byte) error {
+				keys = append(keys, string(key))
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, []string{"sa", "ic", "ib", "ia"}, keys)
+
+			// a typed pivot stops the iteration after the last value of its type
+			keys = keys[:0]
+			err = idx.IterateAfter(document.NewIntegerValue(0), entries["ia"], false, func(entry, val, key []byte) error {
+				keys = append(keys, string(key))
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, []string{"ib", "ic"}, keys)
+
+			// the iteration resumes after the entry even if it was deleted
+			require.NoError(t, idx.Delete(document.NewIntegerValue(2), []byte("ic")))
+			keys = keys[:0]
+			err = idx.IterateAfter(document.Value{}, entries["ic"], false, func(entry, val, key []byte) error {
+				keys = append(keys, string(key))
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, []string{"sa", "sb", "sc"}, keys)
+		})
+	}
+}
+
 // BenchmarkIndexSet benchmarks the Set method with 1, 10, 1000 and 10000 successive insertions.
 func BenchmarkIndexSet(b *testing.B) {
 	for size := 10; size <= 10000; size *= 10 {
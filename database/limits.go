@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Names of the limits reported by LimitError.
+const (
+	MemoryLimit           = "memory"
+	ScannedDocumentsLimit = "scanned documents"
+	TimeoutLimit          = "timeout"
+)
+
+// Limits restrict the resources a statement can use during its execution.
+// They can be set on the database, on a transaction and on a statement,
+// using WithLimits. Limits set on a statement take precedence over those of
+// its transaction, which take precedence over those of the database.
+// A zero value inherits the limit of the upper level and a negative value
+// removes it.
+type Limits struct {
+	// Maximum number of bytes the sort, aggregate and distinct operations
+	// of a statement can hold in memory.
+	// Data written to temporary files, once the WorkMemoryLimit
+	// of the database is reached, is not taken into account.
+	MaxMemory int64
+	// Maximum number of documents a statement can read from tables and indexes.
+	MaxScannedDocuments int64
+	// Maximum execution time of a statement, including the time spent by
+	// the caller to process its results.
+	Timeout time.Duration
+}
+
+// merge returns l with the limits set in other overriding its own.
+func (l Limits) merge(other Limits) Limits {
+	if other.MaxMemory != 0 {
+		l.MaxMemory = other.MaxMemory
+	}
+	if other.MaxScannedDocuments != 0 {
+		l.MaxScannedDocuments = other.MaxScannedDocuments
+	}
+	if other.Timeout != 0 {
+		l.Timeout = other.Timeout
+	}
+
+	return l
+}
+
+// A LimitError is returned when a statement exceeds one of its limits.
+type LimitError struct {
+	// Name of the limit, one of MemoryLimit, ScannedDocumentsLimit or TimeoutLimit.
+	Limit string
+}
+
+// Error returns the string representation of the error.
+func (e *LimitError) Error() string {
+	return "statement exceeded its " + e.Limit + " limit"
+}
+
+type limitsKey struct{}
+
+// WithLimits returns a copy of ctx carrying limits for the statements
+// executed with it. Transactions created with that context also use them
+// as their own limits.
+func WithLimits(ctx context.Context, l Limits) context.Context {
+	if cur, ok := ctx.Value(limitsKey{}).(Limits); ok {
+		l = cur.merge(l)
+	}
+
+	return context.WithValue(ctx, limitsKey{}, l)
+}
+
+func limitsFromContext(ctx context.Context) Limits {
+	l, _ := ctx.Value(limitsKey{}).(Limits)
+	return l
+}
+
+// A Budget tracks the resources used by the execution of a statement
+// and reports when they exceed its limits.
+// It is safe for concurrent use. A nil Budget has no limits.
+type Budget struct {
+	limits  Limits
+	memory  int64
+	scanned int64
+}
+
+// NewBudget returns a budget enforcing the given limits.
+func NewBudget(l Limits) *Budget {
+	return &Budget{limits: l}
+}
+
+// Limits returns the limits enforced by the budget.
+func (b *Budget) Limits() Limits {
+	if b == nil {
+		return Limits{}
+	}
+
+	return b.limits
+}
+
+// TracksMemory returns whether the memory used by operations must be reported to the budget.
+func (b *Budget) TracksMemory() bool {
+	return b != nil && b.limits.MaxMemory > 0
+}
+
+// Grow records that n more bytes are held in memory, or n fewer bytes
+// if n is negative. It returns a LimitError if the memory limit is exceeded.
+func (b *Budget) Grow(n int64) error {
+	if !b.TracksMemory() {
+		return nil
+	}
+
+	if atomic.AddInt64(&b.memory, n) > b.limits.MaxMemory {
+		return &LimitError{Limit: MemoryLimit}
+	}
+
+	return nil
+}
+
+// Scan records that a document was read from a table or an index.
+// It returns a LimitError if the limit of scanned documents is exceeded.
+func (b *Budget) Scan() error {
+	if b == nil || b.limits.MaxScannedDocuments <= 0 {
+		return nil
+	}
+
+	if atomic.AddInt64(&b.scanned, 1) > b.limits.MaxScannedDocuments {
+		return &LimitError{Limit: ScannedDocumentsLimit}
+	}
+
+	return nil
+}
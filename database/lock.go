@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrDatabaseLocked is returned by TryBegin and TryBeginTx when the transaction
+// cannot be created without waiting for another transaction.
+var ErrDatabaseLocked = errors.New("database is locked")
+
+// txLock is a readers-writer lock whose acquisition can be canceled using a context.
+// As with sync.RWMutex, once a writer is waiting for the lock, new readers wait
+// until the writer has acquired and released the lock.
+// The zero value is an unlocked lock.
+type txLock struct {
+	mu      sync.Mutex
+	readers int
+	writer  bool
+	// number of writers waiting for the lock.
+	waiting int
+	// closed every time the lock is released.
+	released chan struct{}
+}
+
+// wait returns a channel closed the next time the lock is released.
+// It must be called with l.mu held.
+func (l *txLock) wait() <-chan struct{} {
+	if l.released == nil {
+		l.released = make(chan struct{})
+	}
+
+	return l.released
+}
+
+// notify wakes up the callers waiting for the lock.
+// It must be called with l.mu held.
+func (l *txLock) notify() {
+	if l.released != nil {
+		close(l.released)
+		l.released = nil
+	}
+}
+
+// rlock acquires the lock for reading and returns the time spent waiting.
+// If block is false and the lock cannot be acquired immediately, it returns ErrDatabaseLocked.
+func (l *txLock) rlock(ctx context.Context, block bool) (time.Duration, error) {
+	var start time.Time
+
+	l.mu.Lock()
+	for l.writer || l.waiting > 0 {
+		if !block {
+			l.mu.Unlock()
+			return 0, ErrDatabaseLocked
+		}
+
+		if start.IsZero() {
+			start = time.Now()
+		}
+		released := l.wait()
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return time.Since(start), ctx.Err()
+		case <-released:
+		}
+
+		l.mu.Lock()
+	}
+
+	l.readers++
+	l.mu.Unlock()
+	return since(start), nil
+}
+
+func (l *txLock) runlock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.readers--
+	if l.readers == 0 {
+		l.notify()
+	}
+}
+
+// lock acquires the lock for writing and returns the time spent waiting.
+func (l *txLock) lock(ctx context.Context) (time.Duration, error) {
+	var start time.Time
+
+	l.mu.Lock()
+	l.waiting++
+	for l.writer || l.readers > 0 {
+		if start.IsZero() {
+			start = time.Now()
+		}
+		released := l.wait()
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			l.mu.Lock()
+			l.waiting--
+			// readers were waiting for this writer.
+			l.notify()
+			l.mu.Unlock()
+			return time.Since(start), ctx.Err()
+		case <-released:
+		}
+
+		l.mu.Lock()
+	}
+
+	l.waiting--
+	l.writer = true
+	l.mu.Unlock()
+	return since(start), nil
+}
+
+// since returns the time elapsed since start, or zero if start is zero.
+func since(start time.Time) time.Duration {
+	if start.IsZero() {
+		return 0
+	}
+
+	return time.Since(start)
+}
+
+func (l *txLock) unlock() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.writer = false
+	l.notify()
+}
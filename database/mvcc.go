@@ -0,0 +1,1551 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/genjidb/genji/engine"
+	"github.com/google/btree"
+)
+
+// ErrTransactionConflict is returned when committing a read/write transaction that
+// modified data which was also modified by a transaction commited after it started.
+// The transaction is rolled back and can be retried.
+var ErrTransactionConflict = errors.New("transaction conflict: data was modified by a concurrent transaction")
+
+const (
+	// degree of the btrees holding the changes of a transaction
+	// and the history of the keys.
+	writeSetDegree = 12
+
+	// number of changes read at once from a write set by iterators.
+	writeSetBatchSize = 64
+
+	// number of keys read at once from the engine by iterators.
+	snapshotBatchSize = 128
+
+	// minimum number of key versions recorded by the commits
+	// before attempting to prune them.
+	minPruneThreshold = 1024
+)
+
+// mvcc implements multi-version concurrency control on top of any engine.
+//
+// Every transaction reads from a snapshot of the database taken when it started, and read/write
+// transactions buffer their changes in memory. On commit, the changes are checked against the ones
+// of the transactions commited since the snapshot was taken: if both modified the same key, or if
+// one of them created, dropped or truncated the store of the other, the commit fails with
+// ErrTransactionConflict. Otherwise, the changes are written using a read/write engine transaction.
+// This gives snapshot isolation to transactions, and allows independent writers to run in parallel,
+// only commits being serialized.
+//
+// Snapshots don't hold engine transactions, since some engines, like Bolt, can't grow the database
+// while read-only transactions are open. Instead, every read uses a short-lived engine transaction,
+// and each commit records the previous value of the keys it modifies: keys modified after
+// a snapshot was taken are read from these values.
+type mvcc struct {
+	ng engine.Engine
+
+	// mu protects ts and active.
+	mu sync.Mutex
+	// number of commits so far, used as the timestamp of the snapshots and commits.
+	ts uint64
+	// number of running transactions per start timestamp.
+	active map[uint64]int
+
+	// commitLock serializes commits and protects the fields below.
+	// It is a channel so that waiting for it can be canceled.
+	commitLock chan struct{}
+	// vmu protects commits, which is also read by the transactions
+	// reading their snapshot.
+	vmu sync.RWMutex
+	// changes commited per store. Changes older than every running
+	// transaction are no longer needed and are pruned.
+	commits map[string]*storeCommits
+	// number of key versions recorded in commits.
+	recorded int
+	// number of recorded versions beyond which commits are pruned.
+	pruneThreshold int
+	// timestamp of the last commit that modified the schema.
+	schemaTS uint64
+
+	// seqmu protects the sequences.
+	// Sequences are allocated by the database rather than by the engine since
+	// the engine stores can only be modified when commiting.
+	seqmu     sync.Mutex
+	sequences map[string]*sequence
+}
+
+// storeCommits records the commits that modified a store.
+type storeCommits struct {
+	// timestamp of the last commit that created, dropped or truncated the store.
+	reset uint64
+	// timestamp of the last commit that modified the store.
+	last uint64
+	// history of the keys modified by the commits, ordered by key.
+	keys *btree.BTree
+}
+
+// keyHistory holds the values a key had before being modified by the commits.
+// It implements btree.Item.
+type keyHistory struct {
+	k []byte
+	// versions of the key, by increasing timestamp.
+	versions []keyVersion
+}
+
+// keyVersion is the value of a key before a commit modified it.
+type keyVersion struct {
+	// timestamp of the commit.
+	ts uint64
+	// value of the key, nil if it didn't exist.
+	prev []byte
+}
+
+func (h *keyHistory) Less(than btree.Item) bool {
+	return bytes.Compare(h.k, than.(*keyHistory).k) < 0
+}
+
+// lastCommit returns the timestamp of the last commit that modified the key.
+func (h *keyHistory) lastCommit() uint64 {
+	return h.versions[len(h.versions)-1].ts
+}
+
+// before returns the value the key had at the given timestamp,
+// if it was modified by a later commit.
+func (h *keyHistory) before(ts uint64) (*writeEntry, bool) {
+	for _, v := range h.versions {
+		if v.ts > ts {
+			return &writeEntry{k: h.k, v: v.prev, deleted: v.prev == nil}, true
+		}
+	}
+
+	return nil, false
+}
+
+type sequence struct {
+	// last value returned.
+	value uint64
+	// last value written to the sequence store.
+	persisted uint64
+}
+
+func newMVCC(ng engine.Engine) *mvcc {
+	return &mvcc{
+		ng:             ng,
+		active:         make(map[uint64]int),
+		commitLock:     make(chan struct{}, 1),
+		commits:        make(map[string]*storeCommits),
+		pruneThreshold: minPruneThreshold,
+		sequences:      make(map[string]*sequence),
+	}
+}
+
+// begin creates a transaction reading from a snapshot of the database.
+func (m *mvcc) begin(ctx context.Context, readOnly bool) (*mvccTx, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	tx := mvccTx{
+		m:        m,
+		ctx:      ctx,
+		readOnly: readOnly,
+		stores:   make(map[string]*writeSet),
+	}
+
+	tx.takeSnapshot()
+	return &tx, nil
+}
+
+// view calls fn with a read-only engine transaction, which is closed once fn returns.
+func (m *mvcc) view(ctx context.Context, fn func(ntx engine.Transaction) error) error {
+	ntx, err := m.ng.Begin(ctx, engine.TxOptions{})
+	if err != nil {
+		return err
+	}
+	defer ntx.Rollback()
+
+	return fn(ntx)
+}
+
+// loadSequences initializes the sequences of the given stores.
+// It must be called before any transaction is created.
+func (m *mvcc) loadSequences(ctx context.Context, storeNames []string) error {
+	tx, err := m.ng.Begin(ctx, engine.TxOptions{Writable: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	seqStore, err := tx.GetStore([]byte(sequenceStoreName))
+	if err != nil {
+		return err
+	}
+
+	for _, name := range storeNames {
+		st, err := tx.GetStore([]byte(name))
+		if err == engine.ErrStoreNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		// databases created by previous versions only store their sequences
+		// in the engine. The value returned by the engine was never used:
+		// the engine transaction is rolled back.
+		value, err := st.NextSequence()
+		if err != nil {
+			return err
+		}
+		value--
+
+		var persisted uint64
+		v, err := seqStore.Get([]byte(name))
+		if err == nil {
+			persisted, _ = binary.Uvarint(v)
+		} else if err != engine.ErrKeyNotFound {
+			return err
+		}
+
+		if persisted > value {
+			value = persisted
+		}
+
+		m.sequences[name] = &sequence{value: value, persisted: persisted}
+	}
+
+	return nil
+}
+
+// nextSequence returns the next value of the sequence of the given store.
+// The value is persisted by the next successful commit.
+func (m *mvcc) nextSequence(storeName string) uint64 {
+	m.seqmu.Lock()
+	defer m.seqmu.Unlock()
+
+	seq, ok := m.sequences[storeName]
+	if !ok {
+		seq = new(sequence)
+		m.sequences[storeName] = seq
+	}
+
+	seq.value++
+	return seq.value
+}
+
+// persistSequences writes the sequences that changed since they were last persisted.
+// It returns a function that must be called once the engine transaction is commited.
+func (m *mvcc) persistSequences(tx engine.Transaction) (func(), error) {
+	type change struct {
+		seq   *sequence
+		value uint64
+	}
+	var changes []change
+	var names []string
+
+	m.seqmu.Lock()
+	for name, seq := range m.sequences {
+		if seq.value != seq.persisted {
+			changes = append(changes, change{seq: seq, value: seq.value})
+			names = append(names, name)
+		}
+	}
+	m.seqmu.Unlock()
+
+	if len(changes) == 0 {
+		return func() {}, nil
+	}
+
+	st, err := tx.GetStore([]byte(sequenceStoreName))
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, binary.MaxVarintLen64)
+	for i, c := range changes {
+		n := binary.PutUvarint(buf, c.value)
+		err = st.Put([]byte(names[i]), append([]byte{}, buf[:n]...))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return func() {
+		m.seqmu.Lock()
+		defer m.seqmu.Unlock()
+
+		for _, c := range changes {
+			if c.seq.persisted < c.value {
+				c.seq.persisted = c.value
+			}
+		}
+	}, nil
+}
+
+// validate returns ErrTransactionConflict if the changes of the transaction
+// conflict with the ones commited since it started.
+// It must be called with the commit lock held.
+func (m *mvcc) validate(tx *mvccTx) error {
+	if !tx.hasChanges() {
+		return nil
+	}
+
+	// the schema can only be modified while no other transaction is running,
+	// except the ones waiting for the schema lock, which may have been planned
+	// against the previous schema.
+	if m.schemaTS > tx.startTS {
+		return ErrTransactionConflict
+	}
+
+	for name, ws := range tx.stores {
+		if !ws.changed() {
+			continue
+		}
+
+		sc, ok := m.commits[name]
+		if !ok {
+			continue
+		}
+
+		if sc.reset > tx.startTS {
+			return ErrTransactionConflict
+		}
+
+		if ws.reset {
+			if sc.last > tx.startTS {
+				return ErrTransactionConflict
+			}
+			continue
+		}
+
+		var err error
+		ws.entries.Ascend(func(i btree.Item) bool {
+			h := sc.keys.Get(&keyHistory{k: i.(*writeEntry).k})
+			if h != nil && h.(*keyHistory).lastCommit() > tx.startTS {
+				err = ErrTransactionConflict
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// storeCommits returns the commits of the given store, creating them if needed.
+// It must be called with vmu held.
+func (m *mvcc) storeCommits(name string) *storeCommits {
+	sc, ok := m.commits[name]
+	if !ok {
+		sc = &storeCommits{keys: btree.New(writeSetDegree)}
+		m.commits[name] = sc
+	}
+
+	return sc
+}
+
+// publish the previous values of the keys modified by the commit with the given timestamp.
+// They must be published before the changes are written to the engine: the transactions
+// reading a key from the engine then look for its previous value, which they use if the key
+// was modified after their snapshot was taken.
+// It must be called with the commit lock held.
+func (m *mvcc) publish(images map[string][]*writeEntry, ts uint64) {
+	m.vmu.Lock()
+	defer m.vmu.Unlock()
+
+	for name, entries := range images {
+		sc := m.storeCommits(name)
+
+		for _, e := range entries {
+			var h *keyHistory
+			if i := sc.keys.Get(&keyHistory{k: e.k}); i != nil {
+				h = i.(*keyHistory)
+			} else {
+				h = &keyHistory{k: e.k}
+				sc.keys.ReplaceOrInsert(h)
+			}
+
+			v := keyVersion{ts: ts}
+			if !e.deleted {
+				v.prev = e.v
+			}
+			h.versions = append(h.versions, v)
+			m.recorded++
+		}
+	}
+}
+
+// unpublish removes the values published by a commit which failed.
+// It must be called with the commit lock held.
+func (m *mvcc) unpublish(images map[string][]*writeEntry, ts uint64) {
+	m.vmu.Lock()
+	defer m.vmu.Unlock()
+
+	for name, entries := range images {
+		sc := m.commits[name]
+
+		for _, e := range entries {
+			i := sc.keys.Get(&keyHistory{k: e.k})
+			if i == nil {
+				continue
+			}
+
+			h := i.(*keyHistory)
+			if h.lastCommit() != ts {
+				continue
+			}
+
+			h.versions = h.versions[:len(h.versions)-1]
+			m.recorded--
+			if len(h.versions) == 0 {
+				sc.keys.Delete(h)
+			}
+		}
+	}
+}
+
+// record the changes of a transaction commited at the given timestamp.
+// It must be called with the commit lock held.
+func (m *mvcc) record(tx *mvccTx, ts uint64) {
+	m.vmu.Lock()
+	defer m.vmu.Unlock()
+
+	if tx.schemaLocked {
+		m.schemaTS = ts
+	}
+
+	for name, ws := range tx.stores {
+		if !ws.changed() {
+			continue
+		}
+
+		sc := m.storeCommits(name)
+		sc.last = ts
+		if ws.reset {
+			sc.reset = ts
+		}
+	}
+}
+
+// prune removes the commits that are no longer needed by the running transactions.
+// It must be called with the commit lock held.
+func (m *mvcc) prune() {
+	m.mu.Lock()
+	oldest := m.ts
+	for ts := range m.active {
+		if ts < oldest {
+			oldest = ts
+		}
+	}
+	running := len(m.active)
+	m.mu.Unlock()
+
+	m.vmu.Lock()
+	defer m.vmu.Unlock()
+
+	if running == 0 {
+		m.commits = make(map[string]*storeCommits)
+		m.recorded = 0
+		m.pruneThreshold = minPruneThreshold
+		return
+	}
+
+	if m.recorded < m.pruneThreshold {
+		return
+	}
+
+	for name, sc := range m.commits {
+		var stale []*keyHistory
+		sc.keys.Ascend(func(i btree.Item) bool {
+			h := i.(*keyHistory)
+
+			n := 0
+			for n < len(h.versions) && h.versions[n].ts <= oldest {
+				n++
+			}
+			if n > 0 {
+				h.versions = append([]keyVersion(nil), h.versions[n:]...)
+				m.recorded -= n
+			}
+
+			if len(h.versions) == 0 {
+				stale = append(stale, h)
+			}
+			return true
+		})
+
+		for _, h := range stale {
+			sc.keys.Delete(h)
+		}
+
+		if sc.keys.Len() == 0 && sc.last <= oldest {
+			delete(m.commits, name)
+		}
+	}
+
+	m.pruneThreshold = 2 * m.recorded
+	if m.pruneThreshold < minPruneThreshold {
+		m.pruneThreshold = minPruneThreshold
+	}
+}
+
+// end unregisters a transaction started at the given timestamp.
+// It must be called with m.mu held.
+func (m *mvcc) end(startTS uint64) {
+	m.active[startTS]--
+	if m.active[startTS] == 0 {
+		delete(m.active, startTS)
+	}
+}
+
+// lockCommits acquires the commit lock, unless ctx is canceled first.
+// It returns the time spent waiting.
+func (m *mvcc) lockCommits(ctx context.Context) (time.Duration, error) {
+	select {
+	case m.commitLock <- struct{}{}:
+		return 0, nil
+	default:
+	}
+
+	start := time.Now()
+	select {
+	case m.commitLock <- struct{}{}:
+		return time.Since(start), nil
+	case <-ctx.Done():
+		return time.Since(start), ctx.Err()
+	}
+}
+
+func (m *mvcc) unlockCommits() {
+	<-m.commitLock
+}
+
+// mvccTx is an engine.Transaction which reads from a snapshot
+// of the database and, if read/write, writes its changes on commit.
+type mvccTx struct {
+	m        *mvcc
+	ctx      context.Context
+	readOnly bool
+
+	// set while the transaction is registered as running since startTS.
+	hasSnapshot bool
+	startTS     uint64
+	stores      map[string]*writeSet
+
+	// set if the transaction holds the schema lock.
+	schemaLocked bool
+	// error returned on commit, if the transaction can no longer succeed.
+	// if the transaction has no snapshot, it is returned by every method.
+	err error
+	// time spent waiting for the commit lock.
+	commitWait time.Duration
+	// timestamp of the commit, zero if the transaction wasn't
+	// commited or didn't modify the database.
+	commitTS   uint64
+	terminated bool
+}
+
+// takeSnapshot registers the transaction as running since the last commit:
+// the changes commited afterwards are hidden from it.
+func (tx *mvccTx) takeSnapshot() {
+	tx.m.mu.Lock()
+	tx.startTS = tx.m.ts
+	tx.m.active[tx.startTS]++
+	tx.m.mu.Unlock()
+
+	tx.hasSnapshot = true
+}
+
+// releaseSnapshot unregisters the transaction.
+func (tx *mvccTx) releaseSnapshot() {
+	if !tx.hasSnapshot {
+		return
+	}
+
+	tx.hasSnapshot = false
+
+	tx.m.mu.Lock()
+	tx.m.end(tx.startTS)
+	tx.m.mu.Unlock()
+}
+
+// lockSchema releases the snapshot, calls wait, which must return once the transaction
+// has exclusive access to the database, and takes a new snapshot which includes every commit.
+// If the changes of the transaction conflict with the commits that happened in the meantime,
+// the transaction will fail to commit.
+// If wait fails, the transaction can only be rolled back.
+func (tx *mvccTx) lockSchema(wait func() error) error {
+	err := tx.check()
+	if err != nil {
+		return err
+	}
+
+	tx.releaseSnapshot()
+
+	err = wait()
+	if err != nil {
+		tx.err = err
+		return err
+	}
+
+	// no other transaction is running, the commit lock is free.
+	_, err = tx.m.lockCommits(tx.ctx)
+	if err != nil {
+		tx.err = err
+		return err
+	}
+	err = tx.m.validate(tx)
+	tx.m.unlockCommits()
+	if err != nil {
+		tx.err = err
+	}
+
+	tx.schemaLocked = true
+	tx.takeSnapshot()
+	return nil
+}
+
+func (tx *mvccTx) hasChanges() bool {
+	for _, ws := range tx.stores {
+		if ws.changed() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (tx *mvccTx) check() error {
+	if tx.terminated {
+		return engine.ErrTransactionDiscarded
+	}
+
+	if !tx.hasSnapshot {
+		return tx.err
+	}
+
+	select {
+	case <-tx.ctx.Done():
+		return tx.ctx.Err()
+	default:
+	}
+
+	return nil
+}
+
+// checkWritable returns engine.ErrTransactionReadOnly if the transaction is read-only.
+func (tx *mvccTx) checkWritable() error {
+	err := tx.check()
+	if err != nil {
+		return err
+	}
+
+	if tx.readOnly {
+		return engine.ErrTransactionReadOnly
+	}
+
+	return nil
+}
+
+// Rollback discards the changes of the transaction.
+func (tx *mvccTx) Rollback() error {
+	if tx.terminated {
+		return engine.ErrTransactionDiscarded
+	}
+
+	tx.terminated = true
+	tx.releaseSnapshot()
+	return nil
+}
+
+// Commit writes the changes of the transaction to the engine,
+// unless they conflict with a transaction commited after the snapshot was taken.
+// Whether it succeeds or not, the transaction is closed.
+func (tx *mvccTx) Commit() error {
+	if tx.readOnly && !tx.terminated {
+		return engine.ErrTransactionReadOnly
+	}
+
+	err := tx.check()
+	if err != nil {
+		if err != engine.ErrTransactionDiscarded {
+			tx.Rollback()
+		}
+		return err
+	}
+
+	tx.terminated = true
+
+	if tx.err != nil {
+		tx.releaseSnapshot()
+		return tx.err
+	}
+
+	m := tx.m
+	waited, err := m.lockCommits(tx.ctx)
+	tx.commitWait += waited
+	if err != nil {
+		tx.releaseSnapshot()
+		return err
+	}
+	defer m.unlockCommits()
+
+	// the transaction remains registered until its changes are recorded,
+	// otherwise the commits it is validated against could be pruned.
+	defer func() {
+		tx.releaseSnapshot()
+		m.prune()
+	}()
+
+	err = m.validate(tx)
+	if err != nil {
+		return err
+	}
+
+	if !tx.hasChanges() && !tx.schemaLocked {
+		return nil
+	}
+
+	wtx, err := m.ng.Begin(tx.ctx, engine.TxOptions{Writable: true})
+	if err != nil {
+		return err
+	}
+	defer wtx.Rollback()
+
+	images, err := tx.apply(wtx)
+	if err != nil {
+		return err
+	}
+
+	persisted, err := m.persistSequences(wtx)
+	if err != nil {
+		return err
+	}
+
+	// the timestamp only changes with the commit lock held.
+	m.mu.Lock()
+	ts := m.ts + 1
+	m.mu.Unlock()
+
+	m.publish(images, ts)
+	err = wtx.Commit()
+	if err != nil {
+		m.unpublish(images, ts)
+		return err
+	}
+	persisted()
+
+	m.mu.Lock()
+	m.ts = ts
+	m.mu.Unlock()
+	tx.commitTS = ts
+
+	m.record(tx, ts)
+	return nil
+}
+
+// apply writes the changes of the transaction using the given engine transaction.
+// It returns the previous value of the modified keys, per store, which are needed by
+// the transactions whose snapshot is older than the commit. No transaction is running
+// alongside the ones holding the schema lock: they don't return them.
+func (tx *mvccTx) apply(wtx engine.Transaction) (map[string][]*writeEntry, error) {
+	images := make(map[string][]*writeEntry)
+
+	for name, ws := range tx.stores {
+		if !ws.changed() {
+			continue
+		}
+
+		var prev []*writeEntry
+		if ws.reset {
+			if ws.inSnapshot {
+				if !tx.schemaLocked {
+					var err error
+					prev, err = storeEntries(wtx, name)
+					if err != nil {
+						return nil, err
+					}
+				}
+
+				err := wtx.DropStore([]byte(name))
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			if ws.exists {
+				err := wtx.CreateStore([]byte(name))
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if !ws.exists {
+			if len(prev) > 0 {
+				images[name] = prev
+			}
+			continue
+		}
+
+		st, err := wtx.GetStore([]byte(name))
+		if err != nil {
+			return nil, err
+		}
+
+		// keys of the store before it was reset, whose previous value is known.
+		known := make(map[string]struct{}, len(prev))
+		for _, e := range prev {
+			known[string(e.k)] = struct{}{}
+		}
+
+		ws.entries.Ascend(func(i btree.Item) bool {
+			e := i.(*writeEntry)
+
+			if !tx.schemaLocked {
+				if _, ok := known[string(e.k)]; !ok {
+					p := writeEntry{k: e.k, deleted: true}
+					if !ws.reset {
+						var v []byte
+						v, err = st.Get(e.k)
+						if err == nil {
+							p.v, p.deleted = append([]byte{}, v...), false
+						} else if err != engine.ErrKeyNotFound {
+							return false
+						}
+					}
+					prev = append(prev, &p)
+				}
+			}
+
+			if e.deleted {
+				err = st.Delete(e.k)
+				if err == engine.ErrKeyNotFound {
+					err = nil
+				}
+			} else {
+				err = st.Put(e.k, e.v)
+			}
+			return err == nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		if len(prev) > 0 {
+			images[name] = prev
+		}
+	}
+
+	return images, nil
+}
+
+// storeEntries returns a copy of the content of the given store.
+func storeEntries(ntx engine.Transaction, name string) ([]*writeEntry, error) {
+	st, err := ntx.GetStore([]byte(name))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*writeEntry
+	it := st.Iterator(engine.IteratorOptions{})
+	defer it.Close()
+
+	for it.Seek(nil); it.Valid(); it.Next() {
+		item := it.Item()
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &writeEntry{k: append([]byte{}, item.Key()...), v: v})
+	}
+
+	return entries, it.Err()
+}
+
+// writeSet returns the changes made to the given store, creating
+// them if the store wasn't modified so far.
+func (tx *mvccTx) writeSet(name []byte) (*writeSet, error) {
+	ws, ok := tx.stores[string(name)]
+	if ok {
+		return ws, nil
+	}
+
+	// stores are only created or dropped by the transactions holding the schema lock:
+	// the engine contains the stores of the snapshot.
+	var inSnapshot bool
+	err := tx.m.view(tx.ctx, func(ntx engine.Transaction) error {
+		_, err := ntx.GetStore(name)
+		if err == engine.ErrStoreNotFound {
+			return nil
+		}
+		inSnapshot = err == nil
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ws = &writeSet{
+		tx:         tx,
+		name:       string(name),
+		inSnapshot: inSnapshot,
+		exists:     inSnapshot,
+		entries:    btree.New(writeSetDegree),
+	}
+	tx.stores[ws.name] = ws
+	return ws, nil
+}
+
+// GetStore returns a store that reads from the snapshot
+// and records its changes in the transaction.
+func (tx *mvccTx) GetStore(name []byte) (engine.Store, error) {
+	err := tx.check()
+	if err != nil {
+		return nil, err
+	}
+
+	ws, err := tx.writeSet(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !ws.exists {
+		return nil, engine.ErrStoreNotFound
+	}
+
+	return ws, nil
+}
+
+func (tx *mvccTx) CreateStore(name []byte) error {
+	err := tx.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	ws, err := tx.writeSet(name)
+	if err != nil {
+		return err
+	}
+
+	if ws.exists {
+		return engine.ErrStoreAlreadyExists
+	}
+
+	ws.exists = true
+	ws.clear()
+	return nil
+}
+
+func (tx *mvccTx) DropStore(name []byte) error {
+	err := tx.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	ws, err := tx.writeSet(name)
+	if err != nil {
+		return err
+	}
+
+	if !ws.exists {
+		return engine.ErrStoreNotFound
+	}
+
+	ws.exists = false
+	ws.clear()
+	return nil
+}
+
+// writeEntry is a change made to a key. It implements engine.Item
+// and btree.Item.
+type writeEntry struct {
+	k, v    []byte
+	deleted bool
+}
+
+func (e *writeEntry) Key() []byte {
+	return e.k
+}
+
+func (e *writeEntry) ValueCopy(buf []byte) ([]byte, error) {
+	return append(buf[:0], e.v...), nil
+}
+
+func (e *writeEntry) Less(than btree.Item) bool {
+	return bytes.Compare(e.k, than.(*writeEntry).k) < 0
+}
+
+// writeSet is an engine.Store that records the changes made to a store by a transaction.
+// Keys that weren't modified are read from the snapshot of the transaction.
+type writeSet struct {
+	tx   *mvccTx
+	name string
+
+	// whether the store exists in the snapshot.
+	inSnapshot bool
+	// whether the store exists for the transaction.
+	exists bool
+	// set if the store was created, dropped or truncated by the transaction:
+	// the content of the snapshot is ignored.
+	reset bool
+	// changes made to the keys.
+	entries *btree.BTree
+}
+
+func (ws *writeSet) changed() bool {
+	return ws.reset || ws.entries.Len() > 0
+}
+
+func (ws *writeSet) clear() {
+	ws.reset = true
+	ws.entries = btree.New(writeSetDegree)
+}
+
+func (ws *writeSet) check() error {
+	err := ws.tx.check()
+	if err != nil {
+		return err
+	}
+
+	if !ws.exists {
+		return engine.ErrStoreNotFound
+	}
+
+	return nil
+}
+
+func (ws *writeSet) checkWritable() error {
+	err := ws.check()
+	if err != nil {
+		return err
+	}
+
+	if ws.tx.readOnly {
+		return engine.ErrTransactionReadOnly
+	}
+
+	return nil
+}
+
+// readSnapshot reports whether the content of the store in the snapshot must be read.
+func (ws *writeSet) readSnapshot() bool {
+	return !ws.reset && ws.inSnapshot
+}
+
+// snapshotGet returns the value the key had in the snapshot.
+func (ws *writeSet) snapshotGet(k []byte) ([]byte, error) {
+	var v []byte
+	err := ws.tx.m.view(ws.tx.ctx, func(ntx engine.Transaction) error {
+		st, err := ntx.GetStore([]byte(ws.name))
+		if err != nil {
+			return err
+		}
+
+		v, err = st.Get(k)
+		if err != nil {
+			return err
+		}
+		v = append([]byte{}, v...)
+		return nil
+	})
+	if err != nil && err != engine.ErrKeyNotFound {
+		return nil, err
+	}
+
+	// the engine must be read first: the previous value of the keys
+	// is published before the changes of a commit are written.
+	ws.tx.m.vmu.RLock()
+	defer ws.tx.m.vmu.RUnlock()
+
+	if sc, ok := ws.tx.m.commits[ws.name]; ok {
+		if i := sc.keys.Get(&keyHistory{k: k}); i != nil {
+			if e, ok := i.(*keyHistory).before(ws.tx.startTS); ok {
+				if e.deleted {
+					return nil, engine.ErrKeyNotFound
+				}
+				return e.v, nil
+			}
+		}
+	}
+
+	return v, err
+}
+
+func (ws *writeSet) Get(k []byte) ([]byte, error) {
+	err := ws.check()
+	if err != nil {
+		return nil, err
+	}
+
+	if i := ws.entries.Get(&writeEntry{k: k}); i != nil {
+		e := i.(*writeEntry)
+		if e.deleted {
+			return nil, engine.ErrKeyNotFound
+		}
+		return e.v, nil
+	}
+
+	if !ws.readSnapshot() {
+		return nil, engine.ErrKeyNotFound
+	}
+
+	return ws.snapshotGet(k)
+}
+
+func (ws *writeSet) Put(k, v []byte) error {
+	err := ws.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	if len(k) == 0 {
+		return errors.New("empty keys are forbidden")
+	}
+
+	if len(v) == 0 {
+		return errors.New("empty values are forbidden")
+	}
+
+	ws.entries.ReplaceOrInsert(&writeEntry{
+		k: append([]byte{}, k...),
+		v: append([]byte{}, v...),
+	})
+	return nil
+}
+
+func (ws *writeSet) Delete(k []byte) error {
+	err := ws.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	_, err = ws.Get(k)
+	if err != nil {
+		return err
+	}
+
+	ws.entries.ReplaceOrInsert(&writeEntry{
+		k:       append([]byte{}, k...),
+		deleted: true,
+	})
+	return nil
+}
+
+func (ws *writeSet) Truncate() error {
+	err := ws.checkWritable()
+	if err != nil {
+		return err
+	}
+
+	ws.clear()
+	return nil
+}
+
+func (ws *writeSet) NextSequence() (uint64, error) {
+	err := ws.checkWritable()
+	if err != nil {
+		return 0, err
+	}
+
+	return ws.tx.m.nextSequence(ws.name), nil
+}
+
+// Iterator returns an iterator that merges the changes of the transaction
+// with the content of the snapshot.
+// The iterator is not affected by the changes made after it was positioned
+// by a call to Seek.
+// Read-only transactions have no changes: their iterators only read the snapshot,
+// and can be used concurrently.
+func (ws *writeSet) Iterator(opts engine.IteratorOptions) engine.Iterator {
+	if ws.tx.readOnly {
+		return &snapshotIterator{ws: ws, reverse: opts.Reverse}
+	}
+
+	return &mergeIterator{
+		ws:      ws,
+		reverse: opts.Reverse,
+	}
+}
+
+// mergeIterator iterates over the changes of a write set and the
+// content of the snapshot at the same time.
+// Changes are read in batches from a clone of the btree, which
+// is unaffected by subsequent writes.
+type mergeIterator struct {
+	ws      *writeSet
+	reverse bool
+
+	base     engine.Iterator
+	fromBase bool
+	item     engine.Item
+	err      error
+
+	entries   *btree.BTree
+	batch     []*writeEntry
+	pos       int
+	exhausted bool
+}
+
+func (it *mergeIterator) Seek(pivot []byte) {
+	it.err = it.ws.check()
+	if it.err != nil {
+		return
+	}
+
+	it.entries = it.ws.entries.Clone()
+	it.loadEntries(pivot, false)
+
+	it.base = nil
+	if it.ws.readSnapshot() {
+		it.base = &snapshotIterator{ws: it.ws, reverse: it.reverse}
+		it.base.Seek(pivot)
+	}
+
+	it.settle()
+}
+
+// loadEntries reads the next batch of entries, starting from the given key.
+func (it *mergeIterator) loadEntries(from []byte, skipFrom bool) {
+	it.batch = it.batch[:0]
+	it.pos = 0
+	it.exhausted = true
+
+	fn := func(i btree.Item) bool {
+		e := i.(*writeEntry)
+		if skipFrom && bytes.Equal(e.k, from) {
+			return true
+		}
+
+		it.batch = append(it.batch, e)
+		if len(it.batch) == writeSetBatchSize {
+			it.exhausted = false
+			return false
+		}
+		return true
+	}
+
+	var pivot btree.Item
+	if len(from) > 0 {
+		pivot = &writeEntry{k: from}
+	}
+	iterateTree(it.entries, pivot, it.reverse, fn)
+}
+
+// iterateTree calls fn on the items of the btree, in ascending order or in
+// descending order if reverse is true, starting from the pivot if not nil.
+func iterateTree(tr *btree.BTree, pivot btree.Item, reverse bool, fn btree.ItemIterator) {
+	switch {
+	case reverse && pivot == nil:
+		tr.Descend(fn)
+	case reverse:
+		tr.DescendLessOrEqual(pivot, fn)
+	case pivot == nil:
+		tr.Ascend(fn)
+	default:
+		tr.AscendGreaterOrEqual(pivot, fn)
+	}
+}
+
+// entry returns the current entry of the write set, or nil.
+func (it *mergeIterator) entry() *writeEntry {
+	if it.pos < len(it.batch) {
+		return it.batch[it.pos]
+	}
+
+	if it.exhausted || len(it.batch) == 0 {
+		return nil
+	}
+
+	it.loadEntries(it.batch[len(it.batch)-1].k, true)
+	return it.entry()
+}
+
+// settle positions the iterator on the smallest key (or the greatest
+// if reversed) of both sources. Changes hide the snapshot values of the same key.
+func (it *mergeIterator) settle() {
+	for {
+		e := it.entry()
+		baseValid := it.base != nil && it.base.Valid()
+
+		if e == nil {
+			it.item, it.fromBase = nil, false
+			if baseValid {
+				it.item, it.fromBase = it.base.Item(), true
+			}
+			return
+		}
+
+		cmp := -1
+		if baseValid {
+			cmp = bytes.Compare(e.k, it.base.Item().Key())
+			if it.reverse {
+				cmp = -cmp
+			}
+		}
+
+		if cmp > 0 {
+			it.item, it.fromBase = it.base.Item(), true
+			return
+		}
+
+		if cmp == 0 {
+			it.base.Next()
+		}
+
+		if e.deleted {
+			it.pos++
+			continue
+		}
+
+		it.item, it.fromBase = e, false
+		return
+	}
+}
+
+func (it *mergeIterator) Next() {
+	if it.fromBase {
+		it.base.Next()
+	} else {
+		it.pos++
+	}
+
+	it.settle()
+}
+
+func (it *mergeIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+
+	if it.base != nil {
+		return it.base.Err()
+	}
+
+	return nil
+}
+
+func (it *mergeIterator) Valid() bool {
+	return it.item != nil && it.Err() == nil
+}
+
+func (it *mergeIterator) Item() engine.Item {
+	return it.item
+}
+
+func (it *mergeIterator) Close() error {
+	return nil
+}
+
+// snapshotIterator iterates over the content of a store in the snapshot of a transaction.
+// Keys are read from the engine in batches, each using its own engine transaction, and the
+// keys modified after the snapshot was taken are replaced by their previous value.
+type snapshotIterator struct {
+	ws      *writeSet
+	reverse bool
+
+	batch []*writeEntry
+	pos   int
+	// key from which the next batch is read, excluded.
+	next      []byte
+	exhausted bool
+	err       error
+}
+
+func (it *snapshotIterator) Seek(pivot []byte) {
+	it.load(pivot, false)
+}
+
+// load reads the next keys of the snapshot, starting from the given key.
+func (it *snapshotIterator) load(from []byte, skipFrom bool) {
+	for {
+		it.batch, it.pos = it.batch[:0], 0
+
+		it.err = it.ws.tx.check()
+		if it.err != nil {
+			return
+		}
+
+		var items []*writeEntry
+		var bound []byte
+		items, it.exhausted, it.err = it.loadEngine(from, skipFrom)
+		if it.err != nil {
+			return
+		}
+		if !it.exhausted {
+			bound = items[len(items)-1].k
+		}
+
+		// the engine must be read first: the previous value of the keys
+		// is published before the changes of a commit are written.
+		changes, full := it.loadChanges(from, skipFrom, bound)
+		if full {
+			bound = changes[len(changes)-1].k
+			it.exhausted = false
+			for len(items) > 0 && it.after(items[len(items)-1].k, bound) {
+				items = items[:len(items)-1]
+			}
+		}
+
+		it.merge(items, changes)
+		it.next = bound
+		if len(it.batch) > 0 || it.exhausted {
+			return
+		}
+
+		from, skipFrom = bound, true
+	}
+}
+
+// after reports whether a comes after b in the order of iteration.
+func (it *snapshotIterator) after(a, b []byte) bool {
+	cmp := bytes.Compare(a, b)
+	if it.reverse {
+		return cmp < 0
+	}
+	return cmp > 0
+}
+
+// loadEngine reads a batch of keys from the engine. It reports whether
+// the end of the store was reached.
+func (it *snapshotIterator) loadEngine(from []byte, skipFrom bool) ([]*writeEntry, bool, error) {
+	var items []*writeEntry
+	exhausted := true
+
+	err := it.ws.tx.m.view(it.ws.tx.ctx, func(ntx engine.Transaction) error {
+		st, err := ntx.GetStore([]byte(it.ws.name))
+		if err != nil {
+			return err
+		}
+
+		eit := st.Iterator(engine.IteratorOptions{Reverse: it.reverse})
+		defer eit.Close()
+
+		for eit.Seek(from); eit.Valid(); eit.Next() {
+			item := eit.Item()
+			if skipFrom && bytes.Equal(item.Key(), from) {
+				continue
+			}
+
+			if len(items) == snapshotBatchSize {
+				exhausted = false
+				break
+			}
+
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				return err
+			}
+			items = append(items, &writeEntry{k: append([]byte{}, item.Key()...), v: v})
+		}
+
+		return eit.Err()
+	})
+
+	return items, exhausted, err
+}
+
+// loadChanges returns the previous value of the keys modified after the snapshot was taken,
+// starting from the given key and up to bound, if not nil. It reports whether more changes
+// could have been returned.
+func (it *snapshotIterator) loadChanges(from []byte, skipFrom bool, bound []byte) ([]*writeEntry, bool) {
+	m := it.ws.tx.m
+	m.vmu.RLock()
+	defer m.vmu.RUnlock()
+
+	sc, ok := m.commits[it.ws.name]
+	if !ok {
+		return nil, false
+	}
+
+	var changes []*writeEntry
+	full := false
+
+	var pivot btree.Item
+	if len(from) > 0 {
+		pivot = &keyHistory{k: from}
+	}
+	iterateTree(sc.keys, pivot, it.reverse, func(i btree.Item) bool {
+		h := i.(*keyHistory)
+		if skipFrom && bytes.Equal(h.k, from) {
+			return true
+		}
+		if bound != nil && it.after(h.k, bound) {
+			return false
+		}
+
+		e, ok := h.before(it.ws.tx.startTS)
+		if !ok {
+			return true
+		}
+
+		changes = append(changes, e)
+		if len(changes) == snapshotBatchSize {
+			full = true
+			return false
+		}
+		return true
+	})
+
+	return changes, full
+}
+
+// merge sets the batch to the keys of the engine, replaced
+// by their previous value if they were modified.
+func (it *snapshotIterator) merge(items, changes []*writeEntry) {
+	for len(items) > 0 || len(changes) > 0 {
+		var e *writeEntry
+
+		switch {
+		case len(changes) == 0:
+			e, items = items[0], items[1:]
+		case len(items) == 0:
+			e, changes = changes[0], changes[1:]
+		case bytes.Equal(items[0].k, changes[0].k):
+			e, items, changes = changes[0], items[1:], changes[1:]
+		case it.after(items[0].k, changes[0].k):
+			e, changes = changes[0], changes[1:]
+		default:
+			e, items = items[0], items[1:]
+		}
+
+		if !e.deleted {
+			it.batch = append(it.batch, e)
+		}
+	}
+}
+
+func (it *snapshotIterator) Next() {
+	it.pos++
+	if it.pos < len(it.batch) || it.exhausted {
+		return
+	}
+
+	it.load(it.next, true)
+}
+
+func (it *snapshotIterator) Err() error {
+	return it.err
+}
+
+func (it *snapshotIterator) Valid() bool {
+	return it.err == nil && it.pos < len(it.batch)
+}
+
+func (it *snapshotIterator) Item() engine.Item {
+	return it.batch[it.pos]
+}
+
+func (it *snapshotIterator) Close() error {
+	return nil
+}
@@ -0,0 +1,576 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/document"
+	"github.com/genjidb/genji/document/encoding/msgpack"
+	"github.com/genjidb/genji/engine/boltengine"
+	"github.com/genjidb/genji/engine/memoryengine"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentWriters(t *testing.T) {
+	newDB := func(t *testing.T) (*database.Database, func()) {
+		db, cleanup := newTestDB(t)
+
+		update(t, db, func(tx *database.Transaction) error {
+			for _, name := range []string{"a", "b"} {
+				err := tx.CreateTable(name, nil)
+				if err != nil {
+					return err
+				}
+			}
+
+			tb, err := tx.GetTable("a")
+			if err != nil {
+				return err
+			}
+			_, err = tb.Insert(newDocument())
+			return err
+		})
+
+		return db, cleanup
+	}
+
+	firstKey := func(t *testing.T, tx *database.Transaction, tableName string) []byte {
+		tb, err := tx.GetTable(tableName)
+		require.NoError(t, err)
+
+		errStop := errors.New("stop")
+		var key []byte
+		err = tb.Iterate(func(d document.Document) error {
+			key = d.(document.Keyer).RawKey()
+			return errStop
+		})
+		require.Equal(t, errStop, err)
+		return key
+	}
+
+	t.Run("Different tables", func(t *testing.T) {
+		db, cleanup := newDB(t)
+		defer cleanup()
+
+		tx1, err := db.Begin(true)
+		require.NoError(t, err)
+		defer tx1.Rollback()
+
+		tx2, err := db.Begin(true)
+		require.NoError(t, err)
+		defer tx2.Rollback()
+
+		for tx, name := range map[*database.Transaction]string{tx1: "a", tx2: "b"} {
+			tb, err := tx.GetTable(name)
+			require.NoError(t, err)
+			_, err = tb.Insert(newDocument())
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, tx1.Commit())
+		require.NoError(t, tx2.Commit())
+
+		tx, err := db.Begin(false)
+		require.NoError(t, err)
+		defer tx.Rollback()
+		require.Equal(t, 2, countDocuments(t, tx, "a"))
+		require.Equal(t, 1, countDocuments(t, tx, "b"))
+	})
+
+	t.Run("Different keys", func(t *testing.T) {
+		db, cleanup := newDB(t)
+		defer cleanup()
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				tx, err := db.Begin(true)
+				if err != nil {
+					errs <- err
+					return
+				}
+				defer tx.Rollback()
+
+				tb, err := tx.GetTable("b")
+				if err == nil {
+					_, err = tb.Insert(newDocument())
+				}
+				if err == nil {
+					err = tx.Commit()
+				}
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		tx, err := db.Begin(false)
+		require.NoError(t, err)
+		defer tx.Rollback()
+		require.Equal(t, 10, countDocuments(t, tx, "b"))
+	})
+
+	t.Run("Same key", func(t *testing.T) {
+		db, cleanup := newDB(t)
+		defer cleanup()
+
+		tx1, err := db.Begin(true)
+		require.NoError(t, err)
+		defer tx1.Rollback()
+
+		tx2, err := db.Begin(true)
+		require.NoError(t, err)
+		defer tx2.Rollback()
+
+		for tx, v := range map[*database.Transaction]string{tx1: "tx1", tx2: "tx2"} {
+			tb, err := tx.GetTable("a")
+			require.NoError(t, err)
+			err = tb.Replace(firstKey(t, tx, "a"), document.NewFieldBuffer().Add("fielda", document.NewTextValue(v)))
+			require.NoError(t, err)
+		}
+
+		require.NoError(t, tx1.Commit())
+		err = tx2.Commit()
+		require.True(t, errors.Is(err, database.ErrTransactionConflict))
+
+		// the transaction was rolled back and can be retried.
+		require.Error(t, tx2.Rollback())
+		tx2, err = db.Begin(true)
+		require.NoError(t, err)
+		defer tx2.Rollback()
+
+		tb, err := tx2.GetTable("a")
+		require.NoError(t, err)
+		d, err := tb.GetDocument(firstKey(t, tx2, "a"))
+		require.NoError(t, err)
+		v, err := d.GetByField("fielda")
+		require.NoError(t, err)
+		require.Equal(t, document.NewTextValue("tx1"), v)
+	})
+
+	t.Run("Truncated table", func(t *testing.T) {
+		db, cleanup := newDB(t)
+		defer cleanup()
+
+		tx1, err := db.Begin(true)
+		require.NoError(t, err)
+		defer tx1.Rollback()
+
+		tb, err := tx1.GetTable("a")
+		require.NoError(t, err)
+		_, err = tb.Insert(newDocument())
+		require.NoError(t, err)
+
+		tx2, err := db.Begin(true)
+		require.NoError(t, err)
+		defer tx2.Rollback()
+
+		tb, err = tx2.GetTable("a")
+		require.NoError(t, err)
+		require.NoError(t, tb.Truncate())
+		require.NoError(t, tx2.Commit())
+
+		err = tx1.Commit()
+		require.True(t, errors.Is(err, database.ErrTransactionConflict))
+	})
+
+	t.Run("Schema changes", func(t *testing.T) {
+		db, cleanup := newDB(t)
+		defer cleanup()
+
+		tx1, err := db.Begin(true)
+		require.NoError(t, err)
+		defer tx1.Rollback()
+
+		// schema changes wait for the running transactions.
+		done := make(chan error)
+		go func() {
+			tx, err := db.Begin(true)
+			if err != nil {
+				done <- err
+				return
+			}
+			defer tx.Rollback()
+
+			err = tx.CreateTable("c", nil)
+			if err == nil {
+				err = tx.Commit()
+			}
+			done <- err
+		}()
+
+		select {
+		case err = <-done:
+			t.Fatalf("table created while a transaction is running: %v", err)
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		tb, err := tx1.GetTable("b")
+		require.NoError(t, err)
+		_, err = tb.Insert(newDocument())
+		require.NoError(t, err)
+		require.NoError(t, tx1.Commit())
+		require.NoError(t, <-done)
+
+		tx, err := db.Begin(false)
+		require.NoError(t, err)
+		defer tx.Rollback()
+		_, err = tx.GetTable("c")
+		require.NoError(t, err)
+	})
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	update(t, db, func(tx *database.Transaction) error {
+		return tx.CreateTable("test", nil)
+	})
+
+	tx1, err := db.Begin(true)
+	require.NoError(t, err)
+	defer tx1.Rollback()
+
+	update(t, db, func(tx *database.Transaction) error {
+		tb, err := tx.GetTable("test")
+		if err != nil {
+			return err
+		}
+		_, err = tb.Insert(newDocument())
+		return err
+	})
+
+	// changes commited after the transaction started are not visible.
+	require.Equal(t, 0, countDocuments(t, tx1, "test"))
+
+	// changes of the transaction are visible to itself only.
+	tb, err := tx1.GetTable("test")
+	require.NoError(t, err)
+	_, err = tb.Insert(newDocument())
+	require.NoError(t, err)
+	require.Equal(t, 1, countDocuments(t, tx1, "test"))
+
+	tx2, err := db.Begin(false)
+	require.NoError(t, err)
+	require.Equal(t, 1, countDocuments(t, tx2, "test"))
+	require.NoError(t, tx2.Rollback())
+
+	require.NoError(t, tx1.Commit())
+
+	tx2, err = db.Begin(false)
+	require.NoError(t, err)
+	defer tx2.Rollback()
+	require.Equal(t, 2, countDocuments(t, tx2, "test"))
+}
+
+func TestSequencesReload(t *testing.T) {
+	ng := memoryengine.NewEngine()
+	defer ng.Close()
+
+	for i := 0; i < 2; i++ {
+		db, err := database.New(context.Background(), ng, database.Options{Codec: msgpack.NewCodec()})
+		require.NoError(t, err)
+
+		update(t, db, func(tx *database.Transaction) error {
+			if i == 0 {
+				err := tx.CreateTable("test", nil)
+				if err != nil {
+					return err
+				}
+			}
+
+			tb, err := tx.GetTable("test")
+			if err != nil {
+				return err
+			}
+			for j := 0; j < 3; j++ {
+				_, err = tb.Insert(newDocument())
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+
+	db, err := database.New(context.Background(), ng, database.Options{Codec: msgpack.NewCodec()})
+	require.NoError(t, err)
+
+	tx, err := db.Begin(false)
+	require.NoError(t, err)
+	defer tx.Rollback()
+	require.Equal(t, 6, countDocuments(t, tx, "test"))
+}
+
+func newBoltTestDB(t *testing.T) *database.Database {
+	ng, err := boltengine.NewEngine(filepath.Join(t.TempDir(), "test.db"), 0o600, nil)
+	require.NoError(t, err)
+
+	db, err := database.New(context.Background(), ng, database.Options{Codec: msgpack.NewCodec()})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	return db
+}
+
+func TestBoltTransactions(t *testing.T) {
+	t.Run("Concurrent increments", func(t *testing.T) {
+		db := newBoltTestDB(t)
+
+		var key []byte
+		update(t, db, func(tx *database.Transaction) error {
+			err := tx.CreateTable("test", nil)
+			if err != nil {
+				return err
+			}
+
+			tb, err := tx.GetTable("test")
+			if err != nil {
+				return err
+			}
+			d, err := tb.Insert(document.NewFieldBuffer().Add("n", document.NewDoubleValue(0)))
+			if err != nil {
+				return err
+			}
+			key = d.(document.Keyer).RawKey()
+			return nil
+		})
+
+		increment := func() error {
+			tx, err := db.Begin(true)
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+
+			tb, err := tx.GetTable("test")
+			if err != nil {
+				return err
+			}
+			d, err := tb.GetDocument(key)
+			if err != nil {
+				return err
+			}
+			v, err := d.GetByField("n")
+			if err != nil {
+				return err
+			}
+			err = tb.Replace(key, document.NewFieldBuffer().Add("n", document.NewDoubleValue(v.V.(float64)+1)))
+			if err != nil {
+				return err
+			}
+			return tx.Commit()
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 8)
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for j := 0; j < 50; j++ {
+					err := increment()
+					for errors.Is(err, database.ErrTransactionConflict) {
+						err = increment()
+					}
+					if err != nil {
+						errs <- err
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		tx, err := db.Begin(false)
+		require.NoError(t, err)
+		defer tx.Rollback()
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+		d, err := tb.GetDocument(key)
+		require.NoError(t, err)
+		v, err := d.GetByField("n")
+		require.NoError(t, err)
+		require.Equal(t, document.NewDoubleValue(400), v)
+	})
+
+	t.Run("File growth", func(t *testing.T) {
+		db := newBoltTestDB(t)
+
+		update(t, db, func(tx *database.Transaction) error {
+			return tx.CreateTable("test", nil)
+		})
+
+		// transactions opened by the same goroutine must not
+		// prevent the commit from growing the database.
+		rw, err := db.Begin(true)
+		require.NoError(t, err)
+		defer rw.Rollback()
+		ro, err := db.Begin(false)
+		require.NoError(t, err)
+		defer ro.Rollback()
+
+		done := make(chan error, 1)
+		go func() {
+			done <- func() error {
+				tx, err := db.Begin(true)
+				if err != nil {
+					return err
+				}
+				defer tx.Rollback()
+
+				tb, err := tx.GetTable("test")
+				if err != nil {
+					return err
+				}
+				for i := 0; i < 20000; i++ {
+					_, err = tb.Insert(newDocument())
+					if err != nil {
+						return err
+					}
+				}
+				return tx.Commit()
+			}()
+		}()
+
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(30 * time.Second):
+			t.Fatal("the commit is blocked by the running transactions")
+		}
+
+		// the commit isn't visible to the transactions started before it.
+		require.Equal(t, 0, countDocuments(t, rw, "test"))
+		require.Equal(t, 0, countDocuments(t, ro, "test"))
+		require.NoError(t, rw.Commit())
+		require.NoError(t, ro.Rollback())
+
+		tx, err := db.Begin(false)
+		require.NoError(t, err)
+		defer tx.Rollback()
+		require.Equal(t, 20000, countDocuments(t, tx, "test"))
+	})
+
+	t.Run("Snapshot", func(t *testing.T) {
+		db := newBoltTestDB(t)
+
+		var keys [][]byte
+		update(t, db, func(tx *database.Transaction) error {
+			err := tx.CreateTable("test", nil)
+			if err != nil {
+				return err
+			}
+
+			tb, err := tx.GetTable("test")
+			if err != nil {
+				return err
+			}
+			for i := 0; i < 1000; i++ {
+				d, err := tb.Insert(document.NewFieldBuffer().Add("n", document.NewDoubleValue(float64(i))))
+				if err != nil {
+					return err
+				}
+				keys = append(keys, d.(document.Keyer).RawKey())
+			}
+			return nil
+		})
+
+		sum := func(tx *database.Transaction, reverse bool) (n int, total float64) {
+			tb, err := tx.GetTable("test")
+			require.NoError(t, err)
+
+			fn := func(d document.Document) error {
+				v, err := d.GetByField("n")
+				if err != nil {
+					return err
+				}
+				n++
+				total += v.V.(float64)
+				return nil
+			}
+			if reverse {
+				err = tb.DescendLessOrEqual(document.Value{}, fn)
+			} else {
+				err = tb.AscendGreaterOrEqual(document.Value{}, fn)
+			}
+			require.NoError(t, err)
+			return n, total
+		}
+
+		ro, err := db.Begin(false)
+		require.NoError(t, err)
+		defer ro.Rollback()
+		rw, err := db.Begin(true)
+		require.NoError(t, err)
+		defer rw.Rollback()
+
+		// delete the even documents, update the others and add new ones.
+		update(t, db, func(tx *database.Transaction) error {
+			tb, err := tx.GetTable("test")
+			if err != nil {
+				return err
+			}
+			for i, k := range keys {
+				if i%2 == 0 {
+					err = tb.Delete(k)
+				} else {
+					err = tb.Replace(k, document.NewFieldBuffer().Add("n", document.NewDoubleValue(-1)))
+				}
+				if err != nil {
+					return err
+				}
+			}
+			for i := 0; i < 500; i++ {
+				_, err = tb.Insert(document.NewFieldBuffer().Add("n", document.NewDoubleValue(1)))
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		for _, tx := range []*database.Transaction{ro, rw} {
+			for _, reverse := range []bool{false, true} {
+				n, total := sum(tx, reverse)
+				require.Equal(t, 1000, n)
+				require.Equal(t, float64(999*1000/2), total)
+			}
+
+			tb, err := tx.GetTable("test")
+			require.NoError(t, err)
+			d, err := tb.GetDocument(keys[10])
+			require.NoError(t, err)
+			v, err := d.GetByField("n")
+			require.NoError(t, err)
+			require.Equal(t, document.NewDoubleValue(10), v)
+		}
+
+		tx, err := db.Begin(false)
+		require.NoError(t, err)
+		defer tx.Rollback()
+		n, total := sum(tx, false)
+		require.Equal(t, 1000, n)
+		require.Equal(t, float64(0), total)
+	})
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"container/list"
+	"sync"
+)
+
+// DefaultPlanCacheSize is the number of queries kept by the plan cache
+// if no size is specified in the options.
+const DefaultPlanCacheSize = 256
+
+// PlanCache is an LRU cache of parsed and prepared queries, indexed by their text.
+// Queries are stored as interface{} since they are parsed and planned
+// by packages that depend on this one.
+// The cache is invalidated every time the catalog is modified.
+type PlanCache struct {
+	mu      sync.Mutex
+	size    int
+	catalog *Catalog
+	// version of the catalog when the entries were added
+	version uint64
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+type planCacheEntry struct {
+	key   string
+	value interface{}
+}
+
+// NewPlanCache creates a cache keeping at most size queries.
+// The cache is invalidated when the given catalog is modified.
+func NewPlanCache(catalog *Catalog, size int) *PlanCache {
+	return &PlanCache{
+		size:    size,
+		catalog: catalog,
+		version: catalog.Version(),
+		ll:      list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get returns the query cached for the given text, if any.
+func (c *PlanCache) Get(key string) (interface{}, bool) {
+	if c == nil || c.size <= 0 {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkVersion()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.ll.MoveToFront(e)
+	return e.Value.(*planCacheEntry).value, true
+}
+
+// Put adds the query to the cache, evicting the least recently
+// used query if the cache is full.
+func (c *PlanCache) Put(key string, value interface{}) {
+	if c == nil || c.size <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkVersion()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*planCacheEntry).value = value
+		c.ll.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.ll.PushFront(&planCacheEntry{key: key, value: value})
+
+	if c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.entries, e.Value.(*planCacheEntry).key)
+	}
+}
+
+// Len returns the number of queries in the cache.
+func (c *PlanCache) Len() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkVersion()
+
+	return c.ll.Len()
+}
+
+// checkVersion removes every entry if the catalog was modified
+// since they were added.
+// It must be called with the lock held.
+func (c *PlanCache) checkVersion() {
+	version := c.catalog.Version()
+	if version == c.version {
+		return
+	}
+
+	c.version = version
+	c.ll.Init()
+	c.entries = make(map[string]*list.Element)
+}
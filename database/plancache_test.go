@@ -0,0 +1,59 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/genjidb/genji/database"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanCache(t *testing.T) {
+	t.Run("Should evict the least recently used entries", func(t *testing.T) {
+		c := database.NewPlanCache(database.NewCatalog(), 2)
+
+		c.Put("a", 1)
+		c.Put("b", 2)
+
+		v, ok := c.Get("a")
+		require.True(t, ok)
+		require.Equal(t, 1, v)
+
+		c.Put("c", 3)
+		require.Equal(t, 2, c.Len())
+
+		_, ok = c.Get("b")
+		require.False(t, ok)
+		v, ok = c.Get("a")
+		require.True(t, ok)
+		require.Equal(t, 1, v)
+		v, ok = c.Get("c")
+		require.True(t, ok)
+		require.Equal(t, 3, v)
+	})
+
+	t.Run("Should be disabled if the size is negative", func(t *testing.T) {
+		c := database.NewPlanCache(database.NewCatalog(), -1)
+
+		c.Put("a", 1)
+		_, ok := c.Get("a")
+		require.False(t, ok)
+		require.Equal(t, 0, c.Len())
+	})
+
+	t.Run("Should be invalidated when the catalog changes", func(t *testing.T) {
+		db, cleanup := newTestDB(t)
+		defer cleanup()
+
+		c := db.PlanCache()
+		c.Put("a", 1)
+		require.Equal(t, 1, c.Len())
+
+		update(t, db, func(tx *database.Transaction) error {
+			return tx.CreateTable("test", nil)
+		})
+
+		_, ok := c.Get("a")
+		require.False(t, ok)
+		require.Equal(t, 0, c.Len())
+	})
+}
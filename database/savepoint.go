@@ -0,0 +1,288 @@
+package database
+
+import (
+	"errors"
+
+	"github.com/genjidb/genji/engine"
+	"github.com/genjidb/genji/stringutil"
+)
+
+// ErrSavepointNotFound is returned when releasing or rolling back to a savepoint that doesn't exist.
+var ErrSavepointNotFound = errors.New("savepoint not found")
+
+// A savepoint marks a position in the undo log of a transaction.
+type savepoint struct {
+	name string
+	// number of entries of the undo log when the savepoint was created.
+	entries int
+	// number of rollback hooks when the savepoint was created.
+	hooks int
+	// number of recorded changes when the savepoint was created.
+	changes int
+}
+
+// Savepoint creates a savepoint with the given name.
+// Changes made after the savepoint can be canceled with RollbackToSavepoint
+// without canceling the rest of the transaction.
+// If a savepoint with the same name already exists, the new one hides it until it is released.
+func (tx *Transaction) Savepoint(name string) error {
+	tx.savepoints = append(tx.savepoints, savepoint{
+		name:    name,
+		entries: len(tx.undo.entries),
+		hooks:   len(tx.onRollbackHooks),
+		changes: len(tx.changes),
+	})
+	tx.undo.enabled = true
+
+	return nil
+}
+
+// ReleaseSavepoint destroys the savepoint with the given name, and every savepoint created after it.
+// Changes made after the savepoint are kept.
+func (tx *Transaction) ReleaseSavepoint(name string) error {
+	i, err := tx.getSavepoint(name)
+	if err != nil {
+		return err
+	}
+
+	tx.savepoints = tx.savepoints[:i]
+
+	// changes only need to be recorded if there are savepoints to roll back to.
+	if len(tx.savepoints) == 0 {
+		tx.undo.entries = nil
+		tx.undo.enabled = false
+	}
+
+	return nil
+}
+
+// RollbackToSavepoint cancels every change made after the savepoint with the given name
+// and destroys the savepoints created after it.
+// The savepoint itself is kept and can be rolled back to again.
+func (tx *Transaction) RollbackToSavepoint(name string) error {
+	i, err := tx.getSavepoint(name)
+	if err != nil {
+		return err
+	}
+	sp := tx.savepoints[i]
+
+	err = tx.undo.rollback(sp.entries)
+	if err != nil {
+		return err
+	}
+
+	for j := len(tx.onRollbackHooks) - 1; j >= sp.hooks; j-- {
+		tx.onRollbackHooks[j]()
+	}
+	tx.onRollbackHooks = tx.onRollbackHooks[:sp.hooks]
+	tx.changes = tx.changes[:sp.changes]
+
+	tx.savepoints = tx.savepoints[:i+1]
+	return nil
+}
+
+// getSavepoint returns the index of the most recent savepoint with the given name.
+func (tx *Transaction) getSavepoint(name string) (int, error) {
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if tx.savepoints[i].name == name {
+			return i, nil
+		}
+	}
+
+	return 0, stringutil.Errorf("%w: %q", ErrSavepointNotFound, name)
+}
+
+type undoOp uint8
+
+const (
+	// restore the previous value of a key, or delete it if it wasn't found.
+	undoRestore undoOp = iota + 1
+	// drop a store that was created.
+	undoDropStore
+	// create a store that was dropped.
+	undoCreateStore
+)
+
+type undoEntry struct {
+	op    undoOp
+	store []byte
+	key   []byte
+	// previous value of the key, if found.
+	value []byte
+	found bool
+}
+
+// undoLog is an engine.Transaction that records the changes made to the stores
+// while savepoints exist, so that they can be canceled without rolling back the
+// engine transaction.
+type undoLog struct {
+	engine.Transaction
+
+	enabled bool
+	entries []undoEntry
+}
+
+func (u *undoLog) record(e undoEntry) {
+	u.entries = append(u.entries, e)
+}
+
+// rollback cancels the changes recorded after the n-th entry, in reverse order.
+func (u *undoLog) rollback(n int) error {
+	for i := len(u.entries) - 1; i >= n; i-- {
+		e := u.entries[i]
+
+		var err error
+		switch e.op {
+		case undoRestore:
+			var st engine.Store
+			st, err = u.Transaction.GetStore(e.store)
+			if err != nil {
+				break
+			}
+			if !e.found {
+				err = st.Delete(e.key)
+				if err == engine.ErrKeyNotFound {
+					err = nil
+				}
+			} else {
+				err = st.Put(e.key, e.value)
+			}
+		case undoDropStore:
+			err = u.Transaction.DropStore(e.store)
+		case undoCreateStore:
+			err = u.Transaction.CreateStore(e.store)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	u.entries = u.entries[:n]
+	return nil
+}
+
+// recordStore records the content of the store so that it can be restored.
+func (u *undoLog) recordStore(name []byte, st engine.Store) error {
+	it := st.Iterator(engine.IteratorOptions{})
+	defer it.Close()
+
+	for it.Seek(nil); it.Valid(); it.Next() {
+		item := it.Item()
+		v, err := item.ValueCopy(nil)
+		if err != nil {
+			return err
+		}
+
+		u.record(undoEntry{
+			op:    undoRestore,
+			store: name,
+			key:   append([]byte{}, item.Key()...),
+			value: v,
+			found: true,
+		})
+	}
+
+	return it.Err()
+}
+
+// GetStore returns a store that records its changes in the undo log.
+func (u *undoLog) GetStore(name []byte) (engine.Store, error) {
+	st, err := u.Transaction.GetStore(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &undoStore{Store: st, name: name, log: u}, nil
+}
+
+// CreateStore creates the store and records it in the undo log.
+func (u *undoLog) CreateStore(name []byte) error {
+	err := u.Transaction.CreateStore(name)
+	if err != nil {
+		return err
+	}
+
+	if u.enabled {
+		u.record(undoEntry{op: undoDropStore, store: name})
+	}
+
+	return nil
+}
+
+// DropStore records the content of the store in the undo log and drops it.
+func (u *undoLog) DropStore(name []byte) error {
+	if u.enabled {
+		st, err := u.Transaction.GetStore(name)
+		if err != nil {
+			return err
+		}
+
+		// the values are recorded before the creation of the store
+		// since the log is replayed in reverse order.
+		err = u.recordStore(name, st)
+		if err != nil {
+			return err
+		}
+		u.record(undoEntry{op: undoCreateStore, store: name})
+	}
+
+	return u.Transaction.DropStore(name)
+}
+
+// undoStore is an engine.Store that records its changes in the undo log.
+type undoStore struct {
+	engine.Store
+
+	name []byte
+	log  *undoLog
+}
+
+// recordKey records the current value of the key.
+func (s *undoStore) recordKey(k []byte) error {
+	v, err := s.Store.Get(k)
+	if err != nil && err != engine.ErrKeyNotFound {
+		return err
+	}
+
+	s.log.record(undoEntry{
+		op:    undoRestore,
+		store: s.name,
+		key:   append([]byte{}, k...),
+		value: append([]byte{}, v...),
+		found: err == nil,
+	})
+	return nil
+}
+
+func (s *undoStore) Put(k, v []byte) error {
+	if s.log.enabled {
+		err := s.recordKey(k)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.Store.Put(k, v)
+}
+
+func (s *undoStore) Delete(k []byte) error {
+	if s.log.enabled {
+		err := s.recordKey(k)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.Store.Delete(k)
+}
+
+func (s *undoStore) Truncate() error {
+	if s.log.enabled {
+		err := s.log.recordStore(s.name, s.Store)
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.Store.Truncate()
+}
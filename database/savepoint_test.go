@@ -0,0 +1,141 @@
+package database_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/document"
+	"github.com/stretchr/testify/require"
+)
+
+func countDocuments(t testing.TB, tx *database.Transaction, tableName string) int {
+	t.Helper()
+
+	tb, err := tx.GetTable(tableName)
+	require.NoError(t, err)
+
+	var n int
+	err = tb.Iterate(func(d document.Document) error {
+		n++
+		return nil
+	})
+	require.NoError(t, err)
+	return n
+}
+
+func TestSavepoints(t *testing.T) {
+	t.Run("Rollback to", func(t *testing.T) {
+		tb, cleanup := newTestTable(t)
+		defer cleanup()
+		tx := tb.Tx()
+
+		_, err := tb.Insert(newDocument())
+		require.NoError(t, err)
+
+		require.NoError(t, tx.Savepoint("a"))
+
+		key, err := tb.Insert(newDocument())
+		require.NoError(t, err)
+		_, err = tb.Insert(newDocument())
+		require.NoError(t, err)
+		require.Equal(t, 3, countDocuments(t, tx, "test"))
+
+		require.NoError(t, tx.RollbackToSavepoint("a"))
+		require.Equal(t, 1, countDocuments(t, tx, "test"))
+
+		// the savepoint can be rolled back to again
+		_, err = tb.Insert(newDocument())
+		require.NoError(t, err)
+		require.NoError(t, tx.RollbackToSavepoint("a"))
+		require.Equal(t, 1, countDocuments(t, tx, "test"))
+
+		_, err = tb.GetDocument(key.(document.Keyer).RawKey())
+		require.Equal(t, database.ErrDocumentNotFound, err)
+	})
+
+	t.Run("Replace and delete", func(t *testing.T) {
+		tb, cleanup := newTestTable(t)
+		defer cleanup()
+		tx := tb.Tx()
+
+		d, err := tb.Insert(newDocument())
+		require.NoError(t, err)
+		key := d.(document.Keyer).RawKey()
+
+		require.NoError(t, tx.Savepoint("a"))
+
+		err = tb.Replace(key, document.NewFieldBuffer().Add("fielda", document.NewTextValue("c")))
+		require.NoError(t, err)
+		require.NoError(t, tx.Savepoint("b"))
+		err = tb.Delete(key)
+		require.NoError(t, err)
+
+		require.NoError(t, tx.RollbackToSavepoint("b"))
+		d, err = tb.GetDocument(key)
+		require.NoError(t, err)
+		v, err := d.GetByField("fielda")
+		require.NoError(t, err)
+		require.Equal(t, document.NewTextValue("c"), v)
+
+		require.NoError(t, tx.RollbackToSavepoint("a"))
+		d, err = tb.GetDocument(key)
+		require.NoError(t, err)
+		v, err = d.GetByField("fielda")
+		require.NoError(t, err)
+		require.Equal(t, document.NewTextValue("a"), v)
+
+		// b was created after a and has been destroyed
+		err = tx.RollbackToSavepoint("b")
+		require.True(t, errors.Is(err, database.ErrSavepointNotFound))
+	})
+
+	t.Run("Release", func(t *testing.T) {
+		tb, cleanup := newTestTable(t)
+		defer cleanup()
+		tx := tb.Tx()
+
+		require.NoError(t, tx.Savepoint("a"))
+		require.NoError(t, tx.Savepoint("b"))
+		_, err := tb.Insert(newDocument())
+		require.NoError(t, err)
+
+		require.NoError(t, tx.ReleaseSavepoint("a"))
+		require.Equal(t, 1, countDocuments(t, tx, "test"))
+
+		for _, name := range []string{"a", "b"} {
+			err = tx.RollbackToSavepoint(name)
+			require.True(t, errors.Is(err, database.ErrSavepointNotFound))
+			err = tx.ReleaseSavepoint(name)
+			require.True(t, errors.Is(err, database.ErrSavepointNotFound))
+		}
+	})
+
+	t.Run("Tables", func(t *testing.T) {
+		tb, cleanup := newTestTable(t)
+		defer cleanup()
+		tx := tb.Tx()
+
+		_, err := tb.Insert(newDocument())
+		require.NoError(t, err)
+
+		require.NoError(t, tx.Savepoint("a"))
+
+		err = tx.CreateTable("other", nil)
+		require.NoError(t, err)
+		err = tx.DropTable("test")
+		require.NoError(t, err)
+
+		require.NoError(t, tx.RollbackToSavepoint("a"))
+
+		_, err = tx.GetTable("other")
+		require.True(t, errors.Is(err, database.ErrTableNotFound))
+		require.Equal(t, 1, countDocuments(t, tx, "test"))
+
+		tb, err = tx.GetTable("test")
+		require.NoError(t, err)
+		require.NoError(t, tb.Truncate())
+		require.NoError(t, tx.RollbackToSavepoint("a"))
+		require.Equal(t, 1, countDocuments(t, tx, "test"))
+	})
+}
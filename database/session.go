@@ -0,0 +1,62 @@
+package database
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrTransactionInProgress is returned when a transaction is started
+// while the session already has an explicit transaction.
+var ErrTransactionInProgress = errors.New("cannot open a transaction within a transaction")
+
+// A Session represents a client of the database, such as a connection
+// of the database/sql driver or the shell.
+// It owns the explicit transaction started with the BEGIN statement:
+// queries run within a session use that transaction until it is committed
+// or rolled back, without affecting the other sessions.
+// A session must not be used by multiple goroutines concurrently.
+type Session struct {
+	db *Database
+
+	mu sync.Mutex
+	tx *Transaction
+}
+
+// NewSession creates a session for the database.
+func (db *Database) NewSession() *Session {
+	return &Session{db: db}
+}
+
+// DB returns the database the session belongs to.
+func (s *Session) DB() *Database {
+	return s.db
+}
+
+// Tx returns the explicit transaction of the session. It returns nil if there is no
+// such transaction.
+func (s *Session) Tx() *Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.tx
+}
+
+// Close rolls back the explicit transaction of the session, if any.
+func (s *Session) Close() error {
+	tx := s.Tx()
+	if tx == nil {
+		return nil
+	}
+
+	return tx.Rollback()
+}
+
+// detach is called once the transaction attached to the session is closed.
+func (s *Session) detach(tx *Transaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tx == tx {
+		s.tx = nil
+	}
+}
@@ -0,0 +1,491 @@
+package database
+
+import (
+	"bytes"
+
+	"github.com/genjidb/genji/document"
+	"github.com/genjidb/genji/engine"
+	"github.com/genjidb/genji/stringutil"
+)
+
+// DefaultHistogramBuckets is the maximum number of buckets
+// of the histograms computed by Analyze.
+const DefaultHistogramBuckets = 32
+
+// keySamplesPerBucket is the number of keys sampled per range of keys
+// computed by Analyze.
+const keySamplesPerBucket = 64
+
+// TableStatistics holds statistics about the content of a table.
+// They are computed by the ANALYZE statement and can be used by the planner
+// to estimate the number of documents returned by an operation.
+type TableStatistics struct {
+	TableName string
+	RowCount  int64
+	// Raw keys dividing the table into ranges holding roughly
+	// the same number of documents, in ascending order.
+	Keys [][]byte
+	// Statistics of every indexed path of the table.
+	Paths []*PathStatistics
+}
+
+// GetPathStatistics returns the statistics of the given path, or nil if there are none.
+func (t *TableStatistics) GetPathStatistics(p document.Path) *PathStatistics {
+	for _, ps := range t.Paths {
+		if ps.Path.IsEqual(p) {
+			return ps
+		}
+	}
+
+	return nil
+}
+
+// ToDocument returns a document representation of the statistics.
+func (t *TableStatistics) ToDocument() document.Document {
+	buf := document.NewFieldBuffer()
+
+	buf.Add("table_name", document.NewTextValue(t.TableName))
+	buf.Add("row_count", document.NewIntegerValue(t.RowCount))
+
+	keys := document.NewValueBuffer()
+	for _, k := range t.Keys {
+		keys = keys.Append(document.NewBlobValue(k))
+	}
+	buf.Add("keys", document.NewArrayValue(keys))
+
+	paths := document.NewValueBuffer()
+	for _, ps := range t.Paths {
+		paths = paths.Append(document.NewDocumentValue(ps.toDocument()))
+	}
+	buf.Add("paths", document.NewArrayValue(paths))
+
+	return buf
+}
+
+// ScanDocument implements the document.Scanner interface.
+func (t *TableStatistics) ScanDocument(d document.Document) error {
+	v, err := d.GetByField("table_name")
+	if err != nil {
+		return err
+	}
+	t.TableName = v.V.(string)
+
+	v, err = d.GetByField("row_count")
+	if err != nil {
+		return err
+	}
+	t.RowCount = v.V.(int64)
+
+	// statistics computed by older versions don't have keys
+	v, err = d.GetByField("keys")
+	if err != nil && err != document.ErrFieldNotFound {
+		return err
+	}
+	if err == nil {
+		err = v.V.(document.Array).Iterate(func(_ int, value document.Value) error {
+			t.Keys = append(t.Keys, append([]byte(nil), value.V.([]byte)...))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	v, err = d.GetByField("paths")
+	if err != nil {
+		return err
+	}
+
+	return v.V.(document.Array).Iterate(func(_ int, value document.Value) error {
+		var ps PathStatistics
+		err := ps.scanDocument(value.V.(document.Document))
+		if err != nil {
+			return err
+		}
+
+		t.Paths = append(t.Paths, &ps)
+		return nil
+	})
+}
+
+// SplitKeys returns at most n-1 keys, taken from Keys, dividing the table
+// into n ranges holding roughly the same number of documents.
+func (t *TableStatistics) SplitKeys(n int) [][]byte {
+	buckets := len(t.Keys) + 1
+
+	var keys [][]byte
+	last := -1
+	for i := 1; i < n; i++ {
+		idx := i*buckets/n - 1
+		if idx < 0 || idx == last {
+			continue
+		}
+		keys = append(keys, t.Keys[idx])
+		last = idx
+	}
+
+	return keys
+}
+
+// keySampler samples the keys of a table, read in ascending order,
+// and returns the keys dividing them into ranges of the same size.
+// It keeps one key every step keys, doubling the step every time
+// the number of samples reaches twice the limit.
+type keySampler struct {
+	limit   int
+	samples [][]byte
+	step    int
+	n       int
+}
+
+func newKeySampler(limit int) *keySampler {
+	return &keySampler{limit: limit, step: 1}
+}
+
+func (s *keySampler) add(key []byte) {
+	if s.n%s.step == 0 {
+		s.samples = append(s.samples, append([]byte(nil), key...))
+		if len(s.samples) == 2*s.limit {
+			for i := 0; i < s.limit; i++ {
+				s.samples[i] = s.samples[2*i]
+			}
+			s.samples = s.samples[:s.limit]
+			s.step *= 2
+		}
+	}
+	s.n++
+}
+
+// split returns at most n-1 sampled keys dividing the keys into n ranges.
+func (s *keySampler) split(n int) [][]byte {
+	var keys [][]byte
+	last := 0
+	for i := 1; i < n; i++ {
+		idx := i * len(s.samples) / n
+		if idx == last {
+			continue
+		}
+		keys = append(keys, s.samples[idx])
+		last = idx
+	}
+
+	return keys
+}
+
+// PathStatistics holds statistics about the values of a path.
+type PathStatistics struct {
+	Path          document.Path
+	DistinctCount int64
+	// Histogram of the values, in ascending order.
+	// Each bucket holds roughly the same number of documents.
+	Histogram []HistogramBucket
+}
+
+// HistogramBucket holds the number of documents whose value is greater than
+// the Max of the previous bucket and lower than or equal to the Max of the bucket.
+type HistogramBucket struct {
+	Max           document.Value
+	Count         int64
+	DistinctCount int64
+
+	encodedMax []byte
+}
+
+func (ps *PathStatistics) toDocument() document.Document {
+	buf := document.NewFieldBuffer()
+
+	buf.Add("path", document.NewArrayValue(pathToArray(ps.Path)))
+	buf.Add("distinct_count", document.NewIntegerValue(ps.DistinctCount))
+
+	histogram := document.NewValueBuffer()
+	for _, b := range ps.Histogram {
+		bb := document.NewFieldBuffer().
+			Add("max", b.Max).
+			Add("count", document.NewIntegerValue(b.Count)).
+			Add("distinct_count", document.NewIntegerValue(b.DistinctCount))
+		histogram = histogram.Append(document.NewDocumentValue(bb))
+	}
+	buf.Add("histogram", document.NewArrayValue(histogram))
+
+	return buf
+}
+
+func (ps *PathStatistics) scanDocument(d document.Document) error {
+	v, err := d.GetByField("path")
+	if err != nil {
+		return err
+	}
+	ps.Path, err = arrayToPath(v.V.(document.Array))
+	if err != nil {
+		return err
+	}
+
+	v, err = d.GetByField("distinct_count")
+	if err != nil {
+		return err
+	}
+	ps.DistinctCount = v.V.(int64)
+
+	v, err = d.GetByField("histogram")
+	if err != nil {
+		return err
+	}
+
+	return v.V.(document.Array).Iterate(func(_ int, value document.Value) error {
+		bd := value.V.(document.Document)
+
+		var b HistogramBucket
+		b.Max, err = bd.GetByField("max")
+		if err != nil {
+			return err
+		}
+		b.encodedMax, err = encodeStatisticsValue(b.Max)
+		if err != nil {
+			return err
+		}
+
+		v, err := bd.GetByField("count")
+		if err != nil {
+			return err
+		}
+		b.Count = v.V.(int64)
+
+		v, err = bd.GetByField("distinct_count")
+		if err != nil {
+			return err
+		}
+		b.DistinctCount = v.V.(int64)
+
+		ps.Histogram = append(ps.Histogram, b)
+		return nil
+	})
+}
+
+// EstimateEqual returns the estimated number of documents whose value is equal to v.
+func (ps *PathStatistics) EstimateEqual(v document.Value) (float64, error) {
+	enc, err := encodeStatisticsValue(v)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, b := range ps.Histogram {
+		if bytes.Compare(enc, b.encodedMax) > 0 {
+			continue
+		}
+
+		if b.DistinctCount == 0 {
+			return 0, nil
+		}
+
+		return float64(b.Count) / float64(b.DistinctCount), nil
+	}
+
+	return 0, nil
+}
+
+// EstimateRange returns the estimated number of documents whose value is between min and max.
+// If min or max have no type, the range is unbounded on that side.
+// If only one of them has a type, only values of that type are considered.
+// Buckets that are only partially covered by the range are assumed to be half covered.
+func (ps *PathStatistics) EstimateRange(min, max document.Value) (float64, error) {
+	var encMin, encMax []byte
+	var err error
+
+	if !min.Type.IsZero() && min.V != nil {
+		encMin, err = encodeStatisticsValue(min)
+		if err != nil {
+			return 0, err
+		}
+	} else if !max.Type.IsZero() {
+		// the lowest value of that type
+		encMin = []byte{byte(statisticsValueType(max.Type))}
+	}
+
+	if !max.Type.IsZero() && max.V != nil {
+		encMax, err = encodeStatisticsValue(max)
+		if err != nil {
+			return 0, err
+		}
+	} else if !min.Type.IsZero() {
+		// greater than any value of that type
+		encMax = []byte{byte(statisticsValueType(min.Type)) + 1}
+	}
+
+	var total float64
+	var prevMax []byte
+	for _, b := range ps.Histogram {
+		lower := prevMax
+		prevMax = b.encodedMax
+
+		// the bucket is below the range
+		if encMin != nil && bytes.Compare(b.encodedMax, encMin) < 0 {
+			continue
+		}
+
+		// the bucket is above the range
+		if encMax != nil && lower != nil && bytes.Compare(lower, encMax) >= 0 {
+			break
+		}
+
+		fullyCovered := (encMin == nil || (lower != nil && bytes.Compare(lower, encMin) >= 0)) &&
+			(encMax == nil || bytes.Compare(b.encodedMax, encMax) <= 0)
+
+		if fullyCovered {
+			total += float64(b.Count)
+		} else {
+			total += float64(b.Count) / 2
+		}
+	}
+
+	return total, nil
+}
+
+// encodeStatisticsValue encodes v so that the encoded values of a histogram
+// follow the order of the values.
+// Integers are encoded as doubles so that they can be compared with
+// the numbers stored in untyped fields.
+func encodeStatisticsValue(v document.Value) ([]byte, error) {
+	if v.Type == document.IntegerValue {
+		var err error
+		v, err = v.CastAsDouble()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	err := document.NewValueEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+// statisticsValueType returns the type used to encode values of type t.
+func statisticsValueType(t document.ValueType) document.ValueType {
+	if t == document.IntegerValue {
+		return document.DoubleValue
+	}
+
+	return t
+}
+
+// histogramBuilder builds a histogram from a list of encoded values
+// received in ascending order.
+type histogramBuilder struct {
+	bucketSize int64
+	decode     func([]byte) (document.Value, error)
+
+	stats   PathStatistics
+	current HistogramBucket
+	prev    []byte
+	hasPrev bool
+}
+
+func newHistogramBuilder(p document.Path, rowCount int64, maxBuckets int, decode func([]byte) (document.Value, error)) *histogramBuilder {
+	bucketSize := rowCount / int64(maxBuckets)
+	if rowCount%int64(maxBuckets) != 0 {
+		bucketSize++
+	}
+
+	return &histogramBuilder{
+		bucketSize: bucketSize,
+		decode:     decode,
+		stats:      PathStatistics{Path: p},
+	}
+}
+
+func (h *histogramBuilder) add(val []byte) error {
+	if !h.hasPrev || !bytes.Equal(val, h.prev) {
+		// buckets are closed between two distinct values
+		// so that a value doesn't span multiple buckets.
+		if h.current.Count >= h.bucketSize {
+			err := h.closeBucket()
+			if err != nil {
+				return err
+			}
+		}
+
+		h.stats.DistinctCount++
+		h.current.DistinctCount++
+		h.prev = append(h.prev[:0], val...)
+		h.hasPrev = true
+	}
+
+	h.current.Count++
+	return nil
+}
+
+func (h *histogramBuilder) closeBucket() error {
+	if h.current.Count == 0 {
+		return nil
+	}
+
+	v, err := h.decode(h.prev)
+	if err != nil {
+		return err
+	}
+
+	h.current.Max = v
+	h.current.encodedMax, err = encodeStatisticsValue(v)
+	if err != nil {
+		return err
+	}
+
+	h.stats.Histogram = append(h.stats.Histogram, h.current)
+	h.current = HistogramBucket{}
+	return nil
+}
+
+func (h *histogramBuilder) build() (*PathStatistics, error) {
+	err := h.closeBucket()
+	if err != nil {
+		return nil, err
+	}
+
+	return &h.stats, nil
+}
+
+// statisticsStore stores the statistics of every analyzed table.
+type statisticsStore struct {
+	db *Database
+	st engine.Store
+}
+
+// Get returns the statistics of the given table.
+func (s *statisticsStore) Get(tableName string) (*TableStatistics, error) {
+	v, err := s.st.Get([]byte(tableName))
+	if err == engine.ErrKeyNotFound {
+		return nil, stringutil.Errorf("%w: %q", ErrStatisticsNotFound, tableName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var stats TableStatistics
+	err = stats.ScanDocument(s.db.Codec.NewDocument(v))
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// Replace the statistics of the table.
+func (s *statisticsStore) Replace(stats *TableStatistics) error {
+	var buf bytes.Buffer
+	enc := s.db.Codec.NewEncoder(&buf)
+	defer enc.Close()
+	err := enc.EncodeDocument(stats.ToDocument())
+	if err != nil {
+		return err
+	}
+
+	return s.st.Put([]byte(stats.TableName), buf.Bytes())
+}
+
+// Delete the statistics of the table, if any.
+func (s *statisticsStore) Delete(tableName string) error {
+	err := s.st.Delete([]byte(tableName))
+	if err == engine.ErrKeyNotFound {
+		return nil
+	}
+	return err
+}
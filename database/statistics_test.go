@@ -0,0 +1,115 @@
+package database_test
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+
+	"github.com/genjidb/genji"
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/document"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyze(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec(`
+		CREATE TABLE test(a INTEGER);
+		CREATE INDEX idx_test_a ON test(a);
+		CREATE INDEX idx_test_b ON test(b);
+	`)
+	require.NoError(t, err)
+
+	// a: 1000 distinct values
+	// b: 10 distinct values, 100 documents each
+	for i := 0; i < 1000; i++ {
+		err = db.Exec("INSERT INTO test (a, b) VALUES (?, ?)", i, i%10)
+		require.NoError(t, err)
+	}
+
+	err = db.Exec("ANALYZE test")
+	require.NoError(t, err)
+
+	update(t, db.DB, func(tx *database.Transaction) error {
+		stats, err := tx.GetTableStatistics("test")
+		require.NoError(t, err)
+		require.EqualValues(t, 1000, stats.RowCount)
+
+		// the keys divide the table into ranges of roughly the same size
+		require.Len(t, stats.Keys, database.DefaultHistogramBuckets-1)
+		tb, err := tx.GetTable("test")
+		require.NoError(t, err)
+		splits := stats.SplitKeys(4)
+		require.Len(t, splits, 3)
+		counts := make([]int, len(splits)+1)
+		err = tb.Iterate(func(d document.Document) error {
+			key := d.(document.Keyer).RawKey()
+			i := sort.Search(len(splits), func(i int) bool {
+				return bytes.Compare(splits[i], key) > 0
+			})
+			counts[i]++
+			return nil
+		})
+		require.NoError(t, err)
+		for _, c := range counts {
+			require.InDelta(t, 250, c, 50)
+		}
+
+		a := stats.GetPathStatistics(parsePath(t, "a"))
+		require.NotNil(t, a)
+		require.EqualValues(t, 1000, a.DistinctCount)
+		require.Len(t, a.Histogram, database.DefaultHistogramBuckets)
+
+		var total int64
+		for _, b := range a.Histogram {
+			total += b.Count
+		}
+		require.EqualValues(t, 1000, total)
+		require.Equal(t, document.NewIntegerValue(999), a.Histogram[len(a.Histogram)-1].Max)
+
+		n, err := a.EstimateEqual(document.NewIntegerValue(10))
+		require.NoError(t, err)
+		require.Equal(t, float64(1), n)
+
+		n, err = a.EstimateEqual(document.NewIntegerValue(5000))
+		require.NoError(t, err)
+		require.Zero(t, n)
+
+		n, err = a.EstimateRange(document.NewIntegerValue(500), document.Value{})
+		require.NoError(t, err)
+		require.InDelta(t, 500, n, 50)
+
+		n, err = a.EstimateRange(document.NewIntegerValue(100), document.NewIntegerValue(199))
+		require.NoError(t, err)
+		require.InDelta(t, 100, n, 50)
+
+		b := stats.GetPathStatistics(parsePath(t, "b"))
+		require.NotNil(t, b)
+		require.EqualValues(t, 10, b.DistinctCount)
+
+		// values of b are converted to doubles
+		n, err = b.EstimateEqual(document.NewDoubleValue(3))
+		require.NoError(t, err)
+		require.Equal(t, float64(100), n)
+
+		require.Nil(t, stats.GetPathStatistics(parsePath(t, "c")))
+
+		// statistics follow the table
+		err = tx.RenameTable("test", "test2")
+		require.NoError(t, err)
+		_, err = tx.GetTableStatistics("test")
+		require.ErrorIs(t, err, database.ErrStatisticsNotFound)
+		_, err = tx.GetTableStatistics("test2")
+		require.NoError(t, err)
+
+		err = tx.DropTable("test2")
+		require.NoError(t, err)
+		_, err = tx.GetTableStatistics("test2")
+		require.ErrorIs(t, err, database.ErrStatisticsNotFound)
+
+		return errDontCommit
+	})
+}
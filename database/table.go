@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"sync/atomic"
 
 	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/document/encoding"
@@ -46,6 +47,27 @@ func (t *Table) Name() string {
 
 // Truncate deletes all the documents from the table.
 func (t *Table) Truncate() error {
+	if t.watched() {
+		// record the deletion of every document.
+		it := t.Store.Iterator(engine.IteratorOptions{})
+		for it.Seek(nil); it.Valid(); it.Next() {
+			item := it.Item()
+			v, err := item.ValueCopy(nil)
+			if err != nil {
+				it.Close()
+				return err
+			}
+			t.recordChange(ChangeDelete, item.Key(), v, nil)
+		}
+		err := it.Err()
+		if er := it.Close(); err == nil {
+			err = er
+		}
+		if err != nil {
+			return err
+		}
+	}
+
 	return t.Store.Truncate()
 }
 
@@ -97,7 +119,7 @@ func (t *Table) Insert(d document.Document) (document.Document, error) {
 			v = document.NewNullValue()
 		}
 
-		err = idx.Set(v, key)
+		err = idx.set(v, key, fb)
 		if err != nil {
 			if err == ErrIndexDuplicateValue {
 				return nil, ErrDuplicateDocument
@@ -107,6 +129,10 @@ func (t *Table) Insert(d document.Document) (document.Document, error) {
 		}
 	}
 
+	if t.watched() {
+		t.recordChange(ChangeInsert, key, nil, buf.Bytes())
+	}
+
 	if fb, ok := d.(*document.FieldBuffer); ok {
 		fb.EncodedKey = key
 		return fb, nil
@@ -133,11 +159,22 @@ func (t *Table) Delete(key []byte) error {
 		return err
 	}
 
+	var oldValue []byte
+	watched := t.watched()
+	if watched {
+		oldValue, err = t.storedValue(key)
+		if err != nil {
+			return err
+		}
+	}
+
 	indexes := t.Indexes()
 
 	for _, idx := range indexes {
 		v, err := idx.Info.Path.GetValueFromDocument(d)
-		if err != nil {
+		if err == document.ErrFieldNotFound {
+			v = document.NewNullValue()
+		} else if err != nil {
 			return err
 		}
 
@@ -147,7 +184,16 @@ func (t *Table) Delete(key []byte) error {
 		}
 	}
 
-	return t.Store.Delete(key)
+	err = t.Store.Delete(key)
+	if err != nil {
+		return err
+	}
+
+	if watched {
+		t.recordChange(ChangeDelete, key, oldValue, nil)
+	}
+
+	return nil
 }
 
 // Replace a document by key.
@@ -177,6 +223,15 @@ func (t *Table) replace(indexes []*Index, key []byte, d document.Document) error
 		return err
 	}
 
+	var oldValue []byte
+	watched := t.watched()
+	if watched {
+		oldValue, err = t.storedValue(key)
+		if err != nil {
+			return err
+		}
+	}
+
 	// remove key from indexes
 	for _, idx := range indexes {
 		v, err := idx.Info.Path.GetValueFromDocument(old)
@@ -212,7 +267,7 @@ func (t *Table) replace(indexes []*Index, key []byte, d document.Document) error
 			v = document.NewNullValue()
 		}
 
-		err = idx.Set(v, key)
+		err = idx.set(v, key, d)
 		if err != nil {
 			if err == ErrIndexDuplicateValue {
 				return ErrDuplicateDocument
@@ -222,9 +277,49 @@ func (t *Table) replace(indexes []*Index, key []byte, d document.Document) error
 		}
 	}
 
+	if watched {
+		t.recordChange(ChangeUpdate, key, oldValue, buf.Bytes())
+	}
+
 	return nil
 }
 
+// watched returns whether the changes made to the table must be recorded
+// for the subscriptions of the database.
+func (t *Table) watched() bool {
+	return t.tx.db.feed.watches(t.name)
+}
+
+// storedValue returns a copy of the encoded document stored under key.
+func (t *Table) storedValue(key []byte) ([]byte, error) {
+	v, err := t.Store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(nil), v...), nil
+}
+
+// recordChange records a change made to the table from the encoded versions
+// of the document before and after the change.
+func (t *Table) recordChange(typ ChangeType, key, oldValue, newValue []byte) {
+	c := Change{
+		Type:  typ,
+		Table: t.name,
+		Key:   append([]byte(nil), key...),
+	}
+
+	pk := t.Info().GetPrimaryKey()
+	if oldValue != nil {
+		c.Old = &documentWithKey{Document: t.tx.db.Codec.NewDocument(oldValue), key: c.Key, pk: pk}
+	}
+	if newValue != nil {
+		c.New = &documentWithKey{Document: t.tx.db.Codec.NewDocument(newValue), key: c.Key, pk: pk}
+	}
+
+	t.tx.recordChange(c)
+}
+
 type documentWithKey struct {
 	document.Document
 
@@ -260,6 +355,7 @@ type lazilyDecodedDocument struct {
 	buf   []byte
 	codec encoding.Codec
 	pk    *FieldConstraint
+	tx    *Transaction
 }
 
 func (d *lazilyDecodedDocument) GetByField(field string) (v document.Value, err error) {
@@ -306,6 +402,7 @@ func (d *lazilyDecodedDocument) Reset() {
 func (d *lazilyDecodedDocument) copyFromItem() error {
 	var err error
 	d.buf, err = d.item.ValueCopy(d.buf)
+	atomic.AddInt64(&d.tx.decodedDocuments, 1)
 
 	return err
 }
@@ -412,6 +509,7 @@ func (t *Table) iterate(pivot document.Value, reverse bool, fn func(d document.D
 	// it during each iteration.
 	d := lazilyDecodedDocument{
 		codec: t.tx.db.Codec,
+		tx:    t.tx,
 	}
 
 	d.pk = info.GetPrimaryKey()
@@ -437,6 +535,92 @@ func (t *Table) iterate(pivot document.Value, reverse bool, fn func(d document.D
 	return nil
 }
 
+// A BatchIterator reads the documents of a range of keys of a table in batches.
+// Unlike the documents passed by the other iteration methods,
+// the documents of a batch remain valid once the next batch is read and can be
+// read concurrently.
+// The batch iterators of a read-only transaction can be used concurrently,
+// provided they are all created by the same goroutine.
+type BatchIterator struct {
+	table *Table
+	it    engine.Iterator
+	pk    *FieldConstraint
+	from  []byte
+	to    []byte
+	seek  bool
+}
+
+// NewBatchIterator returns an iterator over the documents of the table
+// whose key is greater than or equal to from and lower than to, in key order.
+// A nil boundary leaves the range open on that side.
+// The iterator must be closed after use.
+func (t *Table) NewBatchIterator(from, to []byte) *BatchIterator {
+	return &BatchIterator{
+		table: t,
+		it:    t.Store.Iterator(engine.IteratorOptions{}),
+		pk:    t.Info().GetPrimaryKey(),
+		from:  from,
+		to:    to,
+		seek:  true,
+	}
+}
+
+// Next returns a batch of at most size documents.
+// It returns an empty batch once every document of the range has been read.
+func (b *BatchIterator) Next(size int) ([]document.Document, error) {
+	if b.seek {
+		b.it.Seek(b.from)
+		b.seek = false
+	}
+
+	var batch []document.Document
+	for ; b.it.Valid() && len(batch) < size; b.it.Next() {
+		item := b.it.Item()
+		if b.to != nil && bytes.Compare(item.Key(), b.to) >= 0 {
+			break
+		}
+
+		var ic itemCopy
+		var err error
+		ic.key = append([]byte(nil), item.Key()...)
+		ic.value, err = item.ValueCopy(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		batch = append(batch, &lazilyDecodedDocument{
+			item:  &ic,
+			codec: b.table.tx.db.Codec,
+			pk:    b.pk,
+			tx:    b.table.tx,
+		})
+	}
+	if err := b.it.Err(); err != nil {
+		return nil, err
+	}
+
+	return batch, nil
+}
+
+// Close releases the resources associated with the iterator.
+func (b *BatchIterator) Close() error {
+	return b.it.Close()
+}
+
+// itemCopy is an engine.Item holding a copy of the key and value of an item,
+// which remains valid after the iterator moves.
+type itemCopy struct {
+	key, value []byte
+}
+
+func (i *itemCopy) Key() []byte {
+	return i.key
+}
+
+func (i *itemCopy) ValueCopy(buf []byte) ([]byte, error) {
+	return append(buf[:0], i.value...), nil
+}
+
 // GetDocument returns one document by key.
 func (t *Table) GetDocument(key []byte) (document.Document, error) {
 	v, err := t.Store.Get(key)
@@ -447,6 +631,8 @@ func (t *Table) GetDocument(key []byte) (document.Document, error) {
 		return nil, stringutil.Errorf("failed to fetch document %q: %w", key, err)
 	}
 
+	atomic.AddInt64(&t.tx.decodedDocuments, 1)
+
 	info := t.Info()
 
 	var d documentWithKey
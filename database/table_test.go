@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"sort"
 	"testing"
 
 	"github.com/genjidb/genji/binarysort"
@@ -98,6 +99,52 @@ func TestTableIterate(t *testing.T) {
 	})
 }
 
+// TestTableBatchIterator verifies BatchIterator behaviour.
+func TestTableBatchIterator(t *testing.T) {
+	tb, cleanup := newTestTable(t)
+	defer cleanup()
+
+	var all []string
+	for i := 0; i < 1000; i++ {
+		d, err := tb.Insert(newDocument())
+		require.NoError(t, err)
+		all = append(all, string(d.(document.Keyer).RawKey()))
+	}
+	sort.Strings(all)
+
+	keys := [][]byte{[]byte(all[250]), []byte(all[500]), []byte(all[750])}
+
+	var got []string
+	for i := 0; i <= len(keys); i++ {
+		var from, to []byte
+		if i > 0 {
+			from = keys[i-1]
+		}
+		if i < len(keys) {
+			to = keys[i]
+		}
+
+		it := tb.NewBatchIterator(from, to)
+		n := 0
+		for {
+			docs, err := it.Next(100)
+			require.NoError(t, err)
+			if len(docs) == 0 {
+				break
+			}
+			require.LessOrEqual(t, len(docs), 100)
+			for _, d := range docs {
+				got = append(got, string(d.(document.Keyer).RawKey()))
+			}
+			n += len(docs)
+		}
+		require.NoError(t, it.Close())
+		require.Equal(t, 250, n)
+	}
+
+	require.Equal(t, all, got)
+}
+
 // TestTableGetDocument verifies GetDocument behaviour.
 func TestTableGetDocument(t *testing.T) {
 	t.Run("Should fail if not found", func(t *testing.T) {
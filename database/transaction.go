@@ -1,30 +1,67 @@
 package database
 
 import (
+	"context"
+	"sync/atomic"
+	"time"
+
 	"github.com/genjidb/genji/engine"
 	"github.com/genjidb/genji/stringutil"
 )
 
 var (
-	internalPrefix     = "__genji_"
-	tableInfoStoreName = internalPrefix + "tables"
-	indexStoreName     = internalPrefix + "indexes"
+	internalPrefix      = "__genji_"
+	tableInfoStoreName  = internalPrefix + "tables"
+	indexStoreName      = internalPrefix + "indexes"
+	statisticsStoreName = internalPrefix + "statistics"
+	sequenceStoreName   = internalPrefix + "sequences"
 )
 
 // Transaction represents a database transaction. It provides methods for managing the
 // collection of tables and the transaction itself.
 // Transaction is either read-only or read/write. Read-only can be used to read tables
 // and read/write can be used to read, create, delete and modify tables.
+// Read/write transactions run concurrently and see a snapshot of the database taken
+// when they started. If two of them modify the same data, the last one to commit
+// fails with ErrTransactionConflict. Transactions modifying the schema wait for
+// the other transactions to end and prevent new ones from starting until they are done.
 type Transaction struct {
-	db       *Database
+	db *Database
+	// context passed to BeginTx.
+	ctx      context.Context
 	tx       engine.Transaction
 	writable bool
-	// if set to true, this transaction is attached to the database
-	attached bool
+	// concurrency control of read/write transactions.
+	mvcc *mvccTx
+	// set if the transaction holds the database lock.
+	locked bool
+	// set if the transaction has exclusive access to the database.
+	schemaLocked bool
+	// time spent waiting for the database lock.
+	lockWait time.Duration
+	// if set, this transaction is attached to the session
+	session *Session
+	// limits set when the transaction was created.
+	limits Limits
+
+	// changes recorded since the first savepoint.
+	undo *undoLog
+	// savepoints created with the Savepoint method, in order of creation.
+	savepoints []savepoint
+
+	// changes made to the tables watched by subscriptions.
+	changes []Change
 
 	// these functions are run after a successful rollback or commit.
 	onRollbackHooks []func()
 	onCommitHooks   []func()
+
+	// time at which the transaction was created.
+	startedAt time.Time
+
+	// number of documents read from the tables.
+	// it is updated atomically since documents can be read by parallel scans.
+	decodedDocuments int64
 }
 
 // DB returns the underlying database that created the transaction.
@@ -32,68 +69,122 @@ func (tx *Transaction) DB() *Database {
 	return tx.db
 }
 
-// Rollback the transaction. Can be used safely after commit.
-func (tx *Transaction) Rollback() error {
-	err := tx.tx.Rollback()
-	if err != nil {
-		return err
+// Limits returns the limits of a statement executed within the transaction
+// with the given context.
+func (tx *Transaction) Limits(ctx context.Context) Limits {
+	l := tx.db.Limits.merge(tx.limits)
+	// the limits of the context of the transaction are already part of tx.limits.
+	if ctx != tx.ctx {
+		l = l.merge(limitsFromContext(ctx))
 	}
 
-	defer func() {
-		if tx.writable {
-			tx.db.txmu.Unlock()
-		} else {
-			tx.db.txmu.RUnlock()
-		}
-	}()
+	return l
+}
+
+// Context returns the context the transaction was created with.
+func (tx *Transaction) Context() context.Context {
+	if tx.ctx == nil {
+		return context.Background()
+	}
 
-	if tx.attached {
-		tx.db.attachedTxMu.Lock()
-		defer tx.db.attachedTxMu.Unlock()
+	return tx.ctx
+}
 
-		if tx.db.attachedTransaction != nil {
-			tx.db.attachedTransaction = nil
-		}
+// StartedAt returns the time at which the transaction was created.
+func (tx *Transaction) StartedAt() time.Time {
+	return tx.startedAt
+}
+
+// LockWait returns the time the transaction spent waiting for other transactions:
+// to be created, to get exclusive access to the database when modifying the schema,
+// and to commit.
+func (tx *Transaction) LockWait() time.Duration {
+	if tx.mvcc != nil {
+		return tx.lockWait + tx.mvcc.commitWait
 	}
 
-	for i := len(tx.onRollbackHooks) - 1; i >= 0; i-- {
-		tx.onRollbackHooks[i]()
+	return tx.lockWait
+}
+
+// DecodedDocuments returns the number of documents read from the tables
+// since the beginning of the transaction.
+func (tx *Transaction) DecodedDocuments() int64 {
+	return atomic.LoadInt64(&tx.decodedDocuments)
+}
+
+// Rollback the transaction. Can be used safely after commit.
+func (tx *Transaction) Rollback() error {
+	err := tx.tx.Rollback()
+	if err != nil {
+		return err
 	}
 
+	tx.release(tx.onRollbackHooks)
 	return nil
 }
 
 // Commit the transaction. Calling this method on read-only transactions
 // will return an error.
+// If the commit of a read/write transaction fails, the transaction is rolled back.
 func (tx *Transaction) Commit() error {
 	err := tx.tx.Commit()
 	if err != nil {
+		if tx.writable && err != engine.ErrTransactionDiscarded {
+			tx.release(tx.onRollbackHooks)
+		}
 		return err
 	}
 
+	tx.release(tx.onCommitHooks)
+	return nil
+}
+
+// release detaches the transaction from its session, runs the given hooks
+// and releases the database lock.
+func (tx *Transaction) release(hooks []func()) {
 	defer func() {
-		if tx.writable {
-			tx.db.txmu.Unlock()
-		} else {
-			tx.db.txmu.RUnlock()
+		switch {
+		case !tx.locked:
+		case tx.schemaLocked:
+			tx.db.txlock.unlock()
+		default:
+			tx.db.txlock.runlock()
 		}
 	}()
 
-	if tx.attached {
-		tx.db.attachedTxMu.Lock()
-		defer tx.db.attachedTxMu.Unlock()
+	if tx.session != nil {
+		tx.session.detach(tx)
+	}
 
-		if tx.db.attachedTransaction != nil {
-			tx.db.attachedTransaction = nil
-		}
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i]()
 	}
+}
 
-	for i := len(tx.onCommitHooks) - 1; i >= 0; i-- {
-		tx.onCommitHooks[i]()
+// lockSchema gives the transaction exclusive access to the database, which is required
+// to modify the schema. It waits for the other transactions to end and prevents new
+// ones from starting until the transaction is done.
+func (tx *Transaction) lockSchema() error {
+	if !tx.writable || tx.schemaLocked {
+		return nil
 	}
 
-	return nil
+	// the snapshot is released while waiting and a new one is taken
+	// once the other transactions are done.
+	return tx.mvcc.lockSchema(func() error {
+		tx.db.txlock.runlock()
+		tx.locked = false
+
+		waited, err := tx.db.txlock.lock(tx.ctx)
+		tx.lockWait += waited
+		if err != nil {
+			return stringutil.Errorf("waited %s for the database lock: %w", waited, err)
+		}
 
+		tx.locked = true
+		tx.schemaLocked = true
+		return nil
+	})
 }
 
 // Writable indicates if the transaction is writable or not.
@@ -164,6 +255,22 @@ func (tx *Transaction) ReIndexAll() error {
 	return tx.db.catalog.ReIndexAll(tx)
 }
 
+// Analyze computes and stores the statistics of the given table.
+func (tx *Transaction) Analyze(tableName string) error {
+	return tx.db.catalog.Analyze(tx, tableName)
+}
+
+// AnalyzeAll computes and stores the statistics of every table of the database.
+func (tx *Transaction) AnalyzeAll() error {
+	return tx.db.catalog.AnalyzeAll(tx)
+}
+
+// GetTableStatistics returns the statistics of the given table.
+// If the table was never analyzed, it returns ErrStatisticsNotFound.
+func (tx *Transaction) GetTableStatistics(tableName string) (*TableStatistics, error) {
+	return tx.db.catalog.GetTableStatistics(tx, tableName)
+}
+
 func (tx *Transaction) getTableStore() *tableStore {
 	st, err := tx.tx.GetStore([]byte(tableInfoStoreName))
 	if err != nil {
@@ -187,3 +294,15 @@ func (tx *Transaction) getIndexStore() *indexStore {
 		db: tx.db,
 	}
 }
+
+func (tx *Transaction) getStatisticsStore() *statisticsStore {
+	st, err := tx.tx.GetStore([]byte(statisticsStoreName))
+	if err != nil {
+		panic(stringutil.Sprintf("database incorrectly setup: missing %q table: %v", statisticsStoreName, err))
+	}
+
+	return &statisticsStore{
+		st: st,
+		db: tx.db,
+	}
+}
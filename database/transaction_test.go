@@ -2,7 +2,9 @@ package database_test
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/genjidb/genji/database"
 	"github.com/genjidb/genji/document/encoding/msgpack"
@@ -32,3 +34,146 @@ func newTestTx(t testing.TB) (*database.Database, *database.Transaction, func())
 		cleanup()
 	}
 }
+
+func TestTransactionLock(t *testing.T) {
+	// lockDB returns a transaction holding the database lock
+	// because it modifies the schema.
+	lockDB := func(t *testing.T, db *database.Database) *database.Transaction {
+		tx, err := db.Begin(true)
+		require.NoError(t, err)
+		require.NoError(t, tx.CreateTable("test", nil))
+		return tx
+	}
+
+	t.Run("Timeout", func(t *testing.T) {
+		db, cleanup := newTestDB(t)
+		defer cleanup()
+
+		tx := lockDB(t, db)
+		defer tx.Rollback()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		_, err := db.BeginTx(ctx, &database.TxOptions{ReadOnly: true})
+		require.True(t, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("TryBegin", func(t *testing.T) {
+		db, cleanup := newTestDB(t)
+		defer cleanup()
+
+		tx := lockDB(t, db)
+
+		_, err := db.TryBegin(false)
+		require.Equal(t, database.ErrDatabaseLocked, err)
+
+		require.NoError(t, tx.Rollback())
+
+		tx, err = db.TryBegin(true)
+		require.NoError(t, err)
+		require.Zero(t, tx.LockWait())
+		require.NoError(t, tx.Rollback())
+	})
+
+	t.Run("LockWait", func(t *testing.T) {
+		db, cleanup := newTestDB(t)
+		defer cleanup()
+
+		tx := lockDB(t, db)
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			tx.Rollback()
+		}()
+
+		other, err := db.Begin(false)
+		require.NoError(t, err)
+		defer other.Rollback()
+		require.GreaterOrEqual(t, int64(other.LockWait()), int64(10*time.Millisecond))
+	})
+
+	t.Run("Schema lock timeout", func(t *testing.T) {
+		db, cleanup := newTestDB(t)
+		defer cleanup()
+
+		tx1, err := db.Begin(false)
+		require.NoError(t, err)
+		defer tx1.Rollback()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		tx2, err := db.BeginTx(ctx, nil)
+		require.NoError(t, err)
+
+		// tx1 prevents tx2 from getting exclusive access to the database.
+		err = tx2.CreateTable("test", nil)
+		require.True(t, errors.Is(err, context.DeadlineExceeded))
+		require.Error(t, tx2.Commit())
+
+		// tx2 doesn't hold the lock anymore.
+		tx3, err := db.TryBegin(false)
+		require.NoError(t, err)
+		require.NoError(t, tx3.Rollback())
+
+		require.NoError(t, tx1.Rollback())
+		tx3, err = db.TryBegin(true)
+		require.NoError(t, err)
+		require.NoError(t, tx3.CreateTable("test", nil))
+		require.NoError(t, tx3.Commit())
+	})
+
+	t.Run("Session", func(t *testing.T) {
+		db, cleanup := newTestDB(t)
+		defer cleanup()
+
+		tx := lockDB(t, db)
+		defer tx.Rollback()
+
+		s := db.NewSession()
+		defer s.Close()
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := db.BeginTx(context.Background(), &database.TxOptions{Session: s})
+			done <- err
+		}()
+
+		// the session isn't locked while waiting for the database lock.
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := db.BeginTx(ctx, &database.TxOptions{Session: s})
+		require.True(t, errors.Is(err, context.DeadlineExceeded))
+		require.Nil(t, s.Tx())
+
+		require.NoError(t, tx.Rollback())
+		require.NoError(t, <-done)
+		require.NotNil(t, s.Tx())
+
+		_, err = db.BeginTx(context.Background(), &database.TxOptions{Session: s})
+		require.Equal(t, database.ErrTransactionInProgress, err)
+	})
+}
+
+func TestAttachedTx(t *testing.T) {
+	db, cleanup := newTestDB(t)
+	defer cleanup()
+
+	require.Nil(t, db.GetAttachedTx())
+
+	tx, err := db.BeginTx(context.Background(), &database.TxOptions{Attached: true})
+	require.NoError(t, err)
+	require.Equal(t, tx, db.GetAttachedTx())
+	require.Equal(t, tx, db.AttachedSession().Tx())
+
+	_, err = db.BeginTx(context.Background(), &database.TxOptions{Attached: true})
+	require.Equal(t, database.ErrTransactionInProgress, err)
+
+	// other transactions are not affected.
+	other, err := db.Begin(false)
+	require.NoError(t, err)
+	require.NoError(t, other.Rollback())
+
+	require.NoError(t, tx.Rollback())
+	require.Nil(t, db.GetAttachedTx())
+}
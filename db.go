@@ -2,37 +2,91 @@ package genji
 
 import (
 	"context"
+	"errors"
 
 	"github.com/genjidb/genji/database"
 	"github.com/genjidb/genji/document"
+	"github.com/genjidb/genji/planner"
 	"github.com/genjidb/genji/query"
 	"github.com/genjidb/genji/sql/parser"
 	"github.com/genjidb/genji/stream"
 )
 
+// ErrSessionRequired is returned when a query run by a handle without session leaves
+// a transaction opened by the BEGIN statement: the transaction is rolled back.
+// Transactions spanning multiple queries must be opened on a handle created with NewSession.
+var ErrSessionRequired = errors.New("transactions opened by BEGIN must be closed by the same query unless run within a session")
+
 // DB represents a collection of tables stored in the underlying engine.
 type DB struct {
 	DB *database.Database
 
 	ctx context.Context
+	// session holding the transaction opened by the BEGIN statement.
+	// if nil, each query runs within a session of its own.
+	session *database.Session
 }
 
 // WithContext creates a new database handle using the given context for every operation.
+// The handle shares the session of db, if any.
 func (db *DB) WithContext(ctx context.Context) *DB {
 	return &DB{
-		DB:  db.DB,
-		ctx: ctx,
+		DB:      db.DB,
+		ctx:     ctx,
+		session: db.session,
+	}
+}
+
+// WithLimits creates a new database handle whose statements, and the transactions
+// it creates, are restricted by the given limits. They override the limits
+// of the database and of the handle.
+// The handle shares the session of db.
+func (db *DB) WithLimits(l database.Limits) *DB {
+	return db.WithContext(database.WithLimits(db.ctx, l))
+}
+
+// Subscribe returns a subscription receiving the documents inserted, updated and deleted
+// in the given tables, or in every table if none is given, by the transactions
+// committed after the call. See database.Database.Subscribe for more details.
+// The subscription must be closed after usage.
+func (db *DB) Subscribe(tables ...string) *database.Subscription {
+	return db.DB.Subscribe(tables...)
+}
+
+// NewSession creates a new database handle with its own session.
+// Transactions opened with the BEGIN statement are only visible to the handle
+// that opened them and to the handles created from it with WithContext.
+// The handles returned by Open and New have no session: each of their queries
+// runs within a session of its own, and must close the transactions it opens.
+// Like sessions, the handle must not be used by multiple goroutines concurrently.
+func (db *DB) NewSession() *DB {
+	return &DB{
+		DB:      db.DB,
+		ctx:     db.ctx,
+		session: db.DB.NewSession(),
 	}
 }
 
 // Close the database.
+// If the handle was created by NewSession, or derived from such a handle, Close only rolls back
+// the transaction opened by the BEGIN statement, if any: the database remains open.
 func (db *DB) Close() error {
+	if db.session != nil {
+		return db.session.Close()
+	}
+
 	return db.DB.Close()
 }
 
 // Begin starts a new transaction.
 // The returned transaction must be closed either by calling Rollback or Commit.
+// If the database is locked by a transaction modifying the schema, Begin waits until
+// it is done or until the context of the handle is canceled.
 func (db *DB) Begin(writable bool) (*Tx, error) {
+	if db.session != nil && db.session.Tx() != nil {
+		return nil, database.ErrTransactionInProgress
+	}
+
 	tx, err := db.DB.BeginTx(db.ctx, &database.TxOptions{
 		ReadOnly: !writable,
 	})
@@ -45,6 +99,25 @@ func (db *DB) Begin(writable bool) (*Tx, error) {
 	}, nil
 }
 
+// TryBegin is like Begin but returns database.ErrDatabaseLocked instead of waiting
+// if the database is locked by a transaction modifying the schema.
+func (db *DB) TryBegin(writable bool) (*Tx, error) {
+	if db.session != nil && db.session.Tx() != nil {
+		return nil, database.ErrTransactionInProgress
+	}
+
+	tx, err := db.DB.TryBeginTx(db.ctx, &database.TxOptions{
+		ReadOnly: !writable,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tx{
+		Transaction: tx,
+	}, nil
+}
+
 // View starts a read only transaction, runs fn and automatically rolls it back.
 func (db *DB) View(fn func(tx *Tx) error) error {
 	tx, err := db.Begin(false)
@@ -93,12 +166,30 @@ func (db *DB) Exec(q string, args ...interface{}) error {
 // Query the database and return the result.
 // The returned result must always be closed after usage.
 func (db *DB) Query(q string, args ...interface{}) (*query.Result, error) {
-	pq, err := parser.ParseQuery(q)
+	pq, err := parser.PrepareQuery(db.DB, q)
 	if err != nil {
 		return nil, err
 	}
 
-	return pq.Run(db.ctx, db.DB, argsToParams(args))
+	return db.run(pq, args)
+}
+
+// QueryAfter runs the query and only returns the documents located after
+// the position of the cursor, as returned by the Cursor method of a previous result
+// of the same query. If the cursor is empty, it behaves like Query.
+// The returned result must always be closed after usage.
+func (db *DB) QueryAfter(cursor string, q string, args ...interface{}) (*query.Result, error) {
+	pq, err := parser.PrepareQuery(db.DB, q)
+	if err != nil {
+		return nil, err
+	}
+
+	pq, err = resumeQuery(pq, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.run(pq, args)
 }
 
 // QueryDocument runs the query and returns the first document.
@@ -113,6 +204,28 @@ func (db *DB) QueryDocument(q string, args ...interface{}) (document.Document, e
 	return scanDocument(res)
 }
 
+// run the query within the session of the handle or, if it has none,
+// within a session of its own.
+func (db *DB) run(pq query.Query, args []interface{}) (*query.Result, error) {
+	if db.session != nil {
+		return pq.RunSession(db.ctx, db.session, argsToParams(args))
+	}
+
+	s := db.DB.NewSession()
+	res, err := pq.RunSession(db.ctx, s, argsToParams(args))
+	if s.Tx() == nil {
+		return res, err
+	}
+
+	// the transaction opened by BEGIN would no longer be reachable.
+	if err == nil {
+		res.Close()
+		err = ErrSessionRequired
+	}
+	s.Close()
+	return nil, err
+}
+
 func scanDocument(res *query.Result) (document.Document, error) {
 	var d document.Document
 	err := res.Iterate(func(doc document.Document) error {
@@ -147,12 +260,28 @@ type Tx struct {
 // Query the database withing the transaction and returns the result.
 // Closing the returned result after usage is not mandatory.
 func (tx *Tx) Query(q string, args ...interface{}) (*query.Result, error) {
-	pq, err := parser.ParseQuery(q)
+	pq, err := parser.PrepareQuery(tx.DB(), q)
+	if err != nil {
+		return nil, err
+	}
+
+	return pq.Exec(tx.Context(), tx.Transaction, argsToParams(args))
+}
+
+// QueryAfter runs the query within the transaction and only returns the documents
+// located after the position of the cursor. See DB.QueryAfter for more details.
+func (tx *Tx) QueryAfter(cursor string, q string, args ...interface{}) (*query.Result, error) {
+	pq, err := parser.PrepareQuery(tx.DB(), q)
+	if err != nil {
+		return nil, err
+	}
+
+	pq, err = resumeQuery(pq, cursor)
 	if err != nil {
 		return nil, err
 	}
 
-	return pq.Exec(tx.Transaction, argsToParams(args))
+	return pq.Exec(tx.Context(), tx.Transaction, argsToParams(args))
 }
 
 // QueryDocument runs the query and returns the first document.
@@ -184,3 +313,123 @@ func (tx *Tx) Exec(q string, args ...interface{}) (err error) {
 		return nil
 	})
 }
+
+// Prepare parses the query and returns a prepared statement.
+// The statement can be executed multiple times with different arguments:
+// the query is parsed once and the execution plan is only recomputed when
+// the arguments change or when the structure of the database is modified.
+func (db *DB) Prepare(q string) (*Statement, error) {
+	pq, err := parser.PrepareQuery(db.DB, q)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Statement{
+		pq: pq,
+		db: db,
+	}, nil
+}
+
+// Prepare parses the query and returns a prepared statement
+// that will be executed within the transaction.
+func (tx *Tx) Prepare(q string) (*Statement, error) {
+	pq, err := parser.PrepareQuery(tx.DB(), q)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Statement{
+		pq: pq,
+		tx: tx,
+	}, nil
+}
+
+// Statement is a prepared statement. Once created, it can be executed
+// multiple times, concurrently or not.
+type Statement struct {
+	pq query.Query
+	db *DB
+	tx *Tx
+}
+
+// Query the database and return the result.
+// The returned result must always be closed after usage.
+func (s *Statement) Query(args ...interface{}) (*query.Result, error) {
+	if s.tx != nil {
+		return s.pq.Exec(s.tx.Context(), s.tx.Transaction, argsToParams(args))
+	}
+
+	return s.db.run(s.pq, args)
+}
+
+// QueryAfter runs the statement and only returns the documents located after
+// the position of the cursor. See DB.QueryAfter for more details.
+func (s *Statement) QueryAfter(cursor string, args ...interface{}) (*query.Result, error) {
+	pq, err := resumeQuery(s.pq, cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.tx != nil {
+		return pq.Exec(s.tx.Context(), s.tx.Transaction, argsToParams(args))
+	}
+
+	return s.db.run(pq, args)
+}
+
+// QueryDocument runs the query and returns the first document.
+// If the query returns no error, QueryDocument returns database.ErrDocumentNotFound.
+func (s *Statement) QueryDocument(args ...interface{}) (document.Document, error) {
+	res, err := s.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	return scanDocument(res)
+}
+
+// Exec a query against the database without returning the result.
+func (s *Statement) Exec(args ...interface{}) (err error) {
+	res, err := s.Query(args...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		er := res.Close()
+		if err == nil {
+			err = er
+		}
+	}()
+
+	return res.Iterate(func(d document.Document) error {
+		return nil
+	})
+}
+
+// resumeQuery returns a copy of the query whose last statement
+// only returns the documents located after the position of the cursor.
+func resumeQuery(pq query.Query, cursor string) (query.Query, error) {
+	if cursor == "" {
+		return pq, nil
+	}
+
+	pos, err := planner.DecodeCursor(cursor)
+	if err != nil {
+		return pq, err
+	}
+
+	if len(pq.Statements) == 0 {
+		return pq, query.ErrCursorNotSupported
+	}
+
+	last, ok := pq.Statements[len(pq.Statements)-1].(*planner.Statement)
+	if !ok {
+		return pq, query.ErrCursorNotSupported
+	}
+
+	statements := append([]query.Statement(nil), pq.Statements...)
+	statements[len(statements)-1] = last.After(pos)
+
+	return query.New(statements...), nil
+}
@@ -1,13 +1,17 @@
 package genji_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/genjidb/genji"
 	"github.com/genjidb/genji/database"
 	"github.com/genjidb/genji/document"
+	"github.com/genjidb/genji/query"
 	"github.com/stretchr/testify/require"
 )
 
@@ -118,6 +122,633 @@ func TestQueryDocument(t *testing.T) {
 	})
 }
 
+func TestPrepare(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec(`
+			CREATE TABLE test(a INT, b TEXT);
+			INSERT INTO test (a, b) VALUES (1, 'foo'), (2, 'bar'), (3, 'baz')
+		`)
+	require.NoError(t, err)
+
+	t.Run("Should run the statement with different arguments", func(t *testing.T) {
+		stmt, err := db.Prepare("SELECT b FROM test WHERE a = ?")
+		require.NoError(t, err)
+
+		for i, expected := range []string{"foo", "bar", "baz", "foo"} {
+			var b string
+			d, err := stmt.QueryDocument(i%3 + 1)
+			require.NoError(t, err)
+			require.NoError(t, document.Scan(d, &b))
+			require.Equal(t, expected, b)
+		}
+
+		_, err = stmt.QueryDocument(10)
+		require.Equal(t, database.ErrDocumentNotFound, err)
+	})
+
+	t.Run("Should replan when the catalog changes", func(t *testing.T) {
+		stmt, err := db.Prepare("EXPLAIN SELECT b FROM test WHERE a = ?")
+		require.NoError(t, err)
+
+		var plan string
+		d, err := stmt.QueryDocument(2)
+		require.NoError(t, err)
+		require.NoError(t, document.Scan(d, &plan))
+		require.Equal(t, `seqScan(test) | filter(a = ?) | project(b)`, plan)
+
+		err = db.Exec("CREATE INDEX idx_a ON test(a)")
+		require.NoError(t, err)
+
+		d, err = stmt.QueryDocument(2)
+		require.NoError(t, err)
+		require.NoError(t, document.Scan(d, &plan))
+		require.Equal(t, `indexScan("idx_a", ?) | filter(a = ?) | project(b)`, plan)
+	})
+
+	t.Run("Should bind the parameters of the ranges read from an index", func(t *testing.T) {
+		stmt, err := db.Prepare("SELECT b FROM test WHERE a IN (?, ?, 3)")
+		require.NoError(t, err)
+
+		tests := []struct {
+			a, b     interface{}
+			expected []string
+		}{
+			{1, 2, []string{"foo", "bar", "baz"}},
+			{1, 1, []string{"foo", "baz"}},
+			{2.0, "bar", []string{"bar", "baz"}},
+			{1.5, 2, []string{"bar", "baz"}},
+		}
+
+		for _, test := range tests {
+			res, err := stmt.Query(test.a, test.b)
+			require.NoError(t, err)
+
+			var values []string
+			err = res.Iterate(func(d document.Document) error {
+				var b string
+				err := document.Scan(d, &b)
+				values = append(values, b)
+				return err
+			})
+			require.NoError(t, err)
+			require.NoError(t, res.Close())
+			require.ElementsMatch(t, test.expected, values)
+		}
+	})
+
+	t.Run("Should run within a transaction", func(t *testing.T) {
+		tx, err := db.Begin(true)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		insert, err := tx.Prepare("INSERT INTO test (a, b) VALUES (?, ?)")
+		require.NoError(t, err)
+		count, err := tx.Prepare("SELECT COUNT(*) FROM test")
+		require.NoError(t, err)
+
+		for i := 0; i < 10; i++ {
+			require.NoError(t, insert.Exec(i+10, "x"))
+		}
+
+		var n int
+		d, err := count.QueryDocument()
+		require.NoError(t, err)
+		require.NoError(t, document.Scan(d, &n))
+		require.Equal(t, 13, n)
+	})
+}
+
+func TestPrepareParallelScan(t *testing.T) {
+	db, err := genji.OpenWithOptions(":memory:", database.Options{ParallelWorkers: 4})
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec("CREATE TABLE test(a INT)")
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		err = db.Exec("INSERT INTO test (a) VALUES (?)", i)
+		require.NoError(t, err)
+	}
+	err = db.Exec("ANALYZE test")
+	require.NoError(t, err)
+
+	sess := db.NewSession()
+	defer sess.Close()
+
+	stmt, err := sess.Prepare("SELECT COUNT(*) FROM test WHERE a % 2 = 0")
+	require.NoError(t, err)
+
+	count := func() int {
+		var n int
+		d, err := stmt.QueryDocument()
+		require.NoError(t, err)
+		require.NoError(t, document.Scan(d, &n))
+		return n
+	}
+
+	// the plan, which scans the table in parallel, is cached
+	require.Equal(t, 500, count())
+
+	// and reused by the read-write transaction, which must read its changes sequentially
+	err = sess.Exec("BEGIN")
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		err = sess.Exec("INSERT INTO test (a) VALUES (?)", i*2)
+		require.NoError(t, err)
+	}
+	require.Equal(t, 600, count())
+}
+
+func TestSessions(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec("CREATE TABLE test; INSERT INTO test (a) VALUES (1)")
+	require.NoError(t, err)
+
+	// each query run by a handle without session has its own session:
+	// a transaction left open by BEGIN is rolled back.
+	err = db.Exec("BEGIN; INSERT INTO test (a) VALUES (2)")
+	require.Equal(t, genji.ErrSessionRequired, err)
+	err = db.Exec("BEGIN; INSERT INTO test (a) VALUES (2); ROLLBACK")
+	require.NoError(t, err)
+
+	sess := db.NewSession()
+	other := db.NewSession()
+
+	// each session has its own explicit transaction
+	err = sess.Exec("BEGIN READ ONLY")
+	require.NoError(t, err)
+	err = other.Exec("BEGIN READ ONLY")
+	require.NoError(t, err)
+
+	_, err = sess.Begin(false)
+	require.Equal(t, database.ErrTransactionInProgress, err)
+
+	// handles created with WithContext share the session
+	_, err = sess.WithContext(context.Background()).Begin(false)
+	require.Equal(t, database.ErrTransactionInProgress, err)
+
+	// the handle without session isn't affected
+	err = db.Exec("INSERT INTO test (a) VALUES (2)")
+	require.NoError(t, err)
+	err = db.Exec("DELETE FROM test WHERE a = 2")
+	require.NoError(t, err)
+
+	for _, s := range []*genji.DB{db, sess, other} {
+		d, err := s.QueryDocument("SELECT COUNT(*) FROM test")
+		require.NoError(t, err)
+		var n int
+		require.NoError(t, document.Scan(d, &n))
+		require.Equal(t, 1, n)
+	}
+
+	err = sess.Exec("ROLLBACK")
+	require.NoError(t, err)
+	err = other.Exec("ROLLBACK")
+	require.NoError(t, err)
+
+	// closing a session rolls back its transaction, without closing the database
+	err = other.Exec("BEGIN; INSERT INTO test (a) VALUES (2)")
+	require.NoError(t, err)
+	require.NoError(t, other.Close())
+	d, err := db.QueryDocument("SELECT COUNT(*) FROM test")
+	require.NoError(t, err)
+	var n int
+	require.NoError(t, document.Scan(d, &n))
+	require.Equal(t, 1, n)
+
+	// a rolled back transaction is detached from its session
+	err = other.Exec("BEGIN; INSERT INTO test (a) VALUES (2); ROLLBACK")
+	require.NoError(t, err)
+	d, err = db.QueryDocument("SELECT COUNT(*) FROM test")
+	require.NoError(t, err)
+	require.NoError(t, document.Scan(d, &n))
+	require.Equal(t, 1, n)
+}
+
+func TestQueryCancel(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec("CREATE TABLE test")
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		err = db.Exec("INSERT INTO test (a) VALUES (?)", i)
+		require.NoError(t, err)
+	}
+
+	// the context of the query is used, even within
+	// a transaction created with another context.
+	sess := db.NewSession()
+	defer sess.Close()
+	err = sess.Exec("BEGIN READ ONLY")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	res, err := sess.WithContext(ctx).Query("SELECT * FROM test ORDER BY a DESC")
+	require.NoError(t, err)
+	defer res.Close()
+
+	var n int
+	err = res.Iterate(func(d document.Document) error {
+		n++
+		cancel()
+		return nil
+	})
+	require.Equal(t, context.Canceled, err)
+	require.Less(t, n, 1000)
+}
+
+func TestLimits(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec("CREATE TABLE test")
+	require.NoError(t, err)
+	for i := 0; i < 100; i++ {
+		err = db.Exec("INSERT INTO test (a) VALUES (?)", i)
+		require.NoError(t, err)
+	}
+
+	exceeds := func(t *testing.T, db *genji.DB, q string, limit string) {
+		t.Helper()
+
+		res, err := db.Query(q)
+		require.NoError(t, err)
+		defer res.Close()
+
+		err = res.Iterate(func(d document.Document) error { return nil })
+		var lerr *database.LimitError
+		require.True(t, errors.As(err, &lerr), "unexpected error %v", err)
+		require.Equal(t, limit, lerr.Limit)
+	}
+
+	t.Run("Scanned documents", func(t *testing.T) {
+		ldb := db.WithLimits(database.Limits{MaxScannedDocuments: 10})
+		exceeds(t, ldb, "SELECT * FROM test", database.ScannedDocumentsLimit)
+
+		_, err := ldb.QueryDocument("SELECT * FROM test LIMIT 5")
+		require.NoError(t, err)
+	})
+
+	t.Run("Memory", func(t *testing.T) {
+		ldb := db.WithLimits(database.Limits{MaxMemory: 100})
+		exceeds(t, ldb, "SELECT * FROM test ORDER BY a", database.MemoryLimit)
+		exceeds(t, ldb, "SELECT DISTINCT a FROM test", database.MemoryLimit)
+		exceeds(t, ldb, "SELECT COUNT(*) FROM test GROUP BY a", database.MemoryLimit)
+
+		// the memory is released once the operation is done.
+		ldb = db.WithLimits(database.Limits{MaxMemory: 1024 * 1024})
+		for i := 0; i < 3; i++ {
+			err := ldb.Exec("SELECT * FROM test ORDER BY a")
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		ldb := db.WithLimits(database.Limits{Timeout: time.Nanosecond})
+		exceeds(t, ldb, "SELECT * FROM test", database.TimeoutLimit)
+	})
+
+	t.Run("Parallel scans", func(t *testing.T) {
+		pdb, err := genji.OpenWithOptions(":memory:", database.Options{ParallelWorkers: 4})
+		require.NoError(t, err)
+		defer pdb.Close()
+
+		err = pdb.Exec("CREATE TABLE test")
+		require.NoError(t, err)
+		for i := 0; i < 1000; i++ {
+			err = pdb.Exec("INSERT INTO test (a) VALUES (?)", i)
+			require.NoError(t, err)
+		}
+		err = pdb.Exec("ANALYZE test")
+		require.NoError(t, err)
+
+		d, err := pdb.QueryDocument("EXPLAIN SELECT COUNT(*) FROM test GROUP BY a")
+		require.NoError(t, err)
+		var plan string
+		require.NoError(t, document.Scan(d, &plan))
+		require.Contains(t, plan, "gather(4)")
+
+		ldb := pdb.WithLimits(database.Limits{MaxScannedDocuments: 10})
+		exceeds(t, ldb, "SELECT COUNT(*) FROM test", database.ScannedDocumentsLimit)
+		exceeds(t, ldb, "SELECT * FROM test WHERE a > 0", database.ScannedDocumentsLimit)
+
+		ldb = pdb.WithLimits(database.Limits{MaxMemory: 100})
+		exceeds(t, ldb, "SELECT COUNT(*) FROM test GROUP BY a", database.MemoryLimit)
+
+		// the memory is released once the operation is done.
+		ldb = pdb.WithLimits(database.Limits{MaxMemory: 1024 * 1024})
+		for i := 0; i < 3; i++ {
+			err := ldb.Exec("SELECT COUNT(*) FROM test GROUP BY a")
+			require.NoError(t, err)
+		}
+
+		ldb = pdb.WithLimits(database.Limits{Timeout: time.Nanosecond})
+		exceeds(t, ldb, "SELECT COUNT(*) FROM test GROUP BY a", database.TimeoutLimit)
+	})
+
+	t.Run("Precedence", func(t *testing.T) {
+		db.DB.Limits = database.Limits{MaxScannedDocuments: 10}
+		defer func() { db.DB.Limits = database.Limits{} }()
+		exceeds(t, db, "SELECT * FROM test", database.ScannedDocumentsLimit)
+
+		// the limits of the transaction override those of the database
+		tx, err := db.DB.BeginTx(context.Background(), &database.TxOptions{
+			ReadOnly: true,
+			Limits:   database.Limits{MaxScannedDocuments: -1},
+		})
+		require.NoError(t, err)
+		defer tx.Rollback()
+		gtx := &genji.Tx{Transaction: tx}
+		err = gtx.Exec("SELECT * FROM test")
+		require.NoError(t, err)
+
+		// the limits of the statement override those of the transaction
+		sdb := db.NewSession()
+		err = sdb.WithLimits(database.Limits{MaxScannedDocuments: -1}).Exec("BEGIN READ ONLY")
+		require.NoError(t, err)
+		defer sdb.Exec("ROLLBACK")
+		err = sdb.Exec("SELECT * FROM test")
+		require.NoError(t, err)
+		exceeds(t, sdb.WithLimits(database.Limits{MaxScannedDocuments: 5}), "SELECT * FROM test", database.ScannedDocumentsLimit)
+	})
+}
+
+func TestSubscribe(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec("CREATE TABLE test(a INTEGER PRIMARY KEY, b TEXT)")
+	require.NoError(t, err)
+
+	sub := db.Subscribe("test")
+	defer sub.Close()
+
+	err = db.Exec(`
+		INSERT INTO test (a, b) VALUES (1, 'foo'), (2, 'bar');
+		UPDATE test SET b = 'baz' WHERE a = 1;
+		DELETE FROM test WHERE a = 2;
+	`)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var got []string
+	for len(got) < 4 {
+		cs, err := sub.Next(ctx)
+		require.NoError(t, err)
+
+		for _, c := range cs.Changes {
+			var a int
+			var b string
+			d := c.New
+			if d == nil {
+				d = c.Old
+			}
+			require.NoError(t, document.Scan(d, &a, &b))
+			got = append(got, fmt.Sprintf("%s %d %s", c.Type, a, b))
+		}
+	}
+
+	require.Equal(t, []string{"insert 1 foo", "insert 2 bar", "update 1 baz", "delete 2 bar"}, got)
+}
+
+func TestQueryPlanCache(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec("CREATE TABLE test; INSERT INTO test (a) VALUES (1), (2)")
+	require.NoError(t, err)
+	require.Equal(t, 0, db.DB.PlanCache().Len())
+
+	for i := 1; i <= 2; i++ {
+		var a int
+		d, err := db.QueryDocument("SELECT a FROM test WHERE a = ?", i)
+		require.NoError(t, err)
+		require.NoError(t, document.Scan(d, &a))
+		require.Equal(t, i, a)
+		require.Equal(t, 1, db.DB.PlanCache().Len())
+	}
+
+	err = db.Exec("CREATE INDEX idx_a ON test(a)")
+	require.NoError(t, err)
+	require.Equal(t, 0, db.DB.PlanCache().Len())
+
+	d, err := db.QueryDocument("EXPLAIN SELECT a FROM test WHERE a = ?", 2)
+	require.NoError(t, err)
+	var plan string
+	require.NoError(t, document.Scan(d, &plan))
+	require.Equal(t, `indexOnlyScan("idx_a", ?) | filter(a = ?) | project(a)`, plan)
+}
+
+func TestQueryAfter(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec(`
+		CREATE TABLE test;
+		CREATE INDEX idx_b ON test(b);
+		CREATE INDEX idx_c ON test(c);
+		CREATE TABLE users(name TEXT PRIMARY KEY);
+	`)
+	require.NoError(t, err)
+
+	// enough documents for their docids to be encoded on multiple bytes
+	for i := 0; i < 300; i++ {
+		if i%10 == 0 {
+			err = db.Exec("INSERT INTO test (a) VALUES (?)", i)
+		} else {
+			err = db.Exec("INSERT INTO test (a, b) VALUES (?, ?)", i, i%7)
+		}
+		require.NoError(t, err)
+
+		err = db.Exec("INSERT INTO users (name) VALUES (?)", fmt.Sprintf("user-%d", i))
+		require.NoError(t, err)
+	}
+
+	readAll := func(t *testing.T, res *query.Result, field string) []interface{} {
+		t.Helper()
+
+		var values []interface{}
+		err := res.Iterate(func(d document.Document) error {
+			v, err := d.GetByField(field)
+			require.NoError(t, err)
+			values = append(values, v.V)
+			return nil
+		})
+		require.NoError(t, err)
+		return values
+	}
+
+	// paginate runs the query page by page, using the cursor
+	// returned by the previous page.
+	paginate := func(t *testing.T, limit int, field string, run func(cursor string) (*query.Result, error)) []interface{} {
+		t.Helper()
+
+		var all []interface{}
+		var cursor string
+		for {
+			res, err := run(cursor)
+			require.NoError(t, err)
+
+			page := readAll(t, res, field)
+			require.LessOrEqual(t, len(page), limit)
+
+			cursor, err = res.Cursor()
+			require.NoError(t, err)
+			require.NoError(t, res.Close())
+
+			if len(page) == 0 {
+				require.Empty(t, cursor)
+				return all
+			}
+			all = append(all, page...)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		field string
+	}{
+		{"Table scan", "SELECT a FROM test", "a"},
+		{"Table scan with filter", "SELECT a FROM test WHERE a % 3 = 0", "a"},
+		{"Reverse table scan", "SELECT name FROM users ORDER BY name DESC", "name"},
+		{"Primary key range", "SELECT name FROM users WHERE name > 'user-150'", "name"},
+		{"Index scan", "SELECT a FROM test ORDER BY b", "a"},
+		{"Reverse index scan", "SELECT a FROM test ORDER BY b DESC", "a"},
+		{"Index range", "SELECT a FROM test WHERE b >= 2 AND b < 5", "a"},
+		{"Covering index scan", "SELECT b FROM test ORDER BY b", "b"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := db.Query(test.query)
+			require.NoError(t, err)
+			expected := readAll(t, res, test.field)
+			require.NoError(t, res.Close())
+
+			got := paginate(t, 25, test.field, func(cursor string) (*query.Result, error) {
+				return db.QueryAfter(cursor, test.query+" LIMIT 25")
+			})
+			require.Equal(t, expected, got)
+		})
+	}
+
+	t.Run("Prepared statement", func(t *testing.T) {
+		stmt, err := db.Prepare("SELECT a FROM test WHERE b = ? LIMIT 5")
+		require.NoError(t, err)
+
+		got := paginate(t, 5, "a", func(cursor string) (*query.Result, error) {
+			return stmt.QueryAfter(cursor, 3)
+		})
+		require.Len(t, got, 38)
+		for _, a := range got {
+			require.Equal(t, 3, int(a.(float64))%7)
+		}
+	})
+
+	t.Run("Transaction", func(t *testing.T) {
+		tx, err := db.Begin(false)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		got := paginate(t, 100, "a", func(cursor string) (*query.Result, error) {
+			return tx.QueryAfter(cursor, "SELECT a FROM test LIMIT 100")
+		})
+		require.Len(t, got, 300)
+	})
+
+	t.Run("Unsupported queries", func(t *testing.T) {
+		for _, q := range []string{
+			"SELECT a FROM test LIMIT 10 OFFSET 10",
+			"SELECT a FROM test ORDER BY a LIMIT 10",
+			"SELECT COUNT(*) AS a FROM test",
+		} {
+			res, err := db.Query(q)
+			require.NoError(t, err)
+			readAll(t, res, "a")
+			_, err = res.Cursor()
+			require.Equal(t, query.ErrCursorNotSupported, err)
+			require.NoError(t, res.Close())
+		}
+
+		res, err := db.Query("SELECT a FROM test LIMIT 10")
+		require.NoError(t, err)
+		readAll(t, res, "a")
+		cursor, err := res.Cursor()
+		require.NoError(t, err)
+		require.NoError(t, res.Close())
+
+		_, err = db.QueryAfter(cursor, "SELECT a FROM test ORDER BY a LIMIT 10")
+		require.Equal(t, query.ErrCursorNotSupported, err)
+	})
+
+	t.Run("Invalid cursor", func(t *testing.T) {
+		_, err := db.QueryAfter("not a cursor", "SELECT a FROM test")
+		require.Equal(t, query.ErrInvalidCursor, err)
+
+		// cursor created by a scan of another index
+		res, err := db.Query("SELECT a FROM test ORDER BY b LIMIT 10")
+		require.NoError(t, err)
+		readAll(t, res, "a")
+		cursor, err := res.Cursor()
+		require.NoError(t, err)
+		require.NoError(t, res.Close())
+
+		_, err = db.QueryAfter(cursor, "SELECT a FROM test ORDER BY c LIMIT 10")
+		require.Equal(t, query.ErrInvalidCursor, err)
+		_, err = db.QueryAfter(cursor, "SELECT a FROM test LIMIT 10")
+		require.Equal(t, query.ErrInvalidCursor, err)
+	})
+
+	t.Run("Deleted row", func(t *testing.T) {
+		for _, q := range []string{
+			"SELECT a FROM test",
+			"SELECT a FROM test ORDER BY b",
+			"SELECT a FROM test ORDER BY b DESC",
+		} {
+			res, err := db.Query(q)
+			require.NoError(t, err)
+			expected := readAll(t, res, "a")
+			require.NoError(t, res.Close())
+
+			res, err = db.Query(q + " LIMIT 25")
+			require.NoError(t, err)
+			page := readAll(t, res, "a")
+			cursor, err := res.Cursor()
+			require.NoError(t, err)
+			require.NoError(t, res.Close())
+			require.Equal(t, expected[:25], page)
+
+			// delete the document the cursor points to
+			err = db.Exec("DELETE FROM test WHERE a = ?", page[24])
+			require.NoError(t, err)
+
+			res, err = db.QueryAfter(cursor, q)
+			require.NoError(t, err)
+			got := readAll(t, res, "a")
+			require.NoError(t, res.Close())
+			require.Equal(t, expected[25:], got, q)
+		}
+	})
+}
+
 func BenchmarkSelect(b *testing.B) {
 	for size := 1; size <= 10000; size *= 10 {
 		b.Run(fmt.Sprintf("%.05d", size), func(b *testing.B) {
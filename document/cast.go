@@ -3,6 +3,7 @@ package document
 import (
 	"encoding/base64"
 	"strconv"
+	"time"
 
 	"github.com/genjidb/genji/stringutil"
 )
@@ -25,6 +26,8 @@ func (v Value) CastAs(t ValueType) (Value, error) {
 		return v.CastAsInteger()
 	case DoubleValue:
 		return v.CastAsDouble()
+	case TimestampValue:
+		return v.CastAsTimestamp()
 	case BlobValue:
 		return v.CastAsBlob()
 	case TextValue:
@@ -63,6 +66,7 @@ func (v Value) CastAsBool() (Value, error) {
 // CastAsInteger casts according to the following rules:
 // Bool: returns 1 if true, 0 if false.
 // Double: cuts off the decimal and remaining numbers.
+// Timestamp: returns the number of seconds elapsed since January 1, 1970 UTC.
 // Text: uses strconv.ParseInt to determine the integer value,
 // then casts it to an integer. If it fails uses strconv.ParseFloat
 // to determine the double value, then casts it to an integer
@@ -79,6 +83,8 @@ func (v Value) CastAsInteger() (Value, error) {
 		return NewIntegerValue(0), nil
 	case DoubleValue:
 		return NewIntegerValue(int64(v.V.(float64))), nil
+	case TimestampValue:
+		return NewIntegerValue(v.V.(time.Time).Unix()), nil
 	case TextValue:
 		i, err := strconv.ParseInt(v.V.(string), 10, 64)
 		if err != nil {
@@ -131,7 +137,7 @@ func (v Value) CastAsText() (Value, error) {
 
 	s := string(d)
 
-	if v.Type == BlobValue {
+	if v.Type == BlobValue || v.Type == TimestampValue {
 		s, err = strconv.Unquote(s)
 		if err != nil {
 			return Value{}, err
@@ -141,6 +147,41 @@ func (v Value) CastAsText() (Value, error) {
 	return NewTextValue(s), nil
 }
 
+// timestampLayouts lists the formats accepted when casting a text to a timestamp.
+// Texts without a time zone are considered to be in UTC.
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// CastAsTimestamp casts according to the following rules:
+// Integer: considered as the number of seconds elapsed since January 1, 1970 UTC.
+// Text: parses an RFC 3339 date and time, with or without the T separator
+// and the time zone, or a date alone. It fails if the text isn't in one of these formats.
+// Any other type is considered an invalid cast.
+func (v Value) CastAsTimestamp() (Value, error) {
+	switch v.Type {
+	case TimestampValue:
+		return v, nil
+	case IntegerValue:
+		return NewTimestampValue(time.Unix(v.V.(int64), 0)), nil
+	case TextValue:
+		for _, layout := range timestampLayouts {
+			t, err := time.Parse(layout, v.V.(string))
+			if err == nil {
+				return NewTimestampValue(t), nil
+			}
+		}
+
+		return Value{}, stringutil.Errorf(`cannot cast %q as timestamp`, v.V)
+	}
+
+	return Value{}, stringutil.Errorf("cannot cast %s as timestamp", v.Type)
+}
+
 // CastAsBlob casts according to the following rules:
 // Text: decodes a base64 string, otherwise fails.
 // Any other type is considered an invalid cast.
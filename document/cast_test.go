@@ -2,6 +2,7 @@ package document
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -17,6 +18,7 @@ func TestCastAs(t *testing.T) {
 	doubleV := NewDoubleValue(10.5)
 	textV := NewTextValue("foo")
 	blobV := NewBlobValue([]byte("abc"))
+	timestampV := NewTimestampValue(time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC))
 	arrayV := NewArrayValue(NewValueBuffer().
 		Append(NewTextValue("bar")).
 		Append(integerV))
@@ -62,6 +64,7 @@ func TestCastAs(t *testing.T) {
 			{textV, Value{}, true},
 			{NewTextValue("10"), integerV, false},
 			{NewTextValue("10.5"), integerV, false},
+			{timestampV, NewIntegerValue(1609556645), false},
 			{blobV, Value{}, true},
 			{arrayV, Value{}, true},
 			{docV, Value{}, true},
@@ -89,6 +92,7 @@ func TestCastAs(t *testing.T) {
 			{doubleV, NewTextValue("10.5"), false},
 			{textV, textV, false},
 			{blobV, NewTextValue("YWJj"), false},
+			{timestampV, NewTextValue("2021-01-02T03:04:05Z"), false},
 			{arrayV, NewTextValue(`["bar", 10]`), false},
 			{docV,
 				NewTextValue(`{"a": 10, "b": "foo"}`),
@@ -96,6 +100,23 @@ func TestCastAs(t *testing.T) {
 		})
 	})
 
+	t.Run("timestamp", func(t *testing.T) {
+		check(t, TimestampValue, []test{
+			{boolV, Value{}, true},
+			{NewIntegerValue(1609556645), timestampV, false},
+			{doubleV, Value{}, true},
+			{textV, Value{}, true},
+			{NewTextValue("2021-01-02T03:04:05Z"), timestampV, false},
+			{NewTextValue("2021-01-02T05:04:05+02:00"), timestampV, false},
+			{NewTextValue("2021-01-02 03:04:05"), timestampV, false},
+			{NewTextValue("2021-01-02"), NewTimestampValue(time.Date(2021, 1, 2, 0, 0, 0, 0, time.UTC)), false},
+			{timestampV, timestampV, false},
+			{blobV, Value{}, true},
+			{arrayV, Value{}, true},
+			{docV, Value{}, true},
+		})
+	})
+
 	t.Run("blob", func(t *testing.T) {
 		check(t, BlobValue, []test{
 			{boolV, Value{}, true},
@@ -3,6 +3,7 @@ package document
 import (
 	"bytes"
 	"strings"
+	"time"
 )
 
 type operator uint8
@@ -32,6 +33,22 @@ func (op operator) String() string {
 	return ""
 }
 
+// swap returns the operator to use when swapping the operands.
+func (op operator) swap() operator {
+	switch op {
+	case operatorGt:
+		return operatorLt
+	case operatorGte:
+		return operatorLte
+	case operatorLt:
+		return operatorGt
+	case operatorLte:
+		return operatorGte
+	}
+
+	return op
+}
+
 // IsEqual returns true if v is equal to the given value.
 func (v Value) IsEqual(other Value) (bool, error) {
 	return compare(operatorEq, v, other)
@@ -85,6 +102,16 @@ func compare(op operator, l, r Value) (bool, error) {
 	case r.Type == BlobValue && l.Type == BlobValue:
 		return compareBlobs(op, l.V.([]byte), r.V.([]byte)), nil
 
+	// compare timestamps together
+	case l.Type == TimestampValue && r.Type == TimestampValue:
+		return compareTimestamps(op, l.V.(time.Time), r.V.(time.Time)), nil
+
+	// compare timestamps with RFC 3339 texts
+	case l.Type == TimestampValue && r.Type == TextValue:
+		return compareTimestampWithText(op, l, r), nil
+	case l.Type == TextValue && r.Type == TimestampValue:
+		return compareTimestampWithText(op.swap(), r, l), nil
+
 	// compare integers together
 	case l.Type == IntegerValue && r.Type == IntegerValue:
 		return compareIntegers(op, l.V.(int64), r.V.(int64)), nil
@@ -167,6 +194,34 @@ func compareBlobs(op operator, l, r []byte) bool {
 	return false
 }
 
+func compareTimestamps(op operator, l, r time.Time) bool {
+	switch op {
+	case operatorEq:
+		return l.Equal(r)
+	case operatorGt:
+		return l.After(r)
+	case operatorGte:
+		return !l.Before(r)
+	case operatorLt:
+		return l.Before(r)
+	case operatorLte:
+		return !l.After(r)
+	}
+
+	return false
+}
+
+// compareTimestampWithText parses the text as a timestamp and compares it with ts.
+// If the text isn't a valid timestamp, the values are considered different.
+func compareTimestampWithText(op operator, ts, text Value) bool {
+	t, err := text.CastAsTimestamp()
+	if err != nil {
+		return false
+	}
+
+	return compareTimestamps(op, ts.V.(time.Time), t.V.(time.Time))
+}
+
 func compareIntegers(op operator, l, r int64) bool {
 	switch op {
 	case operatorEq:
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/genjidb/genji/document"
 	"github.com/stretchr/testify/require"
@@ -250,3 +251,61 @@ func TestCompare(t *testing.T) {
 		})
 	}
 }
+
+func TestCompareTimestampWithText(t *testing.T) {
+	ts := document.NewTimestampValue(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		op   string
+		text string
+		ok   bool
+	}{
+		{"=", "2021-06-01T12:00:00Z", true},
+		{"=", "2021-06-01T14:00:00+02:00", true},
+		{"=", "2021-06-01", false},
+		{"!=", "2021-06-01", true},
+		{">", "2021-06-01", true},
+		{">", "2021-06-01T12:00:00Z", false},
+		{">=", "2021-06-01T12:00:00Z", true},
+		{"<", "2021-06-02", true},
+		{"<", "2021-06-01", false},
+		{"<=", "2021-06-01 12:00:00", true},
+		{"=", "hello", false},
+		{">", "hello", false},
+		{"<", "hello", false},
+	}
+
+	swapped := map[string]string{"=": "=", "!=": "!=", ">": "<", ">=": "<=", "<": ">", "<=": ">="}
+
+	for _, test := range tests {
+		text := document.NewTextValue(test.text)
+		t.Run(fmt.Sprintf("%s%s", test.op, test.text), func(t *testing.T) {
+			compare := func(a, b document.Value, op string) bool {
+				var ok bool
+				var err error
+
+				switch op {
+				case "=":
+					ok, err = a.IsEqual(b)
+				case "!=":
+					ok, err = a.IsNotEqual(b)
+				case ">":
+					ok, err = a.IsGreaterThan(b)
+				case ">=":
+					ok, err = a.IsGreaterThanOrEqual(b)
+				case "<":
+					ok, err = a.IsLesserThan(b)
+				case "<=":
+					ok, err = a.IsLesserThanOrEqual(b)
+				}
+				require.NoError(t, err)
+				return ok
+			}
+
+			require.Equal(t, test.ok, compare(ts, text, test.op))
+
+			// the result is the same with swapped operands
+			require.Equal(t, test.ok, compare(text, ts, swapped[test.op]))
+		})
+	}
+}
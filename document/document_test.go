@@ -423,7 +423,7 @@ func TestNewFromStruct(t *testing.T) {
 			case 27:
 				require.EqualValues(t, document.IntegerValue, v.Type)
 			case 28:
-				require.EqualValues(t, document.TextValue, v.Type)
+				require.EqualValues(t, document.TimestampValue, v.Type)
 			default:
 				require.FailNowf(t, "", "unknown field %q", f)
 			}
@@ -515,11 +515,10 @@ func TestNewFromStruct(t *testing.T) {
 
 		v, err = doc.GetByField("bb")
 		require.NoError(t, err)
-		var timeStr string
-		require.NoError(t, v.Scan(&timeStr))
-		parsedTime, err := time.Parse(time.RFC3339Nano, timeStr)
-		require.NoError(t, err)
-		require.Equal(t, u.BB, parsedTime)
+		require.Equal(t, document.TimestampValue, v.Type)
+		var bb time.Time
+		require.NoError(t, v.Scan(&bb))
+		require.Equal(t, u.BB, bb)
 	})
 }
 
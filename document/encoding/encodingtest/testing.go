@@ -4,6 +4,7 @@ package encodingtest
 import (
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/document/encoding"
@@ -49,6 +50,7 @@ func testEncodeDecode(t *testing.T, codecBuilder func() encoding.Codec) {
 		Append(document.NewDoubleValue(3)).
 		Append(document.NewBlobValue([]byte("blob"))).
 		Append(document.NewTextValue("hello")).
+		Append(document.NewTimestampValue(time.Date(2020, 11, 15, 16, 37, 10, 20, time.UTC))).
 		Append(document.NewDocumentValue(addressMapDoc)).
 		Append(document.NewArrayValue(document.NewValueBuffer().Append(document.NewIntegerValue(11))))
 
@@ -76,7 +78,7 @@ func testEncodeDecode(t *testing.T, codecBuilder func() encoding.Codec) {
 				Add("name", document.NewTextValue("john")).
 				Add("address", document.NewDocumentValue(addressMapDoc)).
 				Add("array", document.NewArrayValue(complexArray)),
-			`{"age": 10, "name": "john", "address": {"city": "Ajaccio", "country": "France"}, "array": [true, -40, -3.14, 3, "YmxvYg==", "hello", {"city": "Ajaccio", "country": "France"}, [11]]}`,
+			`{"age": 10, "name": "john", "address": {"city": "Ajaccio", "country": "France"}, "array": [true, -40, -3.14, 3, "YmxvYg==", "hello", "2020-11-15T16:37:10.00000002Z", {"city": "Ajaccio", "country": "France"}, [11]]}`,
 		},
 	}
 
@@ -2,6 +2,7 @@ package msgpack
 
 import (
 	"io"
+	"time"
 
 	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/document/encoding"
@@ -109,6 +110,7 @@ func (e *Encoder) EncodeArray(a document.Array) error {
 // - int32 -> int32
 // - int64 -> int64
 // - float64 -> float64
+// - timestamp -> timestamp extension
 func (e *Encoder) EncodeValue(v document.Value) error {
 	switch v.Type {
 	case document.DocumentValue:
@@ -127,6 +129,8 @@ func (e *Encoder) EncodeValue(v document.Value) error {
 		return e.enc.EncodeInt(v.V.(int64))
 	case document.DoubleValue:
 		return e.enc.EncodeFloat64(v.V.(float64))
+	case document.TimestampValue:
+		return e.enc.EncodeTime(v.V.(time.Time))
 	}
 
 	return e.enc.Encode(v.V)
@@ -244,6 +248,14 @@ func (d *Decoder) DecodeValue() (v document.Value, err error) {
 		}
 		v.Type = document.DoubleValue
 		return
+	case msgpcode.FixExt4, msgpcode.FixExt8, msgpcode.Ext8:
+		var t time.Time
+		t, err = d.dec.DecodeTime()
+		if err != nil {
+			return
+		}
+		v = document.NewTimestampValue(t)
+		return
 	}
 
 	panic(stringutil.Sprintf("unsupported type %v", c))
@@ -312,15 +312,13 @@ func scanValue(v Value, ref reflect.Value) error {
 	// test with supported stdlib types
 	switch ref.Type().String() {
 	case "time.Time":
-		if v.Type == TextValue {
-			parsed, err := time.Parse(time.RFC3339Nano, v.V.(string))
-			if err != nil {
-				return err
-			}
-
-			ref.Set(reflect.ValueOf(parsed))
-			return nil
+		v, err := v.CastAsTimestamp()
+		if err != nil {
+			return err
 		}
+
+		ref.Set(reflect.ValueOf(v.V.(time.Time)))
+		return nil
 	}
 
 	switch ref.Kind() {
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"math"
 	"strconv"
+	"time"
 
 	"github.com/buger/jsonparser"
 	"github.com/genjidb/genji/binarysort"
@@ -47,6 +48,9 @@ const (
 	// double family: 0xA0 to 0xAF
 	DoubleValue ValueType = 0xA0
 
+	// timestamp family: 0xB0 to 0xBF
+	TimestampValue ValueType = 0xB0
+
 	// string family: 0xC0 to 0xCF
 	TextValue ValueType = 0xC0
 
@@ -70,6 +74,8 @@ func (t ValueType) String() string {
 		return "integer"
 	case DoubleValue:
 		return "double"
+	case TimestampValue:
+		return "timestamp"
 	case BlobValue:
 		return "blob"
 	case TextValue:
@@ -131,6 +137,15 @@ func NewDoubleValue(x float64) Value {
 	}
 }
 
+// NewTimestampValue encodes x and returns a value.
+// Timestamps are stored in UTC.
+func NewTimestampValue(x time.Time) Value {
+	return Value{
+		Type: TimestampValue,
+		V:    x.UTC(),
+	}
+}
+
 // NewBlobValue encodes x and returns a value.
 func NewBlobValue(x []byte) Value {
 	return Value{
@@ -175,6 +190,8 @@ func NewZeroValue(t ValueType) Value {
 		return NewIntegerValue(0)
 	case DoubleValue:
 		return NewDoubleValue(0)
+	case TimestampValue:
+		return NewTimestampValue(time.Time{})
 	case BlobValue:
 		return NewBlobValue(nil)
 	case TextValue:
@@ -208,6 +225,8 @@ func (v Value) IsZeroValue() (bool, error) {
 		return v.V == integerZeroValue.V, nil
 	case DoubleValue:
 		return v.V == doubleZeroValue.V, nil
+	case TimestampValue:
+		return v.V.(time.Time).IsZero(), nil
 	case BlobValue:
 		return bytes.Equal(v.V.([]byte), blobZeroValue.V.([]byte)), nil
 	case TextValue:
@@ -269,6 +288,8 @@ func (v Value) MarshalJSON() ([]byte, error) {
 		return strconv.AppendFloat(nil, v.V.(float64), fmt, prec, 64), nil
 	case TextValue:
 		return []byte(strconv.Quote(v.V.(string))), nil
+	case TimestampValue:
+		return []byte(strconv.Quote(v.V.(time.Time).Format(time.RFC3339Nano))), nil
 	case BlobValue:
 		src := v.V.([]byte)
 		dst := make([]byte, base64.StdEncoding.EncodedLen(len(src))+2)
@@ -314,6 +335,8 @@ func (v Value) Append(buf []byte) ([]byte, error) {
 		return binarysort.AppendInt64(buf, v.V.(int64)), nil
 	case DoubleValue:
 		return binarysort.AppendFloat64(buf, v.V.(float64)), nil
+	case TimestampValue:
+		return binarysort.AppendTime(buf, v.V.(time.Time)), nil
 	case NullValue:
 		return buf, nil
 	case ArrayValue:
@@ -368,6 +391,12 @@ func (v *Value) UnmarshalBinary(data []byte) error {
 			return err
 		}
 		v.V = x
+	case TimestampValue:
+		x, err := binarysort.DecodeTime(data)
+		if err != nil {
+			return err
+		}
+		v.V = x
 	case ArrayValue:
 		a, _, err := decodeArray(data)
 		if err != nil {
@@ -449,6 +478,10 @@ func calculateValues(a, b Value, operator byte) (res Value, err error) {
 		return NewNullValue(), nil
 	}
 
+	if a.Type == TimestampValue || b.Type == TimestampValue {
+		return Value{}, stringutil.Errorf("cannot use %c with %s and %s, use DATE_ADD to shift timestamps", operator, a.Type, b.Type)
+	}
+
 	if a.Type.IsNumber() && b.Type.IsNumber() {
 		if a.Type == DoubleValue || b.Type == DoubleValue {
 			return calculateFloats(a, b, operator)
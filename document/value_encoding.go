@@ -3,6 +3,7 @@ package document
 import (
 	"errors"
 	"io"
+	"time"
 
 	"github.com/genjidb/genji/binarysort"
 )
@@ -68,6 +69,8 @@ func (ve *ValueEncoder) appendValue(v Value) error {
 		ve.buf = binarysort.AppendInt64(ve.buf, v.V.(int64))
 	case DoubleValue:
 		ve.buf = binarysort.AppendFloat64(ve.buf, v.V.(float64))
+	case TimestampValue:
+		ve.buf = binarysort.AppendTime(ve.buf, v.V.(time.Time))
 	default:
 		return errors.New("cannot encode type " + v.Type.String() + " as key")
 	}
@@ -140,6 +143,11 @@ func (ve *ValueEncoder) appendDocument(d Document) error {
 	return ve.append(documentEnd)
 }
 
+// DecodeValue decodes a value encoded with ValueEncoder.
+func DecodeValue(data []byte) (Value, error) {
+	return decodeValue(data)
+}
+
 // decodeValue decodes a value encoded with ValueEncoder.
 func decodeValue(data []byte) (Value, error) {
 	t := ValueType(data[0])
@@ -178,6 +186,12 @@ func decodeValue(data []byte) (Value, error) {
 			return Value{}, err
 		}
 		return NewDoubleValue(x), nil
+	case TimestampValue:
+		x, err := binarysort.DecodeTime(data)
+		if err != nil {
+			return Value{}, err
+		}
+		return NewTimestampValue(x), nil
 	case ArrayValue:
 		a, _, err := decodeArray(data)
 		if err != nil {
@@ -223,6 +237,12 @@ func decodeValueUntil(data []byte, delim, end byte) (Value, int, error) {
 		} else {
 			return Value{}, 0, errors.New("malformed " + t.String())
 		}
+	case TimestampValue:
+		if i+binarysort.TimeSize < len(data) && (data[i+binarysort.TimeSize] == delim || data[i+binarysort.TimeSize] == end) {
+			i += binarysort.TimeSize
+		} else {
+			return Value{}, 0, errors.New("malformed " + t.String())
+		}
 	case BlobValue, TextValue:
 		for i < len(data) && data[i] != delim && data[i] != end {
 			i++
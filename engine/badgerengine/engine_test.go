@@ -1,6 +1,7 @@
 package badgerengine_test
 
 import (
+	"database/sql"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -10,6 +11,7 @@ import (
 	"github.com/genjidb/genji/engine"
 	"github.com/genjidb/genji/engine/badgerengine"
 	"github.com/genjidb/genji/engine/enginetest"
+	_ "github.com/genjidb/genji/sql/driver"
 	"github.com/stretchr/testify/require"
 )
 
@@ -29,6 +31,39 @@ func TestBadgerEngine(t *testing.T) {
 	enginetest.TestSuite(t, builder(t))
 }
 
+func TestDriverDSN(t *testing.T) {
+	dir, cleanup := tempDir(t)
+	defer cleanup()
+
+	dsn := "genji://" + filepath.Join(dir, "badger") + "?engine=badger"
+
+	db, err := sql.Open("genji", dsn)
+	require.NoError(t, err)
+
+	_, err = db.Exec("CREATE TABLE test; INSERT INTO test (a) VALUES (1)")
+	require.NoError(t, err)
+	require.NoError(t, db.Close())
+
+	db, err = sql.Open("genji", dsn+"&readonly=true")
+	require.NoError(t, err)
+	defer db.Close()
+
+	var a int
+	err = db.QueryRow("SELECT a FROM test").Scan(&a)
+	require.NoError(t, err)
+	require.Equal(t, 1, a)
+
+	_, err = db.Exec("INSERT INTO test (a) VALUES (2)")
+	require.Error(t, err)
+
+	mdb, err := sql.Open("genji", "genji://:memory:?engine=badger")
+	require.NoError(t, err)
+	defer mdb.Close()
+
+	_, err = mdb.Exec("CREATE TABLE test")
+	require.NoError(t, err)
+}
+
 func BenchmarkBadgerEngineStorePut(b *testing.B) {
 	enginetest.BenchmarkStorePut(b, builder(b))
 }
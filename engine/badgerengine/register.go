@@ -0,0 +1,25 @@
+package badgerengine
+
+import (
+	"github.com/dgraph-io/badger/v3"
+	"github.com/genjidb/genji/engine"
+)
+
+// register the engine so that it can be selected by DSNs passed to the database/sql driver,
+// e.g. genji:///data/app?engine=badger.
+func init() {
+	engine.Register("badger", openEngine)
+}
+
+// openEngine opens a Badger engine in the given directory.
+// If the path is :memory:, the database is kept in memory.
+func openEngine(path string, opts engine.OpenOptions) (engine.Engine, error) {
+	var bopts badger.Options
+	if path == ":memory:" {
+		bopts = badger.DefaultOptions("").WithInMemory(true)
+	} else {
+		bopts = badger.DefaultOptions(path)
+	}
+
+	return NewEngine(bopts.WithReadOnly(opts.ReadOnly).WithLogger(nil))
+}
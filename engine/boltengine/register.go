@@ -0,0 +1,18 @@
+package boltengine
+
+import (
+	"github.com/genjidb/genji/engine"
+	bolt "go.etcd.io/bbolt"
+)
+
+func init() {
+	engine.Register("bolt", openEngine)
+}
+
+// openEngine opens a BoltDB engine at the given path.
+func openEngine(path string, opts engine.OpenOptions) (engine.Engine, error) {
+	return NewEngine(path, 0660, &bolt.Options{
+		ReadOnly: opts.ReadOnly,
+		Timeout:  opts.Timeout,
+	})
+}
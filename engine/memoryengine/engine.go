@@ -16,22 +16,32 @@ import (
 const btreeDegree = 12
 
 // Engine is a simple memory engine implementation that stores data in
-// an in-memory Btree. It is not thread safe.
+// an in-memory Btree.
+// Each transaction works on a snapshot of the btrees taken when it was created:
+// writes are applied to copy-on-write clones of the trees and become visible
+// to the transactions created after the commit.
+// Multiple read-only transactions can run concurrently with one read/write transaction.
 type Engine struct {
+	mu        sync.Mutex
 	closed    bool
-	stores    map[string]*tree
+	stores    map[string]*btree.BTree
 	sequences map[string]uint64
+
+	// held by the read/write transaction for its whole lifetime.
+	writeMu sync.Mutex
 }
 
 // NewEngine creates an in-memory engine.
 func NewEngine() *Engine {
 	return &Engine{
-		stores:    make(map[string]*tree),
+		stores:    make(map[string]*btree.BTree),
 		sequences: make(map[string]uint64),
 	}
 }
 
 // Begin creates a transaction.
+// If another read/write transaction is running, opening a read/write transaction
+// blocks until it is commited or rolled back.
 func (ng *Engine) Begin(ctx context.Context, opts engine.TxOptions) (engine.Transaction, error) {
 	select {
 	case <-ctx.Done():
@@ -39,15 +49,35 @@ func (ng *Engine) Begin(ctx context.Context, opts engine.TxOptions) (engine.Tran
 	default:
 	}
 
+	if opts.Writable {
+		ng.writeMu.Lock()
+	}
+
+	ng.mu.Lock()
+	defer ng.mu.Unlock()
+
 	if ng.closed {
+		if opts.Writable {
+			ng.writeMu.Unlock()
+		}
 		return nil, errors.New("engine closed")
 	}
 
-	return &transaction{ctx: ctx, ng: ng, writable: opts.Writable}, nil
+	// cloning a btree is cheap: nodes are shared until one
+	// of the clones modifies them.
+	stores := make(map[string]*btree.BTree, len(ng.stores))
+	for name, tr := range ng.stores {
+		stores[name] = tr.Clone()
+	}
+
+	return &transaction{ctx: ctx, ng: ng, writable: opts.Writable, stores: stores}, nil
 }
 
 // Close the engine.
 func (ng *Engine) Close() error {
+	ng.mu.Lock()
+	defer ng.mu.Unlock()
+
 	if ng.closed {
 		return errors.New("engine already closed")
 	}
@@ -58,19 +88,17 @@ func (ng *Engine) Close() error {
 
 // This implements the engine.Transaction type.
 type transaction struct {
-	ctx        context.Context
-	ng         *Engine
-	writable   bool
-	onRollback []func() // called during a rollback
-	onCommit   []func() // called during a commit
+	ctx      context.Context
+	ng       *Engine
+	writable bool
+	// snapshot of the stores of the engine.
+	// on commit, it replaces the stores of the engine.
+	stores     map[string]*btree.BTree
 	terminated bool
 	wg         sync.WaitGroup
 }
 
-// If the transaction is writable, rollback calls
-// every function stored in the onRollback slice
-// to undo every mutation done since the beginning
-// of the transaction.
+// Rollback discards the snapshot of the transaction.
 func (tx *transaction) Rollback() error {
 	if tx.terminated {
 		return engine.ErrTransactionDiscarded
@@ -81,9 +109,7 @@ func (tx *transaction) Rollback() error {
 	tx.wg.Wait()
 
 	if tx.writable {
-		for _, undo := range tx.onRollback {
-			undo()
-		}
+		tx.ng.writeMu.Unlock()
 	}
 
 	select {
@@ -95,9 +121,7 @@ func (tx *transaction) Rollback() error {
 	return nil
 }
 
-// If the transaction is writable, Commit calls
-// every function stored in the onCommit slice
-// to finalize every mutation done since the beginning
+// Commit replaces the stores of the engine by the snapshot
 // of the transaction.
 func (tx *transaction) Commit() error {
 	if tx.terminated {
@@ -118,9 +142,11 @@ func (tx *transaction) Commit() error {
 
 	tx.terminated = true
 
-	for _, fn := range tx.onCommit {
-		fn()
-	}
+	tx.ng.mu.Lock()
+	tx.ng.stores = tx.stores
+	tx.ng.mu.Unlock()
+
+	tx.ng.writeMu.Unlock()
 
 	return nil
 }
@@ -132,12 +158,12 @@ func (tx *transaction) GetStore(name []byte) (engine.Store, error) {
 	default:
 	}
 
-	tr, ok := tx.ng.stores[string(name)]
+	_, ok := tx.stores[string(name)]
 	if !ok {
 		return nil, engine.ErrStoreNotFound
 	}
 
-	return &storeTx{tx: tx, tr: tr, name: string(name)}, nil
+	return &storeTx{tx: tx, name: string(name)}, nil
 }
 
 func (tx *transaction) CreateStore(name []byte) error {
@@ -151,19 +177,12 @@ func (tx *transaction) CreateStore(name []byte) error {
 		return engine.ErrTransactionReadOnly
 	}
 
-	_, err := tx.GetStore(name)
-	if err == nil {
+	_, ok := tx.stores[string(name)]
+	if ok {
 		return engine.ErrStoreAlreadyExists
 	}
 
-	tr := btree.New(btreeDegree)
-
-	tx.ng.stores[string(name)] = &tree{bt: tr}
-
-	// on rollback, remove the btree from the list of stores
-	tx.onRollback = append(tx.onRollback, func() {
-		delete(tx.ng.stores, string(name))
-	})
+	tx.stores[string(name)] = btree.New(btreeDegree)
 
 	return nil
 }
@@ -179,95 +198,12 @@ func (tx *transaction) DropStore(name []byte) error {
 		return engine.ErrTransactionReadOnly
 	}
 
-	rb, ok := tx.ng.stores[string(name)]
+	_, ok := tx.stores[string(name)]
 	if !ok {
 		return engine.ErrStoreNotFound
 	}
 
-	delete(tx.ng.stores, string(name))
-
-	// on rollback put back the btree to the list of stores
-	tx.onRollback = append(tx.onRollback, func() {
-		tx.ng.stores[string(name)] = rb
-	})
+	delete(tx.stores, string(name))
 
 	return nil
 }
-
-// tree is a thread safe wrapper aroung BTree.
-// It prevents modifying and rebalancing the btree while other
-// routines are reading it.
-type tree struct {
-	bt *btree.BTree
-
-	m sync.RWMutex
-}
-
-func (t *tree) Get(key btree.Item) btree.Item {
-	t.m.RLock()
-	defer t.m.RUnlock()
-
-	return t.bt.Get(key)
-}
-
-func (t *tree) Delete(key btree.Item) btree.Item {
-	t.m.Lock()
-	defer t.m.Unlock()
-
-	return t.bt.Delete(key)
-}
-
-func (t *tree) ReplaceOrInsert(key btree.Item) btree.Item {
-	t.m.Lock()
-	defer t.m.Unlock()
-
-	return t.bt.ReplaceOrInsert(key)
-}
-
-func (t *tree) Ascend(iterator btree.ItemIterator) {
-	t.m.RLock()
-	defer t.m.RUnlock()
-
-	t.bt.Ascend(func(i btree.Item) bool {
-		t.m.RUnlock()
-		defer t.m.RLock()
-
-		return iterator(i)
-	})
-}
-
-func (t *tree) AscendGreaterOrEqual(pivot btree.Item, iterator btree.ItemIterator) {
-	t.m.RLock()
-	defer t.m.RUnlock()
-
-	t.bt.AscendGreaterOrEqual(pivot, func(i btree.Item) bool {
-		t.m.RUnlock()
-		defer t.m.RLock()
-
-		return iterator(i)
-	})
-}
-
-func (t *tree) Descend(iterator btree.ItemIterator) {
-	t.m.RLock()
-	defer t.m.RUnlock()
-
-	t.bt.Descend(func(i btree.Item) bool {
-		t.m.RUnlock()
-		defer t.m.RLock()
-
-		return iterator(i)
-	})
-}
-
-func (t *tree) DescendLessOrEqual(pivot btree.Item, iterator btree.ItemIterator) {
-	t.m.RLock()
-	defer t.m.RUnlock()
-
-	t.bt.DescendLessOrEqual(pivot, func(i btree.Item) bool {
-		t.m.RUnlock()
-		defer t.m.RLock()
-
-		return iterator(i)
-	})
-}
@@ -0,0 +1,20 @@
+package memoryengine
+
+import (
+	"errors"
+
+	"github.com/genjidb/genji/engine"
+)
+
+func init() {
+	engine.Register("memory", openEngine)
+}
+
+// openEngine creates a memory engine, the path is ignored.
+func openEngine(path string, opts engine.OpenOptions) (engine.Engine, error) {
+	if opts.ReadOnly {
+		return nil, errors.New("the memory engine cannot be opened in read-only mode")
+	}
+
+	return NewEngine(), nil
+}
@@ -13,10 +13,6 @@ import (
 // it is also used as a btree.Item.
 type item struct {
 	k, v []byte
-	// set to true if the item has been deleted
-	// during the current transaction
-	// but before rollback or commit.
-	deleted bool
 }
 
 func (i *item) Key() []byte {
@@ -37,18 +33,32 @@ func (i *item) Less(than btree.Item) bool {
 
 // storeTx implements an engine.Store.
 type storeTx struct {
-	tr   *tree
 	tx   *transaction
 	name string
 }
 
-func (s *storeTx) Put(k, v []byte) error {
+// tree returns the btree of the store in the snapshot of the transaction.
+func (s *storeTx) tree() (*btree.BTree, error) {
 	select {
 	case <-s.tx.ctx.Done():
-		return s.tx.ctx.Err()
+		return nil, s.tx.ctx.Err()
 	default:
 	}
 
+	tr, ok := s.tx.stores[s.name]
+	if !ok {
+		return nil, engine.ErrStoreNotFound
+	}
+
+	return tr, nil
+}
+
+func (s *storeTx) Put(k, v []byte) error {
+	tr, err := s.tree()
+	if err != nil {
+		return err
+	}
+
 	if !s.tx.writable {
 		return engine.ErrTransactionReadOnly
 	}
@@ -61,147 +71,75 @@ func (s *storeTx) Put(k, v []byte) error {
 		return errors.New("empty values are forbidden")
 	}
 
-	it := &item{k: k}
-	// if there is an existing value, fetch it
-	// and overwrite it directly using the pointer.
-	if i := s.tr.Get(it); i != nil {
-		cur := i.(*item)
-
-		oldv, oldDeleted := cur.v, cur.deleted
-		cur.v = v
-		cur.deleted = false
-
-		// on rollback replace the new value by the old value
-		s.tx.onRollback = append(s.tx.onRollback, func() {
-			cur.v = oldv
-			cur.deleted = oldDeleted
-		})
-
-		return nil
-	}
-
-	it.v = v
-	s.tr.ReplaceOrInsert(it)
-
-	// on rollback delete the new item
-	s.tx.onRollback = append(s.tx.onRollback, func() {
-		s.tr.Delete(it)
-	})
-
+	tr.ReplaceOrInsert(&item{k: k, v: v})
 	return nil
 }
 
 func (s *storeTx) Get(k []byte) ([]byte, error) {
-	select {
-	case <-s.tx.ctx.Done():
-		return nil, s.tx.ctx.Err()
-	default:
+	tr, err := s.tree()
+	if err != nil {
+		return nil, err
 	}
 
-	it := s.tr.Get(&item{k: k})
-
+	it := tr.Get(&item{k: k})
 	if it == nil {
 		return nil, engine.ErrKeyNotFound
 	}
 
-	i := it.(*item)
-	// don't return items that have been deleted during
-	// this transaction.
-	if i.deleted {
-		return nil, engine.ErrKeyNotFound
-	}
-
 	return it.(*item).v, nil
 }
 
-// Delete marks k for deletion. The item will be actually
-// deleted during the commit phase of the current transaction.
-// The deletion is delayed to avoid a rebalancing of the tree
-// every time we remove an item from it,
-// which causes iterators to behave incorrectly when looping
-// and deleting at the same time.
+// Delete removes k from the store.
+// Iterators are not affected since they iterate over
+// a clone of the tree.
 func (s *storeTx) Delete(k []byte) error {
-	select {
-	case <-s.tx.ctx.Done():
-		return s.tx.ctx.Err()
-	default:
+	tr, err := s.tree()
+	if err != nil {
+		return err
 	}
 
 	if !s.tx.writable {
 		return engine.ErrTransactionReadOnly
 	}
 
-	it := s.tr.Get(&item{k: k})
-	if it == nil {
+	if tr.Delete(&item{k: k}) == nil {
 		return engine.ErrKeyNotFound
 	}
 
-	i := it.(*item)
-	// items that have been deleted during
-	// this transaction must be ignored.
-	if i.deleted {
-		return engine.ErrKeyNotFound
-	}
-
-	// set the deleted flag to true.
-	// this makes the item invisible during this
-	// transaction without actually deleting it
-	// from the tree.
-	// once the transaction is commited, actually
-	// remove it from the tree.
-	i.deleted = true
-
-	// on rollback set the deleted flag to false.
-	s.tx.onRollback = append(s.tx.onRollback, func() {
-		i.deleted = false
-	})
-
-	// on commit, remove the item from the tree.
-	s.tx.onCommit = append(s.tx.onCommit, func() {
-		if i.deleted {
-			s.tr.Delete(i)
-		}
-	})
 	return nil
 }
 
-// Truncate replaces the current tree by a new
-// one. The current tree will be garbage collected
-// once the transaction is commited.
+// Truncate replaces the current tree by a new one.
 func (s *storeTx) Truncate() error {
-	select {
-	case <-s.tx.ctx.Done():
-		return s.tx.ctx.Err()
-	default:
+	_, err := s.tree()
+	if err != nil {
+		return err
 	}
 
 	if !s.tx.writable {
 		return engine.ErrTransactionReadOnly
 	}
 
-	old := s.tr
-	s.tr = &tree{bt: btree.New(btreeDegree)}
-
-	// on rollback replace the new tree by the old one.
-	s.tx.onRollback = append(s.tx.onRollback, func() {
-		s.tr = old
-	})
-
+	s.tx.stores[s.name] = btree.New(btreeDegree)
 	return nil
 }
 
 // NextSequence returns a monotonically increasing integer.
+// Sequences are shared by all the transactions and are not
+// restored on rollback.
 func (s *storeTx) NextSequence() (uint64, error) {
-	select {
-	case <-s.tx.ctx.Done():
-		return 0, s.tx.ctx.Err()
-	default:
+	_, err := s.tree()
+	if err != nil {
+		return 0, err
 	}
 
 	if !s.tx.writable {
 		return 0, engine.ErrTransactionReadOnly
 	}
 
+	s.tx.ng.mu.Lock()
+	defer s.tx.ng.mu.Unlock()
+
 	s.tx.ng.sequences[s.name]++
 
 	return s.tx.ng.sequences[s.name], nil
@@ -211,7 +149,7 @@ func (s *storeTx) NextSequence() (uint64, error) {
 func (s *storeTx) Iterator(opts engine.IteratorOptions) engine.Iterator {
 	return &iterator{
 		tx:      s.tx,
-		tr:      s.tr,
+		name:    s.name,
 		reverse: opts.Reverse,
 		ch:      make(chan *item),
 		closed:  make(chan struct{}),
@@ -221,8 +159,8 @@ func (s *storeTx) Iterator(opts engine.IteratorOptions) engine.Iterator {
 // iterator uses a goroutine to read from the tree on demand.
 type iterator struct {
 	tx      *transaction
+	name    string
 	reverse bool
-	tr      *tree
 	item    *item // current item
 	ch      chan *item
 	closed  chan struct{} // closed by the goroutine when it's shutdown
@@ -243,7 +181,17 @@ func (it *iterator) Seek(pivot []byte) {
 	it.closed = make(chan struct{})
 	it.ctx, it.cancel = context.WithCancel(it.tx.ctx)
 
-	it.runIterator(pivot)
+	tr, ok := it.tx.stores[it.name]
+	if !ok {
+		tr = btree.New(btreeDegree)
+	}
+	// read/write transactions can modify the tree while it is being read:
+	// the iterator reads a clone to remain unaffected.
+	if it.tx.writable {
+		tr = tr.Clone()
+	}
+
+	it.runIterator(pivot, tr)
 
 	it.Next()
 }
@@ -251,30 +199,19 @@ func (it *iterator) Seek(pivot []byte) {
 // runIterator creates a goroutine that reads from the tree.
 // Once the goroutine is done reading or if the context is canceled,
 // both ch and closed channels will be closed.
-func (it *iterator) runIterator(pivot []byte) {
+func (it *iterator) runIterator(pivot []byte, tr *btree.BTree) {
 	it.tx.wg.Add(1)
 
-	go func(ctx context.Context, ch chan *item, tr *tree) {
+	go func(ctx context.Context, ch chan *item, closed chan struct{}) {
 		defer it.tx.wg.Done()
 		defer close(ch)
-		defer close(it.closed)
+		defer close(closed)
 
 		iter := btree.ItemIterator(func(i btree.Item) bool {
 			select {
 			case <-ctx.Done():
 				return false
-			default:
-			}
-
-			itm := i.(*item)
-			if itm.deleted {
-				return true
-			}
-
-			select {
-			case <-ctx.Done():
-				return false
-			case ch <- itm:
+			case ch <- i.(*item):
 				return true
 			}
 		})
@@ -292,7 +229,7 @@ func (it *iterator) runIterator(pivot []byte) {
 				tr.AscendGreaterOrEqual(&item{k: pivot}, iter)
 			}
 		}
-	}(it.ctx, it.ch, it.tr)
+	}(it.ctx, it.ch, it.closed)
 }
 
 func (it *iterator) Valid() bool {
@@ -0,0 +1,44 @@
+package engine
+
+import (
+	"sync"
+	"time"
+)
+
+// OpenOptions are the options engines registered with Register must take into account
+// when opening a database.
+type OpenOptions struct {
+	// Open the engine in read-only mode.
+	ReadOnly bool
+	// Maximum time to wait for the lock of the database files, if the engine uses one.
+	// If zero, wait indefinitely.
+	Timeout time.Duration
+}
+
+// An Opener opens an engine at the given path.
+type Opener func(path string, opts OpenOptions) (Engine, error)
+
+var (
+	openersMu sync.RWMutex
+	openers   = make(map[string]Opener)
+)
+
+// Register makes an engine available under the given name, which can then
+// be selected by the engine parameter of the DSNs passed to the database/sql driver.
+// It is meant to be called by the init function of engine packages.
+// Registering an engine under the name of another one replaces it.
+func Register(name string, open Opener) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+
+	openers[name] = open
+}
+
+// Lookup returns the opener of the engine registered under the given name.
+func Lookup(name string) (Opener, bool) {
+	openersMu.RLock()
+	defer openersMu.RUnlock()
+
+	open, ok := openers[name]
+	return open, ok
+}
@@ -0,0 +1,543 @@
+package expr
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genjidb/genji/document"
+	"github.com/genjidb/genji/stringutil"
+)
+
+// NowFunc represents the NOW() function.
+// It returns the time at which the current transaction started,
+// which means that it returns the same value for every document of a statement.
+type NowFunc struct{}
+
+// Eval returns the start time of the current transaction,
+// or the current time if evaluated outside of a transaction.
+func (n *NowFunc) Eval(env *Environment) (document.Value, error) {
+	if tx := env.GetTx(); tx != nil {
+		return document.NewTimestampValue(tx.StartedAt()), nil
+	}
+
+	return document.NewTimestampValue(time.Now()), nil
+}
+
+// IsEqual compares this expression with the other expression and returns
+// true if they are equal.
+func (n *NowFunc) IsEqual(other Expr) bool {
+	_, ok := other.(*NowFunc)
+	return ok
+}
+
+func (n *NowFunc) String() string {
+	return "NOW()"
+}
+
+// DateTruncFunc represents the DATE_TRUNC(unit, timestamp) function.
+// It truncates the timestamp to the given unit, which must be one of
+// year, quarter, month, week, day, hour, minute, second, millisecond or microsecond.
+// Weeks start on mondays.
+type DateTruncFunc struct {
+	Unit Expr
+	Expr Expr
+}
+
+// Eval returns the truncated timestamp.
+func (d *DateTruncFunc) Eval(env *Environment) (document.Value, error) {
+	unit, err := evalText(env, d.Unit)
+	if err != nil || unit.Type == document.NullValue {
+		return unit, err
+	}
+
+	ts, err := evalTimestamp(env, d.Expr)
+	if err != nil || ts.Type == document.NullValue {
+		return ts, err
+	}
+
+	t, err := truncateTime(ts.V.(time.Time), unit.V.(string))
+	if err != nil {
+		return nullLitteral, err
+	}
+
+	return document.NewTimestampValue(t), nil
+}
+
+// IsEqual compares this expression with the other expression and returns
+// true if they are equal.
+func (d *DateTruncFunc) IsEqual(other Expr) bool {
+	o, ok := other.(*DateTruncFunc)
+	if !ok {
+		return false
+	}
+
+	return Equal(d.Unit, o.Unit) && Equal(d.Expr, o.Expr)
+}
+
+func (d *DateTruncFunc) String() string {
+	return stringutil.Sprintf("DATE_TRUNC(%v, %v)", d.Unit, d.Expr)
+}
+
+// ExtractFunc represents the EXTRACT(part FROM timestamp) function.
+// It returns a field of the timestamp as an integer.
+// The part must be one of year, quarter, month, week (ISO 8601 week number), day,
+// dow (day of the week, 0 being sunday), doy (day of the year), hour, minute, second,
+// millisecond (milliseconds within the second), microsecond (microseconds within the second)
+// or epoch (number of seconds elapsed since January 1, 1970 UTC, returned as a double).
+type ExtractFunc struct {
+	Part Expr
+	Expr Expr
+}
+
+// Eval returns the selected part of the timestamp.
+func (e *ExtractFunc) Eval(env *Environment) (document.Value, error) {
+	part, err := evalText(env, e.Part)
+	if err != nil || part.Type == document.NullValue {
+		return part, err
+	}
+
+	ts, err := evalTimestamp(env, e.Expr)
+	if err != nil || ts.Type == document.NullValue {
+		return ts, err
+	}
+
+	t := ts.V.(time.Time)
+
+	var i int
+	switch strings.ToLower(part.V.(string)) {
+	case "year":
+		i = t.Year()
+	case "quarter":
+		i = (int(t.Month())-1)/3 + 1
+	case "month":
+		i = int(t.Month())
+	case "week":
+		_, i = t.ISOWeek()
+	case "day":
+		i = t.Day()
+	case "dow":
+		i = int(t.Weekday())
+	case "doy":
+		i = t.YearDay()
+	case "hour":
+		i = t.Hour()
+	case "minute":
+		i = t.Minute()
+	case "second":
+		i = t.Second()
+	case "millisecond":
+		i = t.Nanosecond() / int(time.Millisecond)
+	case "microsecond":
+		i = t.Nanosecond() / int(time.Microsecond)
+	case "epoch":
+		return document.NewDoubleValue(float64(t.UnixNano()) / float64(time.Second)), nil
+	default:
+		return nullLitteral, stringutil.Errorf("unknown timestamp part %q", part.V)
+	}
+
+	return document.NewIntegerValue(int64(i)), nil
+}
+
+// IsEqual compares this expression with the other expression and returns
+// true if they are equal.
+func (e *ExtractFunc) IsEqual(other Expr) bool {
+	o, ok := other.(*ExtractFunc)
+	if !ok {
+		return false
+	}
+
+	return Equal(e.Part, o.Part) && Equal(e.Expr, o.Expr)
+}
+
+func (e *ExtractFunc) String() string {
+	return stringutil.Sprintf("EXTRACT(%v FROM %v)", e.Part, e.Expr)
+}
+
+// DateAddFunc represents the DATE_ADD(timestamp, interval) function.
+// It adds the interval to the timestamp. See ParseInterval for the
+// format of the interval.
+type DateAddFunc struct {
+	Expr     Expr
+	Interval Expr
+}
+
+// Eval returns the timestamp shifted by the interval.
+func (d *DateAddFunc) Eval(env *Environment) (document.Value, error) {
+	ts, err := evalTimestamp(env, d.Expr)
+	if err != nil || ts.Type == document.NullValue {
+		return ts, err
+	}
+
+	iv, err := evalInterval(env, d.Interval)
+	if err != nil || iv == nil {
+		return nullLitteral, err
+	}
+
+	return document.NewTimestampValue(iv.AddTo(ts.V.(time.Time))), nil
+}
+
+// IsEqual compares this expression with the other expression and returns
+// true if they are equal.
+func (d *DateAddFunc) IsEqual(other Expr) bool {
+	o, ok := other.(*DateAddFunc)
+	if !ok {
+		return false
+	}
+
+	return Equal(d.Expr, o.Expr) && Equal(d.Interval, o.Interval)
+}
+
+func (d *DateAddFunc) String() string {
+	return stringutil.Sprintf("DATE_ADD(%v, %v)", d.Expr, d.Interval)
+}
+
+// DateBinFunc represents the DATE_BIN(interval, timestamp) function.
+// It returns the beginning of the bucket of the given size the timestamp falls into.
+// Buckets are aligned on January 1, 1970 UTC, and the interval must not
+// contain months or years since they don't have a fixed size.
+type DateBinFunc struct {
+	Interval Expr
+	Expr     Expr
+}
+
+// Eval returns the start of the bucket.
+func (d *DateBinFunc) Eval(env *Environment) (document.Value, error) {
+	iv, err := evalInterval(env, d.Interval)
+	if err != nil || iv == nil {
+		return nullLitteral, err
+	}
+
+	ts, err := evalTimestamp(env, d.Expr)
+	if err != nil || ts.Type == document.NullValue {
+		return ts, err
+	}
+
+	if iv.Months != 0 {
+		return nullLitteral, stringutil.Errorf("cannot bin timestamps into intervals containing months or years")
+	}
+
+	size := int64(iv.Days)*int64(24*time.Hour) + int64(iv.Duration)
+	if size <= 0 {
+		return nullLitteral, stringutil.Errorf("bin interval must be positive")
+	}
+
+	t := ts.V.(time.Time)
+
+	// offset of the timestamp within its bucket, in nanoseconds.
+	// when the size is a whole number of seconds, compute it from the seconds
+	// to support timestamps that don't fit into an int64 of nanoseconds.
+	var offset int64
+	if size%int64(time.Second) == 0 {
+		offset = floorMod(t.Unix(), size/int64(time.Second))*int64(time.Second) + int64(t.Nanosecond())
+	} else {
+		offset = floorMod(t.UnixNano(), size)
+	}
+
+	return document.NewTimestampValue(t.Add(-time.Duration(offset))), nil
+}
+
+// IsEqual compares this expression with the other expression and returns
+// true if they are equal.
+func (d *DateBinFunc) IsEqual(other Expr) bool {
+	o, ok := other.(*DateBinFunc)
+	if !ok {
+		return false
+	}
+
+	return Equal(d.Interval, o.Interval) && Equal(d.Expr, o.Expr)
+}
+
+func (d *DateBinFunc) String() string {
+	return stringutil.Sprintf("DATE_BIN(%v, %v)", d.Interval, d.Expr)
+}
+
+// DateFormatFunc represents the DATE_FORMAT(timestamp, format) function.
+// It formats the timestamp using strftime-like specifiers. See TimeLayout
+// for the list of supported specifiers.
+type DateFormatFunc struct {
+	Expr   Expr
+	Format Expr
+}
+
+// Eval returns the formatted timestamp as a text.
+func (d *DateFormatFunc) Eval(env *Environment) (document.Value, error) {
+	ts, err := evalTimestamp(env, d.Expr)
+	if err != nil || ts.Type == document.NullValue {
+		return ts, err
+	}
+
+	format, err := evalText(env, d.Format)
+	if err != nil || format.Type == document.NullValue {
+		return format, err
+	}
+
+	layout, err := TimeLayout(format.V.(string))
+	if err != nil {
+		return nullLitteral, err
+	}
+
+	return document.NewTextValue(ts.V.(time.Time).Format(layout)), nil
+}
+
+// IsEqual compares this expression with the other expression and returns
+// true if they are equal.
+func (d *DateFormatFunc) IsEqual(other Expr) bool {
+	o, ok := other.(*DateFormatFunc)
+	if !ok {
+		return false
+	}
+
+	return Equal(d.Expr, o.Expr) && Equal(d.Format, o.Format)
+}
+
+func (d *DateFormatFunc) String() string {
+	return stringutil.Sprintf("DATE_FORMAT(%v, %v)", d.Expr, d.Format)
+}
+
+// DateParseFunc represents the DATE_PARSE(text, format) function.
+// It parses the text using strftime-like specifiers and returns a timestamp.
+// See TimeLayout for the list of supported specifiers.
+type DateParseFunc struct {
+	Expr   Expr
+	Format Expr
+}
+
+// Eval returns the parsed timestamp.
+func (d *DateParseFunc) Eval(env *Environment) (document.Value, error) {
+	s, err := evalText(env, d.Expr)
+	if err != nil || s.Type == document.NullValue {
+		return s, err
+	}
+
+	format, err := evalText(env, d.Format)
+	if err != nil || format.Type == document.NullValue {
+		return format, err
+	}
+
+	layout, err := TimeLayout(format.V.(string))
+	if err != nil {
+		return nullLitteral, err
+	}
+
+	t, err := time.Parse(layout, s.V.(string))
+	if err != nil {
+		return nullLitteral, stringutil.Errorf("cannot parse %q as timestamp: %w", s.V, err)
+	}
+
+	return document.NewTimestampValue(t), nil
+}
+
+// IsEqual compares this expression with the other expression and returns
+// true if they are equal.
+func (d *DateParseFunc) IsEqual(other Expr) bool {
+	o, ok := other.(*DateParseFunc)
+	if !ok {
+		return false
+	}
+
+	return Equal(d.Expr, o.Expr) && Equal(d.Format, o.Format)
+}
+
+func (d *DateParseFunc) String() string {
+	return stringutil.Sprintf("DATE_PARSE(%v, %v)", d.Expr, d.Format)
+}
+
+// An Interval represents an amount of time that can be added to a timestamp.
+// Months and days are kept apart from the duration since their length varies.
+type Interval struct {
+	Months   int
+	Days     int
+	Duration time.Duration
+}
+
+// AddTo returns t shifted by the interval.
+func (i Interval) AddTo(t time.Time) time.Time {
+	return t.AddDate(0, i.Months, i.Days).Add(i.Duration)
+}
+
+var intervalUnits = map[string]func(i *Interval, n int64){
+	"microsecond": func(i *Interval, n int64) { i.Duration += time.Duration(n) * time.Microsecond },
+	"millisecond": func(i *Interval, n int64) { i.Duration += time.Duration(n) * time.Millisecond },
+	"second":      func(i *Interval, n int64) { i.Duration += time.Duration(n) * time.Second },
+	"minute":      func(i *Interval, n int64) { i.Duration += time.Duration(n) * time.Minute },
+	"hour":        func(i *Interval, n int64) { i.Duration += time.Duration(n) * time.Hour },
+	"day":         func(i *Interval, n int64) { i.Days += int(n) },
+	"week":        func(i *Interval, n int64) { i.Days += int(n) * 7 },
+	"month":       func(i *Interval, n int64) { i.Months += int(n) },
+	"quarter":     func(i *Interval, n int64) { i.Months += int(n) * 3 },
+	"year":        func(i *Interval, n int64) { i.Months += int(n) * 12 },
+}
+
+// ParseInterval parses a text made of one or more pairs of
+// an integer and a unit, for example "1 hour", "-2 days" or "1 year 6 months".
+// Units are the ones accepted by DATE_TRUNC, in singular or plural form.
+func ParseInterval(s string) (*Interval, error) {
+	fields := strings.Fields(strings.ToLower(s))
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return nil, stringutil.Errorf("invalid interval %q", s)
+	}
+
+	var i Interval
+	for j := 0; j < len(fields); j += 2 {
+		n, err := strconv.ParseInt(fields[j], 10, 64)
+		if err != nil {
+			return nil, stringutil.Errorf("invalid interval %q", s)
+		}
+
+		fn, ok := intervalUnits[strings.TrimSuffix(fields[j+1], "s")]
+		if !ok {
+			return nil, stringutil.Errorf("invalid interval %q: unknown unit %q", s, fields[j+1])
+		}
+		fn(&i, n)
+	}
+
+	return &i, nil
+}
+
+// strftime specifiers and their equivalent in Go time layouts.
+var timeLayoutSpecifiers = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'j': "002",
+	'H': "15",
+	'I': "03",
+	'M': "04",
+	'S': "05",
+	'f': "000000",
+	'L': "000",
+	'p': "PM",
+	'a': "Mon",
+	'A': "Monday",
+	'b': "Jan",
+	'B': "January",
+	'z': "-0700",
+	'Z': "MST",
+	'F': "2006-01-02",
+	'T': "15:04:05",
+	'%': "%",
+}
+
+// TimeLayout converts a format containing strftime specifiers
+// to a Go time layout.
+// The supported specifiers are %Y, %y, %m, %d, %e, %j, %H, %I, %M, %S,
+// %f (microseconds), %L (milliseconds), %p, %a, %A, %b, %B, %z, %Z, %F, %T and %%.
+func TimeLayout(format string) (string, error) {
+	var sb strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			sb.WriteByte(format[i])
+			continue
+		}
+
+		if i+1 == len(format) {
+			return "", stringutil.Errorf("invalid time format %q: trailing %%", format)
+		}
+		i++
+
+		l, ok := timeLayoutSpecifiers[format[i]]
+		if !ok {
+			return "", stringutil.Errorf("invalid time format %q: unknown specifier %%%c", format, format[i])
+		}
+
+		sb.WriteString(l)
+	}
+
+	return sb.String(), nil
+}
+
+// floorMod returns the remainder of the floored division of a by b.
+func floorMod(a, b int64) int64 {
+	m := a % b
+	if m < 0 {
+		m += b
+	}
+	return m
+}
+
+func truncateTime(t time.Time, unit string) (time.Time, error) {
+	y, m, d := t.Date()
+
+	switch strings.ToLower(unit) {
+	case "year":
+		return time.Date(y, time.January, 1, 0, 0, 0, 0, time.UTC), nil
+	case "quarter":
+		return time.Date(y, (m-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC), nil
+	case "month":
+		return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC), nil
+	case "week":
+		// weeks start on mondays
+		return time.Date(y, m, d-(int(t.Weekday())+6)%7, 0, 0, 0, 0, time.UTC), nil
+	case "day":
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), nil
+	case "hour":
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, time.UTC), nil
+	case "minute":
+		return t.Truncate(time.Minute), nil
+	case "second":
+		return t.Truncate(time.Second), nil
+	case "millisecond":
+		return t.Truncate(time.Millisecond), nil
+	case "microsecond":
+		return t.Truncate(time.Microsecond), nil
+	}
+
+	return time.Time{}, stringutil.Errorf("unknown time unit %q", unit)
+}
+
+// evalTimestamp evaluates e and converts the result to a timestamp.
+// It returns a null value if e evaluates to null or if the field doesn't exist.
+func evalTimestamp(env *Environment, e Expr) (document.Value, error) {
+	v, err := e.Eval(env)
+	if err == document.ErrFieldNotFound || v.Type == document.NullValue {
+		return nullLitteral, nil
+	}
+	if err != nil {
+		return v, err
+	}
+
+	return v.CastAsTimestamp()
+}
+
+// evalText evaluates e, which must return a text or null.
+func evalText(env *Environment, e Expr) (document.Value, error) {
+	v, err := e.Eval(env)
+	if err == document.ErrFieldNotFound || v.Type == document.NullValue {
+		return nullLitteral, nil
+	}
+	if err != nil {
+		return v, err
+	}
+
+	if v.Type != document.TextValue {
+		return nullLitteral, stringutil.Errorf("expected text, got %s", v.Type)
+	}
+
+	return v, nil
+}
+
+// evalInterval evaluates e and converts the result to an interval.
+// Integers are considered as a number of seconds, texts are parsed
+// with ParseInterval. It returns nil if e evaluates to null.
+func evalInterval(env *Environment, e Expr) (*Interval, error) {
+	v, err := e.Eval(env)
+	if err == document.ErrFieldNotFound || v.Type == document.NullValue {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch v.Type {
+	case document.IntegerValue:
+		return &Interval{Duration: time.Duration(v.V.(int64)) * time.Second}, nil
+	case document.TextValue:
+		return ParseInterval(v.V.(string))
+	}
+
+	return nil, stringutil.Errorf("cannot use %s as interval", v.Type)
+}
@@ -0,0 +1,144 @@
+package expr_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/genjidb/genji/document"
+	"github.com/genjidb/genji/expr"
+	"github.com/stretchr/testify/require"
+)
+
+var envWithTimestamp = expr.NewEnvironment(document.NewFieldBuffer().
+	Add("ts", document.NewTimestampValue(time.Date(2021, 3, 17, 14, 35, 12, 345678900, time.UTC))))
+
+func timestampValue(s string) document.Value {
+	v, err := document.NewTextValue(s).CastAsTimestamp()
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func TestDateTimeFuncs(t *testing.T) {
+	tests := []struct {
+		expr  string
+		res   document.Value
+		fails bool
+	}{
+		// date_trunc
+		{"date_trunc('year', ts)", timestampValue("2021-01-01"), false},
+		{"date_trunc('quarter', ts)", timestampValue("2021-01-01"), false},
+		{"date_trunc('month', ts)", timestampValue("2021-03-01"), false},
+		{"date_trunc('week', ts)", timestampValue("2021-03-15"), false},
+		{"date_trunc('day', ts)", timestampValue("2021-03-17"), false},
+		{"date_trunc('HOUR', ts)", timestampValue("2021-03-17 14:00:00"), false},
+		{"date_trunc('minute', ts)", timestampValue("2021-03-17 14:35:00"), false},
+		{"date_trunc('second', ts)", timestampValue("2021-03-17 14:35:12"), false},
+		{"date_trunc('millisecond', ts)", timestampValue("2021-03-17 14:35:12.345"), false},
+		{"date_trunc('day', '2021-03-17 10:00:00')", timestampValue("2021-03-17"), false},
+		{"date_trunc('day', notfound)", nullLitteral, false},
+		{"date_trunc('day', NULL)", nullLitteral, false},
+		{"date_trunc('decade', ts)", nullLitteral, true},
+		{"date_trunc(1, ts)", nullLitteral, true},
+		{"date_trunc('day', 'foo')", nullLitteral, true},
+
+		// extract
+		{"extract(year FROM ts)", document.NewIntegerValue(2021), false},
+		{"extract('quarter' FROM ts)", document.NewIntegerValue(1), false},
+		{"extract(month FROM ts)", document.NewIntegerValue(3), false},
+		{"extract(week FROM ts)", document.NewIntegerValue(11), false},
+		{"extract(day FROM ts)", document.NewIntegerValue(17), false},
+		{"extract(dow FROM ts)", document.NewIntegerValue(3), false},
+		{"extract(doy FROM ts)", document.NewIntegerValue(76), false},
+		{"extract(hour FROM ts)", document.NewIntegerValue(14), false},
+		{"extract(minute FROM ts)", document.NewIntegerValue(35), false},
+		{"extract(second FROM ts)", document.NewIntegerValue(12), false},
+		{"extract(millisecond FROM ts)", document.NewIntegerValue(345), false},
+		{"extract(microsecond FROM ts)", document.NewIntegerValue(345678), false},
+		{"extract(epoch FROM '2021-01-01 00:00:01.5')", document.NewDoubleValue(1609459201.5), false},
+		{"extract('year', ts)", document.NewIntegerValue(2021), false},
+		{"extract(year FROM NULL)", nullLitteral, false},
+		{"extract(century FROM ts)", nullLitteral, true},
+
+		// date_add
+		{"date_add(ts, '1 day')", timestampValue("2021-03-18 14:35:12.3456789"), false},
+		{"date_add(ts, '-2 hours 30 minutes')", timestampValue("2021-03-17 13:05:12.3456789"), false},
+		{"date_add(ts, '1 year 1 month')", timestampValue("2022-04-17 14:35:12.3456789"), false},
+		{"date_add(ts, 60)", timestampValue("2021-03-17 14:36:12.3456789"), false},
+		{"date_add('2021-01-31', '1 week')", timestampValue("2021-02-07"), false},
+		{"date_add(ts, NULL)", nullLitteral, false},
+		{"date_add(NULL, '1 day')", nullLitteral, false},
+		{"date_add(ts, '1 fortnight')", nullLitteral, true},
+		{"date_add(ts, '1')", nullLitteral, true},
+		{"date_add(ts, 1.5)", nullLitteral, true},
+
+		// date_bin
+		{"date_bin('15 minutes', ts)", timestampValue("2021-03-17 14:30:00"), false},
+		{"date_bin('1 day', ts)", timestampValue("2021-03-17"), false},
+		{"date_bin('500 milliseconds', ts)", timestampValue("2021-03-17 14:35:12"), false},
+		{"date_bin(10, ts)", timestampValue("2021-03-17 14:35:10"), false},
+		{"date_bin('1 hour', '1969-12-31 23:30:00')", timestampValue("1969-12-31 23:00:00"), false},
+		{"date_bin('1 hour', NULL)", nullLitteral, false},
+		{"date_bin('1 month', ts)", nullLitteral, true},
+		{"date_bin('-1 hour', ts)", nullLitteral, true},
+
+		// date_format
+		{"date_format(ts, '%Y-%m-%d %H:%M:%S.%L')", document.NewTextValue("2021-03-17 14:35:12.345"), false},
+		{"date_format(ts, '%a %d %b %y, %I:%M %p')", document.NewTextValue("Wed 17 Mar 21, 02:35 PM"), false},
+		{"date_format(ts, '%F %T.%f %z %%')", document.NewTextValue("2021-03-17 14:35:12.345678 +0000 %"), false},
+		{"date_format(NULL, '%Y')", nullLitteral, false},
+		{"date_format(ts, '%Q')", nullLitteral, true},
+		{"date_format(ts, '%')", nullLitteral, true},
+
+		// date_parse
+		{"date_parse('17/03/2021 14:35', '%d/%m/%Y %H:%M')", timestampValue("2021-03-17 14:35:00"), false},
+		{"date_parse('2021-03-17 14:35:00 +0200', '%F %T %z')", timestampValue("2021-03-17 12:35:00"), false},
+		{"date_parse(NULL, '%Y')", nullLitteral, false},
+		{"date_parse('foo', '%Y')", nullLitteral, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.expr, func(t *testing.T) {
+			testExpr(t, test.expr, envWithTimestamp, test.res, test.fails)
+		})
+	}
+
+	t.Run("now()", func(t *testing.T) {
+		before := time.Now()
+		v, err := new(expr.NowFunc).Eval(&expr.Environment{})
+		require.NoError(t, err)
+		require.Equal(t, document.TimestampValue, v.Type)
+		require.False(t, v.V.(time.Time).Before(before.UTC().Truncate(time.Microsecond)))
+	})
+}
+
+func TestParseInterval(t *testing.T) {
+	tests := []struct {
+		s     string
+		want  expr.Interval
+		fails bool
+	}{
+		{"1 second", expr.Interval{Duration: time.Second}, false},
+		{"2 Hours 30 minutes", expr.Interval{Duration: 150 * time.Minute}, false},
+		{"1 year -1 month 2 weeks 1 day", expr.Interval{Months: 11, Days: 15}, false},
+		{"3 quarters", expr.Interval{Months: 9}, false},
+		{"10 microseconds 1 millisecond", expr.Interval{Duration: 1010 * time.Microsecond}, false},
+		{"", expr.Interval{}, true},
+		{"1", expr.Interval{}, true},
+		{"one day", expr.Interval{}, true},
+		{"1 days ago", expr.Interval{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			i, err := expr.ParseInterval(test.s)
+			if test.fails {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.want, *i)
+		})
+	}
+}
@@ -1,6 +1,8 @@
 package expr
 
 import (
+	"context"
+
 	"github.com/genjidb/genji/database"
 	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/stringutil"
@@ -9,10 +11,14 @@ import (
 // Environment contains information about the context in which
 // the expression is evaluated.
 type Environment struct {
+	// Ctx is used to cancel the evaluation.
+	Ctx    context.Context
 	Params []Param
 	Vars   *document.FieldBuffer
 	Doc    document.Document
 	Tx     *database.Transaction
+	// Budget tracks the resources used by the evaluation.
+	Budget *database.Budget
 
 	Outer *Environment
 }
@@ -108,9 +114,40 @@ func (e *Environment) GetTx() *database.Transaction {
 	return nil
 }
 
+// GetContext returns the context of the environment or of its outer environments.
+// If none of them has one, it returns the context of the transaction, or
+// context.Background if there is no transaction.
+func (e *Environment) GetContext() context.Context {
+	for env := e; env != nil; env = env.Outer {
+		if env.Ctx != nil {
+			return env.Ctx
+		}
+	}
+
+	if tx := e.GetTx(); tx != nil {
+		return tx.Context()
+	}
+
+	return context.Background()
+}
+
+// GetBudget returns the budget of the environment or of its outer environments,
+// or nil if none of them has one.
+func (e *Environment) GetBudget() *database.Budget {
+	for env := e; env != nil; env = env.Outer {
+		if env.Budget != nil {
+			return env.Budget
+		}
+	}
+
+	return nil
+}
+
 func (e *Environment) Clone() (*Environment, error) {
 	newEnv := Environment{
+		Ctx:    e.Ctx,
 		Params: e.Params,
+		Budget: e.Budget,
 	}
 
 	newEnv.Tx = e.Tx
@@ -66,6 +66,9 @@ func TestString(t *testing.T) {
 		`{"a": "foo", "b": 10}`,
 		"pk()",
 		"CAST(10 AS integer)",
+		"NOW()",
+		`EXTRACT("year" FROM foo.bar[1])`,
+		`DATE_BIN("1 hour", foo.bar[1])`,
 	}
 
 	var operators = []string{
@@ -52,6 +52,48 @@ func BuiltinFunctions() map[string]func(args ...Expr) (Expr, error) {
 			}
 			return &AvgFunc{Expr: args[0]}, nil
 		},
+		"now": func(args ...Expr) (Expr, error) {
+			if len(args) != 0 {
+				return nil, stringutil.Errorf("NOW() takes no arguments")
+			}
+			return new(NowFunc), nil
+		},
+		"date_trunc": func(args ...Expr) (Expr, error) {
+			if len(args) != 2 {
+				return nil, stringutil.Errorf("DATE_TRUNC() takes 2 arguments")
+			}
+			return &DateTruncFunc{Unit: args[0], Expr: args[1]}, nil
+		},
+		"extract": func(args ...Expr) (Expr, error) {
+			if len(args) != 2 {
+				return nil, stringutil.Errorf("EXTRACT() takes 2 arguments")
+			}
+			return &ExtractFunc{Part: args[0], Expr: args[1]}, nil
+		},
+		"date_add": func(args ...Expr) (Expr, error) {
+			if len(args) != 2 {
+				return nil, stringutil.Errorf("DATE_ADD() takes 2 arguments")
+			}
+			return &DateAddFunc{Expr: args[0], Interval: args[1]}, nil
+		},
+		"date_bin": func(args ...Expr) (Expr, error) {
+			if len(args) != 2 {
+				return nil, stringutil.Errorf("DATE_BIN() takes 2 arguments")
+			}
+			return &DateBinFunc{Interval: args[0], Expr: args[1]}, nil
+		},
+		"date_format": func(args ...Expr) (Expr, error) {
+			if len(args) != 2 {
+				return nil, stringutil.Errorf("DATE_FORMAT() takes 2 arguments")
+			}
+			return &DateFormatFunc{Expr: args[0], Format: args[1]}, nil
+		},
+		"date_parse": func(args ...Expr) (Expr, error) {
+			if len(args) != 2 {
+				return nil, stringutil.Errorf("DATE_PARSE() takes 2 arguments")
+			}
+			return &DateParseFunc{Expr: args[0], Format: args[1]}, nil
+		},
 	}
 }
 
@@ -83,6 +125,18 @@ type Aggregator interface {
 	Aggregate(env *Environment) error
 }
 
+// A MergeableAggregator is an aggregator whose state can be combined
+// with the state of another aggregator of the same function.
+// It allows aggregating subsets of a stream separately, for instance
+// in parallel, before merging the partial results.
+type MergeableAggregator interface {
+	Aggregator
+
+	// Merge adds the documents aggregated by other, which must have
+	// been created by the same builder, to the aggregator.
+	Merge(other Aggregator) error
+}
+
 // An AggregatorBuilder is a type that can create aggregators.
 type AggregatorBuilder interface {
 	Aggregator() Aggregator
@@ -239,6 +293,12 @@ func (c *CountAggregator) Aggregate(env *Environment) error {
 }
 
 // Eval returns the result of the aggregation as an integer.
+// Merge adds the counter of other to the counter of c.
+func (c *CountAggregator) Merge(other Aggregator) error {
+	c.Count += other.(*CountAggregator).Count
+	return nil
+}
+
 func (c *CountAggregator) Eval(env *Environment) (document.Value, error) {
 	return document.NewIntegerValue(c.Count), nil
 }
@@ -307,6 +367,20 @@ func (m *MinAggregator) Aggregate(env *Environment) error {
 		return nil
 	}
 
+	return m.update(v)
+}
+
+// Merge keeps the lowest of the minimums of m and other.
+func (m *MinAggregator) Merge(other Aggregator) error {
+	o := other.(*MinAggregator)
+	if o.Min.Type == 0 {
+		return nil
+	}
+
+	return m.update(o.Min)
+}
+
+func (m *MinAggregator) update(v document.Value) error {
 	if m.Min.Type == 0 {
 		m.Min = v
 		return nil
@@ -403,6 +477,20 @@ func (m *MaxAggregator) Aggregate(env *Environment) error {
 		return nil
 	}
 
+	return m.update(v)
+}
+
+// Merge keeps the greatest of the maximums of m and other.
+func (m *MaxAggregator) Merge(other Aggregator) error {
+	o := other.(*MaxAggregator)
+	if o.Max.Type == 0 {
+		return nil
+	}
+
+	return m.update(o.Max)
+}
+
+func (m *MaxAggregator) update(v document.Value) error {
 	if m.Max.Type == 0 {
 		m.Max = v
 		return nil
@@ -502,6 +590,11 @@ func (s *SumAggregator) Aggregate(env *Environment) error {
 		return nil
 	}
 
+	s.add(v)
+	return nil
+}
+
+func (s *SumAggregator) add(v document.Value) {
 	if s.SumF != nil {
 		if v.Type == document.IntegerValue {
 			*s.SumF += float64(v.V.(int64))
@@ -509,7 +602,7 @@ func (s *SumAggregator) Aggregate(env *Environment) error {
 			*s.SumF += float64(v.V.(float64))
 		}
 
-		return nil
+		return
 	}
 
 	if v.Type == document.DoubleValue {
@@ -520,7 +613,7 @@ func (s *SumAggregator) Aggregate(env *Environment) error {
 		s.SumF = &sumF
 		*s.SumF += float64(v.V.(float64))
 
-		return nil
+		return
 	}
 
 	if s.SumI == nil {
@@ -529,6 +622,20 @@ func (s *SumAggregator) Aggregate(env *Environment) error {
 	}
 
 	*s.SumI += v.V.(int64)
+}
+
+// Merge adds the sum of other to the sum of s.
+// The result is a double if any of the sums is a double.
+func (s *SumAggregator) Merge(other Aggregator) error {
+	o := other.(*SumAggregator)
+
+	// once a double is summed, SumF holds the whole sum
+	if o.SumF != nil {
+		s.add(document.NewDoubleValue(*o.SumF))
+	} else if o.SumI != nil {
+		s.add(document.NewIntegerValue(*o.SumI))
+	}
+
 	return nil
 }
 
@@ -618,6 +725,14 @@ func (s *AvgAggregator) Aggregate(env *Environment) error {
 	return nil
 }
 
+// Merge adds the values aggregated by other to s.
+func (s *AvgAggregator) Merge(other Aggregator) error {
+	o := other.(*AvgAggregator)
+	s.Avg += o.Avg
+	s.Counter += o.Counter
+	return nil
+}
+
 // Eval returns the aggregated average as a double.
 func (s *AvgAggregator) Eval(env *Environment) (document.Value, error) {
 	if s.Counter == 0 {
@@ -3,6 +3,7 @@ package expr
 import (
 	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/sql/scanner"
+	"github.com/genjidb/genji/stringutil"
 )
 
 type simpleOperator struct {
@@ -65,6 +66,62 @@ func (op *simpleOperator) IsEqual(other Expr) bool {
 		Equal(op.b, oop.RightHand())
 }
 
+// CloneOperator returns a copy of op that can be modified
+// without altering the original operator.
+// The operands are not copied.
+func CloneOperator(op Operator) Operator {
+	a, b := op.LeftHand(), op.RightHand()
+
+	switch op.(type) {
+	case *addOp:
+		return Add(a, b).(Operator)
+	case *subOp:
+		return Sub(a, b).(Operator)
+	case *mulOp:
+		return Mul(a, b).(Operator)
+	case *divOp:
+		return Div(a, b).(Operator)
+	case *modOp:
+		return Mod(a, b).(Operator)
+	case *bitwiseAndOp:
+		return BitwiseAnd(a, b).(Operator)
+	case *bitwiseOrOp:
+		return BitwiseOr(a, b).(Operator)
+	case *bitwiseXorOp:
+		return BitwiseXor(a, b).(Operator)
+	case *EqOperator:
+		return Eq(a, b).(Operator)
+	case *NeqOperator:
+		return Neq(a, b).(Operator)
+	case *GtOperator:
+		return Gt(a, b).(Operator)
+	case *GteOperator:
+		return Gte(a, b).(Operator)
+	case *LtOperator:
+		return Lt(a, b).(Operator)
+	case *LteOperator:
+		return Lte(a, b).(Operator)
+	case *InOperator:
+		return In(a, b).(Operator)
+	case *NotInOperator:
+		return NotIn(a, b).(Operator)
+	case *IsOperator:
+		return Is(a, b).(Operator)
+	case *IsNotOperator:
+		return IsNot(a, b).(Operator)
+	case *LikeOperator:
+		return Like(a, b).(Operator)
+	case *NotLikeOperator:
+		return NotLike(a, b).(Operator)
+	case *AndOp:
+		return And(a, b).(Operator)
+	case *OrOp:
+		return Or(a, b).(Operator)
+	}
+
+	panic(stringutil.Sprintf("unknown operator %#v", op))
+}
+
 // An Operator is a binary expression that
 // takes two operands and executes an operation on them.
 type Operator interface {
@@ -12,7 +12,17 @@ import (
 
 // New initializes the DB using the given engine.
 func New(ctx context.Context, ng engine.Engine) (*DB, error) {
-	db, err := database.New(ctx, ng, database.Options{Codec: custom.NewCodec()})
+	return NewWithOptions(ctx, ng, database.Options{})
+}
+
+// NewWithOptions initializes the DB using the given engine and options.
+// If opts.Codec is nil, the default codec is used.
+func NewWithOptions(ctx context.Context, ng engine.Engine, opts database.Options) (*DB, error) {
+	if opts.Codec == nil {
+		opts.Codec = custom.NewCodec()
+	}
+
+	db, err := database.New(ctx, ng, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -5,6 +5,7 @@ package genji
 import (
 	"context"
 
+	"github.com/genjidb/genji/database"
 	"github.com/genjidb/genji/engine"
 	"github.com/genjidb/genji/engine/boltengine"
 	"github.com/genjidb/genji/engine/memoryengine"
@@ -14,6 +15,12 @@ import (
 // If path is equal to ":memory:" it will open an in-memory database,
 // otherwise it will create an on-disk database using the BoltDB engine.
 func Open(path string) (*DB, error) {
+	return OpenWithOptions(path, database.Options{})
+}
+
+// OpenWithOptions creates a Genji database at the given path, like Open,
+// and configures it with the given options.
+func OpenWithOptions(path string, opts database.Options) (*DB, error) {
 	var ng engine.Engine
 	var err error
 
@@ -28,5 +35,5 @@ func Open(path string) (*DB, error) {
 	}
 
 	ctx := context.Background()
-	return New(ctx, ng)
+	return NewWithOptions(ctx, ng, opts)
 }
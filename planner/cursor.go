@@ -0,0 +1,205 @@
+package planner
+
+import (
+	"bytes"
+	"encoding/base64"
+
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/document"
+	"github.com/genjidb/genji/expr"
+	"github.com/genjidb/genji/query"
+	"github.com/genjidb/genji/stream"
+)
+
+// EncodeCursor returns an opaque token representing the position.
+// The token contains the primary key of the document and,
+// for index scans, the name of the index, the indexed value and
+// the raw key of the index entry.
+func EncodeCursor(pos *stream.Position) (string, error) {
+	vb := document.NewValueBuffer()
+	if pos.Index != "" {
+		vb = vb.Append(document.NewTextValue(pos.Index)).
+			Append(pos.Value).
+			Append(document.NewBlobValue(pos.Entry))
+	}
+	vb = vb.Append(pos.Key)
+
+	var buf bytes.Buffer
+	err := document.NewValueEncoder(&buf).Encode(document.NewArrayValue(vb))
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// DecodeCursor decodes a token created by EncodeCursor.
+// It returns query.ErrInvalidCursor if the token is malformed.
+func DecodeCursor(token string) (*stream.Position, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) == 0 {
+		return nil, query.ErrInvalidCursor
+	}
+
+	v, err := document.DecodeValue(data)
+	if err != nil || v.Type != document.ArrayValue {
+		return nil, query.ErrInvalidCursor
+	}
+
+	var vb document.ValueBuffer
+	err = vb.Copy(v.V.(document.Array))
+	if err != nil {
+		return nil, query.ErrInvalidCursor
+	}
+
+	var pos stream.Position
+	switch vb.Len() {
+	case 1:
+	case 4:
+		name, _ := vb.GetByIndex(0)
+		entry, _ := vb.GetByIndex(2)
+		if name.Type != document.TextValue || entry.Type != document.BlobValue {
+			return nil, query.ErrInvalidCursor
+		}
+
+		pos.Index = name.V.(string)
+		pos.Value, _ = vb.GetByIndex(1)
+		pos.Entry = entry.V.([]byte)
+	default:
+		return nil, query.ErrInvalidCursor
+	}
+	pos.Key, _ = vb.GetByIndex(vb.Len() - 1)
+
+	return &pos, nil
+}
+
+// cursorScan returns the first operator of the stream if the order of the documents
+// returned by the stream is the order of that operator, which means that the stream
+// can be resumed from the position of any document it returned.
+// Otherwise it returns nil.
+func cursorScan(s *stream.Stream) stream.Operator {
+	first := s.First()
+
+	switch t := first.(type) {
+	case *stream.SeqScanOperator:
+	case *stream.PkScanOperator:
+		// multiple ranges are not guaranteed to be sorted
+		if len(t.Ranges) > 1 {
+			return nil
+		}
+	case *stream.IndexScanOperator:
+		if len(t.Ranges) > 1 {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	for n := first.GetNext(); n != nil; n = n.GetNext() {
+		switch n.(type) {
+		case *stream.FilterOperator, *stream.ProjectOperator, *stream.TakeOperator:
+		default:
+			return nil
+		}
+	}
+
+	return first
+}
+
+// resumeAfter modifies the first operator of the stream so that
+// it only returns the documents located after the given position.
+func resumeAfter(s *stream.Stream, pos *stream.Position) error {
+	switch t := cursorScan(s).(type) {
+	case *stream.SeqScanOperator:
+		if pos.Index != "" {
+			return query.ErrInvalidCursor
+		}
+
+		pk := stream.PkScan(t.TableName)
+		pk.Reverse = t.Reverse
+		pk.After = pos
+		stream.InsertBefore(t, pk)
+		s.Remove(t)
+	case *stream.PkScanOperator:
+		if pos.Index != "" {
+			return query.ErrInvalidCursor
+		}
+
+		t.After = pos
+	case *stream.IndexScanOperator:
+		// the cursor must have been created by a scan of the same index
+		if pos.Index != t.IndexName {
+			return query.ErrInvalidCursor
+		}
+
+		t.After = pos
+	default:
+		return query.ErrCursorNotSupported
+	}
+
+	return nil
+}
+
+// documentKey returns the key of the document read from the table
+// by the first operator of the stream.
+func documentKey(env *expr.Environment) []byte {
+	for e := env; e != nil; e = e.Outer {
+		if k, ok := e.Doc.(document.Keyer); ok && k.RawKey() != nil {
+			return k.RawKey()
+		}
+	}
+
+	return nil
+}
+
+// position returns the position of the document with the given key,
+// relative to the scan. For index scans, entry is the raw key of the
+// index entry of the document.
+func position(tx *database.Transaction, scan stream.Operator, key, entry []byte) (*stream.Position, error) {
+	var pos stream.Position
+	var tableName string
+	var path document.Path
+
+	switch t := scan.(type) {
+	case *stream.SeqScanOperator:
+		tableName = t.TableName
+	case *stream.PkScanOperator:
+		tableName = t.TableName
+	case *stream.IndexScanOperator:
+		idx, err := tx.GetIndex(t.IndexName)
+		if err != nil {
+			return nil, err
+		}
+		tableName = idx.Info.TableName
+		path = idx.Info.Path
+		pos.Index = t.IndexName
+		pos.Entry = entry
+	}
+
+	table, err := tx.GetTable(tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := table.GetDocument(key)
+	if err != nil {
+		return nil, err
+	}
+
+	pos.Key, err = d.(document.Keyer).Key()
+	if err != nil {
+		return nil, err
+	}
+
+	if path != nil {
+		// documents without the indexed path are indexed as null
+		pos.Value, err = path.GetValueFromDocument(d)
+		if err == document.ErrFieldNotFound {
+			pos.Value = document.NewNullValue()
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return &pos, nil
+}
@@ -1,36 +1,64 @@
 package planner
 
 import (
+	"context"
 	"errors"
+	"strings"
 
 	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/expr"
 	"github.com/genjidb/genji/query"
 	"github.com/genjidb/genji/stream"
+	"github.com/genjidb/genji/stringutil"
+)
+
+// ExplainFormat determines how EXPLAIN returns the execution plan.
+type ExplainFormat uint8
+
+// List of supported formats.
+const (
+	// ExplainFormatText returns the plan as a single line of text.
+	ExplainFormatText ExplainFormat = iota
+	// ExplainFormatJSON returns the plan as a tree of documents.
+	ExplainFormatJSON
 )
 
 // ExplainStmt is a query.Statement that
 // displays information about how a statement
 // is going to be executed, without executing it.
+// If Analyze is true, the statement is executed and
+// statistics about each operator are returned instead.
 type ExplainStmt struct {
 	Statement query.Statement
+	Analyze   bool
+	Format    ExplainFormat
 }
 
 // Run analyses the inner statement and displays its execution plan.
 // If the statement is a stream, Optimize will be called prior to
 // displaying all the operations.
 // Explain currently only works on SELECT, UPDATE, INSERT and DELETE statements.
-func (s *ExplainStmt) Run(tx *database.Transaction, params []expr.Param) (query.Result, error) {
+func (s *ExplainStmt) Run(ctx context.Context, tx *database.Transaction, params []expr.Param) (query.Result, error) {
 	switch t := s.Statement.(type) {
 	case *Statement:
-		s, err := Optimize(t.Stream, tx, params)
+		st, err := t.optimize(tx, params)
 		if err != nil {
 			return query.Result{}, err
 		}
 
+		if s.Analyze {
+			return s.analyze(ctx, st, tx, params)
+		}
+
+		if s.Format == ExplainFormatJSON {
+			return documentsResult(ctx, tx, params, document.NewFieldBuffer().
+				Add("plan", explainOperators(operators(st), nil)))
+		}
+
 		var plan string
-		if s != nil {
-			plan = s.String()
+		if st != nil {
+			plan = st.String()
 		} else {
 			plan = "<no exec>"
 		}
@@ -45,14 +73,239 @@ func (s *ExplainStmt) Run(tx *database.Transaction, params []expr.Param) (query.
 			},
 			ReadOnly: true,
 		}
-		return newStatement.Run(tx, params)
+		return newStatement.Run(ctx, tx, params)
 	}
 
 	return query.Result{}, errors.New("EXPLAIN only works on INSERT, SELECT, UPDATE AND DELETE statements")
 }
 
+// Prepare the inner statement, if it can be prepared.
+func (s *ExplainStmt) Prepare() error {
+	if p, ok := s.Statement.(query.Preparer); ok {
+		return p.Prepare()
+	}
+
+	return nil
+}
+
 // IsReadOnly indicates that this statement doesn't write anything into
-// the database.
+// the database, unless the inner statement is executed by EXPLAIN ANALYZE.
 func (s *ExplainStmt) IsReadOnly() bool {
-	return true
+	return !s.Analyze || s.Statement.IsReadOnly()
+}
+
+// analyze executes the stream and returns statistics about the execution
+// of each operator.
+// With the text format, it returns one document per operator.
+func (s *ExplainStmt) analyze(ctx context.Context, st *stream.Stream, tx *database.Transaction, params []expr.Param) (query.Result, error) {
+	// instrumenting the stream modifies the operators,
+	// they must be listed beforehand.
+	ops := operators(st)
+
+	var stats []*stream.OperatorStatistics
+	if st != nil {
+		st, stats = stream.Instrument(st)
+
+		it := statementIterator{
+			Ctx:    ctx,
+			Stream: st,
+			Tx:     tx,
+			Params: params,
+		}
+		err := it.Iterate(func(d document.Document) error {
+			return nil
+		})
+		if err != nil {
+			return query.Result{}, err
+		}
+	}
+
+	if s.Format == ExplainFormatJSON {
+		return documentsResult(ctx, tx, params, document.NewFieldBuffer().
+			Add("plan", explainOperators(ops, stats)))
+	}
+
+	docs := make([]document.Document, 0, len(stats))
+	for _, s := range stats {
+		fb := document.NewFieldBuffer().Add("operator", document.NewTextValue(s.Operator))
+		docs = append(docs, addOperatorStatistics(fb, s))
+	}
+
+	return documentsResult(ctx, tx, params, docs...)
+}
+
+func documentsResult(ctx context.Context, tx *database.Transaction, params []expr.Param, docs ...document.Document) (query.Result, error) {
+	newStatement := Statement{
+		Stream:   stream.New(stream.Documents(docs...)),
+		ReadOnly: true,
+	}
+	return newStatement.Run(ctx, tx, params)
+}
+
+// operators returns the list of operators of the stream, in order.
+func operators(st *stream.Stream) []stream.Operator {
+	if st == nil {
+		return nil
+	}
+
+	var ops []stream.Operator
+	for op := st.First(); op != nil; op = op.GetNext() {
+		ops = append(ops, op)
+	}
+
+	return ops
+}
+
+// explainOperators returns a tree of documents describing the operators.
+// The last operator is the root of the tree and each operator
+// lists the operator it reads from in its children field.
+// If stats is not empty, it must contain the statistics of each operator.
+func explainOperators(ops []stream.Operator, stats []*stream.OperatorStatistics) document.Value {
+	var child *document.FieldBuffer
+
+	for i, op := range ops {
+		fb := explainOperator(op)
+		if i < len(stats) {
+			addOperatorStatistics(fb, stats[i])
+		}
+
+		if child != nil {
+			fb.Add("children", document.NewArrayValue(document.NewValueBuffer(document.NewDocumentValue(child))))
+		}
+
+		child = fb
+	}
+
+	if child == nil {
+		return document.NewNullValue()
+	}
+
+	return document.NewDocumentValue(child)
+}
+
+// explainOperator returns a document describing the operator and its arguments.
+func explainOperator(op stream.Operator) *document.FieldBuffer {
+	fb := document.NewFieldBuffer()
+
+	name := op.String()
+	if i := strings.IndexByte(name, '('); i >= 0 {
+		name = name[:i]
+	}
+	fb.Add("operator", document.NewTextValue(name))
+
+	switch t := op.(type) {
+	case *stream.SeqScanOperator:
+		fb.Add("table", document.NewTextValue(t.TableName))
+		fb.Add("reverse", document.NewBoolValue(t.Reverse))
+	case *stream.PkScanOperator:
+		fb.Add("table", document.NewTextValue(t.TableName))
+		fb.Add("ranges", explainRanges(t.Ranges))
+		fb.Add("reverse", document.NewBoolValue(t.Reverse))
+	case *stream.IndexScanOperator:
+		fb.Add("index", document.NewTextValue(t.IndexName))
+		fb.Add("ranges", explainRanges(t.Ranges))
+		fb.Add("reverse", document.NewBoolValue(t.Reverse))
+		fb.Add("covering", document.NewBoolValue(t.Covering))
+	case *stream.DocumentsOperator:
+		fb.Add("count", document.NewIntegerValue(int64(len(t.Docs))))
+	case *stream.ExprsOperator:
+		fb.Add("exprs", explainExprs(t.Exprs))
+	case *stream.ProjectOperator:
+		fb.Add("exprs", explainExprs(t.Exprs))
+	case *stream.MapOperator:
+		fb.Add("expr", explainExpr(t.E))
+	case *stream.FilterOperator:
+		fb.Add("expr", explainExpr(t.E))
+	case *stream.GroupByOperator:
+		fb.Add("expr", explainExpr(t.E))
+	case *stream.TakeOperator:
+		fb.Add("n", document.NewIntegerValue(t.N))
+	case *stream.SkipOperator:
+		fb.Add("n", document.NewIntegerValue(t.N))
+	case *stream.SortOperator:
+		fb.Add("expr", explainExpr(t.Expr))
+		fb.Add("desc", document.NewBoolValue(t.Desc))
+	case *stream.TopNOperator:
+		fb.Add("expr", explainExpr(t.Expr))
+		fb.Add("desc", document.NewBoolValue(t.Desc))
+		fb.Add("n", document.NewIntegerValue(t.N))
+	case *stream.HashAggregateOperator:
+		vb := document.NewValueBuffer()
+		for _, b := range t.Builders {
+			vb = vb.Append(explainExpr(b))
+		}
+		fb.Add("aggregators", document.NewArrayValue(vb))
+	case *stream.TableInsertOperator:
+		fb.Add("table", document.NewTextValue(t.Name))
+	case *stream.TableReplaceOperator:
+		fb.Add("table", document.NewTextValue(t.Name))
+	case *stream.TableDeleteOperator:
+		fb.Add("table", document.NewTextValue(t.Name))
+	case *stream.SetOperator:
+		fb.Add("path", document.NewTextValue(t.Path.String()))
+		fb.Add("expr", explainExpr(t.E))
+	case *stream.UnsetOperator:
+		fb.Add("field", document.NewTextValue(t.Field))
+	case *stream.GatherOperator:
+		fb.Add("workers", document.NewIntegerValue(int64(t.Workers)))
+	case *stream.IterRenameOperator:
+		vb := document.NewValueBuffer()
+		for _, f := range t.FieldNames {
+			vb = vb.Append(document.NewTextValue(f))
+		}
+		fb.Add("fields", document.NewArrayValue(vb))
+	}
+
+	return fb
+}
+
+func explainExprs(exprs []expr.Expr) document.Value {
+	vb := document.NewValueBuffer()
+	for _, e := range exprs {
+		vb = vb.Append(explainExpr(e))
+	}
+
+	return document.NewArrayValue(vb)
+}
+
+func explainExpr(e interface{}) document.Value {
+	return document.NewTextValue(stringutil.Sprintf("%v", e))
+}
+
+func explainRanges(ranges stream.Ranges) document.Value {
+	vb := document.NewValueBuffer()
+	for _, r := range ranges {
+		// parameters are reported using their textual representation
+		min, max := r.Min, r.Max
+		if r.MinParam != nil {
+			min = explainExpr(r.MinParam)
+		}
+		if r.MaxParam != nil {
+			max = explainExpr(r.MaxParam)
+		}
+
+		fb := document.NewFieldBuffer()
+		if r.Exact {
+			fb.Add("value", min)
+		} else {
+			if !min.Type.IsZero() && min.V != nil {
+				fb.Add("min", min)
+			}
+			if !max.Type.IsZero() && max.V != nil {
+				fb.Add("max", max)
+			}
+			fb.Add("exclusive", document.NewBoolValue(r.Exclusive))
+		}
+		vb = vb.Append(document.NewDocumentValue(fb))
+	}
+
+	return document.NewArrayValue(vb)
+}
+
+func addOperatorStatistics(fb *document.FieldBuffer, s *stream.OperatorStatistics) *document.FieldBuffer {
+	return fb.
+		Add("rows_in", document.NewIntegerValue(s.RowsIn)).
+		Add("rows_out", document.NewIntegerValue(s.RowsOut)).
+		Add("time", document.NewTextValue(s.Duration.String())).
+		Add("decoded_documents", document.NewIntegerValue(s.DecodedDocuments))
 }
@@ -2,8 +2,11 @@ package planner_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/genjidb/genji"
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/document"
 	"github.com/stretchr/testify/require"
 )
 
@@ -22,7 +25,9 @@ func TestExplainStmt(t *testing.T) {
 		// {"EXPLAIN SELECT a + 1 FROM test WHERE c > 10 AND d > 20", false, `"seqScan(test) | filter(c > 10) | filter(d > 20) | project(a + 1)"`},
 		// {"EXPLAIN SELECT a + 1 FROM test WHERE c > 10 OR d > 20", false, `"seqScan(test) | filter(c > 10 OR d > 20) | project(a + 1)"`},
 		// {"EXPLAIN SELECT a + 1 FROM test WHERE c IN [1 + 1, 2 + 2]", false, `"seqScan(test) | filter(c IN [2, 4]) | project(a + 1)"`},
-		{"EXPLAIN SELECT a + 1 FROM test WHERE a > 10", false, `"indexScan(\"idx_a\", [10, -1, true]) | project(a + 1)"`},
+		{"EXPLAIN SELECT a + 1 FROM test WHERE a > 10", false, `"indexOnlyScan(\"idx_a\", [10, -1, true]) | project(a + 1)"`},
+		{"EXPLAIN SELECT k, a FROM test WHERE a > 10", false, `"indexScan(\"idx_a\", [10, -1, true]) | project(k, a)"`},
+		{"EXPLAIN SELECT a + 1 FROM test WHERE c > 30 ORDER BY d DESC LIMIT 10 OFFSET 20", false, `"seqScan(test) | filter(c > 30) | project(a + 1) | topNReverse(d, 30) | skip(20)"`},
 		// {"EXPLAIN SELECT a + 1 FROM test WHERE a > 10 AND b > 20 AND c > 30", false, `"indexScan(\"idx_b\", [20, -1, true]) | filter(a > 10) | filter(c > 30) | project(a + 1)"`},
 		// {"EXPLAIN SELECT a + 1 FROM test WHERE c > 30 ORDER BY d LIMIT 10 OFFSET 20", false, `"seqScan(test) | filter(c > 30) | project(a + 1) | sort(d) | skip(20) | take(10)"`},
 		// {"EXPLAIN SELECT a + 1 FROM test WHERE c > 30 ORDER BY d DESC LIMIT 10 OFFSET 20", false, `"seqScan(test) | filter(c > 30) | project(a + 1) | sortReverse(d) | skip(20) | take(10)"`},
@@ -65,3 +70,275 @@ func TestExplainStmt(t *testing.T) {
 		})
 	}
 }
+
+func TestExplainAnalyzeStmt(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec(`
+		CREATE TABLE test (k INTEGER PRIMARY KEY, a INTEGER);
+		CREATE INDEX idx_a ON test (a);
+	`)
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		err = db.Exec("INSERT INTO test (k, a, b) VALUES (?, ?, ?)", i, i%10, i)
+		require.NoError(t, err)
+	}
+
+	type operatorStats struct {
+		Operator         string
+		RowsIn           int64 `genji:"rows_in"`
+		RowsOut          int64 `genji:"rows_out"`
+		Time             string
+		DecodedDocuments int64 `genji:"decoded_documents"`
+	}
+
+	analyze := func(t *testing.T, q string) []operatorStats {
+		t.Helper()
+
+		res, err := db.Query(q)
+		require.NoError(t, err)
+		defer res.Close()
+
+		var stats []operatorStats
+		err = res.Iterate(func(d document.Document) error {
+			var s operatorStats
+			err := document.StructScan(d, &s)
+			if err != nil {
+				return err
+			}
+			stats = append(stats, s)
+			return nil
+		})
+		require.NoError(t, err)
+		return stats
+	}
+
+	t.Run("SELECT", func(t *testing.T) {
+		stats := analyze(t, "EXPLAIN ANALYZE SELECT k FROM test WHERE b > 50 LIMIT 10")
+		require.Len(t, stats, 4)
+
+		require.Equal(t, "seqScan(test)", stats[0].Operator)
+		require.EqualValues(t, 0, stats[0].RowsIn)
+		require.EqualValues(t, 62, stats[0].RowsOut)
+		// documents are decoded lazily, by the first operator reading them
+		require.EqualValues(t, 0, stats[0].DecodedDocuments)
+
+		require.Equal(t, "filter(b > 50)", stats[1].Operator)
+		require.EqualValues(t, 62, stats[1].RowsIn)
+		require.EqualValues(t, 11, stats[1].RowsOut)
+		require.EqualValues(t, 62, stats[1].DecodedDocuments)
+
+		require.Equal(t, "project(k)", stats[2].Operator)
+		require.EqualValues(t, 11, stats[2].RowsIn)
+		require.EqualValues(t, 11, stats[2].RowsOut)
+
+		// take closes the stream when it receives the 11th document
+		require.Equal(t, "take(10)", stats[3].Operator)
+		require.EqualValues(t, 11, stats[3].RowsIn)
+		require.EqualValues(t, 10, stats[3].RowsOut)
+
+		for _, s := range stats {
+			_, err := time.ParseDuration(s.Time)
+			require.NoError(t, err)
+		}
+	})
+
+	t.Run("index", func(t *testing.T) {
+		stats := analyze(t, "EXPLAIN ANALYZE SELECT * FROM test WHERE a = 3")
+		require.Len(t, stats, 1)
+
+		require.Equal(t, `indexScan("idx_a", 3)`, stats[0].Operator)
+		require.EqualValues(t, 10, stats[0].RowsOut)
+		require.EqualValues(t, 10, stats[0].DecodedDocuments)
+	})
+
+	t.Run("DELETE", func(t *testing.T) {
+		stats := analyze(t, "EXPLAIN ANALYZE DELETE FROM test WHERE a = 3")
+		require.Len(t, stats, 2)
+		require.EqualValues(t, 10, stats[1].RowsIn)
+
+		// the statement must have been executed
+		d, err := db.QueryDocument("SELECT COUNT(*) AS n FROM test")
+		require.NoError(t, err)
+		v, err := d.GetByField("n")
+		require.NoError(t, err)
+		require.Equal(t, document.NewIntegerValue(90), v)
+	})
+}
+
+func TestExplainAnalyzeParallel(t *testing.T) {
+	db, err := genji.OpenWithOptions(":memory:", database.Options{ParallelWorkers: 4})
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec("CREATE TABLE test (a INTEGER)")
+	require.NoError(t, err)
+
+	for i := 0; i < 1000; i++ {
+		err = db.Exec("INSERT INTO test (a) VALUES (?)", i)
+		require.NoError(t, err)
+	}
+	err = db.Exec("ANALYZE test")
+	require.NoError(t, err)
+
+	type operatorStats struct {
+		Operator         string
+		RowsIn           int64 `genji:"rows_in"`
+		RowsOut          int64 `genji:"rows_out"`
+		DecodedDocuments int64 `genji:"decoded_documents"`
+	}
+
+	res, err := db.Query("EXPLAIN ANALYZE SELECT COUNT(*) FROM test WHERE a % 10 = 0")
+	require.NoError(t, err)
+	defer res.Close()
+
+	var stats []operatorStats
+	err = res.Iterate(func(d document.Document) error {
+		var s operatorStats
+		err := document.StructScan(d, &s)
+		if err != nil {
+			return err
+		}
+		stats = append(stats, s)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, stats, 5)
+
+	// the statistics of the workers are added up
+	require.Equal(t, "seqScan(test)", stats[0].Operator)
+	require.EqualValues(t, 1000, stats[0].RowsOut)
+
+	require.Equal(t, "filter(a % 10 = 0)", stats[1].Operator)
+	require.EqualValues(t, 1000, stats[1].RowsIn)
+	require.EqualValues(t, 100, stats[1].RowsOut)
+
+	require.Equal(t, "hashAggregate(COUNT(*))", stats[2].Operator)
+	require.EqualValues(t, 100, stats[2].RowsIn)
+	require.EqualValues(t, 1, stats[2].RowsOut)
+
+	// the documents decoded by the workers are reported by the gather operator
+	require.Equal(t, "gather(4)", stats[3].Operator)
+	require.EqualValues(t, 1, stats[3].RowsIn)
+	require.EqualValues(t, 1, stats[3].RowsOut)
+	require.EqualValues(t, 1000, stats[3].DecodedDocuments)
+}
+
+func TestExplainStmtFormatJSON(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"EXPLAIN (FORMAT JSON) SELECT 1 + 1", `{"operator": "project", "exprs": ["1 + 1"]}`},
+		{"EXPLAIN (FORMAT JSON) SELECT k, a FROM test WHERE a > 10", `{
+			"operator": "project",
+			"exprs": ["k", "a"],
+			"children": [{
+				"operator": "indexScan",
+				"index": "idx_a",
+				"ranges": [{"min": 10, "exclusive": true}],
+				"reverse": false,
+				"covering": false
+			}]
+		}`},
+		{"EXPLAIN (FORMAT JSON) SELECT k FROM test WHERE b = 2", `{
+			"operator": "project",
+			"exprs": ["k"],
+			"children": [{
+				"operator": "indexScan",
+				"index": "idx_b",
+				"ranges": [{"value": 2}],
+				"reverse": false,
+				"covering": false
+			}]
+		}`},
+		{"EXPLAIN (FORMAT JSON) DELETE FROM test WHERE c > 10", `{
+			"operator": "tableDelete",
+			"table": "test",
+			"children": [{
+				"operator": "filter",
+				"expr": "c > 10",
+				"children": [{
+					"operator": "seqScan",
+					"table": "test",
+					"reverse": false
+				}]
+			}]
+		}`},
+		{"EXPLAIN (FORMAT JSON) SELECT a + 1 FROM test ORDER BY d DESC LIMIT 10", `{
+			"operator": "topNReverse",
+			"expr": "d",
+			"desc": true,
+			"n": 10,
+			"children": [{
+				"operator": "project",
+				"exprs": ["a + 1"],
+				"children": [{
+					"operator": "seqScan",
+					"table": "test",
+					"reverse": false
+				}]
+			}]
+		}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			db, err := genji.Open(":memory:")
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.Exec(`
+				CREATE TABLE test (k INTEGER PRIMARY KEY);
+				CREATE INDEX idx_a ON test (a);
+				CREATE UNIQUE INDEX idx_b ON test (b);
+			`)
+			require.NoError(t, err)
+
+			d, err := db.QueryDocument(test.query)
+			require.NoError(t, err)
+
+			v, err := d.GetByField("plan")
+			require.NoError(t, err)
+
+			require.JSONEq(t, test.expected, v.String())
+		})
+	}
+
+	t.Run("ANALYZE", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test (k INTEGER PRIMARY KEY);
+			INSERT INTO test (k, a) VALUES (1, 1), (2, 2), (3, 3);
+		`)
+		require.NoError(t, err)
+
+		d, err := db.QueryDocument("EXPLAIN (ANALYZE, FORMAT JSON) SELECT * FROM test WHERE a > 1")
+		require.NoError(t, err)
+
+		var plan struct {
+			Operator string
+			RowsIn   int64 `genji:"rows_in"`
+			RowsOut  int64 `genji:"rows_out"`
+			Children []struct {
+				Operator string
+				RowsOut  int64 `genji:"rows_out"`
+			}
+		}
+		err = document.Scan(d, &plan)
+		require.NoError(t, err)
+
+		require.Equal(t, "filter", plan.Operator)
+		require.EqualValues(t, 3, plan.RowsIn)
+		require.EqualValues(t, 2, plan.RowsOut)
+		require.Len(t, plan.Children, 1)
+		require.Equal(t, "seqScan", plan.Children[0].Operator)
+		require.EqualValues(t, 3, plan.Children[0].RowsOut)
+	})
+}
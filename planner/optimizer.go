@@ -1,6 +1,8 @@
 package planner
 
 import (
+	"errors"
+
 	"github.com/genjidb/genji/database"
 	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/expr"
@@ -15,12 +17,19 @@ var optimizerRules = []func(s *stream.Stream, tx *database.Transaction, params [
 	RemoveUnnecessaryDistinctNodeRule,
 	RemoveUnnecessaryProjection,
 	UseIndexBasedOnFilterNodeRule,
+	UseParallelScanRule,
+	UseIndexBasedOnSortNodeRule,
+	FuseSortAndTakeNodesRule,
+	UseCoveringIndexRule,
 }
 
 // Optimize takes a tree, applies a list of optimization rules
 // and returns an optimized tree.
 // Depending on the rule, the tree may be modified in place or
 // replaced by a new one.
+// If params is nil, parameters are not evaluated: they are kept in the
+// tree and bound during its execution, so that the optimized tree can be
+// executed with different parameters.
 func Optimize(s *stream.Stream, tx *database.Transaction, params []expr.Param) (*stream.Stream, error) {
 	var err error
 
@@ -132,12 +141,16 @@ func PrecalculateExprRule(s *stream.Stream, _ *database.Transaction, params []ex
 // expression nodes when possible.
 // it returns a new expression with simplified nodes.
 // if no simplification is possible it returns the same expression.
+// e is never modified, so that the same statement can be optimized
+// multiple times with different parameters.
 func precalculateExpr(e expr.Expr, params []expr.Param) (expr.Expr, error) {
 	switch t := e.(type) {
 	case expr.LiteralExprList:
 		// we assume that the list of expressions contains only literals
 		// until proven wrong.
 		literalsOnly := true
+		// the original list must not be modified
+		t = append(expr.LiteralExprList(nil), t...)
 		for i, te := range t {
 			newExpr, err := precalculateExpr(te, params)
 			if err != nil {
@@ -160,11 +173,15 @@ func precalculateExpr(e expr.Expr, params []expr.Param) (expr.Expr, error) {
 			return expr.ArrayValue(document.NewValueBuffer(values...)), nil
 		}
 
+		return t, nil
 	case *expr.KVPairs:
 		// we assume that the list of kvpairs contains only literals
 		// until proven wrong.
 		literalsOnly := true
 
+		// the original pairs must not be modified
+		t = &expr.KVPairs{Pairs: append([]expr.KVPair(nil), t.Pairs...), SelfReferenced: t.SelfReferenced}
+
 		var err error
 		for i, kv := range t.Pairs {
 			kv.V, err = precalculateExpr(kv.V, params)
@@ -188,6 +205,8 @@ func precalculateExpr(e expr.Expr, params []expr.Param) (expr.Expr, error) {
 
 			return expr.LiteralValue(document.NewDocumentValue(&fb)), nil
 		}
+
+		return t, nil
 	case expr.Operator:
 		// since expr.Operator is an interface,
 		// this optimization must only be applied to
@@ -207,6 +226,8 @@ func precalculateExpr(e expr.Expr, params []expr.Param) (expr.Expr, error) {
 		if err != nil {
 			return nil, err
 		}
+		// the original operator must not be modified
+		t = expr.CloneOperator(t)
 		t.SetLeftHandExpr(lh)
 		t.SetRightHandExpr(rh)
 
@@ -222,7 +243,14 @@ func precalculateExpr(e expr.Expr, params []expr.Param) (expr.Expr, error) {
 			// we replace this expression with the result of its evaluation
 			return expr.LiteralValue(v), nil
 		}
+
+		return t, nil
 	case expr.PositionalParam, expr.NamedParam:
+		// parameters are bound during the execution
+		if params == nil {
+			return e, nil
+		}
+
 		v, err := e.Eval(&expr.Environment{Params: params})
 		if err != nil {
 			return nil, err
@@ -388,7 +416,9 @@ func isProjectionUnique(indexes database.Indexes, po *stream.ProjectOperator, pk
 // - one of its operands is a path expression that is indexed
 // - the other operand is a literal value or a parameter
 // If found, it will replace the input node by an indexInputNode using this index.
-// TODO(asdine): add support for ORDER BY
+// If the table was analyzed, the number of documents read by each candidate is estimated
+// from the table statistics and the candidate is only selected if it is cheaper than
+// reading the whole table.
 func UseIndexBasedOnFilterNodeRule(s *stream.Stream, tx *database.Transaction, params []expr.Param) (*stream.Stream, error) {
 	n := s.Op
 
@@ -429,14 +459,52 @@ func UseIndexBasedOnFilterNodeRule(s *stream.Stream, tx *database.Transaction, p
 		n = n.GetPrev()
 	}
 
-	// determine which index is the most interesting and replace it in the tree.
-	// we will assume that unique indexes are more interesting than list indexes
-	// because they usually have less elements.
+	// if the table was analyzed, compare the estimated cost of each candidate
+	// with the cost of reading the whole table.
+	// otherwise, rely on the shape of the ranges.
+	stats, err := tx.GetTableStatistics(st.TableName)
+	if err != nil && !errors.Is(err, database.ErrStatisticsNotFound) {
+		return nil, err
+	}
+
+	var selectedCandidate *candidate
+	if stats != nil {
+		selectedCandidate, err = selectCandidateFromStatistics(candidates, stats)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		selectedCandidate = selectCandidateFromRanges(candidates)
+	}
+
+	if selectedCandidate == nil {
+		return s, nil
+	}
+
+	// remove the selection node from the tree.
+	// it is kept if the ranges contain parameters, since the bounds whose value
+	// cannot be used to read the index are ignored during the execution.
+	if !selectedCandidate.ranges.HasParams() {
+		s.Remove(selectedCandidate.filterOp)
+	}
+
+	// we replace the seq scan node by the selected index scan node
+	stream.InsertBefore(s.First(), selectedCandidate.newOp)
+
+	s.Remove(s.First().GetNext())
+
+	return s, nil
+}
+
+// selectCandidateFromRanges selects the candidate with the cheapest ranges.
+// We will assume that unique indexes are more interesting than list indexes
+// because they usually have less elements.
+func selectCandidateFromRanges(candidates []*candidate) *candidate {
 	var selectedCandidate *candidate
 	var cost int
 
 	for i, candidate := range candidates {
-		currentCost := candidate.cost
+		currentCost := candidate.ranges.Cost()
 
 		if selectedCandidate == nil {
 			selectedCandidate = candidates[i]
@@ -456,19 +524,59 @@ func UseIndexBasedOnFilterNodeRule(s *stream.Stream, tx *database.Transaction, p
 		}
 	}
 
-	if selectedCandidate == nil {
-		return s, nil
-	}
+	return selectedCandidate
+}
 
-	// remove the selection node from the tree
-	s.Remove(selectedCandidate.filterOp)
+// Cost of the operations used to compare candidates with table statistics.
+const (
+	// reading one document from the table, in key order.
+	tableReadCost = 1.0
+	// reading one index entry and fetching the associated document from the table.
+	indexReadCost = 4.0
+	// seeking the beginning of a range.
+	seekCost = 2.0
+
+	// fraction of the table returned by an equality or a range lookup
+	// on a path that has no statistics.
+	defaultEqualSelectivity = 0.1
+	defaultRangeSelectivity = 0.3
+)
 
-	// we replace the seq scan node by the selected index scan node
-	stream.InsertBefore(s.First(), selectedCandidate.newOp)
+// selectCandidateFromStatistics estimates the cost of each candidate using the
+// statistics of the table and selects the cheapest one.
+// It returns nil if reading the whole table is cheaper than any candidate.
+func selectCandidateFromStatistics(candidates []*candidate, stats *database.TableStatistics) (*candidate, error) {
+	var selectedCandidate *candidate
+	var selectedCost float64
 
-	s.Remove(s.First().GetNext())
+	// cost of a sequential scan
+	cost := float64(stats.RowCount) * tableReadCost
 
-	return s, nil
+	for _, candidate := range candidates {
+		rows, err := candidate.estimateRows(stats)
+		if err != nil {
+			return nil, err
+		}
+
+		currentCost := float64(len(candidate.ranges)) * seekCost
+		if candidate.isIndex {
+			currentCost += rows * indexReadCost
+		} else {
+			currentCost += rows * tableReadCost
+		}
+
+		if currentCost >= cost {
+			continue
+		}
+
+		if selectedCandidate == nil || currentCost < selectedCost ||
+			(currentCost == selectedCost && selectedCandidate.priority < candidate.priority) {
+			selectedCandidate = candidate
+			selectedCost = currentCost
+		}
+	}
+
+	return selectedCandidate, nil
 }
 
 type candidate struct {
@@ -477,17 +585,58 @@ type candidate struct {
 	filterOp *stream.FilterOperator
 	// the candidate indexScan or pkScan operator
 	newOp stream.Operator
-	// the cost of the candidate
-	cost int
+	// the path read by the candidate
+	path document.Path
+	// the ranges read by the candidate
+	ranges stream.Ranges
 	// is this candidate reading from an index
 	isIndex bool
 	// is this candidate reading primary key ranges
 	isPk bool
+	// does the path only contain unique values
+	isUnique bool
 	// if the costs of two candidates are equal,
 	// this number determines which node will be prioritized
 	priority int
 }
 
+// estimateRows returns the estimated number of documents read by the candidate.
+func (c *candidate) estimateRows(stats *database.TableStatistics) (float64, error) {
+	ps := stats.GetPathStatistics(c.path)
+	rowCount := float64(stats.RowCount)
+
+	var rows float64
+	for _, rng := range c.ranges {
+		var n float64
+		var err error
+
+		// the value of parameters is not known during the planning
+		switch {
+		case rng.Exact && c.isUnique:
+			n = 1
+		case rng.Exact && ps != nil && !rng.HasParams():
+			n, err = ps.EstimateEqual(rng.Min)
+		case rng.Exact:
+			n = rowCount * defaultEqualSelectivity
+		case ps != nil && !rng.HasParams():
+			n, err = ps.EstimateRange(rng.Min, rng.Max)
+		default:
+			n = rowCount * defaultRangeSelectivity
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		rows += n
+	}
+
+	if rows > rowCount {
+		rows = rowCount
+	}
+
+	return rows, nil
+}
+
 // getCandidateFromfilterNode analyses f and determines if it can be replaced by an indexScan or pkScan operator.
 func getCandidateFromfilterNode(f *stream.FilterOperator, tableName string, info *database.TableInfo, indexes database.Indexes) (*candidate, error) {
 	if f.E == nil {
@@ -511,61 +660,47 @@ func getCandidateFromfilterNode(f *stream.FilterOperator, tableName string, info
 		return nil, nil
 	}
 
-	// analyse the other operand to make sure it's a literal
-	ev, ok := e.(expr.LiteralValue)
-	if !ok {
-		return nil, nil
-	}
-	v := document.Value(ev)
-
 	// now, we look if an index exists for that path
 	cd := candidate{
 		filterOp: f,
+		path:     path,
 	}
 
 	// we'll start with checking if the path is the primary key of the table
 	if pk := info.GetPrimaryKey(); pk != nil && pk.Path.IsEqual(path) {
 		// check if the operand can be used and convert it when possible
-		v, ok, err := operandCanUseIndex(pk.Type, pk.Path, info.FieldConstraints, v)
+		ranges, ok, err := getRanges(op, e, pk.Path, pk.Type, info.FieldConstraints)
 		if err != nil || !ok {
 			return nil, err
 		}
 
+		cd.ranges = ranges
 		cd.isPk = true
+		cd.isUnique = true
 		cd.priority = 3
 
-		ranges, err := getRangesFromOp(op, v)
-		if err != nil {
-			return nil, err
-		}
-
-		cd.newOp = stream.PkScan(tableName, ranges...)
-		cd.cost = ranges.Cost()
+		cd.newOp = stream.PkScan(tableName, cd.ranges...)
 		return &cd, nil
 	}
 
 	// if not, check if an index exists for that path
 	if idx := indexes.GetIndexByPath(document.Path(path)); idx != nil {
 		// check if the operand can be used and convert it when possible
-		v, ok, err := operandCanUseIndex(idx.Info.Type, idx.Info.Path, info.FieldConstraints, v)
+		ranges, ok, err := getRanges(op, e, idx.Info.Path, idx.Info.Type, info.FieldConstraints)
 		if err != nil || !ok {
 			return nil, err
 		}
 
+		cd.ranges = ranges
 		cd.isIndex = true
+		cd.isUnique = idx.Info.Unique
 		if idx.Info.Unique {
 			cd.priority = 2
 		} else {
 			cd.priority = 1
 		}
 
-		ranges, err := getRangesFromOp(op, v)
-		if err != nil {
-			return nil, err
-		}
-
-		cd.newOp = stream.IndexScan(idx.Info.IndexName, ranges...)
-		cd.cost = ranges.Cost()
+		cd.newOp = stream.IndexScan(idx.Info.IndexName, cd.ranges...)
 
 		return &cd, nil
 	}
@@ -573,6 +708,44 @@ func getCandidateFromfilterNode(f *stream.FilterOperator, tableName string, info
 	return nil, nil
 }
 
+// getRanges returns the ranges of an index on path, whose values are of type indexType,
+// read by the operator. e is the operand compared with the path.
+// It returns false if the operand is not a literal value, or contains parameters
+// bound during the execution, or if it cannot be used to read the index.
+func getRanges(op expr.Operator, e expr.Expr, path document.Path, indexType document.ValueType, fc database.FieldConstraints) (stream.Ranges, bool, error) {
+	switch t := e.(type) {
+	case expr.LiteralValue:
+		v, ok, err := fc.ConvertIndexOperand(path, indexType, document.Value(t))
+		if err != nil || !ok {
+			return nil, false, err
+		}
+
+		ranges, err := getRangesFromOp(op, v)
+		return ranges, err == nil, err
+	case expr.PositionalParam, expr.NamedParam:
+		return getRangesFromParam(op, e), true, nil
+	case expr.LiteralExprList:
+		// IN operator whose list contains parameters
+		var ranges stream.Ranges
+		for _, e := range t {
+			if isParam(e) {
+				ranges = ranges.Append(stream.Range{MinParam: e, Exact: true})
+				continue
+			}
+
+			v, ok, err := fc.ConvertIndexOperand(path, indexType, document.Value(e.(expr.LiteralValue)))
+			if err != nil || !ok {
+				return nil, false, err
+			}
+			ranges = ranges.Append(stream.Range{Min: v, Exact: true})
+		}
+
+		return ranges, true, nil
+	}
+
+	return nil, false, nil
+}
+
 func operatorCanUseIndex(op expr.Operator) (bool, document.Path, expr.Expr) {
 	lf, leftIsField := op.LeftHand().(expr.Path)
 	rf, rightIsField := op.RightHand().(expr.Path)
@@ -586,8 +759,20 @@ func operatorCanUseIndex(op expr.Operator) (bool, document.Path, expr.Expr) {
 			// The IN operator can use indexes only if the right hand side is an array with constants.
 			// At this point, we know that PrecalculateExprRule has converted any constant expression into
 			// actual values, so we can check if the right hand side is an array.
-			lv, ok := rh.(expr.LiteralValue)
-			if !ok || lv.Type != document.ArrayValue {
+			// If the parameters are not known yet, the right hand side can also
+			// be a list of constants and parameters.
+			switch t := rh.(type) {
+			case expr.LiteralValue:
+				if t.Type != document.ArrayValue {
+					return false, nil, nil
+				}
+			case expr.LiteralExprList:
+				for _, e := range t {
+					if _, ok := e.(expr.LiteralValue); !ok && !isParam(e) {
+						return false, nil, nil
+					}
+				}
+			default:
 				return false, nil, nil
 			}
 
@@ -610,24 +795,6 @@ func operatorCanUseIndex(op expr.Operator) (bool, document.Path, expr.Expr) {
 	return false, nil, nil
 }
 
-func operandCanUseIndex(indexType document.ValueType, path document.Path, fc database.FieldConstraints, v document.Value) (document.Value, bool, error) {
-	// ensure the operand satisfies all the constraints, index can work only on exact types.
-	// if a number is encountered, try to convert it to the right type if and only if the conversion
-	// is lossless.
-	converted, err := fc.ConvertValueAtPath(path, v, database.LosslessNumbersConversion)
-	if err != nil {
-		return v, false, err
-	}
-
-	// if the index is not typed, any operand can work
-	if indexType.IsZero() {
-		return converted, true, nil
-	}
-
-	// if the index is typed, it must be of the same type as the converted value
-	return converted, indexType == converted.Type, nil
-}
-
 func getRangesFromOp(op expr.Operator, v document.Value) (stream.Ranges, error) {
 	var ranges stream.Ranges
 
@@ -674,3 +841,391 @@ func getRangesFromOp(op expr.Operator, v document.Value) (stream.Ranges, error)
 
 	return ranges, nil
 }
+
+// getRangesFromParam returns the ranges read by the operator when its operand
+// is a parameter bound during the execution.
+func getRangesFromParam(op expr.Operator, param expr.Expr) stream.Ranges {
+	switch op.(type) {
+	case *expr.EqOperator:
+		return stream.Ranges{{MinParam: param, Exact: true}}
+	case *expr.GtOperator:
+		return stream.Ranges{{MinParam: param, Exclusive: true}}
+	case *expr.GteOperator:
+		return stream.Ranges{{MinParam: param}}
+	case *expr.LtOperator:
+		return stream.Ranges{{MaxParam: param, Exclusive: true}}
+	case *expr.LteOperator:
+		return stream.Ranges{{MaxParam: param}}
+	}
+
+	// the IN operator requires a list
+	return nil
+}
+
+func isParam(e expr.Expr) bool {
+	switch e.(type) {
+	case expr.PositionalParam, expr.NamedParam:
+		return true
+	}
+
+	return false
+}
+
+// UseIndexBasedOnSortNodeRule removes the sort node if the documents
+// can be read in the right order from the primary key or from an index
+// on the sorted path.
+// If the stream already reads a range of the primary key or of an index
+// on the sorted path, only the direction of the scan is changed.
+// The rule doesn't apply if a node located between the scan and the sort
+// node may change the order of the documents, or if the sorted path is
+// shadowed by a projection.
+// Example, with an index on a:
+//   this:
+//     seqScan(foo) | project(a, b) | sortReverse(a) | take(10)
+//   becomes this:
+//     indexScanReverse("idx_foo_a") | project(a, b) | take(10)
+func UseIndexBasedOnSortNodeRule(s *stream.Stream, tx *database.Transaction, _ []expr.Param) (*stream.Stream, error) {
+	firstNode := s.First()
+	if firstNode == nil {
+		return s, nil
+	}
+
+	// look for the sort node and make sure nothing
+	// between the first node and the sort node
+	// alters the order of the documents.
+	var sortNode *stream.SortOperator
+	var projections []*stream.ProjectOperator
+	for n := firstNode.GetNext(); n != nil && sortNode == nil; n = n.GetNext() {
+		switch t := n.(type) {
+		case *stream.SortOperator:
+			sortNode = t
+		case *stream.ProjectOperator:
+			projections = append(projections, t)
+		case *stream.FilterOperator, *stream.DistinctOperator:
+		default:
+			return s, nil
+		}
+	}
+	if sortNode == nil {
+		return s, nil
+	}
+
+	ep, ok := sortNode.Expr.(expr.Path)
+	if !ok {
+		return s, nil
+	}
+	path := document.Path(ep)
+
+	for _, po := range projections {
+		if isPathShadowedByProjection(path, po) {
+			return s, nil
+		}
+	}
+
+	switch t := firstNode.(type) {
+	case *stream.SeqScanOperator:
+		tb, err := tx.GetTable(t.TableName)
+		if err != nil {
+			return nil, err
+		}
+
+		pk := tb.Info().GetPrimaryKey()
+		if pk != nil && pk.Path.IsEqual(path) {
+			t.Reverse = sortNode.Desc
+			break
+		}
+
+		idx := tb.Indexes().GetIndexByPath(path)
+		if idx == nil {
+			return s, nil
+		}
+
+		is := stream.IndexScan(idx.Info.IndexName)
+		is.Reverse = sortNode.Desc
+		stream.InsertBefore(firstNode, is)
+		s.Remove(firstNode)
+	case *stream.PkScanOperator:
+		// multiple ranges are not guaranteed to be sorted
+		if len(t.Ranges) > 1 {
+			return s, nil
+		}
+
+		tb, err := tx.GetTable(t.TableName)
+		if err != nil {
+			return nil, err
+		}
+
+		pk := tb.Info().GetPrimaryKey()
+		if pk == nil || !pk.Path.IsEqual(path) {
+			return s, nil
+		}
+
+		t.Reverse = sortNode.Desc
+	case *stream.IndexScanOperator:
+		if len(t.Ranges) > 1 {
+			return s, nil
+		}
+
+		idx, err := tx.GetIndex(t.IndexName)
+		if err != nil {
+			return nil, err
+		}
+
+		if !idx.Info.Path.IsEqual(path) {
+			return s, nil
+		}
+
+		t.Reverse = sortNode.Desc
+	default:
+		return s, nil
+	}
+
+	s.Remove(sortNode)
+
+	return s, nil
+}
+
+// isPathShadowedByProjection returns true if the projection outputs a field
+// with the same name as the first fragment of p whose value is not
+// the one of the original document.
+func isPathShadowedByProjection(p document.Path, po *stream.ProjectOperator) bool {
+	field := p[0].FieldName
+
+	for _, e := range po.Exprs {
+		if _, ok := e.(expr.Wildcard); ok {
+			continue
+		}
+
+		var name string
+		if ne, ok := e.(*expr.NamedExpr); ok {
+			name = ne.Name()
+			e = ne.Expr
+		} else {
+			name = e.(stringutil.Stringer).String()
+		}
+
+		if name != field {
+			continue
+		}
+
+		ep, ok := e.(expr.Path)
+		if !ok || !document.Path(ep).IsEqual(p[:1]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// FuseSortAndTakeNodesRule replaces a sort node followed by a take node,
+// and optionally a skip node in between, by a topN node that only keeps
+// in memory the documents that can be returned.
+// Example:
+//   this:
+//     sort(a) | skip(5) | take(10)
+//   becomes this:
+//     topN(a, 15) | skip(5)
+func FuseSortAndTakeNodesRule(s *stream.Stream, _ *database.Transaction, _ []expr.Param) (*stream.Stream, error) {
+	for n := s.First(); n != nil; n = n.GetNext() {
+		so, ok := n.(*stream.SortOperator)
+		if !ok {
+			continue
+		}
+
+		next := so.GetNext()
+
+		var skip int64
+		if sk, ok := next.(*stream.SkipOperator); ok {
+			skip = sk.N
+			next = sk.GetNext()
+		}
+
+		take, ok := next.(*stream.TakeOperator)
+		if !ok {
+			return s, nil
+		}
+
+		stream.InsertBefore(so, &stream.TopNOperator{Expr: so.Expr, Desc: so.Desc, N: take.N + skip})
+		s.Remove(so)
+		s.Remove(take)
+
+		break
+	}
+
+	return s, nil
+}
+
+// UseCoveringIndexRule turns an indexScan operator into an index-only scan
+// if the index covers every path used by the rest of the stream.
+// Documents are then built from the index entries and
+// the table is never read.
+// To avoid returning documents that would not have been indexed,
+// only index scans that read ranges are considered.
+// Example, with an index on a that includes b:
+//   this:
+//     indexScan("idx_a", [10, -1, true]) | project(a, b)
+//   becomes this:
+//     indexOnlyScan("idx_a", [10, -1, true]) | project(a, b)
+func UseCoveringIndexRule(s *stream.Stream, tx *database.Transaction, _ []expr.Param) (*stream.Stream, error) {
+	is, ok := s.First().(*stream.IndexScanOperator)
+	if !ok || len(is.Ranges) == 0 {
+		return s, nil
+	}
+
+	idx, err := tx.GetIndex(is.IndexName)
+	if err != nil {
+		return nil, err
+	}
+
+	// without projection, the stream returns the original documents
+	var hasProjection bool
+
+	for n := is.GetNext(); n != nil; n = n.GetNext() {
+		var exprs []expr.Expr
+
+		switch t := n.(type) {
+		case *stream.FilterOperator:
+			exprs = []expr.Expr{t.E}
+		case *stream.ProjectOperator:
+			hasProjection = true
+			exprs = t.Exprs
+		case *stream.SortOperator:
+			exprs = []expr.Expr{t.Expr}
+		case *stream.TopNOperator:
+			exprs = []expr.Expr{t.Expr}
+		case *stream.GroupByOperator:
+			exprs = []expr.Expr{t.E}
+		case *stream.HashAggregateOperator:
+			for _, b := range t.Builders {
+				e, ok := b.(expr.Expr)
+				if !ok {
+					return s, nil
+				}
+				exprs = append(exprs, e)
+			}
+		case *stream.TakeOperator, *stream.SkipOperator, *stream.DistinctOperator:
+		default:
+			// any other operator may need the original document
+			return s, nil
+		}
+
+		for _, e := range exprs {
+			if !isExprCoveredByIndex(e, idx.Info) {
+				return s, nil
+			}
+		}
+	}
+
+	is.Covering = hasProjection
+	return s, nil
+}
+
+// isExprCoveredByIndex returns true if every path used by e can be read from the index entries.
+// Unknown expressions are considered not covered.
+func isExprCoveredByIndex(e expr.Expr, info *database.IndexInfo) bool {
+	switch t := e.(type) {
+	case expr.LiteralValue, expr.PositionalParam, expr.NamedParam:
+		return true
+	case expr.Path:
+		return info.Covers(document.Path(t))
+	case *expr.NamedExpr:
+		return isExprCoveredByIndex(t.Expr, info)
+	case expr.Parentheses:
+		return isExprCoveredByIndex(t.E, info)
+	case expr.Operator:
+		return isExprCoveredByIndex(t.LeftHand(), info) && isExprCoveredByIndex(t.RightHand(), info)
+	case expr.CastFunc:
+		return isExprCoveredByIndex(t.Expr, info)
+	case *expr.CountFunc:
+		return t.Wildcard || isExprCoveredByIndex(t.Expr, info)
+	case *expr.MinFunc:
+		return isExprCoveredByIndex(t.Expr, info)
+	case *expr.MaxFunc:
+		return isExprCoveredByIndex(t.Expr, info)
+	case *expr.SumFunc:
+		return isExprCoveredByIndex(t.Expr, info)
+	case *expr.AvgFunc:
+		return isExprCoveredByIndex(t.Expr, info)
+	case expr.LiteralExprList:
+		for _, e := range t {
+			if !isExprCoveredByIndex(e, info) {
+				return false
+			}
+		}
+		return true
+	case *expr.KVPairs:
+		for _, kv := range t.Pairs {
+			if !isExprCoveredByIndex(kv.V, info) {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false
+}
+
+// UseParallelScanRule runs the sequential scan of read-only queries and the operators
+// that follow it in parallel, if the database is configured to use more than one worker.
+// A gather node is inserted after the longest sequence of operators that can be run
+// by the workers: filters, projections, and aggregations whose partial results can be merged.
+// Since the gather node doesn't preserve the order of the documents, the rule doesn't apply
+// to streams that sort their documents, which can rely on the order of the scan.
+// Example, with 4 workers:
+//   this:
+//     seqScan(foo) | filter(a > 10) | project(a) | take(10)
+//   becomes this:
+//     seqScan(foo) | filter(a > 10) | project(a) | gather(4) | take(10)
+func UseParallelScanRule(s *stream.Stream, tx *database.Transaction, _ []expr.Param) (*stream.Stream, error) {
+	workers := tx.DB().ParallelWorkers
+	if workers < 2 || tx.Writable() {
+		return s, nil
+	}
+
+	scan, ok := s.First().(*stream.SeqScanOperator)
+	if !ok || scan.Reverse {
+		return s, nil
+	}
+
+	for n := s.Op; n != nil; n = n.GetPrev() {
+		if _, ok := n.(*stream.SortOperator); ok {
+			return s, nil
+		}
+	}
+
+	// partial aggregations are kept in memory,
+	// they are not used if aggregations can be spilled to disk.
+	canAggregate := func(n stream.Operator) bool {
+		ha, ok := n.(*stream.HashAggregateOperator)
+		return ok && ha.Mergeable() && tx.DB().WorkMemoryLimit == 0
+	}
+
+	var last stream.Operator = scan
+loop:
+	for n := scan.GetNext(); n != nil; n = n.GetNext() {
+		switch n.(type) {
+		case *stream.FilterOperator, *stream.ProjectOperator:
+			last = n
+		case *stream.GroupByOperator:
+			if !canAggregate(n.GetNext()) {
+				break loop
+			}
+			last = n.GetNext()
+			break loop
+		case *stream.HashAggregateOperator:
+			if canAggregate(n) {
+				last = n
+			}
+			break loop
+		default:
+			break loop
+		}
+	}
+
+	g := stream.InsertAfter(last, stream.Gather(workers))
+	if last == s.Op {
+		s.Op = g
+	}
+
+	return s, nil
+}
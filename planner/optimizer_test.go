@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/genjidb/genji"
+	"github.com/genjidb/genji/database"
 	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/expr"
 	"github.com/genjidb/genji/planner"
@@ -529,4 +530,449 @@ func TestUseIndexBasedOnSelectionNodeRule(t *testing.T) {
 			})
 		}
 	})
+
+	t.Run("with statistics", func(t *testing.T) {
+		tests := []struct {
+			name           string
+			root, expected *st.Stream
+		}{
+			{
+				"low selectivity",
+				st.New(st.SeqScan("foo")).Pipe(st.Filter(parser.MustParseExpr("b = true"))),
+				st.New(st.SeqScan("foo")).Pipe(st.Filter(parser.MustParseExpr("b = true"))),
+			},
+			{
+				"high selectivity",
+				st.New(st.SeqScan("foo")).Pipe(st.Filter(parser.MustParseExpr("a = 10"))),
+				st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(10), Exact: true})),
+			},
+			{
+				"FROM foo WHERE b = true AND a = 10",
+				st.New(st.SeqScan("foo")).
+					Pipe(st.Filter(parser.MustParseExpr("b = true"))).
+					Pipe(st.Filter(parser.MustParseExpr("a = 10"))),
+				st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(10), Exact: true})).
+					Pipe(st.Filter(parser.MustParseExpr("b = true"))),
+			},
+			{
+				"FROM foo WHERE a > 990 AND c = 3",
+				st.New(st.SeqScan("foo")).
+					Pipe(st.Filter(parser.MustParseExpr("a > 990"))).
+					Pipe(st.Filter(parser.MustParseExpr("c = 3"))),
+				st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(990), Exclusive: true})).
+					Pipe(st.Filter(parser.MustParseExpr("c = 3"))),
+			},
+			{
+				"FROM foo WHERE a > 10 AND c = 3",
+				st.New(st.SeqScan("foo")).
+					Pipe(st.Filter(parser.MustParseExpr("a > 10"))).
+					Pipe(st.Filter(parser.MustParseExpr("c = 3"))),
+				st.New(st.IndexScan("idx_foo_c", st.Range{Min: document.NewIntegerValue(3), Exact: true})).
+					Pipe(st.Filter(parser.MustParseExpr("a > 10"))),
+			},
+			{
+				"FROM foo WHERE k < 100",
+				st.New(st.SeqScan("foo")).Pipe(st.Filter(parser.MustParseExpr("k < 100"))),
+				st.New(st.PkScan("foo", st.Range{Max: document.NewIntegerValue(100), Exclusive: true})),
+			},
+		}
+
+		for _, test := range tests {
+			t.Run(test.name, func(t *testing.T) {
+				db, err := genji.Open(":memory:")
+				require.NoError(t, err)
+				defer db.Close()
+
+				tx, err := db.Begin(true)
+				require.NoError(t, err)
+				defer tx.Rollback()
+
+				err = tx.Exec(`
+					CREATE TABLE foo (k INT PRIMARY KEY, a INT, b BOOL, c INT);
+					CREATE INDEX idx_foo_a ON foo(a);
+					CREATE INDEX idx_foo_b ON foo(b);
+					CREATE INDEX idx_foo_c ON foo(c);
+				`)
+				require.NoError(t, err)
+
+				for i := 0; i < 1000; i++ {
+					err = tx.Exec("INSERT INTO foo (k, a, b, c) VALUES (?, ?, ?, ?)", i, i, i%2 == 0, i%10)
+					require.NoError(t, err)
+				}
+
+				err = tx.Exec("ANALYZE foo")
+				require.NoError(t, err)
+
+				res, err := planner.UseIndexBasedOnFilterNodeRule(test.root, tx.Transaction, nil)
+				require.NoError(t, err)
+				require.Equal(t, test.expected.String(), res.String())
+			})
+		}
+	})
+}
+
+func TestUseIndexBasedOnSortNodeRule(t *testing.T) {
+	tests := []struct {
+		name           string
+		root, expected *st.Stream
+	}{
+		{
+			"no sort",
+			st.New(st.SeqScan("foo")).Pipe(st.Project(parser.MustParseExpr("a"))),
+			st.New(st.SeqScan("foo")).Pipe(st.Project(parser.MustParseExpr("a"))),
+		},
+		{
+			"non-indexed path",
+			st.New(st.SeqScan("foo")).Pipe(st.Sort(parser.MustParseExpr("b"))),
+			st.New(st.SeqScan("foo")).Pipe(st.Sort(parser.MustParseExpr("b"))),
+		},
+		{
+			"primary key",
+			st.New(st.SeqScan("foo")).Pipe(st.Sort(parser.MustParseExpr("k"))).Pipe(st.Take(10)),
+			st.New(st.SeqScan("foo")).Pipe(st.Take(10)),
+		},
+		{
+			"primary key desc",
+			st.New(st.SeqScan("foo")).Pipe(st.SortReverse(parser.MustParseExpr("k"))),
+			st.New(st.SeqScanReverse("foo")),
+		},
+		{
+			"indexed path",
+			st.New(st.SeqScan("foo")).
+				Pipe(st.Filter(parser.MustParseExpr("b > 2"))).
+				Pipe(st.Project(parser.MustParseExpr("a"), parser.MustParseExpr("b"))).
+				Pipe(st.Sort(parser.MustParseExpr("a"))).
+				Pipe(st.Take(10)),
+			st.New(st.IndexScan("idx_foo_a")).
+				Pipe(st.Filter(parser.MustParseExpr("b > 2"))).
+				Pipe(st.Project(parser.MustParseExpr("a"), parser.MustParseExpr("b"))).
+				Pipe(st.Take(10)),
+		},
+		{
+			"indexed path desc",
+			st.New(st.SeqScan("foo")).Pipe(st.SortReverse(parser.MustParseExpr("a"))),
+			st.New(st.IndexScanReverse("idx_foo_a")),
+		},
+		{
+			"pk range",
+			st.New(st.PkScan("foo", st.Range{Min: document.NewIntegerValue(1)})).
+				Pipe(st.SortReverse(parser.MustParseExpr("k"))),
+			st.New(st.PkScanReverse("foo", st.Range{Min: document.NewIntegerValue(1)})),
+		},
+		{
+			"index range",
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})).
+				Pipe(st.SortReverse(parser.MustParseExpr("a"))),
+			st.New(st.IndexScanReverse("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})),
+		},
+		{
+			"index range on another path",
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})).
+				Pipe(st.Sort(parser.MustParseExpr("c"))),
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})).
+				Pipe(st.Sort(parser.MustParseExpr("c"))),
+		},
+		{
+			"multiple ranges",
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1), Exact: true}, st.Range{Min: document.NewIntegerValue(2), Exact: true})).
+				Pipe(st.Sort(parser.MustParseExpr("a"))),
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1), Exact: true}, st.Range{Min: document.NewIntegerValue(2), Exact: true})).
+				Pipe(st.Sort(parser.MustParseExpr("a"))),
+		},
+		{
+			"shadowed path",
+			st.New(st.SeqScan("foo")).
+				Pipe(st.Project(&expr.NamedExpr{ExprName: "a", Expr: parser.MustParseExpr("b")})).
+				Pipe(st.Sort(parser.MustParseExpr("a"))),
+			st.New(st.SeqScan("foo")).
+				Pipe(st.Project(&expr.NamedExpr{ExprName: "a", Expr: parser.MustParseExpr("b")})).
+				Pipe(st.Sort(parser.MustParseExpr("a"))),
+		},
+		{
+			"aggregation",
+			st.New(st.SeqScan("foo")).
+				Pipe(st.HashAggregate(&expr.CountFunc{Wildcard: true})).
+				Pipe(st.Project(parser.MustParseExpr("COUNT(*)"))).
+				Pipe(st.Sort(parser.MustParseExpr("a"))),
+			st.New(st.SeqScan("foo")).
+				Pipe(st.HashAggregate(&expr.CountFunc{Wildcard: true})).
+				Pipe(st.Project(parser.MustParseExpr("COUNT(*)"))).
+				Pipe(st.Sort(parser.MustParseExpr("a"))),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := genji.Open(":memory:")
+			require.NoError(t, err)
+			defer db.Close()
+
+			tx, err := db.Begin(true)
+			require.NoError(t, err)
+			defer tx.Rollback()
+
+			err = tx.Exec(`
+				CREATE TABLE foo (k INT PRIMARY KEY);
+				CREATE INDEX idx_foo_a ON foo(a);
+			`)
+			require.NoError(t, err)
+
+			res, err := planner.UseIndexBasedOnSortNodeRule(test.root, tx.Transaction, nil)
+			require.NoError(t, err)
+			require.Equal(t, test.expected.String(), res.String())
+		})
+	}
+}
+
+func TestFuseSortAndTakeNodesRule(t *testing.T) {
+	tests := []struct {
+		name           string
+		root, expected *st.Stream
+	}{
+		{
+			"no take",
+			st.New(st.SeqScan("foo")).
+				Pipe(st.Sort(parser.MustParseExpr("a"))).
+				Pipe(st.Skip(5)),
+			st.New(st.SeqScan("foo")).
+				Pipe(st.Sort(parser.MustParseExpr("a"))).
+				Pipe(st.Skip(5)),
+		},
+		{
+			"take",
+			st.New(st.SeqScan("foo")).
+				Pipe(st.Sort(parser.MustParseExpr("a"))).
+				Pipe(st.Take(10)),
+			st.New(st.SeqScan("foo")).
+				Pipe(st.TopN(parser.MustParseExpr("a"), 10)),
+		},
+		{
+			"skip and take",
+			st.New(st.SeqScan("foo")).
+				Pipe(st.SortReverse(parser.MustParseExpr("a"))).
+				Pipe(st.Skip(5)).
+				Pipe(st.Take(10)),
+			st.New(st.SeqScan("foo")).
+				Pipe(st.TopNReverse(parser.MustParseExpr("a"), 15)).
+				Pipe(st.Skip(5)),
+		},
+		{
+			"take not following sort",
+			st.New(st.SeqScan("foo")).
+				Pipe(st.Sort(parser.MustParseExpr("a"))).
+				Pipe(st.Project(parser.MustParseExpr("a"))).
+				Pipe(st.Take(10)),
+			st.New(st.SeqScan("foo")).
+				Pipe(st.Sort(parser.MustParseExpr("a"))).
+				Pipe(st.Project(parser.MustParseExpr("a"))).
+				Pipe(st.Take(10)),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := planner.FuseSortAndTakeNodesRule(test.root, nil, nil)
+			require.NoError(t, err)
+			require.Equal(t, test.expected.String(), res.String())
+		})
+	}
+}
+
+func TestUseCoveringIndexRule(t *testing.T) {
+	tests := []struct {
+		name           string
+		root, expected *st.Stream
+	}{
+		{
+			"no projection",
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})),
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})),
+		},
+		{
+			"no ranges",
+			st.New(st.IndexScan("idx_foo_a")).
+				Pipe(st.Project(parser.MustParseExpr("a"))),
+			st.New(st.IndexScan("idx_foo_a")).
+				Pipe(st.Project(parser.MustParseExpr("a"))),
+		},
+		{
+			"indexed path",
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})).
+				Pipe(st.Project(parser.MustParseExpr("a"))),
+			st.New(&st.IndexScanOperator{IndexName: "idx_foo_a", Ranges: st.Ranges{{Min: document.NewIntegerValue(1)}}, Covering: true}).
+				Pipe(st.Project(parser.MustParseExpr("a"))),
+		},
+		{
+			"included paths",
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})).
+				Pipe(st.Filter(parser.MustParseExpr("b.c > 2"))).
+				Pipe(st.Project(parser.MustParseExpr("a + c"), parser.MustParseExpr("COUNT(*)"))).
+				Pipe(st.Sort(parser.MustParseExpr("b"))),
+			st.New(&st.IndexScanOperator{IndexName: "idx_foo_a", Ranges: st.Ranges{{Min: document.NewIntegerValue(1)}}, Covering: true}).
+				Pipe(st.Filter(parser.MustParseExpr("b.c > 2"))).
+				Pipe(st.Project(parser.MustParseExpr("a + c"), parser.MustParseExpr("COUNT(*)"))).
+				Pipe(st.Sort(parser.MustParseExpr("b"))),
+		},
+		{
+			"non-included path",
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})).
+				Pipe(st.Project(parser.MustParseExpr("a"), parser.MustParseExpr("d"))),
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})).
+				Pipe(st.Project(parser.MustParseExpr("a"), parser.MustParseExpr("d"))),
+		},
+		{
+			"wildcard",
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})).
+				Pipe(st.Project(expr.Wildcard{})),
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})).
+				Pipe(st.Project(expr.Wildcard{})),
+		},
+		{
+			"pk()",
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})).
+				Pipe(st.Project(parser.MustParseExpr("pk()"))),
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})).
+				Pipe(st.Project(parser.MustParseExpr("pk()"))),
+		},
+		{
+			"write operation",
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})).
+				Pipe(st.Project(parser.MustParseExpr("a"))).
+				Pipe(st.TableInsert("foo")),
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1)})).
+				Pipe(st.Project(parser.MustParseExpr("a"))).
+				Pipe(st.TableInsert("foo")),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := genji.Open(":memory:")
+			require.NoError(t, err)
+			defer db.Close()
+
+			tx, err := db.Begin(true)
+			require.NoError(t, err)
+			defer tx.Rollback()
+
+			err = tx.Exec(`
+				CREATE TABLE foo (k INT PRIMARY KEY);
+				CREATE INDEX idx_foo_a ON foo(a) INCLUDE (b, c);
+			`)
+			require.NoError(t, err)
+
+			res, err := planner.UseCoveringIndexRule(test.root, tx.Transaction, nil)
+			require.NoError(t, err)
+			require.Equal(t, test.expected.String(), res.String())
+		})
+	}
+}
+
+func TestUseParallelScanRule(t *testing.T) {
+	tests := []struct {
+		name           string
+		root, expected *st.Stream
+	}{
+		{
+			"seq scan",
+			st.New(st.SeqScan("foo")),
+			st.New(st.SeqScan("foo")).
+				Pipe(st.Gather(4)),
+		},
+		{
+			"filter and project",
+			st.New(st.SeqScan("foo")).
+				Pipe(st.Filter(parser.MustParseExpr("a > 10"))).
+				Pipe(st.Project(parser.MustParseExpr("a"))).
+				Pipe(st.Take(10)),
+			st.New(st.SeqScan("foo")).
+				Pipe(st.Filter(parser.MustParseExpr("a > 10"))).
+				Pipe(st.Project(parser.MustParseExpr("a"))).
+				Pipe(st.Gather(4)).
+				Pipe(st.Take(10)),
+		},
+		{
+			"aggregation",
+			st.New(st.SeqScan("foo")).
+				Pipe(st.GroupBy(parser.MustParseExpr("a"))).
+				Pipe(st.HashAggregate(&expr.CountFunc{Wildcard: true})).
+				Pipe(st.Project(parser.MustParseExpr("COUNT(*)"))),
+			st.New(st.SeqScan("foo")).
+				Pipe(st.GroupBy(parser.MustParseExpr("a"))).
+				Pipe(st.HashAggregate(&expr.CountFunc{Wildcard: true})).
+				Pipe(st.Gather(4)).
+				Pipe(st.Project(parser.MustParseExpr("COUNT(*)"))),
+		},
+		{
+			"distinct",
+			st.New(st.SeqScan("foo")).
+				Pipe(st.Project(parser.MustParseExpr("a"))).
+				Pipe(st.Distinct()),
+			st.New(st.SeqScan("foo")).
+				Pipe(st.Project(parser.MustParseExpr("a"))).
+				Pipe(st.Gather(4)).
+				Pipe(st.Distinct()),
+		},
+		{
+			"sort",
+			st.New(st.SeqScan("foo")).
+				Pipe(st.Sort(parser.MustParseExpr("a"))),
+			st.New(st.SeqScan("foo")).
+				Pipe(st.Sort(parser.MustParseExpr("a"))),
+		},
+		{
+			"reverse scan",
+			st.New(st.SeqScanReverse("foo")),
+			st.New(st.SeqScanReverse("foo")),
+		},
+		{
+			"index scan",
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1), Exact: true})),
+			st.New(st.IndexScan("idx_foo_a", st.Range{Min: document.NewIntegerValue(1), Exact: true})),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := genji.OpenWithOptions(":memory:", database.Options{ParallelWorkers: 4})
+			require.NoError(t, err)
+			defer db.Close()
+
+			tx, err := db.Begin(false)
+			require.NoError(t, err)
+			defer tx.Rollback()
+
+			res, err := planner.UseParallelScanRule(test.root, tx.Transaction, nil)
+			require.NoError(t, err)
+			require.Equal(t, test.expected.String(), res.String())
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		tx, err := db.Begin(false)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		res, err := planner.UseParallelScanRule(st.New(st.SeqScan("foo")), tx.Transaction, nil)
+		require.NoError(t, err)
+		require.Equal(t, `seqScan(foo)`, res.String())
+	})
+
+	t.Run("read-write transaction", func(t *testing.T) {
+		db, err := genji.OpenWithOptions(":memory:", database.Options{ParallelWorkers: 4})
+		require.NoError(t, err)
+		defer db.Close()
+
+		tx, err := db.Begin(true)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		res, err := planner.UseParallelScanRule(st.New(st.SeqScan("foo")), tx.Transaction, nil)
+		require.NoError(t, err)
+		require.Equal(t, `seqScan(foo)`, res.String())
+	})
 }
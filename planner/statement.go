@@ -1,6 +1,10 @@
 package planner
 
 import (
+	"context"
+	"errors"
+	"sync"
+
 	"github.com/genjidb/genji/database"
 	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/expr"
@@ -12,44 +16,112 @@ import (
 type Statement struct {
 	Stream   *stream.Stream
 	ReadOnly bool
+
+	// set by Prepare
+	plan *cachedPlan
+	// set by After
+	after *stream.Position
 }
 
 // Run returns a result containing the stream. The stream will be executed by calling the Iterate method of
 // the result.
-func (s *Statement) Run(tx *database.Transaction, params []expr.Param) (query.Result, error) {
-	st, err := Optimize(s.Stream, tx, params)
+func (s *Statement) Run(ctx context.Context, tx *database.Transaction, params []expr.Param) (query.Result, error) {
+	st, err := s.optimize(tx, params)
 	if err != nil || st == nil {
 		return query.Result{}, err
 	}
 
+	if s.after != nil {
+		err = resumeAfter(st, s.after)
+		if err != nil {
+			return query.Result{}, err
+		}
+	}
+
 	return query.Result{
 		Iterator: &statementIterator{
+			Ctx:    ctx,
 			Stream: st,
 			Tx:     tx,
 			Params: params,
+			scan:   cursorScan(st),
 		},
 	}, nil
 }
 
+// After returns a copy of the statement that only returns the documents
+// located after the given position.
+// Running the returned statement fails with query.ErrCursorNotSupported if
+// the order of its documents doesn't allow it to be resumed.
+func (s *Statement) After(pos *stream.Position) *Statement {
+	cp := *s
+	cp.after = pos
+	return &cp
+}
+
 // IsReadOnly reports whether the stream will modify the database or only read it.
 func (s *Statement) IsReadOnly() bool {
 	return s.ReadOnly
 }
 
+// Prepare the statement for multiple executions.
+// The optimized stream is kept and reused by the subsequent calls to Run
+// until the catalog is modified. Its parameters are bound during each execution.
+func (s *Statement) Prepare() error {
+	if s.plan == nil {
+		s.plan = new(cachedPlan)
+	}
+
+	return nil
+}
+
+// optimize returns an optimized copy of the stream.
+// s.Stream is never modified.
+func (s *Statement) optimize(tx *database.Transaction, params []expr.Param) (*stream.Stream, error) {
+	if s.plan == nil {
+		return Optimize(s.Stream.Clone(), tx, params)
+	}
+
+	return s.plan.get(s.Stream, tx)
+}
+
 func (s *Statement) String() string {
 	return s.Stream.String()
 }
 
 type statementIterator struct {
+	Ctx    context.Context
 	Stream *stream.Stream
 	Tx     *database.Transaction
 	Params []expr.Param
+
+	// first operator of the stream, if the stream supports cursors
+	scan stream.Operator
+	// key of the last document returned and,
+	// for index scans, raw key of its index entry
+	lastKey   []byte
+	lastEntry []byte
 }
 
 func (s *statementIterator) Iterate(fn func(d document.Document) error) error {
+	ctx := s.Ctx
+	if ctx == nil {
+		ctx = s.Tx.Context()
+	}
+	limits := s.Tx.Limits(ctx)
+
+	parent := ctx
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
 	env := expr.Environment{
+		Ctx:    ctx,
 		Tx:     s.Tx,
 		Params: s.Params,
+		Budget: database.NewBudget(limits),
 	}
 
 	err := s.Stream.Iterate(&env, func(env *expr.Environment) error {
@@ -60,10 +132,95 @@ func (s *statementIterator) Iterate(fn func(d document.Document) error) error {
 			return nil
 		}
 
+		if s.scan != nil {
+			s.lastKey = append(s.lastKey[:0], documentKey(env)...)
+			if is, ok := s.scan.(*stream.IndexScanOperator); ok {
+				s.lastEntry = append(s.lastEntry[:0], is.LastEntry()...)
+			}
+		}
+
 		return fn(env.Doc)
 	})
 	if err == stream.ErrStreamClosed {
 		err = nil
 	}
+
+	// report the expiration of the timeout of the statement,
+	// unless the context of the caller is done too.
+	if err != nil && errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil && parent.Err() == nil {
+		err = &database.LimitError{Limit: database.TimeoutLimit}
+	}
 	return err
 }
+
+// Cursor returns a token identifying the position of the last document returned by Iterate.
+func (s *statementIterator) Cursor() (string, error) {
+	if s.scan == nil {
+		return "", query.ErrCursorNotSupported
+	}
+
+	if len(s.lastKey) == 0 {
+		return "", nil
+	}
+
+	pos, err := position(s.Tx, s.scan, s.lastKey, s.lastEntry)
+	if err != nil {
+		return "", err
+	}
+
+	return EncodeCursor(pos)
+}
+
+// RowsAffected returns the number of documents written by the last operator
+// of the stream, if it modifies a table.
+func (s *statementIterator) RowsAffected() int64 {
+	w, ok := s.Stream.Op.(stream.WriteOperator)
+	if !ok {
+		return 0
+	}
+
+	return w.Affected()
+}
+
+// LastInsertID returns the integer primary key of the last inserted document.
+func (s *statementIterator) LastInsertID() (int64, bool) {
+	ins, ok := s.Stream.Op.(*stream.TableInsertOperator)
+	if !ok {
+		return 0, false
+	}
+
+	return ins.LastInsertID()
+}
+
+// cachedPlan holds the last optimized version of a prepared statement.
+// The plan doesn't depend on the parameters, which are kept in the plan
+// and bound during the execution, but on the catalog, which determines
+// the indexes and statistics available.
+type cachedPlan struct {
+	mu             sync.Mutex
+	st             *stream.Stream
+	catalogVersion uint64
+}
+
+// get returns a copy of the cached plan if it is still valid,
+// otherwise it optimizes s and caches the result.
+func (p *cachedPlan) get(s *stream.Stream, tx *database.Transaction) (*stream.Stream, error) {
+	version := tx.DB().Catalog().Version()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.st == nil || p.catalogVersion != version {
+		st, err := Optimize(s.Clone(), tx, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		p.st = st
+		p.catalogVersion = version
+	}
+
+	// operators are modified during execution,
+	// each run uses its own copy of the plan.
+	return p.st.Clone(), nil
+}
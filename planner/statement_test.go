@@ -0,0 +1,93 @@
+package planner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/document"
+	"github.com/genjidb/genji/document/encoding/msgpack"
+	"github.com/genjidb/genji/engine/memoryengine"
+	"github.com/genjidb/genji/expr"
+	"github.com/genjidb/genji/stream"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreparedStatement(t *testing.T) {
+	db, err := database.New(context.Background(), memoryengine.NewEngine(), database.Options{Codec: msgpack.NewCodec()})
+	require.NoError(t, err)
+	defer db.Close()
+
+	tx, err := db.Begin(true)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	err = tx.CreateTable("test", &database.TableInfo{
+		FieldConstraints: []*database.FieldConstraint{
+			{Path: document.NewPath("a"), Type: document.IntegerValue},
+		},
+	})
+	require.NoError(t, err)
+	err = tx.CreateIndex(&database.IndexInfo{TableName: "test", IndexName: "idx_a", Path: document.NewPath("a"), Type: document.IntegerValue})
+	require.NoError(t, err)
+
+	tb, err := tx.GetTable("test")
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		_, err = tb.Insert(document.NewFieldBuffer().Add("a", document.NewIntegerValue(int64(i))))
+		require.NoError(t, err)
+	}
+
+	// SELECT * FROM test WHERE a >= ?
+	s := Statement{
+		Stream: stream.New(stream.SeqScan("test")).
+			Pipe(stream.Filter(expr.Gte(expr.Path(document.NewPath("a")), expr.PositionalParam(1)))),
+		ReadOnly: true,
+	}
+	require.NoError(t, s.Prepare())
+
+	count := func(param interface{}) int {
+		res, err := s.Run(context.Background(), tx, []expr.Param{{Value: param}})
+		require.NoError(t, err)
+		defer res.Close()
+
+		var n int
+		err = res.Iterate(func(d document.Document) error {
+			n++
+			return nil
+		})
+		require.NoError(t, err)
+		return n
+	}
+
+	require.Equal(t, 10, count(0))
+	plan := s.plan.st
+	require.Equal(t, `indexScan("idx_a", [?, -1]) | filter(a >= ?)`, plan.String())
+
+	// the plan is reused with different parameters,
+	// even if their value cannot be used to read the index.
+	tests := []struct {
+		param    interface{}
+		expected int
+	}{
+		{5, 5},
+		{9, 1},
+		{20, 0},
+		{2.0, 8},
+		{7.5, 2},
+		{"foo", 0},
+		{nil, 0},
+	}
+
+	for _, test := range tests {
+		require.Equal(t, test.expected, count(test.param), "%v", test.param)
+		require.Same(t, plan, s.plan.st)
+	}
+
+	// modifying the catalog invalidates the plan
+	err = tx.DropIndex("idx_a")
+	require.NoError(t, err)
+	require.Equal(t, 5, count(5))
+	require.NotSame(t, plan, s.plan.st)
+	require.Equal(t, `seqScan(test) | filter(a >= ?)`, s.plan.st.String())
+}
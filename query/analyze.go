@@ -0,0 +1,31 @@
+package query
+
+import (
+	"context"
+
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/expr"
+)
+
+// AnalyzeStmt is a DSL that allows creating a full ANALYZE statement.
+type AnalyzeStmt struct {
+	TableName string
+}
+
+// IsReadOnly always returns false. It implements the Statement interface.
+func (stmt AnalyzeStmt) IsReadOnly() bool {
+	return false
+}
+
+// Run runs the Analyze statement in the given transaction.
+// If no table name is provided, every table is analyzed.
+// It implements the Statement interface.
+func (stmt AnalyzeStmt) Run(ctx context.Context, tx *database.Transaction, args []expr.Param) (Result, error) {
+	var res Result
+
+	if stmt.TableName == "" {
+		return res, tx.AnalyzeAll()
+	}
+
+	return res, tx.Analyze(stmt.TableName)
+}
@@ -0,0 +1,107 @@
+package query_test
+
+import (
+	"testing"
+
+	"github.com/genjidb/genji"
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/document"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name             string
+		query            string
+		expectedAnalyzed []string
+		fails            bool
+	}{
+		{"Analyze all", `ANALYZE`, []string{"test1", "test2"}, false},
+		{"Analyze table", `ANALYZE test2`, []string{"test2"}, false},
+		{"Analyze unknown", `ANALYZE doesntexist`, nil, true},
+		{"Analyze read-only", `ANALYZE __genji_tables`, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, err := genji.Open(":memory:")
+			require.NoError(t, err)
+			defer db.Close()
+
+			err = db.Exec(`
+				CREATE TABLE test1;
+				CREATE TABLE test2;
+
+				CREATE INDEX idx_test1_a ON test1(a);
+				CREATE INDEX idx_test2_a ON test2(a);
+				CREATE INDEX idx_test2_b ON test2(b);
+
+				INSERT INTO test1(a, b) VALUES (1, 'a'), (2, 'b');
+				INSERT INTO test2(a, b) VALUES (3, 'c'), (4, 'd'), (4, 'e');
+			`)
+			require.NoError(t, err)
+
+			err = db.Exec(test.query)
+			if test.fails {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			err = db.View(func(tx *genji.Tx) error {
+				for _, tableName := range []string{"test1", "test2"} {
+					stats, err := tx.GetTableStatistics(tableName)
+
+					var analyzed bool
+					for _, name := range test.expectedAnalyzed {
+						if name == tableName {
+							analyzed = true
+						}
+					}
+
+					if !analyzed {
+						require.ErrorIs(t, err, database.ErrStatisticsNotFound)
+						continue
+					}
+					require.NoError(t, err)
+
+					if tableName == "test1" {
+						require.EqualValues(t, 2, stats.RowCount)
+						require.Len(t, stats.Paths, 1)
+						continue
+					}
+
+					require.EqualValues(t, 3, stats.RowCount)
+					require.Len(t, stats.Paths, 2)
+					require.EqualValues(t, 2, stats.GetPathStatistics(parsePath(t, "a")).DistinctCount)
+					require.EqualValues(t, 3, stats.GetPathStatistics(parsePath(t, "b")).DistinctCount)
+				}
+				return nil
+			})
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("Statistics are queryable", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test;
+			CREATE INDEX idx_test_a ON test(a);
+			INSERT INTO test(a) VALUES (1), (2), (2);
+			ANALYZE test;
+		`)
+		require.NoError(t, err)
+
+		d, err := db.QueryDocument("SELECT row_count, paths[0].distinct_count AS d FROM __genji_statistics WHERE table_name = 'test'")
+		require.NoError(t, err)
+
+		var rowCount, distinct int
+		err = document.Scan(d, &rowCount, &distinct)
+		require.NoError(t, err)
+		require.Equal(t, 3, rowCount)
+		require.Equal(t, 2, distinct)
+	})
+}
@@ -1,6 +1,8 @@
 package query
 
 import (
+	"context"
+
 	"github.com/genjidb/genji/database"
 	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/expr"
@@ -20,7 +22,7 @@ func (stmt CreateTableStmt) IsReadOnly() bool {
 
 // Run runs the Create table statement in the given transaction.
 // It implements the Statement interface.
-func (stmt CreateTableStmt) Run(tx *database.Transaction, args []expr.Param) (Result, error) {
+func (stmt CreateTableStmt) Run(ctx context.Context, tx *database.Transaction, args []expr.Param) (Result, error) {
 	var res Result
 
 	err := tx.CreateTable(stmt.TableName, &stmt.Info)
@@ -53,6 +55,9 @@ type CreateIndexStmt struct {
 	Path        document.Path
 	IfNotExists bool
 	Unique      bool
+	// Paths whose values are stored in the index entries,
+	// in addition to the indexed path.
+	IncludedPaths []document.Path
 }
 
 // IsReadOnly always returns false. It implements the Statement interface.
@@ -62,14 +67,15 @@ func (stmt CreateIndexStmt) IsReadOnly() bool {
 
 // Run runs the Create index statement in the given transaction.
 // It implements the Statement interface.
-func (stmt CreateIndexStmt) Run(tx *database.Transaction, args []expr.Param) (Result, error) {
+func (stmt CreateIndexStmt) Run(ctx context.Context, tx *database.Transaction, args []expr.Param) (Result, error) {
 	var res Result
 
 	err := tx.CreateIndex(&database.IndexInfo{
-		Unique:    stmt.Unique,
-		IndexName: stmt.IndexName,
-		TableName: stmt.TableName,
-		Path:      stmt.Path,
+		Unique:        stmt.Unique,
+		IndexName:     stmt.IndexName,
+		TableName:     stmt.TableName,
+		Path:          stmt.Path,
+		IncludedPaths: stmt.IncludedPaths,
 	})
 	if stmt.IfNotExists && err == database.ErrIndexAlreadyExists {
 		err = nil
@@ -143,7 +143,7 @@ func TestInsertStmt(t *testing.T) {
 		err = db.Exec(`CREATE TABLE test(
 			b bool, db double,
 			i integer, bb blob, byt bytes,
-			t text, a array, d document
+			t text, a array, d document, ts timestamp
 		)`)
 		require.NoError(t, err)
 
@@ -152,7 +152,8 @@ func TestInsertStmt(t *testing.T) {
 			VALUES {
 				i: 10000000000, db: 21.21, b: true,
 				bb: "YmxvYlZhbHVlCg==", byt: "Ynl0ZXNWYWx1ZQ==",
-				t: "text", a: [1, "foo", true], d: {"foo": "bar"}
+				t: "text", a: [1, "foo", true], d: {"foo": "bar"},
+				ts: "2021-01-02 03:04:05"
 			}`)
 		require.NoError(t, err)
 
@@ -172,7 +173,8 @@ func TestInsertStmt(t *testing.T) {
 			"byt": "Ynl0ZXNWYWx1ZQ==",
 			"t": "text",
 			"a": [1, "foo", true],
-			"d": {"foo": "bar"}
+			"d": {"foo": "bar"},
+			"ts": "2021-01-02T03:04:05Z"
 		  }]`, buf.String())
 	})
 
@@ -12,6 +12,14 @@ import (
 // ErrResultClosed is returned when trying to close an already closed result.
 var ErrResultClosed = errors.New("result already closed")
 
+// ErrCursorNotSupported is returned when a query cannot be resumed from a cursor,
+// for example because its documents are sorted in memory, skipped or aggregated.
+var ErrCursorNotSupported = errors.New("query doesn't support cursors")
+
+// ErrInvalidCursor is returned when a cursor cannot be decoded
+// or doesn't match the query it is used with.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
 // A Query can execute statements against the database. It can read or write data
 // from any table, or even alter the structure of the database.
 // Results are returned as streams.
@@ -21,18 +29,29 @@ type Query struct {
 	autoCommit bool
 }
 
-// Run executes all the statements in their own transaction and returns the last result.
+// Run executes all the statements within the session of the transactions attached
+// to the database and returns the last result. See RunSession.
+//
+// Deprecated: the transaction opened by the BEGIN statement is shared by every caller of Run.
+// Use RunSession with a session created by database.Database.NewSession instead.
 func (q Query) Run(ctx context.Context, db *database.Database, args []expr.Param) (*Result, error) {
+	return q.RunSession(ctx, db.AttachedSession(), args)
+}
+
+// RunSession executes all the statements within the session and returns the last result.
+// If the session has an explicit transaction, the statements are run within it,
+// otherwise they are run in their own transaction.
+func (q Query) RunSession(ctx context.Context, s *database.Session, args []expr.Param) (*Result, error) {
 	var res Result
 	var err error
 
-	q.tx = db.GetAttachedTx()
+	q.tx = s.Tx()
 	if q.tx == nil {
 		q.autoCommit = true
 	}
 
 	type queryAlterer interface {
-		alterQuery(ctx context.Context, db *database.Database, q *Query) error
+		alterQuery(ctx context.Context, s *database.Session, q *Query) error
 	}
 
 	for i, stmt := range q.Statements {
@@ -43,19 +62,29 @@ func (q Query) Run(ctx context.Context, db *database.Database, args []expr.Param
 		}
 
 		if qa, ok := stmt.(queryAlterer); ok {
-			err = qa.alterQuery(ctx, db, &q)
+			err = qa.alterQuery(ctx, s, &q)
 			if err != nil {
-				if tx := db.GetAttachedTx(); tx != nil {
-					tx.Rollback()
+				// like the other statements, savepoint statements
+				// don't end the transaction when they fail.
+				switch stmt.(type) {
+				case SavepointStmt, ReleaseSavepointStmt, RollbackToSavepointStmt:
+				default:
+					if tx := s.Tx(); tx != nil {
+						tx.Rollback()
+					}
 				}
 				return nil, err
 			}
 
+			// the result of the previous statement belongs to a transaction
+			// that may have been closed and must not be returned.
+			res = Result{}
+
 			continue
 		}
 
 		if q.tx == nil {
-			q.tx, err = db.BeginTx(ctx, &database.TxOptions{
+			q.tx, err = s.DB().BeginTx(ctx, &database.TxOptions{
 				ReadOnly: stmt.IsReadOnly(),
 			})
 			if err != nil {
@@ -63,7 +92,7 @@ func (q Query) Run(ctx context.Context, db *database.Database, args []expr.Param
 			}
 		}
 
-		res, err = stmt.Run(q.tx, args)
+		res, err = stmt.Run(ctx, q.tx, args)
 		if err != nil {
 			if q.autoCommit {
 				q.tx.Rollback()
@@ -110,12 +139,20 @@ func (q Query) Run(ctx context.Context, db *database.Database, args []expr.Param
 }
 
 // Exec the query within the given transaction.
-func (q Query) Exec(tx *database.Transaction, args []expr.Param) (*Result, error) {
+// The execution of the statements stops with the error of ctx
+// once it is canceled.
+func (q Query) Exec(ctx context.Context, tx *database.Transaction, args []expr.Param) (*Result, error) {
 	var res Result
 	var err error
 
 	for i, stmt := range q.Statements {
-		res, err = stmt.Run(tx, args)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		default:
+		}
+
+		res, err = stmt.Run(ctx, tx, args)
 		if err != nil {
 			return nil, err
 		}
@@ -134,17 +171,43 @@ func (q Query) Exec(tx *database.Transaction, args []expr.Param) (*Result, error
 	return &res, nil
 }
 
+// Prepare the statements of the query that implement the Preparer interface
+// so that they can be executed multiple times efficiently.
+func (q Query) Prepare() error {
+	for _, stmt := range q.Statements {
+		p, ok := stmt.(Preparer)
+		if !ok {
+			continue
+		}
+
+		err := p.Prepare()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // New creates a new query with the given statements.
 func New(statements ...Statement) Query {
 	return Query{Statements: statements}
 }
 
 // A Statement represents a unique action that can be executed against the database.
+// The context is used to cancel the execution of the statement,
+// including the iteration of its result.
 type Statement interface {
-	Run(*database.Transaction, []expr.Param) (Result, error)
+	Run(context.Context, *database.Transaction, []expr.Param) (Result, error)
 	IsReadOnly() bool
 }
 
+// A Preparer is a statement that can be prepared for multiple executions,
+// for example by caching its execution plan.
+type Preparer interface {
+	Prepare() error
+}
+
 // Result of a query.
 type Result struct {
 	Iterator document.Iterator
@@ -160,6 +223,59 @@ func (r *Result) Iterate(fn func(d document.Document) error) error {
 	return r.Iterator.Iterate(fn)
 }
 
+// A Cursorer is an iterator that can return the position of the last document
+// it returned.
+type Cursorer interface {
+	Cursor() (string, error)
+}
+
+// Cursor returns an opaque token identifying the position of the last document
+// returned by Iterate. The token can be used to run the same query again, only returning
+// the documents located after that position, without having to skip the previous ones.
+// It must be called before closing the result.
+// If no document was returned, it returns an empty string.
+// If the query doesn't support cursors, it returns ErrCursorNotSupported.
+func (r *Result) Cursor() (string, error) {
+	c, ok := r.Iterator.(Cursorer)
+	if !ok {
+		return "", ErrCursorNotSupported
+	}
+
+	return c.Cursor()
+}
+
+// A WriteReporter is an iterator that can report the effects
+// of the documents it wrote.
+type WriteReporter interface {
+	RowsAffected() int64
+	LastInsertID() (int64, bool)
+}
+
+// RowsAffected returns the number of documents inserted, updated or deleted by the
+// last statement of the query. It must be called after iterating over the result.
+// It returns 0 for statements that don't modify documents.
+func (r *Result) RowsAffected() int64 {
+	w, ok := r.Iterator.(WriteReporter)
+	if !ok {
+		return 0
+	}
+
+	return w.RowsAffected()
+}
+
+// LastInsertID returns the primary key of the last document inserted by the
+// last statement of the query, if that key is an integer.
+// For tables without primary key, it returns the generated document id.
+// It must be called after iterating over the result.
+func (r *Result) LastInsertID() (int64, bool) {
+	w, ok := r.Iterator.(WriteReporter)
+	if !ok {
+		return 0, false
+	}
+
+	return w.LastInsertID()
+}
+
 // Close the result stream.
 // After closing the result, Stream is not supposed to be used.
 // If the result stream was already closed, it returns
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/json"
+	"os"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/genjidb/genji"
+	"github.com/genjidb/genji/database"
 	"github.com/genjidb/genji/document"
 	"github.com/stretchr/testify/require"
 )
@@ -231,6 +234,376 @@ func TestSelectStmt(t *testing.T) {
 		require.JSONEq(t, `[{"foo": true},{"foo": 1}, {"foo": 2},{"foo": "hello"}]`, buf.String())
 	})
 
+	t.Run("with timestamps", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec("CREATE TABLE test(ts TIMESTAMP); CREATE INDEX idx_ts ON test(ts);")
+		require.NoError(t, err)
+
+		err = db.Exec(`INSERT INTO test (ts) VALUES ('2021-03-01'), (1577836800), (?)`,
+			time.Date(2020, 6, 1, 12, 0, 0, 0, time.FixedZone("", 3600)))
+		require.NoError(t, err)
+
+		st, err := db.Query("SELECT * FROM test WHERE ts > CAST('2020-01-01T00:00:00Z' AS TIMESTAMP) ORDER BY ts DESC")
+		require.NoError(t, err)
+		defer st.Close()
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, st)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"ts": "2021-03-01T00:00:00Z"}, {"ts": "2020-06-01T11:00:00Z"}]`, buf.String())
+	})
+
+	t.Run("with time buckets", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec("CREATE TABLE test(ts TIMESTAMP, v DOUBLE)")
+		require.NoError(t, err)
+
+		err = db.Exec(`INSERT INTO test (ts, v) VALUES
+			('2021-03-01 10:05:00', 1), ('2021-03-01 10:20:00', 3),
+			('2021-03-01 10:40:00', 5), ('2021-03-01 11:01:00', 7)`)
+		require.NoError(t, err)
+
+		st, err := db.Query(`
+			SELECT date_bin('30 minutes', ts) AS bucket, AVG(v), COUNT(*)
+			FROM test
+			WHERE ts < date_add('2021-03-01', '1 day')
+			GROUP BY date_bin('30 minutes', ts)`)
+		require.NoError(t, err)
+		defer st.Close()
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, st)
+		require.NoError(t, err)
+		require.JSONEq(t, `[
+			{"bucket": "2021-03-01T10:00:00Z", "AVG(v)": 2, "COUNT(*)": 2},
+			{"bucket": "2021-03-01T10:30:00Z", "AVG(v)": 5, "COUNT(*)": 1},
+			{"bucket": "2021-03-01T11:00:00Z", "AVG(v)": 7, "COUNT(*)": 1}
+		]`, buf.String())
+	})
+
+	t.Run("with timestamps compared with texts", func(t *testing.T) {
+		for _, schema := range []string{
+			"CREATE TABLE test(ts TIMESTAMP)",
+			"CREATE TABLE test(ts TIMESTAMP); CREATE INDEX idx_ts ON test(ts)",
+			"CREATE TABLE test; CREATE INDEX idx_ts ON test(ts)",
+		} {
+			t.Run(schema, func(t *testing.T) {
+				db, err := genji.Open(":memory:")
+				require.NoError(t, err)
+				defer db.Close()
+
+				err = db.Exec(schema)
+				require.NoError(t, err)
+
+				err = db.Exec(`INSERT INTO test (ts) VALUES (?), (?), (?)`,
+					time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC),
+					time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC),
+					time.Date(2021, 6, 1, 2, 0, 0, 0, time.FixedZone("", 7200)))
+				require.NoError(t, err)
+
+				check := func(q string, expected string, args ...interface{}) {
+					t.Helper()
+
+					st, err := db.Query(q, args...)
+					require.NoError(t, err)
+					defer st.Close()
+
+					var buf bytes.Buffer
+					err = document.IteratorToJSONArray(&buf, st)
+					require.NoError(t, err)
+					require.JSONEq(t, expected, buf.String())
+				}
+
+				check("SELECT ts FROM test WHERE ts > '2021-06-01T00:00:00Z' ORDER BY ts",
+					`[{"ts": "2021-07-01T00:00:00Z"}]`)
+				check("SELECT ts FROM test WHERE ts >= '2021-06-01T00:00:00Z' ORDER BY ts",
+					`[{"ts": "2021-06-01T00:00:00Z"}, {"ts": "2021-07-01T00:00:00Z"}]`)
+				check("SELECT ts FROM test WHERE ts = '2021-06-01T02:00:00+02:00'",
+					`[{"ts": "2021-06-01T00:00:00Z"}]`)
+				check("SELECT ts FROM test WHERE ts IN ['2021-03-01', '2021-07-01'] ORDER BY ts",
+					`[{"ts": "2021-03-01T00:00:00Z"}, {"ts": "2021-07-01T00:00:00Z"}]`)
+				check("SELECT ts FROM test WHERE ts < ?",
+					`[{"ts": "2021-03-01T00:00:00Z"}]`, "2021-04-01T00:00:00Z")
+				check("SELECT ts FROM test WHERE ts > 'hello'", `[]`)
+			})
+		}
+	})
+
+	t.Run("with timestamp arithmetic", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec("CREATE TABLE test(ts TIMESTAMP); INSERT INTO test (ts) VALUES ('2021-03-01')")
+		require.NoError(t, err)
+
+		st, err := db.Query("SELECT ts + 1 FROM test")
+		require.NoError(t, err)
+		defer st.Close()
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, st)
+		require.Error(t, err)
+	})
+
+	t.Run("with covering index", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test (k INTEGER PRIMARY KEY);
+			CREATE INDEX idx_a ON test (a) INCLUDE (b, c);
+			INSERT INTO test (k, a, b, c, d) VALUES (1, 10, 'foo', {x: 1}, 1), (2, 20, 'bar', {x: 2}, 2), (3, 20, 'baz', [3], 3);
+			INSERT INTO test (k, a, d) VALUES (4, 30, 4);
+			UPDATE test SET b = 'qux' WHERE k = 2;
+			DELETE FROM test WHERE k = 3;
+		`)
+		require.NoError(t, err)
+
+		d, err := db.QueryDocument("EXPLAIN SELECT a, b, c.x FROM test WHERE a >= 20")
+		require.NoError(t, err)
+		v, err := d.GetByField("plan")
+		require.NoError(t, err)
+		require.Equal(t, `indexOnlyScan("idx_a", [20, -1]) | project(a, b, c.x)`, v.V.(string))
+
+		st, err := db.Query("SELECT a, b, c.x FROM test WHERE a >= 20")
+		require.NoError(t, err)
+		defer st.Close()
+
+		var buf bytes.Buffer
+		err = document.IteratorToJSONArray(&buf, st)
+		require.NoError(t, err)
+		require.JSONEq(t, `[{"a": 20, "b": "qux", "c.x": 2}, {"a": 30, "b": null, "c.x": null}]`, buf.String())
+	})
+
+	t.Run("with aggregation spilling to disk", func(t *testing.T) {
+		open := func(opts database.Options) *genji.DB {
+			db, err := genji.OpenWithOptions(":memory:", opts)
+			require.NoError(t, err)
+
+			err = db.Exec("CREATE TABLE test (k INTEGER PRIMARY KEY)")
+			require.NoError(t, err)
+
+			for i := 0; i < 200; i++ {
+				err = db.Exec("INSERT INTO test (k, a, b) VALUES (?, ?, ?)", i, i%50, i%7)
+				require.NoError(t, err)
+			}
+
+			// parallel scans split the table using its statistics
+			err = db.Exec("ANALYZE test")
+			require.NoError(t, err)
+
+			return db
+		}
+
+		query := func(db *genji.DB) []string {
+			st, err := db.Query("SELECT a, COUNT(*), SUM(k), MIN(b) FROM test GROUP BY a")
+			require.NoError(t, err)
+			defer st.Close()
+
+			var res []string
+			err = st.Iterate(func(d document.Document) error {
+				enc, err := json.Marshal(d)
+				require.NoError(t, err)
+				res = append(res, string(enc))
+				return nil
+			})
+			require.NoError(t, err)
+			return res
+		}
+
+		db := open(database.Options{})
+		defer db.Close()
+		expected := query(db)
+		require.Len(t, expected, 50)
+
+		dir := t.TempDir()
+		spilled := open(database.Options{WorkMemoryLimit: 256, TempDir: dir})
+		defer spilled.Close()
+
+		require.ElementsMatch(t, expected, query(spilled))
+
+		// temporary files must be removed
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+
+	t.Run("with parallel scans", func(t *testing.T) {
+		open := func(workers int) *genji.DB {
+			db, err := genji.OpenWithOptions(":memory:", database.Options{ParallelWorkers: workers})
+			require.NoError(t, err)
+
+			err = db.Exec("CREATE TABLE test (k INTEGER PRIMARY KEY)")
+			require.NoError(t, err)
+
+			for i := 0; i < 1000; i++ {
+				err = db.Exec("INSERT INTO test (k, a, b) VALUES (?, ?, ?)", i, i%50, i%7)
+				require.NoError(t, err)
+			}
+
+			return db
+		}
+
+		query := func(db *genji.DB, q string) []string {
+			st, err := db.Query(q)
+			require.NoError(t, err)
+			defer st.Close()
+
+			var res []string
+			err = st.Iterate(func(d document.Document) error {
+				enc, err := json.Marshal(d)
+				require.NoError(t, err)
+				res = append(res, string(enc))
+				return nil
+			})
+			require.NoError(t, err)
+			return res
+		}
+
+		sequential := open(0)
+		defer sequential.Close()
+		parallel := open(4)
+		defer parallel.Close()
+
+		queries := []string{
+			"SELECT k, a FROM test WHERE b = 3",
+			"SELECT a, COUNT(*), SUM(k), MIN(b), MAX(b), AVG(k) FROM test GROUP BY a",
+			"SELECT COUNT(*) FROM test WHERE a > 10",
+			"SELECT k FROM test WHERE a > 10 ORDER BY k DESC LIMIT 10",
+			"SELECT DISTINCT b FROM test",
+		}
+
+		for _, q := range queries {
+			expected := query(sequential, q)
+			require.NotEmpty(t, expected)
+			require.ElementsMatch(t, expected, query(parallel, q), q)
+		}
+
+		d, err := parallel.QueryDocument("EXPLAIN SELECT COUNT(*) FROM test WHERE a > 10")
+		require.NoError(t, err)
+		var plan string
+		require.NoError(t, document.Scan(d, &plan))
+		require.Equal(t, "seqScan(test) | filter(a > 10) | hashAggregate(COUNT(*)) | gather(4) | project(COUNT(*))", plan)
+	})
+
+	t.Run("with sort spilling to disk", func(t *testing.T) {
+		dir := t.TempDir()
+		db, err := genji.OpenWithOptions(":memory:", database.Options{WorkMemoryLimit: 128, TempDir: dir})
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec("CREATE TABLE test (k INTEGER PRIMARY KEY)")
+		require.NoError(t, err)
+
+		for i := 0; i < 100; i++ {
+			err = db.Exec("INSERT INTO test (k, a, b) VALUES (?, ?, {c: ?, d: [?, 'foo']})", i, (i*37)%100, i, i%2 == 0)
+			require.NoError(t, err)
+		}
+
+		st, err := db.Query("SELECT k, a, b FROM test ORDER BY a DESC")
+		require.NoError(t, err)
+
+		var count int
+		err = st.Iterate(func(d document.Document) error {
+			var k, a int
+			var b struct{ C int }
+			err := document.Scan(d, &k, &a, &b)
+			require.NoError(t, err)
+			require.Equal(t, 99-count, a)
+			require.Equal(t, a, (k*37)%100)
+			require.Equal(t, k, b.C)
+
+			count++
+			return nil
+		})
+		require.NoError(t, err)
+		require.NoError(t, st.Close())
+		require.Equal(t, 100, count)
+
+		// keys must survive the round trip to disk
+		err = db.Exec("DELETE FROM test ORDER BY a LIMIT 10 OFFSET 10")
+		require.NoError(t, err)
+
+		d, err := db.QueryDocument("SELECT COUNT(*) AS n FROM test WHERE a >= 10 AND a < 20")
+		require.NoError(t, err)
+		var n int
+		err = document.Scan(d, &n)
+		require.NoError(t, err)
+		require.Equal(t, 0, n)
+
+		// temporary files must be removed
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+
+	t.Run("with index on ORDER BY", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test (k INTEGER PRIMARY KEY);
+			INSERT INTO test (k, a) VALUES (1, 10), (2, 'foo'), (3, 2.5);
+			INSERT INTO test (k) VALUES (4);
+			CREATE INDEX idx_a ON test (a);
+			INSERT INTO test (k, a) VALUES (5, 30);
+			INSERT INTO test (k) VALUES (6);
+			DELETE FROM test WHERE k = 4;
+		`)
+		require.NoError(t, err)
+
+		tests := []struct {
+			query, plan, expected string
+		}{
+			{
+				"SELECT k, a FROM test ORDER BY a",
+				`indexScan("idx_a") | project(k, a)`,
+				`[{"k": 6, "a": null}, {"k": 3, "a": 2.5}, {"k": 1, "a": 10}, {"k": 5, "a": 30}, {"k": 2, "a": "foo"}]`,
+			},
+			{
+				"SELECT k, a FROM test ORDER BY a DESC LIMIT 2",
+				`indexScanReverse("idx_a") | project(k, a) | take(2)`,
+				`[{"k": 2, "a": "foo"}, {"k": 5, "a": 30}]`,
+			},
+			{
+				"SELECT k FROM test WHERE a > 5 ORDER BY a DESC",
+				`indexScanReverse("idx_a", [5, -1, true]) | project(k)`,
+				`[{"k": 5}, {"k": 1}]`,
+			},
+			{
+				"SELECT k FROM test ORDER BY k DESC LIMIT 2",
+				`seqScanReverse(test) | project(k) | take(2)`,
+				`[{"k": 6}, {"k": 5}]`,
+			},
+		}
+
+		for _, test := range tests {
+			d, err := db.QueryDocument("EXPLAIN " + test.query)
+			require.NoError(t, err)
+			v, err := d.GetByField("plan")
+			require.NoError(t, err)
+			require.Equal(t, test.plan, v.V.(string))
+
+			st, err := db.Query(test.query)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			err = document.IteratorToJSONArray(&buf, st)
+			st.Close()
+			require.NoError(t, err)
+			require.JSONEq(t, test.expected, buf.String())
+		}
+	})
+
 	// https://github.com/genjidb/genji/issues/208
 	t.Run("group by with arrays", func(t *testing.T) {
 		db, err := genji.Open(":memory:")
@@ -322,27 +695,33 @@ func TestDistinct(t *testing.T) {
 		notUnique := total / 10
 
 		t.Run(typ.name, func(t *testing.T) {
-			db, err := genji.Open(":memory:")
-			require.NoError(t, err)
-			defer db.Close()
+			open := func(opts database.Options) *genji.DB {
+				db, err := genji.OpenWithOptions(":memory:", opts)
+				require.NoError(t, err)
 
-			tx, err := db.Begin(true)
-			require.NoError(t, err)
-			defer tx.Rollback()
+				tx, err := db.Begin(true)
+				require.NoError(t, err)
+				defer tx.Rollback()
 
-			err = tx.Exec("CREATE TABLE test(a " + typ.name + " PRIMARY KEY, b " + typ.name + ", doc DOCUMENT, nullable " + typ.name + ");")
-			require.NoError(t, err)
+				err = tx.Exec("CREATE TABLE test(a " + typ.name + " PRIMARY KEY, b " + typ.name + ", doc DOCUMENT, nullable " + typ.name + ");")
+				require.NoError(t, err)
 
-			err = tx.Exec("CREATE UNIQUE INDEX test_doc_index ON test(doc);")
-			require.NoError(t, err)
+				err = tx.Exec("CREATE UNIQUE INDEX test_doc_index ON test(doc);")
+				require.NoError(t, err)
 
-			for i := 0; i < total; i++ {
-				unique, nonunique := typ.generateValue(i, notUnique)
-				err = tx.Exec(`INSERT INTO test VALUES {a: ?, b: ?, doc: {a: ?, b: ?}, nullable: null}`, unique, nonunique, unique, nonunique)
+				for i := 0; i < total; i++ {
+					unique, nonunique := typ.generateValue(i, notUnique)
+					err = tx.Exec(`INSERT INTO test VALUES {a: ?, b: ?, doc: {a: ?, b: ?}, nullable: null}`, unique, nonunique, unique, nonunique)
+					require.NoError(t, err)
+				}
+				err = tx.Commit()
 				require.NoError(t, err)
+
+				return db
 			}
-			err = tx.Commit()
-			require.NoError(t, err)
+
+			db := open(database.Options{})
+			defer db.Close()
 
 			tests := []struct {
 				name          string
@@ -373,6 +752,28 @@ func TestDistinct(t *testing.T) {
 					require.Equal(t, test.expectedCount, i)
 				})
 			}
+
+			// same results must be returned when the seen documents are spilled to disk
+			spilled := open(database.Options{WorkMemoryLimit: 64, TempDir: t.TempDir()})
+			defer spilled.Close()
+
+			for _, test := range tests {
+				t.Run(test.name+"/spilled", func(t *testing.T) {
+					q, err := spilled.Query(test.query)
+					require.NoError(t, err)
+					defer q.Close()
+
+					seen := make(map[string]struct{})
+					err = q.Iterate(func(d document.Document) error {
+						enc, err := json.Marshal(d)
+						require.NoError(t, err)
+						seen[string(enc)] = struct{}{}
+						return nil
+					})
+					require.NoError(t, err)
+					require.Equal(t, test.expectedCount, len(seen))
+				})
+			}
 		})
 	}
 }
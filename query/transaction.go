@@ -13,15 +13,15 @@ type BeginStmt struct {
 	Writable bool
 }
 
-func (stmt BeginStmt) alterQuery(ctx context.Context, db *database.Database, q *Query) error {
+func (stmt BeginStmt) alterQuery(ctx context.Context, s *database.Session, q *Query) error {
 	if q.tx != nil {
 		return errors.New("cannot begin a transaction within a transaction")
 	}
 
 	var err error
-	q.tx, err = db.BeginTx(ctx, &database.TxOptions{
+	q.tx, err = s.DB().BeginTx(ctx, &database.TxOptions{
 		ReadOnly: !stmt.Writable,
-		Attached: true,
+		Session:  s,
 	})
 	q.autoCommit = false
 	return err
@@ -31,14 +31,14 @@ func (stmt BeginStmt) IsReadOnly() bool {
 	return !stmt.Writable
 }
 
-func (stmt BeginStmt) Run(tx *database.Transaction, args []expr.Param) (Result, error) {
+func (stmt BeginStmt) Run(ctx context.Context, tx *database.Transaction, args []expr.Param) (Result, error) {
 	return Result{}, errors.New("cannot begin a transaction within a transaction")
 }
 
 // RollbackStmt is a statement that rollbacks the current active transaction.
 type RollbackStmt struct{}
 
-func (stmt RollbackStmt) alterQuery(ctx context.Context, db *database.Database, q *Query) error {
+func (stmt RollbackStmt) alterQuery(ctx context.Context, s *database.Session, q *Query) error {
 	if q.tx == nil || q.autoCommit {
 		return errors.New("cannot rollback with no active transaction")
 	}
@@ -55,14 +55,14 @@ func (stmt RollbackStmt) IsReadOnly() bool {
 	return false
 }
 
-func (stmt RollbackStmt) Run(tx *database.Transaction, args []expr.Param) (Result, error) {
+func (stmt RollbackStmt) Run(ctx context.Context, tx *database.Transaction, args []expr.Param) (Result, error) {
 	return Result{}, errors.New("cannot rollback with no active transaction")
 }
 
 // CommitStmt is a statement that commits the current active transaction.
 type CommitStmt struct{}
 
-func (stmt CommitStmt) alterQuery(ctx context.Context, db *database.Database, q *Query) error {
+func (stmt CommitStmt) alterQuery(ctx context.Context, s *database.Session, q *Query) error {
 	if q.tx == nil || q.autoCommit {
 		return errors.New("cannot commit with no active transaction")
 	}
@@ -79,6 +79,70 @@ func (stmt CommitStmt) IsReadOnly() bool {
 	return false
 }
 
-func (stmt CommitStmt) Run(tx *database.Transaction, args []expr.Param) (Result, error) {
+func (stmt CommitStmt) Run(ctx context.Context, tx *database.Transaction, args []expr.Param) (Result, error) {
 	return Result{}, errors.New("cannot commit with no active transaction")
 }
+
+// SavepointStmt is a statement that creates a savepoint in the current active transaction.
+type SavepointStmt struct {
+	Name string
+}
+
+func (stmt SavepointStmt) alterQuery(ctx context.Context, s *database.Session, q *Query) error {
+	if q.tx == nil || q.autoCommit {
+		return errors.New("cannot create a savepoint with no active transaction")
+	}
+
+	return q.tx.Savepoint(stmt.Name)
+}
+
+func (stmt SavepointStmt) IsReadOnly() bool {
+	return true
+}
+
+func (stmt SavepointStmt) Run(ctx context.Context, tx *database.Transaction, args []expr.Param) (Result, error) {
+	return Result{}, tx.Savepoint(stmt.Name)
+}
+
+// ReleaseSavepointStmt is a statement that destroys a savepoint of the current active transaction.
+type ReleaseSavepointStmt struct {
+	Name string
+}
+
+func (stmt ReleaseSavepointStmt) alterQuery(ctx context.Context, s *database.Session, q *Query) error {
+	if q.tx == nil || q.autoCommit {
+		return errors.New("cannot release a savepoint with no active transaction")
+	}
+
+	return q.tx.ReleaseSavepoint(stmt.Name)
+}
+
+func (stmt ReleaseSavepointStmt) IsReadOnly() bool {
+	return true
+}
+
+func (stmt ReleaseSavepointStmt) Run(ctx context.Context, tx *database.Transaction, args []expr.Param) (Result, error) {
+	return Result{}, tx.ReleaseSavepoint(stmt.Name)
+}
+
+// RollbackToSavepointStmt is a statement that cancels the changes made
+// since a savepoint of the current active transaction.
+type RollbackToSavepointStmt struct {
+	Name string
+}
+
+func (stmt RollbackToSavepointStmt) alterQuery(ctx context.Context, s *database.Session, q *Query) error {
+	if q.tx == nil || q.autoCommit {
+		return errors.New("cannot rollback to a savepoint with no active transaction")
+	}
+
+	return q.tx.RollbackToSavepoint(stmt.Name)
+}
+
+func (stmt RollbackToSavepointStmt) IsReadOnly() bool {
+	return true
+}
+
+func (stmt RollbackToSavepointStmt) Run(ctx context.Context, tx *database.Transaction, args []expr.Param) (Result, error) {
+	return Result{}, tx.RollbackToSavepoint(stmt.Name)
+}
@@ -1,9 +1,15 @@
 package query_test
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"testing"
 
 	"github.com/genjidb/genji"
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/document"
+	"github.com/genjidb/genji/sql/parser"
 	"github.com/stretchr/testify/require"
 )
 
@@ -30,7 +36,10 @@ func TestTransactionRun(t *testing.T) {
 			db, err := genji.Open(":memory:")
 			require.NoError(t, err)
 			defer db.Close()
-			defer db.Exec("ROLLBACK")
+
+			// transactions opened by BEGIN span multiple queries within a session.
+			db = db.NewSession()
+			defer db.Close()
 
 			for _, q := range test.queries {
 				err = db.Exec(q)
@@ -46,3 +55,96 @@ func TestTransactionRun(t *testing.T) {
 		})
 	}
 }
+
+func TestSavepointRun(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec("CREATE TABLE test(a INTEGER PRIMARY KEY); CREATE UNIQUE INDEX idx_b ON test(b)")
+	require.NoError(t, err)
+
+	db = db.NewSession()
+	defer db.Close()
+
+	err = db.Exec("SAVEPOINT a")
+	require.Error(t, err)
+
+	err = db.Exec("BEGIN")
+	require.NoError(t, err)
+
+	// skip the documents that cannot be inserted without discarding the transaction
+	for i, b := range []int{1, 2, 2, 3} {
+		err = db.Exec("SAVEPOINT doc")
+		require.NoError(t, err)
+
+		err = db.Exec("INSERT INTO test (a, b) VALUES (?, ?)", i, b)
+		if err != nil {
+			err = db.Exec("ROLLBACK TO SAVEPOINT doc")
+			require.NoError(t, err)
+			continue
+		}
+
+		err = db.Exec("RELEASE SAVEPOINT doc")
+		require.NoError(t, err)
+	}
+
+	err = db.Exec("SAVEPOINT s; DELETE FROM test; ROLLBACK TO s; RELEASE s")
+	require.NoError(t, err)
+
+	// failing savepoint statements don't end the transaction
+	err = db.Exec("ROLLBACK TO SAVEPOINT unknown")
+	require.True(t, errors.Is(err, database.ErrSavepointNotFound))
+	err = db.Exec("RELEASE SAVEPOINT unknown")
+	require.True(t, errors.Is(err, database.ErrSavepointNotFound))
+
+	err = db.Exec("COMMIT")
+	require.NoError(t, err)
+
+	res, err := db.Query("SELECT a, b FROM test")
+	require.NoError(t, err)
+	defer res.Close()
+
+	var buf bytes.Buffer
+	err = document.IteratorToJSONArray(&buf, res)
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"a": 0, "b": 1}, {"a": 1, "b": 2}, {"a": 3, "b": 3}]`, buf.String())
+}
+
+func TestDeprecatedRun(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	run := func(q string) error {
+		pq, err := parser.PrepareQuery(db.DB, q)
+		if err != nil {
+			return err
+		}
+
+		res, err := pq.Run(context.Background(), db.DB, nil)
+		if err != nil {
+			return err
+		}
+		defer res.Close()
+
+		return res.Iterate(func(d document.Document) error { return nil })
+	}
+
+	// the transaction opened by BEGIN is attached to the database.
+	err = run("CREATE TABLE test; BEGIN")
+	require.NoError(t, err)
+	require.NotNil(t, db.DB.GetAttachedTx())
+
+	err = run("INSERT INTO test (a) VALUES (1)")
+	require.NoError(t, err)
+	err = run("COMMIT")
+	require.NoError(t, err)
+	require.Nil(t, db.DB.GetAttachedTx())
+
+	d, err := db.QueryDocument("SELECT COUNT(*) FROM test")
+	require.NoError(t, err)
+	var n int
+	require.NoError(t, document.Scan(d, &n))
+	require.Equal(t, 1, n)
+}
@@ -6,10 +6,14 @@ import (
 	"database/sql/driver"
 	"errors"
 	"io"
+	"reflect"
 	"runtime"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/genjidb/genji"
+	"github.com/genjidb/genji/database"
 	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/expr"
 	"github.com/genjidb/genji/planner"
@@ -36,8 +40,15 @@ func (d sqlDriver) Open(name string) (driver.Conn, error) {
 	return nil, errors.New("requires go1.10 or greater")
 }
 
+// OpenConnector parses the DSN and opens the database it describes.
+// See parseDSN for the supported format.
 func (d sqlDriver) OpenConnector(name string) (driver.Connector, error) {
-	db, err := genji.Open(name)
+	cfg, err := parseDSN(name)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := cfg.open()
 	if err != nil {
 		return nil, err
 	}
@@ -65,7 +76,7 @@ type connector struct {
 }
 
 func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
-	return &conn{db: c.db}, nil
+	return &conn{db: c.db, session: c.db.DB.NewSession()}, nil
 }
 
 func (c *connector) Driver() driver.Driver {
@@ -82,9 +93,12 @@ func (c *connector) Close() error {
 
 // conn represents a connection to the Genji database.
 // It implements the database/sql/driver.Conn interface.
+// Each connection has its own session, so that transactions opened with
+// the BEGIN statement are only used by the connection that opened them.
 type conn struct {
-	db *genji.DB
-	tx *genji.Tx
+	db      *genji.DB
+	session *database.Session
+	tx      *genji.Tx
 }
 
 // Prepare returns a prepared statement, bound to this connection.
@@ -94,15 +108,17 @@ func (c *conn) Prepare(q string) (driver.Stmt, error) {
 
 // PrepareContext returns a prepared statement, bound to this connection.
 func (c *conn) PrepareContext(ctx context.Context, q string) (driver.Stmt, error) {
-	pq, err := parser.ParseQuery(q)
+	// the statement is parsed once and its execution plan is reused
+	// by every call to Exec and Query.
+	pq, err := parser.PrepareQuery(c.db.DB, q)
 	if err != nil {
 		return nil, err
 	}
 
 	return stmt{
-		db: c.db,
-		tx: c.tx,
-		q:  pq,
+		session: c.session,
+		tx:      c.tx,
+		q:       pq,
 	}, nil
 }
 
@@ -112,7 +128,7 @@ func (c *conn) Close() error {
 		return c.tx.Rollback()
 	}
 
-	return nil
+	return c.session.Close()
 }
 
 // Begin starts and returns a new transaction.
@@ -128,12 +144,16 @@ func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, e
 		return nil, errors.New("isolation levels are not supported")
 	}
 
+	if c.session.Tx() != nil {
+		return nil, database.ErrTransactionInProgress
+	}
+
 	db := c.db.WithContext(ctx)
 
 	// if the ReadOnly flag is explicitly specified, create a read-only transaction,
-	// otherwise create a read/write transaction.
+	// otherwise create a read/write transaction, unless the database is read-only.
 	var err error
-	c.tx, err = db.Begin(!opts.ReadOnly)
+	c.tx, err = db.Begin(!opts.ReadOnly && !db.DB.ReadOnly())
 
 	return c, err
 }
@@ -153,9 +173,9 @@ func (c *conn) Rollback() error {
 // Stmt is a prepared statement. It is bound to a Conn and not
 // used by multiple goroutines concurrently.
 type stmt struct {
-	db *genji.DB
-	tx *genji.Tx
-	q  query.Query
+	session *database.Session
+	tx      *genji.Tx
+	q       query.Query
 }
 
 // NumInput returns the number of placeholder parameters.
@@ -204,9 +224,9 @@ func (s stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver
 	// if calling ExecContext within a transaction, use it,
 	// otherwise use DB.
 	if s.tx != nil {
-		res, err = s.q.Exec(s.tx.Transaction, driverNamedValueToParams(args))
+		res, err = s.q.Exec(ctx, s.tx.Transaction, driverNamedValueToParams(args))
 	} else {
-		res, err = s.q.Run(ctx, s.db.DB, driverNamedValueToParams(args))
+		res, err = s.q.RunSession(ctx, s.session, driverNamedValueToParams(args))
 	}
 
 	if err != nil {
@@ -218,23 +238,35 @@ func (s stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver
 		return nil, err
 	}
 
+	r := result{rowsAffected: res.RowsAffected()}
+	r.lastInsertID, r.hasInsertID = res.LastInsertID()
+
 	// s.q.Run might return a stream if the last Statement is a Select,
 	// make sure the result is closed before returning so any transaction
 	// created by s.q.Run is closed.
-	return result{}, res.Close()
+	return r, res.Close()
 }
 
 type result struct {
+	rowsAffected int64
+	lastInsertID int64
+	hasInsertID  bool
 }
 
-// LastInsertId is not supported and returns an error.
+// LastInsertId returns the integer primary key of the last document inserted
+// by the statement, or the generated document id for tables without primary key.
+// It returns an error if the statement didn't insert any document with an integer key.
 func (r result) LastInsertId() (int64, error) {
-	return 0, errors.New("not supported")
+	if !r.hasInsertID {
+		return 0, errors.New("no integer primary key was inserted")
+	}
+
+	return r.lastInsertID, nil
 }
 
-// RowsAffected is not supported and returns an error.
+// RowsAffected returns the number of documents inserted, updated or deleted by the statement.
 func (r result) RowsAffected() (int64, error) {
-	return 0, errors.New("not supported")
+	return r.rowsAffected, nil
 }
 
 func (s stmt) Query(args []driver.Value) (driver.Rows, error) {
@@ -256,49 +288,125 @@ func (s stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (drive
 	// if calling QueryContext within a transaction, use it,
 	// otherwise use DB.
 	if s.tx != nil {
-		res, err = s.q.Exec(s.tx.Transaction, driverNamedValueToParams(args))
+		res, err = s.q.Exec(ctx, s.tx.Transaction, driverNamedValueToParams(args))
 	} else {
-		res, err = s.q.Run(ctx, s.db.DB, driverNamedValueToParams(args))
+		res, err = s.q.RunSession(ctx, s.session, driverNamedValueToParams(args))
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	rs := newRecordStream(res)
+	tx := res.Tx
+	if s.tx != nil {
+		tx = s.tx.Transaction
+	}
+
+	columns, err := s.columns(tx)
+	if err != nil {
+		res.Close()
+		return nil, err
+	}
+
+	return newRecordStream(res, columns), nil
+}
+
+// columns returns the columns returned by the last statement of the query.
+// If the statement reads from a table with declared fields, the columns
+// are annotated with the field constraints and wildcards are expanded
+// into the top-level declared fields of the table, followed by a column
+// containing the fields that weren't declared, since tables accept
+// any field.
+func (s stmt) columns(tx *database.Transaction) ([]column, error) {
+	// if there is no projection, the stream will output documents in a single field
+	wildcard := []column{{name: "*", wildcard: true}}
+
 	if len(s.q.Statements) == 0 {
-		return rs, nil
+		return wildcard, nil
 	}
 
 	lastStmt := s.q.Statements[len(s.q.Statements)-1]
 
 	stmt, ok := lastStmt.(*planner.Statement)
 	if !ok || stmt.Stream.Op == nil {
-		return rs, nil
+		return wildcard, nil
 	}
 
-	// Search the ProjectOperator.
+	var tableName string
+	var po *stream.ProjectOperator
 	for op := stmt.Stream.First(); op != nil; op = op.GetNext() {
-		if po, ok := op.(*stream.ProjectOperator); ok {
-			if len(po.Exprs) == 0 {
-				break
+		switch t := op.(type) {
+		case *stream.SeqScanOperator:
+			tableName = t.TableName
+		case *stream.PkScanOperator:
+			tableName = t.TableName
+		case *stream.IndexScanOperator:
+			if tx == nil {
+				continue
 			}
-
-			rs.fields = make([]string, len(po.Exprs))
-			for i := range po.Exprs {
-				rs.fields[i] = stringutil.Sprintf("%s", po.Exprs[i])
+			idx, err := tx.GetIndex(t.IndexName)
+			if err != nil {
+				return nil, err
+			}
+			tableName = idx.Info.TableName
+		case *stream.ProjectOperator:
+			if po == nil {
+				po = t
 			}
+		}
+	}
+
+	if po == nil || len(po.Exprs) == 0 {
+		return wildcard, nil
+	}
 
-			return rs, nil
+	var fcs database.FieldConstraints
+	if tableName != "" && tx != nil {
+		tb, err := tx.GetTable(tableName)
+		if err != nil {
+			return nil, err
 		}
+		fcs = tb.Info().FieldConstraints
 	}
 
-	// if fields is empty, the stream will output documents in a single field
-	if len(rs.fields) == 0 {
-		rs.fields = []string{"*"}
+	var columns []column
+	for _, e := range po.Exprs {
+		if _, ok := e.(expr.Wildcard); ok {
+			var declared []string
+			for _, fc := range fcs {
+				if len(fc.Path) != 1 {
+					continue
+				}
+
+				columns = append(columns, column{name: fc.Path[0].FieldName, fc: fc})
+				declared = append(declared, fc.Path[0].FieldName)
+			}
+
+			if len(declared) == 0 {
+				columns = append(columns, wildcard...)
+			} else {
+				columns = append(columns, column{name: "*", wildcard: true, declared: declared})
+			}
+
+			continue
+		}
+
+		var c column
+		if ne, ok := e.(*expr.NamedExpr); ok {
+			c.name = ne.Name()
+			e = ne.Expr
+		} else {
+			c.name = stringutil.Sprintf("%s", e)
+		}
+
+		if p, ok := e.(expr.Path); ok {
+			c.fc = fcs.Get(document.Path(p))
+		}
+
+		columns = append(columns, c)
 	}
 
-	return rs, nil
+	return columns, nil
 }
 
 func driverNamedValueToParams(args []driver.NamedValue) []expr.Param {
@@ -318,12 +426,31 @@ func (s stmt) Close() error {
 
 var errStop = errors.New("stop")
 
+var (
+	_ driver.Rows                           = (*documentStream)(nil)
+	_ driver.RowsColumnTypeDatabaseTypeName = (*documentStream)(nil)
+	_ driver.RowsColumnTypeScanType         = (*documentStream)(nil)
+	_ driver.RowsColumnTypeNullable         = (*documentStream)(nil)
+)
+
 type documentStream struct {
 	res      *query.Result
 	cancelFn func()
 	c        chan doc
 	wg       sync.WaitGroup
-	fields   []string
+	columns  []column
+}
+
+// column is a column returned by a documentStream.
+type column struct {
+	name string
+	// if true, the column contains the whole document.
+	wildcard bool
+	// if not empty, the wildcard column only contains the fields
+	// of the document that aren't in this list, and is null if there are none.
+	declared []string
+	// constraint of the field the column was read from, if any.
+	fc *database.FieldConstraint
 }
 
 type doc struct {
@@ -331,13 +458,14 @@ type doc struct {
 	err error
 }
 
-func newRecordStream(res *query.Result) *documentStream {
+func newRecordStream(res *query.Result, columns []column) *documentStream {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	ds := documentStream{
 		res:      res,
 		cancelFn: cancel,
 		c:        make(chan doc),
+		columns:  columns,
 	}
 	ds.wg.Add(1)
 
@@ -377,8 +505,11 @@ func (rs *documentStream) iterate(ctx context.Context) {
 		return
 	}
 	if err != nil {
-		rs.c <- doc{
+		select {
+		case <-ctx.Done():
+		case rs.c <- doc{
 			err: err,
+		}:
 		}
 		return
 	}
@@ -386,12 +517,87 @@ func (rs *documentStream) iterate(ctx context.Context) {
 
 // Columns returns the fields selected by the SELECT statement.
 func (rs *documentStream) Columns() []string {
-	return rs.fields
+	names := make([]string, len(rs.columns))
+	for i := range rs.columns {
+		names[i] = rs.columns[i].name
+	}
+
+	return names
+}
+
+// ColumnTypeDatabaseTypeName returns the type declared for the field of the column,
+// in upper case. If no type was declared, it returns an empty string.
+func (rs *documentStream) ColumnTypeDatabaseTypeName(index int) string {
+	c := rs.columns[index]
+	if c.wildcard {
+		return strings.ToUpper(document.DocumentValue.String())
+	}
+	if c.fc == nil {
+		return ""
+	}
+
+	return strings.ToUpper(c.fc.Type.String())
+}
+
+// ColumnTypeScanType returns the Go type of the values of the column.
+// If no type was declared for the field of the column, it returns the type of interface{}.
+func (rs *documentStream) ColumnTypeScanType(index int) reflect.Type {
+	c := rs.columns[index]
+	if c.wildcard {
+		return documentType
+	}
+	if c.fc == nil {
+		return anyType
+	}
+
+	switch c.fc.Type {
+	case document.BoolValue:
+		return reflect.TypeOf(false)
+	case document.IntegerValue:
+		return reflect.TypeOf(int64(0))
+	case document.DoubleValue:
+		return reflect.TypeOf(float64(0))
+	case document.TimestampValue:
+		return reflect.TypeOf(time.Time{})
+	case document.TextValue:
+		return reflect.TypeOf("")
+	case document.BlobValue:
+		return reflect.TypeOf([]byte(nil))
+	case document.ArrayValue:
+		return arrayType
+	case document.DocumentValue:
+		return documentType
+	}
+
+	return anyType
+}
+
+var (
+	anyType      = reflect.TypeOf((*interface{})(nil)).Elem()
+	documentType = reflect.TypeOf((*document.Document)(nil)).Elem()
+	arrayType    = reflect.TypeOf((*document.Array)(nil)).Elem()
+)
+
+// ColumnTypeNullable reports whether the column may contain null values.
+// The result is only known for columns read from fields with declared constraints.
+func (rs *documentStream) ColumnTypeNullable(index int) (nullable, ok bool) {
+	c := rs.columns[index]
+	if c.wildcard {
+		return len(c.declared) > 0, true
+	}
+	if c.fc == nil {
+		return false, false
+	}
+
+	return !c.fc.IsNotNull && !c.fc.IsPrimaryKey, true
 }
 
 // Close closes the rows iterator.
 func (rs *documentStream) Close() error {
 	rs.cancelFn()
+	// wait for the iteration to stop before closing the result,
+	// engines may not allow closing a transaction with open iterators.
+	rs.wg.Wait()
 	return rs.res.Close()
 }
 
@@ -407,14 +613,31 @@ func (rs *documentStream) Next(dest []driver.Value) error {
 		return doc.err
 	}
 
-	for i := range rs.fields {
-		if rs.fields[i] == "*" {
-			dest[i] = doc.d
+	for i, c := range rs.columns {
+		if c.wildcard {
+			if len(c.declared) == 0 {
+				dest[i] = doc.d
+				continue
+			}
 
+			rest, err := undeclaredFields(doc.d, c.declared)
+			if err != nil {
+				return err
+			}
+			if rest.Len() == 0 {
+				dest[i] = nil
+			} else {
+				dest[i] = rest
+			}
 			continue
 		}
 
-		f, err := doc.d.GetByField(rs.fields[i])
+		f, err := doc.d.GetByField(c.name)
+		if err == document.ErrFieldNotFound {
+			// declared fields are optional unless they are NOT NULL
+			dest[i] = nil
+			continue
+		}
 		if err != nil {
 			return err
 		}
@@ -425,6 +648,24 @@ func (rs *documentStream) Next(dest []driver.Value) error {
 	return nil
 }
 
+// undeclaredFields returns the top-level fields of d which are not in declared.
+func undeclaredFields(d document.Document, declared []string) (*document.FieldBuffer, error) {
+	var fb document.FieldBuffer
+
+	err := d.Iterate(func(field string, v document.Value) error {
+		for _, name := range declared {
+			if name == field {
+				return nil
+			}
+		}
+
+		fb.Add(field, v)
+		return nil
+	})
+
+	return &fb, err
+}
+
 type valueScanner struct {
 	dest interface{}
 }
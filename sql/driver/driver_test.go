@@ -3,9 +3,11 @@ package driver
 import (
 	"context"
 	"database/sql"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/engine"
 	"github.com/stretchr/testify/require"
 )
@@ -26,8 +28,10 @@ func TestDriver(t *testing.T) {
 	res, err := db.Exec("CREATE TABLE test")
 	require.NoError(t, err)
 	n, err := res.RowsAffected()
-	require.Error(t, err)
+	require.NoError(t, err)
 	require.EqualValues(t, 0, n)
+	_, err = res.LastInsertId()
+	require.Error(t, err)
 
 	for i := 0; i < 10; i++ {
 		_, err = db.Exec("INSERT INTO test (a, b, c) VALUES (?, ?, ?)", i, []int{i + 1, i + 2, i + 3}, &foo{Foo: "bar"})
@@ -262,6 +266,241 @@ func TestDriver(t *testing.T) {
 		`)
 		require.Equal(t, err, engine.ErrTransactionReadOnly)
 	})
+
+	t.Run("Prepared statement", func(t *testing.T) {
+		stmt, err := db.Prepare("SELECT a FROM test WHERE a = ?")
+		require.NoError(t, err)
+		defer stmt.Close()
+
+		for i := 0; i < 10; i++ {
+			var a int
+			err = stmt.QueryRow(i).Scan(&a)
+			require.NoError(t, err)
+			require.Equal(t, i, a)
+		}
+	})
+
+	t.Run("RowsAffected and LastInsertId", func(t *testing.T) {
+		_, err := db.Exec("CREATE TABLE docids; CREATE TABLE ints(id INTEGER PRIMARY KEY); CREATE TABLE texts(id TEXT PRIMARY KEY)")
+		require.NoError(t, err)
+
+		check := func(res sql.Result, affected int64, lastID int64, hasID bool) {
+			t.Helper()
+
+			n, err := res.RowsAffected()
+			require.NoError(t, err)
+			require.Equal(t, affected, n)
+
+			id, err := res.LastInsertId()
+			if !hasID {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, lastID, id)
+		}
+
+		res, err := db.Exec("INSERT INTO docids (a) VALUES (1), (2), (3)")
+		require.NoError(t, err)
+		check(res, 3, 3, true)
+
+		res, err = db.Exec("INSERT INTO ints (id) VALUES (10), (?)", 20.0)
+		require.NoError(t, err)
+		check(res, 2, 20, true)
+
+		res, err = db.Exec("INSERT INTO texts (id) VALUES ('a')")
+		require.NoError(t, err)
+		check(res, 1, 0, false)
+
+		res, err = db.Exec("UPDATE docids SET b = 1 WHERE a >= 2")
+		require.NoError(t, err)
+		check(res, 2, 0, false)
+
+		res, err = db.Exec("DELETE FROM ints")
+		require.NoError(t, err)
+		check(res, 2, 0, false)
+
+		res, err = db.Exec("DELETE FROM ints")
+		require.NoError(t, err)
+		check(res, 0, 0, false)
+
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		res, err = tx.Exec("INSERT INTO docids (a) VALUES (4)")
+		require.NoError(t, err)
+		check(res, 1, 4, true)
+
+		stmt, err := tx.Prepare("DELETE FROM docids WHERE a = ?")
+		require.NoError(t, err)
+		defer stmt.Close()
+
+		res, err = stmt.Exec(4)
+		require.NoError(t, err)
+		check(res, 1, 0, false)
+	})
+}
+
+func TestDriverConnTransactions(t *testing.T) {
+	db, err := sql.Open("genji", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE test; INSERT INTO test (a) VALUES (1)")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	c1, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer c1.Close()
+	c2, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer c2.Close()
+
+	// transactions opened with BEGIN are bound to their connection
+	_, err = c1.ExecContext(ctx, "BEGIN READ ONLY")
+	require.NoError(t, err)
+	_, err = c2.ExecContext(ctx, "BEGIN READ ONLY")
+	require.NoError(t, err)
+
+	_, err = c1.BeginTx(ctx, nil)
+	require.Error(t, err)
+
+	for _, c := range []*sql.Conn{c1, c2} {
+		var n int
+		err = c.QueryRowContext(ctx, "SELECT COUNT(*) FROM test").Scan(&n)
+		require.NoError(t, err)
+		require.Equal(t, 1, n)
+	}
+
+	_, err = c1.ExecContext(ctx, "ROLLBACK")
+	require.NoError(t, err)
+	_, err = c2.ExecContext(ctx, "ROLLBACK")
+	require.NoError(t, err)
+
+	_, err = c1.ExecContext(ctx, "BEGIN")
+	require.NoError(t, err)
+	_, err = c1.ExecContext(ctx, "INSERT INTO test (a) VALUES (2)")
+	require.NoError(t, err)
+	_, err = c1.ExecContext(ctx, "ROLLBACK")
+	require.NoError(t, err)
+
+	var n int
+	err = c2.QueryRowContext(ctx, "SELECT COUNT(*) FROM test").Scan(&n)
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+}
+
+func TestDriverColumnTypes(t *testing.T) {
+	db, err := sql.Open("genji", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE typed(id INTEGER PRIMARY KEY, name TEXT NOT NULL, score DOUBLE, tags ARRAY, created TIMESTAMP);
+		CREATE TABLE untyped;
+		INSERT INTO typed (id, name, score, tags) VALUES (1, 'a', 1.5, [1]);
+		INSERT INTO typed (id, name, extra) VALUES (2, 'b', 'c');
+		INSERT INTO untyped (a, b) VALUES (1, 2);
+	`)
+	require.NoError(t, err)
+
+	type col struct {
+		name     string
+		typeName string
+		scanType reflect.Type
+		nullable bool
+		ok       bool
+	}
+
+	check := func(t *testing.T, q string, expected []col) {
+		t.Helper()
+
+		rows, err := db.Query(q)
+		require.NoError(t, err)
+		defer rows.Close()
+
+		types, err := rows.ColumnTypes()
+		require.NoError(t, err)
+		require.Len(t, types, len(expected))
+		for i, ct := range types {
+			require.Equal(t, expected[i].name, ct.Name())
+			require.Equal(t, expected[i].typeName, ct.DatabaseTypeName())
+			require.Equal(t, expected[i].scanType, ct.ScanType())
+			nullable, ok := ct.Nullable()
+			require.Equal(t, expected[i].nullable, nullable)
+			require.Equal(t, expected[i].ok, ok)
+		}
+	}
+
+	anyType := reflect.TypeOf((*interface{})(nil)).Elem()
+
+	t.Run("Wildcard", func(t *testing.T) {
+		check(t, "SELECT * FROM typed", []col{
+			{"id", "INTEGER", reflect.TypeOf(int64(0)), false, true},
+			{"name", "TEXT", reflect.TypeOf(""), false, true},
+			{"score", "DOUBLE", reflect.TypeOf(float64(0)), true, true},
+			{"tags", "ARRAY", reflect.TypeOf((*document.Array)(nil)).Elem(), true, true},
+			{"created", "TIMESTAMP", reflect.TypeOf(time.Time{}), true, true},
+			{"*", "DOCUMENT", reflect.TypeOf((*document.Document)(nil)).Elem(), true, true},
+		})
+
+		var id int64
+		var name string
+		var score float64
+		var tags []int
+		var created sql.NullTime
+		var rest interface{}
+		err := db.QueryRow("SELECT * FROM typed WHERE id = 1").Scan(&id, &name, &score, Scanner(&tags), &created, &rest)
+		require.NoError(t, err)
+		require.EqualValues(t, 1, id)
+		require.Equal(t, "a", name)
+		require.Equal(t, 1.5, score)
+		require.Equal(t, []int{1}, tags)
+		require.False(t, created.Valid)
+		require.Nil(t, rest)
+	})
+
+	t.Run("Undeclared fields", func(t *testing.T) {
+		var id int64
+		var name string
+		var score sql.NullFloat64
+		var tags, created interface{}
+		var rest struct {
+			Extra string
+		}
+		err := db.QueryRow("SELECT * FROM typed WHERE id = 2").Scan(&id, &name, &score, &tags, &created, Scanner(&rest))
+		require.NoError(t, err)
+		require.EqualValues(t, 2, id)
+		require.Equal(t, "b", name)
+		require.False(t, score.Valid)
+		require.Nil(t, tags)
+		require.Nil(t, created)
+		require.Equal(t, "c", rest.Extra)
+	})
+
+	t.Run("Fields", func(t *testing.T) {
+		check(t, "SELECT name AS n, score + 1, id FROM typed", []col{
+			{"n", "TEXT", reflect.TypeOf(""), false, true},
+			{"score + 1", "", anyType, false, false},
+			{"id", "INTEGER", reflect.TypeOf(int64(0)), false, true},
+		})
+
+		var n string
+		err := db.QueryRow("SELECT name AS n FROM typed").Scan(&n)
+		require.NoError(t, err)
+		require.Equal(t, "a", n)
+	})
+
+	t.Run("Untyped", func(t *testing.T) {
+		check(t, "SELECT * FROM untyped", []col{
+			{"*", "DOCUMENT", reflect.TypeOf((*document.Document)(nil)).Elem(), false, true},
+		})
+		check(t, "SELECT a FROM untyped", []col{
+			{"a", "", anyType, false, false},
+		})
+	})
 }
 
 func TestDriverWithTimeValues(t *testing.T) {
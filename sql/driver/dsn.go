@@ -0,0 +1,174 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/genjidb/genji"
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/document/encoding"
+	"github.com/genjidb/genji/document/encoding/custom"
+	"github.com/genjidb/genji/document/encoding/msgpack"
+	"github.com/genjidb/genji/engine"
+	_ "github.com/genjidb/genji/engine/boltengine"   // register the bolt engine
+	_ "github.com/genjidb/genji/engine/memoryengine" // register the memory engine
+	"github.com/genjidb/genji/stringutil"
+)
+
+// dsnPrefix identifies DSNs containing options.
+// Any other DSN is considered to be a path.
+const dsnPrefix = "genji://"
+
+// config is the configuration parsed from a DSN.
+type config struct {
+	path      string
+	engine    string
+	codec     encoding.Codec
+	engineOpt engine.OpenOptions
+	dbOpt     database.Options
+}
+
+// parseDSN parses a DSN of the form:
+//
+//	genji://path?param1=value1&...&paramN=valueN
+//
+// Absolute paths thus start with three slashes, e.g. genji:///data/app.db.
+// The supported parameters are:
+//
+//	engine: name of the engine, bolt or memory, or any engine registered with engine.Register.
+//	  Defaults to memory if the path is :memory:, otherwise bolt.
+//	codec: msgpack or custom. Defaults to msgpack.
+//	readonly: if true, only read-only transactions are allowed.
+//	timeout: maximum time to wait for the database files to be unlocked, e.g. 5s.
+//	workmem: maximum number of bytes an operation can use in memory before spilling to disk.
+//	tempdir: directory in which temporary files are created.
+//	parallel: number of goroutines used to scan tables in read-only queries.
+//	maxmem: maximum number of bytes sort, aggregate and distinct operations of a statement can hold in memory.
+//	maxscan: maximum number of documents a statement can read.
+//	stmttimeout: maximum execution time of a statement, e.g. 30s.
+//
+// Limits can also be set per statement, using a context created with database.WithLimits.
+//
+// DSNs without the genji:// prefix are considered to be a path and use the default options.
+func parseDSN(dsn string) (*config, error) {
+	cfg := config{
+		path:  dsn,
+		codec: msgpack.NewCodec(),
+	}
+
+	if strings.HasPrefix(dsn, dsnPrefix) {
+		rest := strings.TrimPrefix(dsn, dsnPrefix)
+
+		var rawQuery string
+		if i := strings.IndexByte(rest, '?'); i >= 0 {
+			rest, rawQuery = rest[:i], rest[i+1:]
+		}
+
+		var err error
+		cfg.path, err = url.PathUnescape(rest)
+		if err != nil {
+			return nil, stringutil.Errorf("invalid DSN path: %w", err)
+		}
+
+		params, err := url.ParseQuery(rawQuery)
+		if err != nil {
+			return nil, stringutil.Errorf("invalid DSN parameters: %w", err)
+		}
+
+		err = cfg.parseParams(params)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.engine == "" {
+		if cfg.path == ":memory:" {
+			cfg.engine = "memory"
+		} else {
+			cfg.engine = "bolt"
+		}
+	}
+
+	if cfg.path == "" && cfg.engine != "memory" {
+		return nil, errors.New("missing path in DSN")
+	}
+
+	return &cfg, nil
+}
+
+func (cfg *config) parseParams(params url.Values) error {
+	var err error
+
+	for k, v := range params {
+		if len(v) != 1 {
+			return stringutil.Errorf("DSN parameter %q must be set once", k)
+		}
+		value := v[0]
+
+		switch k {
+		case "engine":
+			cfg.engine = value
+		case "codec":
+			switch value {
+			case "msgpack":
+				cfg.codec = msgpack.NewCodec()
+			case "custom":
+				cfg.codec = custom.NewCodec()
+			default:
+				return stringutil.Errorf("unknown codec %q", value)
+			}
+		case "readonly":
+			cfg.engineOpt.ReadOnly, err = strconv.ParseBool(value)
+			cfg.dbOpt.ReadOnly = cfg.engineOpt.ReadOnly
+		case "timeout":
+			cfg.engineOpt.Timeout, err = time.ParseDuration(value)
+		case "workmem":
+			cfg.dbOpt.WorkMemoryLimit, err = strconv.ParseInt(value, 10, 64)
+		case "tempdir":
+			cfg.dbOpt.TempDir = value
+		case "parallel":
+			cfg.dbOpt.ParallelWorkers, err = strconv.Atoi(value)
+		case "maxmem":
+			cfg.dbOpt.Limits.MaxMemory, err = strconv.ParseInt(value, 10, 64)
+		case "maxscan":
+			cfg.dbOpt.Limits.MaxScannedDocuments, err = strconv.ParseInt(value, 10, 64)
+		case "stmttimeout":
+			cfg.dbOpt.Limits.Timeout, err = time.ParseDuration(value)
+		default:
+			return stringutil.Errorf("unknown DSN parameter %q", k)
+		}
+		if err != nil {
+			return stringutil.Errorf("invalid value for DSN parameter %q: %w", k, err)
+		}
+	}
+
+	return nil
+}
+
+// open the engine and the database described by the configuration.
+func (cfg *config) open() (*genji.DB, error) {
+	open, ok := engine.Lookup(cfg.engine)
+	if !ok {
+		return nil, stringutil.Errorf("unknown engine %q", cfg.engine)
+	}
+
+	ng, err := open(cfg.path, cfg.engineOpt)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := cfg.dbOpt
+	opts.Codec = cfg.codec
+
+	db, err := genji.NewWithOptions(context.Background(), ng, opts)
+	if err != nil {
+		ng.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
@@ -0,0 +1,126 @@
+package driver
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/genjidb/genji/document/encoding/custom"
+	"github.com/genjidb/genji/engine"
+	"github.com/genjidb/genji/engine/memoryengine"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDSN(t *testing.T) {
+	tests := []struct {
+		dsn     string
+		path    string
+		engine  string
+		fails   bool
+		checkFn func(t *testing.T, cfg *config)
+	}{
+		{":memory:", ":memory:", "memory", false, nil},
+		{"data.db", "data.db", "bolt", false, nil},
+		{"genji://:memory:", ":memory:", "memory", false, nil},
+		{"genji:///data/app.db", "/data/app.db", "bolt", false, nil},
+		{"genji://?engine=memory", "", "memory", false, nil},
+		{"genji://app?engine=badger", "app", "badger", false, nil},
+		{"genji://app?readonly=true&timeout=5s", "app", "bolt", false, func(t *testing.T, cfg *config) {
+			require.True(t, cfg.engineOpt.ReadOnly)
+			require.True(t, cfg.dbOpt.ReadOnly)
+			require.Equal(t, 5*time.Second, cfg.engineOpt.Timeout)
+		}},
+		{"genji://app?codec=custom", "app", "bolt", false, func(t *testing.T, cfg *config) {
+			require.IsType(t, custom.NewCodec(), cfg.codec)
+		}},
+		{"genji://app?workmem=1024&tempdir=/tmp&parallel=4", "app", "bolt", false, func(t *testing.T, cfg *config) {
+			require.EqualValues(t, 1024, cfg.dbOpt.WorkMemoryLimit)
+			require.Equal(t, "/tmp", cfg.dbOpt.TempDir)
+			require.Equal(t, 4, cfg.dbOpt.ParallelWorkers)
+		}},
+		{"genji://app?maxmem=2048&maxscan=100&stmttimeout=2s", "app", "bolt", false, func(t *testing.T, cfg *config) {
+			require.EqualValues(t, 2048, cfg.dbOpt.Limits.MaxMemory)
+			require.EqualValues(t, 100, cfg.dbOpt.Limits.MaxScannedDocuments)
+			require.Equal(t, 2*time.Second, cfg.dbOpt.Limits.Timeout)
+		}},
+		{"genji://", "", "", true, nil},
+		{"genji://app?foo=bar", "", "", true, nil},
+		{"genji://app?codec=json", "", "", true, nil},
+		{"genji://app?readonly=maybe", "", "", true, nil},
+		{"genji://app?timeout=5", "", "", true, nil},
+		{"genji://app?stmttimeout=5", "", "", true, nil},
+		{"genji://app?engine=bolt&engine=memory", "", "", true, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dsn, func(t *testing.T) {
+			cfg, err := parseDSN(test.dsn)
+			if test.fails {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.path, cfg.path)
+			require.Equal(t, test.engine, cfg.engine)
+			if test.checkFn != nil {
+				test.checkFn(t, cfg)
+			}
+		})
+	}
+}
+
+func TestOpenDSN(t *testing.T) {
+	t.Run("ReadOnly", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "genji")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "test.db")
+
+		db, err := sql.Open("genji", "genji://"+path)
+		require.NoError(t, err)
+		_, err = db.Exec("CREATE TABLE test; INSERT INTO test (a) VALUES (1)")
+		require.NoError(t, err)
+		require.NoError(t, db.Close())
+
+		db, err = sql.Open("genji", "genji://"+path+"?readonly=true&timeout=1s")
+		require.NoError(t, err)
+		defer db.Close()
+
+		var a int
+		err = db.QueryRow("SELECT a FROM test").Scan(&a)
+		require.NoError(t, err)
+		require.Equal(t, 1, a)
+
+		_, err = db.Exec("INSERT INTO test (a) VALUES (2)")
+		require.Error(t, err)
+	})
+
+	t.Run("Registered engine", func(t *testing.T) {
+		var opened string
+		engine.Register("test", func(path string, opts engine.OpenOptions) (engine.Engine, error) {
+			opened = path
+			return memoryengine.NewEngine(), nil
+		})
+
+		db, err := sql.Open("genji", "genji://app?engine=test")
+		require.NoError(t, err)
+		defer db.Close()
+
+		_, err = db.Exec("CREATE TABLE test")
+		require.NoError(t, err)
+		require.Equal(t, "app", opened)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		for _, dsn := range []string{
+			"genji://:memory:?readonly=true",
+			"genji://:memory:?engine=unknown",
+		} {
+			_, err := sql.Open("genji", dsn)
+			require.Error(t, err)
+		}
+	})
+}
@@ -337,5 +337,20 @@ func (p *Parser) parseCreateIndexStatement(unique bool) (query.CreateIndexStmt,
 
 	stmt.Path = paths[0]
 
+	// Parse optional "INCLUDE (path, ...)"
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.INCLUDE {
+		p.Unscan()
+		return stmt, nil
+	}
+
+	stmt.IncludedPaths, err = p.parsePathList()
+	if err != nil {
+		return stmt, err
+	}
+	if len(stmt.IncludedPaths) == 0 {
+		tok, pos, lit := p.ScanIgnoreWhitespace()
+		return stmt, newParseError(scanner.Tokstr(tok, lit), []string{"("}, pos)
+	}
+
 	return stmt, nil
 }
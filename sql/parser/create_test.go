@@ -191,6 +191,16 @@ func TestParserCreateTable(t *testing.T) {
 					},
 				},
 			}, false},
+		{"With timestamp type",
+			"CREATE TABLE test(ts timestamp)",
+			query.CreateTableStmt{
+				TableName: "test",
+				Info: database.TableInfo{
+					FieldConstraints: []*database.FieldConstraint{
+						{Path: document.Path(parsePath(t, "ts")), Type: document.TimestampValue},
+					},
+				},
+			}, false},
 		{"With integer aliases types",
 			"CREATE TABLE test(i int, ii int2, ei int8, m mediumint, s smallint, b bigint, t tinyint)",
 			query.CreateTableStmt{
@@ -271,6 +281,8 @@ func TestParserCreateIndex(t *testing.T) {
 		{"No name with IF NOT EXISTS", "CREATE UNIQUE INDEX IF NOT EXISTS ON test (foo[3].baz)", nil, true},
 		{"No fields", "CREATE INDEX idx ON test", nil, true},
 		{"More than 1 path", "CREATE INDEX idx ON test (foo, bar)", nil, true},
+		{"Include", "CREATE INDEX idx ON test (foo) INCLUDE (bar, baz)", query.CreateIndexStmt{IndexName: "idx", TableName: "test", Path: document.Path(parsePath(t, "foo")), IncludedPaths: []document.Path{document.Path(parsePath(t, "bar")), document.Path(parsePath(t, "baz"))}}, false},
+		{"Include without paths", "CREATE INDEX idx ON test (foo) INCLUDE", nil, true},
 	}
 
 	for _, test := range tests {
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"strings"
+
 	"github.com/genjidb/genji/planner"
 	"github.com/genjidb/genji/query"
 	"github.com/genjidb/genji/sql/scanner"
@@ -9,9 +11,27 @@ import (
 // parseExplainStatement parses any statement and returns an ExplainStmt object.
 // This function assumes the EXPLAIN token has already been consumed.
 func (p *Parser) parseExplainStatement() (query.Statement, error) {
-	// ensure we don't have multiple EXPLAIN keywords
+	// parse optional ANALYZE keyword
+	analyze, err := p.parseOptional(scanner.ANALYZE)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := planner.ExplainStmt{Analyze: analyze}
+
+	// parse optional list of options
+	if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.LPAREN {
+		err = p.parseExplainOptions(&stmt)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		p.Unscan()
+	}
+
+	// ensure we don't have multiple EXPLAIN or ANALYZE keywords
 	tok, pos, lit := p.ScanIgnoreWhitespace()
-	if tok == scanner.EXPLAIN {
+	if tok == scanner.EXPLAIN || tok == scanner.ANALYZE {
 		return nil, newParseError(scanner.Tokstr(tok, lit), []string{"SELECT", "UPDATE", "DELETE"}, pos)
 	}
 	p.Unscan()
@@ -21,5 +41,40 @@ func (p *Parser) parseExplainStatement() (query.Statement, error) {
 		return nil, err
 	}
 
-	return &planner.ExplainStmt{Statement: innerStmt}, nil
+	stmt.Statement = innerStmt
+	return &stmt, nil
+}
+
+// parseExplainOptions parses a list of comma separated options, ANALYZE or FORMAT { TEXT | JSON },
+// followed by a closing parenthesis, and sets them on stmt.
+// This function assumes the opening parenthesis has already been consumed.
+func (p *Parser) parseExplainOptions(stmt *planner.ExplainStmt) error {
+	for {
+		tok, pos, lit := p.ScanIgnoreWhitespace()
+		switch {
+		case tok == scanner.ANALYZE:
+			stmt.Analyze = true
+		case tok == scanner.IDENT && strings.EqualFold(lit, "FORMAT"):
+			tok, pos, lit = p.ScanIgnoreWhitespace()
+			switch {
+			case tok == scanner.TYPETEXT:
+				stmt.Format = planner.ExplainFormatText
+			case tok == scanner.IDENT && strings.EqualFold(lit, "JSON"):
+				stmt.Format = planner.ExplainFormatJSON
+			default:
+				return newParseError(scanner.Tokstr(tok, lit), []string{"TEXT", "JSON"}, pos)
+			}
+		default:
+			return newParseError(scanner.Tokstr(tok, lit), []string{"ANALYZE", "FORMAT"}, pos)
+		}
+
+		tok, pos, lit = p.ScanIgnoreWhitespace()
+		switch tok {
+		case scanner.COMMA:
+		case scanner.RPAREN:
+			return nil
+		default:
+			return newParseError(scanner.Tokstr(tok, lit), []string{",", ")"}, pos)
+		}
+	}
 }
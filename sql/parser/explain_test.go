@@ -17,6 +17,15 @@ func TestParserExplain(t *testing.T) {
 	}{
 		{"Explain create table", "EXPLAIN CREATE TABLE test", &planner.ExplainStmt{Statement: query.CreateTableStmt{TableName: "test"}}, false},
 		{"Multiple Explains", "EXPLAIN EXPLAIN CREATE TABLE test", nil, true},
+		{"Explain analyze", "EXPLAIN ANALYZE CREATE TABLE test", &planner.ExplainStmt{Statement: query.CreateTableStmt{TableName: "test"}, Analyze: true}, false},
+		{"Multiple Analyzes", "EXPLAIN ANALYZE ANALYZE test", nil, true},
+		{"Explain format json", "EXPLAIN (FORMAT JSON) CREATE TABLE test", &planner.ExplainStmt{Statement: query.CreateTableStmt{TableName: "test"}, Format: planner.ExplainFormatJSON}, false},
+		{"Explain format text", "EXPLAIN (format text) CREATE TABLE test", &planner.ExplainStmt{Statement: query.CreateTableStmt{TableName: "test"}, Format: planner.ExplainFormatText}, false},
+		{"Explain options", "EXPLAIN (ANALYZE, FORMAT JSON) CREATE TABLE test", &planner.ExplainStmt{Statement: query.CreateTableStmt{TableName: "test"}, Analyze: true, Format: planner.ExplainFormatJSON}, false},
+		{"Explain analyze format json", "EXPLAIN ANALYZE (FORMAT JSON) CREATE TABLE test", &planner.ExplainStmt{Statement: query.CreateTableStmt{TableName: "test"}, Analyze: true, Format: planner.ExplainFormatJSON}, false},
+		{"Unknown format", "EXPLAIN (FORMAT XML) CREATE TABLE test", nil, true},
+		{"Unknown option", "EXPLAIN (VERBOSE) CREATE TABLE test", nil, true},
+		{"Unclosed options", "EXPLAIN (FORMAT JSON CREATE TABLE test", nil, true},
 	}
 
 	for _, test := range tests {
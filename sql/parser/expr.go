@@ -326,6 +326,8 @@ func (p *Parser) parseType() (document.ValueType, error) {
 		return document.IntegerValue, nil
 	case scanner.TYPETEXT:
 		return document.TextValue, nil
+	case scanner.TYPETIMESTAMP:
+		return document.TimestampValue, nil
 	case scanner.TYPEVARCHAR, scanner.TYPECHARACTER:
 		if tok, pos, lit := p.ScanIgnoreWhitespace(); tok != scanner.LPAREN {
 			return 0, newParseError(scanner.Tokstr(tok, lit), []string{"("}, pos)
@@ -550,6 +552,18 @@ func (p *Parser) parseFunction() (expr.Expr, error) {
 
 		exprs = append(exprs, e)
 
+		// Special case: support the EXTRACT(part FROM expr) syntax,
+		// where part is an identifier or a string.
+		if len(exprs) == 1 && strings.EqualFold(fname, "extract") {
+			if tok, _, _ := p.ScanIgnoreWhitespace(); tok == scanner.FROM {
+				if pt, ok := e.(expr.Path); ok && len(pt) == 1 && pt[0].FieldName != "" {
+					exprs[0] = expr.TextValue(pt[0].FieldName)
+				}
+				continue
+			}
+			p.Unscan()
+		}
+
 		if tok, _, _ := p.ScanIgnoreWhitespace(); tok != scanner.COMMA {
 			p.Unscan()
 			break
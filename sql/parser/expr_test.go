@@ -154,6 +154,12 @@ func TestParserExpr(t *testing.T) {
 		{"count(expr) function", "count(a)", &expr.CountFunc{Expr: parsePath(t, "a")}, false},
 		{"count(*) function", "count(*)", &expr.CountFunc{Wildcard: true}, false},
 		{"CAST", "CAST(a.b[1][0] AS TEXT)", expr.CastFunc{Expr: parsePath(t, "a.b[1][0]"), CastAs: document.TextValue}, false},
+		{"now() function", "now()", &expr.NowFunc{}, false},
+		{"extract(part FROM expr)", "EXTRACT(year FROM a.b)", &expr.ExtractFunc{Part: expr.TextValue("year"), Expr: parsePath(t, "a.b")}, false},
+		{"extract('part' FROM expr)", "extract('year' FROM a)", &expr.ExtractFunc{Part: expr.TextValue("year"), Expr: parsePath(t, "a")}, false},
+		{"extract(part, expr)", "extract('year', a)", &expr.ExtractFunc{Part: expr.TextValue("year"), Expr: parsePath(t, "a")}, false},
+		{"extract with missing FROM", "extract(year a)", nil, true},
+		{"date_trunc", "date_trunc('day', a)", &expr.DateTruncFunc{Unit: expr.TextValue("day"), Expr: parsePath(t, "a")}, false},
 	}
 
 	for _, test := range tests {
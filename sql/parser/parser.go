@@ -5,8 +5,10 @@ import (
 	"io"
 	"strings"
 
+	"github.com/genjidb/genji/database"
 	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/expr"
+	"github.com/genjidb/genji/planner"
 	"github.com/genjidb/genji/query"
 	"github.com/genjidb/genji/sql/scanner"
 	"github.com/genjidb/genji/stringutil"
@@ -40,6 +42,48 @@ func ParseQuery(s string) (query.Query, error) {
 	return NewParser(strings.NewReader(s)).ParseQuery()
 }
 
+// PrepareQuery parses and prepares a query string.
+// Queries that only read or modify documents are kept in the plan cache
+// of the database, so that running the same query again doesn't require
+// parsing and optimizing it again.
+func PrepareQuery(db *database.Database, s string) (query.Query, error) {
+	if q, ok := db.PlanCache().Get(s); ok {
+		return q.(query.Query), nil
+	}
+
+	q, err := ParseQuery(s)
+	if err != nil {
+		return q, err
+	}
+
+	err = q.Prepare()
+	if err != nil {
+		return q, err
+	}
+
+	if isCacheable(q) {
+		db.PlanCache().Put(s, q)
+	}
+
+	return q, nil
+}
+
+// isCacheable reports whether all the statements of the query
+// can be shared by concurrent executions.
+func isCacheable(q query.Query) bool {
+	if len(q.Statements) == 0 {
+		return false
+	}
+
+	for _, stmt := range q.Statements {
+		if _, ok := stmt.(*planner.Statement); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
 // ParsePath parses a path to a value in a document.
 func ParsePath(s string) (document.Path, error) {
 	return NewParser(strings.NewReader(s)).parsePath()
@@ -92,6 +136,8 @@ func (p *Parser) ParseStatement() (query.Statement, error) {
 	switch tok {
 	case scanner.ALTER:
 		return p.parseAlterStatement()
+	case scanner.ANALYZE:
+		return p.parseAnalyzeStatement()
 	case scanner.BEGIN:
 		return p.parseBeginStatement()
 	case scanner.COMMIT:
@@ -114,10 +160,14 @@ func (p *Parser) ParseStatement() (query.Statement, error) {
 		return p.parseReIndexStatement()
 	case scanner.ROLLBACK:
 		return p.parseRollbackStatement()
+	case scanner.SAVEPOINT:
+		return p.parseSavepointStatement()
+	case scanner.RELEASE:
+		return p.parseReleaseStatement()
 	}
 
 	return nil, newParseError(scanner.Tokstr(tok, lit), []string{
-		"ALTER", "BEGIN", "COMMIT", "SELECT", "DELETE", "UPDATE", "INSERT", "CREATE", "DROP", "EXPLAIN", "REINDEX", "ROLLBACK",
+		"ALTER", "ANALYZE", "BEGIN", "COMMIT", "SELECT", "DELETE", "UPDATE", "INSERT", "CREATE", "DROP", "EXPLAIN", "REINDEX", "ROLLBACK", "SAVEPOINT", "RELEASE",
 	}, pos)
 }
 
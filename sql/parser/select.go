@@ -3,6 +3,7 @@ package parser
 import (
 	"errors"
 
+	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/expr"
 	"github.com/genjidb/genji/planner"
 	"github.com/genjidb/genji/sql/scanner"
@@ -214,6 +215,11 @@ func (cfg selectConfig) ToStream() (*planner.Statement, error) {
 
 			// check if this is the same expression as the one used in the GROUP BY clause
 			if expr.Equal(e, cfg.GroupByExpr) {
+				// aggregated documents store the group under the name of the GROUP BY expression:
+				// read it from there since the expression can't be evaluated again.
+				if _, ok := e.(expr.Path); !ok {
+					ne.Expr = expr.Path{document.PathFragment{FieldName: stringutil.Sprintf("%s", cfg.GroupByExpr)}}
+				}
 				continue
 			}
 
@@ -23,6 +23,14 @@ func TestParserTransactions(t *testing.T) {
 		{"ROLLBACK TRANSACTION", query.RollbackStmt{}, false},
 		{"COMMIT", query.CommitStmt{}, false},
 		{"COMMIT TRANSACTION", query.CommitStmt{}, false},
+		{"SAVEPOINT a", query.SavepointStmt{Name: "a"}, false},
+		{"SAVEPOINT", nil, true},
+		{"RELEASE SAVEPOINT a", query.ReleaseSavepointStmt{Name: "a"}, false},
+		{"RELEASE a", query.ReleaseSavepointStmt{Name: "a"}, false},
+		{"RELEASE", nil, true},
+		{"ROLLBACK TO SAVEPOINT a", query.RollbackToSavepointStmt{Name: "a"}, false},
+		{"ROLLBACK TRANSACTION TO a", query.RollbackToSavepointStmt{Name: "a"}, false},
+		{"ROLLBACK TO", nil, true},
 	}
 
 	for _, test := range tests {
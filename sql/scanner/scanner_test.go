@@ -144,8 +144,10 @@ func TestScanner_Scan(t *testing.T) {
 		{s: `PRIMARY`, tok: scanner.PRIMARY, raw: `PRIMARY`},
 		{s: `READ`, tok: scanner.READ, raw: `READ`},
 		{s: `REINDEX`, tok: scanner.REINDEX, raw: `REINDEX`},
+		{s: `RELEASE`, tok: scanner.RELEASE, raw: `RELEASE`},
 		{s: `RENAME`, tok: scanner.RENAME, raw: `RENAME`},
 		{s: `ROLLBACK`, tok: scanner.ROLLBACK, raw: `ROLLBACK`},
+		{s: `SAVEPOINT`, tok: scanner.SAVEPOINT, raw: `SAVEPOINT`},
 		{s: `SELECT`, tok: scanner.SELECT, raw: `SELECT`},
 		{s: `SET`, tok: scanner.SET, raw: `SET`},
 		{s: `TABLE`, tok: scanner.TABLE, raw: `TABLE`},
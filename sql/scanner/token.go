@@ -74,6 +74,7 @@ const (
 	// ALL and the following are Genji SQL Keywords
 	ADD_KEYWORD
 	ALTER
+	ANALYZE
 	AS
 	ASC
 	BEGIN
@@ -92,6 +93,7 @@ const (
 	FROM
 	GROUP
 	IF
+	INCLUDE
 	INDEX
 	INSERT
 	INTO
@@ -106,8 +108,10 @@ const (
 	PRIMARY
 	READ
 	REINDEX
+	RELEASE
 	RENAME
 	ROLLBACK
+	SAVEPOINT
 	SELECT
 	SET
 	TABLE
@@ -136,6 +140,7 @@ const (
 	TYPEMEDIUMINT
 	TYPESMALLINT
 	TYPETEXT
+	TYPETIMESTAMP
 	TYPETINYINT
 	TYPEREAL
 	TYPEVARCHAR
@@ -197,6 +202,7 @@ var tokens = [...]string{
 
 	ADD_KEYWORD: "ADD",
 	ALTER:       "ALTER",
+	ANALYZE:     "ANALYZE",
 	AS:          "AS",
 	ASC:         "ASC",
 	BEGIN:       "BEGIN",
@@ -216,6 +222,7 @@ var tokens = [...]string{
 	FIELD:       "FIELD",
 	FROM:        "FROM",
 	IF:          "IF",
+	INCLUDE:     "INCLUDE",
 	INDEX:       "INDEX",
 	INSERT:      "INSERT",
 	INTO:        "INTO",
@@ -229,8 +236,10 @@ var tokens = [...]string{
 	PRIMARY:     "PRIMARY",
 	READ:        "READ",
 	REINDEX:     "REINDEX",
+	RELEASE:     "RELEASE",
 	RENAME:      "RENAME",
 	ROLLBACK:    "ROLLBACK",
+	SAVEPOINT:   "SAVEPOINT",
 	SELECT:      "SELECT",
 	SET:         "SET",
 	TABLE:       "TABLE",
@@ -258,6 +267,7 @@ var tokens = [...]string{
 	TYPEMEDIUMINT: "MEDIUMINT",
 	TYPESMALLINT:  "SMALLINT",
 	TYPETEXT:      "TEXT",
+	TYPETIMESTAMP: "TIMESTAMP",
 	TYPETINYINT:   "TINYINT",
 	TYPEREAL:      "REAL",
 	TYPEVARCHAR:   "VARCHAR",
@@ -28,33 +28,88 @@ func HashAggregate(builders ...expr.AggregatorBuilder) *HashAggregateOperator {
 	return &HashAggregateOperator{Builders: builders}
 }
 
+// groupAggregatorSize is an estimation of the memory used by each aggregator of a group,
+// in bytes. It is used to determine when groups must be spilled to disk.
+const groupAggregatorSize = 64
+
+// Iterate implements the Operator interface.
+// If the memory used by the groups reaches the work memory limit of the database,
+// documents that belong to new groups are written to temporary partitions
+// which are aggregated once the incoming stream is consumed.
+// In that case, groups are still returned in the order they arrived within
+// each partition, but groups of a partition are returned after the groups kept in memory.
 func (op *HashAggregateOperator) Iterate(in *expr.Environment, f func(out *expr.Environment) error) error {
 	encGroup, err := newGroupEncoder()
 	if err != nil {
 		return err
 	}
 
+	limit, dir := workMemoryLimit(in)
+
+	return op.aggregate(in, limit, dir, 0, func(fn func(groupName string, env *expr.Environment) error) error {
+		return op.Prev.Iterate(in, func(out *expr.Environment) error {
+			// we extract the group name from the environment and encode it
+			// to be used as a key to the aggregators map.
+			groupName, err := encGroup(out)
+			if err != nil {
+				return err
+			}
+
+			return fn(groupName, out)
+		})
+	}, f)
+}
+
+func (op *HashAggregateOperator) aggregate(in *expr.Environment, limit int64, dir string, level int, source func(fn func(groupName string, env *expr.Environment) error) error, f func(out *expr.Environment) error) error {
 	// keep order of groups as they arrive to provide deterministic results.
 	var encGroupNames []string
 
 	// store a groupAggregator per group
 	aggregators := make(map[string]*groupAggregator)
+	var size int64
+
+	var partitions *spillPartitions
+	defer func() {
+		partitions.Close()
+	}()
+
+	mem := newMemoryTracker(in)
+	defer mem.release()
 
 	// iterate over s and for each group, aggregate the incoming document
-	err = op.Prev.Iterate(in, func(out *expr.Environment) error {
-		// we extract the group name from the environment and encode it
-		// to be used as a key to the aggregators map.
-		groupName, err := encGroup(out)
-		if err != nil {
+	c := newCanceler(in)
+	err := source(func(groupName string, out *expr.Environment) error {
+		if err := c.check(); err != nil {
 			return err
 		}
 
 		// get the group aggregator from the map or create a new one.
 		a, ok := aggregators[groupName]
 		if !ok {
+			// if there is no room left for a new group,
+			// the document is aggregated later, with the other documents of its partition.
+			if limit > 0 && size >= limit && level < maxSpillLevel {
+				if partitions == nil {
+					partitions = newSpillPartitions(dir, level)
+				}
+
+				data, err := encodeEnvironment(nil, out, in)
+				if err != nil {
+					return err
+				}
+
+				return partitions.Add([]byte(groupName), data)
+			}
+
 			a = newGroupAggregator(out, op.Builders)
 			aggregators[groupName] = a
 			encGroupNames = append(encGroupNames, groupName)
+			groupSize := int64(len(groupName) + len(op.Builders)*groupAggregatorSize)
+			size += groupSize
+			err := mem.grow(groupSize)
+			if err != nil {
+				return err
+			}
 		}
 
 		// call the aggregator for that group and aggregate the document.
@@ -70,7 +125,7 @@ func (op *HashAggregateOperator) Iterate(in *expr.Environment, f func(out *expr.
 	// Ex: For `SELECT COUNT(*) FROM foo`, if `foo` is empty
 	// we want the following result:
 	// {"COUNT(*)": 0}
-	if len(aggregators) == 0 {
+	if len(aggregators) == 0 && level == 0 {
 		aggregators["_"] = newGroupAggregator(nil, op.Builders)
 		encGroupNames = append(encGroupNames, "_")
 	}
@@ -88,7 +143,22 @@ func (op *HashAggregateOperator) Iterate(in *expr.Environment, f func(out *expr.
 		}
 	}
 
-	return nil
+	if partitions == nil {
+		return nil
+	}
+
+	return partitions.Iterate(func(p *spillFile) error {
+		return op.aggregate(in, limit, dir, level+1, func(fn func(groupName string, env *expr.Environment) error) error {
+			return p.Iterate(func(key, data []byte) error {
+				env, err := decodeEnvironment(data, in)
+				if err != nil {
+					return err
+				}
+
+				return fn(string(key), env)
+			})
+		}, f)
+	})
 }
 
 func (op *HashAggregateOperator) String() string {
@@ -206,3 +276,114 @@ func (g *groupAggregator) Flush(env *expr.Environment) (*expr.Environment, error
 	newEnv.SetDocument(fb)
 	return &newEnv, nil
 }
+
+// Mergeable reports whether the aggregators of op support merging
+// partial results, which is required to aggregate documents in parallel.
+func (op *HashAggregateOperator) Mergeable() bool {
+	for _, b := range op.Builders {
+		if _, ok := b.Aggregator().(expr.MergeableAggregator); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// A partialAggregation aggregates a subset of the documents of a stream, in memory.
+// Partial aggregations of distinct subsets are merged to obtain the final groups.
+type partialAggregation struct {
+	builders []expr.AggregatorBuilder
+	encGroup func(env *expr.Environment) (string, error)
+	mem      *memoryTracker
+
+	// keep order of groups as they arrive to provide deterministic results.
+	groupNames  []string
+	aggregators map[string]*groupAggregator
+}
+
+func (op *HashAggregateOperator) newPartialAggregation(in *expr.Environment) (*partialAggregation, error) {
+	encGroup, err := newGroupEncoder()
+	if err != nil {
+		return nil, err
+	}
+
+	return &partialAggregation{
+		builders:    op.Builders,
+		encGroup:    encGroup,
+		mem:         newMemoryTracker(in),
+		aggregators: make(map[string]*groupAggregator),
+	}, nil
+}
+
+// Aggregate the document of the environment into its group.
+func (p *partialAggregation) Aggregate(env *expr.Environment) error {
+	groupName, err := p.encGroup(env)
+	if err != nil {
+		return err
+	}
+
+	a, ok := p.aggregators[groupName]
+	if !ok {
+		a = newGroupAggregator(env, p.builders)
+		p.aggregators[groupName] = a
+		p.groupNames = append(p.groupNames, groupName)
+		err = p.mem.grow(int64(len(groupName) + len(p.builders)*groupAggregatorSize))
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.Aggregate(env)
+}
+
+// release gives back the memory held by the groups aggregated by p.
+// The groups merged into another partial aggregation remain accounted
+// for until p is released.
+func (p *partialAggregation) release() {
+	p.mem.release()
+}
+
+// Merge the groups of other into p.
+func (p *partialAggregation) Merge(other *partialAggregation) error {
+	for _, groupName := range other.groupNames {
+		o := other.aggregators[groupName]
+
+		a, ok := p.aggregators[groupName]
+		if !ok {
+			p.aggregators[groupName] = o
+			p.groupNames = append(p.groupNames, groupName)
+			continue
+		}
+
+		for i, agg := range a.aggregators {
+			err := agg.(expr.MergeableAggregator).Merge(o.aggregators[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Flush outputs one environment per group.
+func (p *partialAggregation) Flush(in *expr.Environment, f func(out *expr.Environment) error) error {
+	// see HashAggregateOperator.aggregate
+	if len(p.aggregators) == 0 {
+		p.aggregators["_"] = newGroupAggregator(nil, p.builders)
+		p.groupNames = append(p.groupNames, "_")
+	}
+
+	for _, groupName := range p.groupNames {
+		e, err := p.aggregators[groupName].Flush(in)
+		if err != nil {
+			return err
+		}
+		err = f(e)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
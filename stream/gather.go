@@ -0,0 +1,367 @@
+package stream
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/document"
+	"github.com/genjidb/genji/expr"
+	"github.com/genjidb/genji/stringutil"
+)
+
+// gatherBatchSize is the number of documents read from the table
+// by a worker at once.
+const gatherBatchSize = 128
+
+// errGatherStopped is used internally to interrupt the goroutines
+// of a GatherOperator.
+var errGatherStopped = errors.New("gather stopped")
+
+// A GatherOperator runs the operators that precede it in parallel.
+// The first operator of the stream must be a SeqScanOperator: the keys of the table
+// are split into one range per worker, using the statistics computed by ANALYZE,
+// and each worker reads its own range and runs its own copy of the operators located
+// between the scan and the gather operator.
+// Tables that were never analyzed or that are too small, as well as
+// read-write transactions, are read sequentially.
+// The environments produced by the workers are sent to the next operator in no particular order.
+// If the operator preceding the gather operator is a HashAggregateOperator, each worker
+// aggregates its documents in memory and the partial groups are merged once all the documents
+// are read.
+// When the stream is instrumented by EXPLAIN ANALYZE, the statistics of the copies run
+// by the workers are added to the statistics of the original operators, and the documents
+// decoded by the workers are reported by the gather operator.
+type GatherOperator struct {
+	baseOperator
+	Workers int
+}
+
+// Gather creates an operator that runs the operators that precede it
+// using the given number of workers.
+func Gather(workers int) *GatherOperator {
+	return &GatherOperator{Workers: workers}
+}
+
+// Iterate implements the Operator interface.
+// If the stream can't be run in parallel, the previous operators are run sequentially.
+func (op *GatherOperator) Iterate(in *expr.Environment, fn func(out *expr.Environment) error) error {
+	if op.Prev == nil {
+		return nil
+	}
+
+	// list the operators run by the workers, in order, along with
+	// their statistics if the stream is instrumented
+	var ops []Operator
+	var stats []*OperatorStatistics
+	for o := op.Prev; o != nil; o = o.GetPrev() {
+		var st *OperatorStatistics
+		if iop, ok := o.(*instrumentedOperator); ok {
+			o = iop.Op
+			st = &iop.stats
+		}
+		ops = append([]Operator{o}, ops...)
+		stats = append([]*OperatorStatistics{st}, stats...)
+	}
+
+	// the changes of read-write transactions can't be read concurrently
+	tx := in.GetTx()
+	scan, ok := ops[0].(*SeqScanOperator)
+	if !ok || scan.Reverse || op.Workers < 2 || tx.Writable() {
+		return op.Prev.Iterate(in, fn)
+	}
+
+	keys, err := op.splitKeys(tx, scan.TableName)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return op.Prev.Iterate(in, fn)
+	}
+	instrumented := stats[0] != nil
+
+	var agg *HashAggregateOperator
+	var aggStats *OperatorStatistics
+	if len(ops) > 1 {
+		if a, ok := ops[len(ops)-1].(*HashAggregateOperator); ok && a.Mergeable() {
+			agg = a
+			aggStats = stats[len(stats)-1]
+			ops = ops[:len(ops)-1]
+			stats = stats[:len(stats)-1]
+		}
+	}
+
+	table, err := tx.GetTable(scan.TableName)
+	if err != nil {
+		return err
+	}
+
+	g := gatherState{
+		done:    make(chan struct{}),
+		results: make(chan *expr.Environment, gatherBatchSize),
+	}
+
+	// the iterators must be created by the same goroutine,
+	// before starting the workers.
+	workers := make([]*gatherWorker, len(keys)+1)
+	for i := range workers {
+		var from, to []byte
+		if i > 0 {
+			from = keys[i-1]
+		}
+		if i < len(keys) {
+			to = keys[i]
+		}
+
+		it := table.NewBatchIterator(from, to)
+		defer it.Close()
+
+		w := gatherWorker{
+			stream: New(&rangeScanOperator{it: it, done: g.done}),
+		}
+		for _, o := range ops[1:] {
+			w.stream = w.stream.Pipe(cloneOperator(o))
+		}
+		if instrumented {
+			w.stream, w.stats = instrument(w.stream, false)
+		}
+		if agg != nil {
+			w.partial, err = agg.newPartialAggregation(in)
+			if err != nil {
+				return err
+			}
+			defer w.partial.release()
+		}
+		workers[i] = &w
+	}
+
+	var wg sync.WaitGroup
+	for _, w := range workers {
+		w := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			g.stop(w.run(in, &g, aggStats != nil))
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(g.results)
+	}()
+
+	for out := range g.results {
+		err := fn(out)
+		if err != nil {
+			g.stop(err)
+			break
+		}
+	}
+
+	// wait for all the goroutines to return
+	for range g.results {
+	}
+
+	if instrumented {
+		for _, w := range workers {
+			for i, st := range w.stats {
+				stats[i].add(st)
+			}
+			if aggStats != nil {
+				aggStats.Duration += w.aggDuration
+			}
+		}
+		if aggStats != nil {
+			aggStats.RowsIn = stats[len(stats)-1].RowsOut
+		}
+	}
+
+	if g.err != nil {
+		return g.err
+	}
+
+	if agg == nil {
+		return nil
+	}
+
+	partial := workers[0].partial
+	for _, w := range workers[1:] {
+		err = partial.Merge(w.partial)
+		if err != nil {
+			return err
+		}
+	}
+
+	if aggStats == nil {
+		return partial.Flush(in, fn)
+	}
+
+	return partial.Flush(in, func(out *expr.Environment) error {
+		aggStats.RowsOut++
+		return fn(out)
+	})
+}
+
+// splitKeys returns the keys dividing the table into one range per worker,
+// taken from the statistics of the table.
+// It returns no keys if the table was never analyzed or if it is too small
+// for every worker to read at least one batch.
+func (op *GatherOperator) splitKeys(tx *database.Transaction, tableName string) ([][]byte, error) {
+	stats, err := tx.GetTableStatistics(tableName)
+	if errors.Is(err, database.ErrStatisticsNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	workers := op.Workers
+	if n := int(stats.RowCount / gatherBatchSize); n < workers {
+		workers = n
+	}
+	if workers < 2 {
+		return nil, nil
+	}
+
+	return stats.SplitKeys(workers), nil
+}
+
+func (op *GatherOperator) String() string {
+	return stringutil.Sprintf("gather(%d)", op.Workers)
+}
+
+// gatherState is shared by the goroutines of a GatherOperator.
+type gatherState struct {
+	done    chan struct{}
+	results chan *expr.Environment
+
+	once sync.Once
+	mu   sync.Mutex
+	err  error
+}
+
+// stop interrupts every goroutine. The first error other than
+// errGatherStopped is returned by the gather operator.
+func (g *gatherState) stop(err error) {
+	if err == nil {
+		return
+	}
+
+	if err != errGatherStopped {
+		g.mu.Lock()
+		if g.err == nil {
+			g.err = err
+		}
+		g.mu.Unlock()
+	}
+
+	g.once.Do(func() {
+		close(g.done)
+	})
+}
+
+// send a copy of the document of the environment to the gather operator.
+// Environments are reused by the operators, which is why the document
+// must be copied before being sent to another goroutine.
+func (g *gatherState) send(env *expr.Environment, outer *expr.Environment) error {
+	var out expr.Environment
+	out.Outer = outer
+
+	if d, ok := env.GetDocument(); ok {
+		var fb document.FieldBuffer
+		err := fb.Copy(d)
+		if err != nil {
+			return err
+		}
+		out.SetDocument(&fb)
+	}
+
+	select {
+	case g.results <- &out:
+		return nil
+	case <-g.done:
+		return errGatherStopped
+	}
+}
+
+// gatherWorker runs a copy of the operators of a GatherOperator
+// on a range of keys of the table.
+type gatherWorker struct {
+	stream  *Stream
+	partial *partialAggregation
+
+	// statistics of the operators, if instrumented
+	stats       []*OperatorStatistics
+	aggDuration time.Duration
+}
+
+// run the stream and send its environments to the gather operator,
+// or aggregate them if the worker runs a partial aggregation.
+func (w *gatherWorker) run(in *expr.Environment, g *gatherState, timeAggregation bool) error {
+	return w.stream.Op.Iterate(in, func(out *expr.Environment) error {
+		if w.partial == nil {
+			return g.send(out, in)
+		}
+
+		if !timeAggregation {
+			return w.partial.Aggregate(out)
+		}
+
+		start := time.Now()
+		err := w.partial.Aggregate(out)
+		w.aggDuration += time.Since(start)
+		return err
+	})
+}
+
+// rangeScanOperator iterates over the documents of a range of keys of a table.
+type rangeScanOperator struct {
+	baseOperator
+	it   *database.BatchIterator
+	done <-chan struct{}
+}
+
+func (op *rangeScanOperator) Iterate(in *expr.Environment, fn func(out *expr.Environment) error) error {
+	var newEnv expr.Environment
+	newEnv.Outer = in
+
+	c := newCanceler(in)
+	budget := in.GetBudget()
+
+	for {
+		select {
+		case <-op.done:
+			return errGatherStopped
+		default:
+		}
+
+		docs, err := op.it.Next(gatherBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return nil
+		}
+
+		for _, d := range docs {
+			if err := c.check(); err != nil {
+				return err
+			}
+			if err := budget.Scan(); err != nil {
+				return err
+			}
+
+			newEnv.SetDocument(d)
+			err := fn(&newEnv)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (op *rangeScanOperator) String() string {
+	return "rangeScan()"
+}
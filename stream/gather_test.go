@@ -0,0 +1,160 @@
+package stream_test
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/genjidb/genji"
+	"github.com/genjidb/genji/document"
+	"github.com/genjidb/genji/expr"
+	"github.com/genjidb/genji/sql/parser"
+	"github.com/genjidb/genji/stream"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGather(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec("CREATE TABLE test (a INTEGER, b INTEGER)")
+	require.NoError(t, err)
+
+	// enough documents to fill multiple batches
+	for i := 0; i < 1000; i++ {
+		err = db.Exec("INSERT INTO test (a, b) VALUES (?, ?)", i, i%3)
+		require.NoError(t, err)
+	}
+
+	// the table is split using its statistics
+	err = db.Exec("ANALYZE test")
+	require.NoError(t, err)
+
+	tx, err := db.Begin(false)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	run := func(t *testing.T, s *stream.Stream) []document.Document {
+		t.Helper()
+
+		var in expr.Environment
+		in.Tx = tx.Transaction
+
+		var docs []document.Document
+		err := s.Iterate(&in, func(out *expr.Environment) error {
+			d, ok := out.GetDocument()
+			require.True(t, ok)
+			var fb document.FieldBuffer
+			err := fb.Copy(d)
+			require.NoError(t, err)
+			docs = append(docs, &fb)
+			return nil
+		})
+		if err == stream.ErrStreamClosed {
+			err = nil
+		}
+		require.NoError(t, err)
+		return docs
+	}
+
+	t.Run("Filter and project", func(t *testing.T) {
+		s := stream.New(stream.SeqScan("test")).
+			Pipe(stream.Filter(parser.MustParseExpr("a % 10 = 0"))).
+			Pipe(stream.Project(parser.MustParseExpr("a"))).
+			Pipe(stream.Gather(4))
+
+		docs := run(t, s)
+		require.Len(t, docs, 100)
+
+		var got []int64
+		for _, d := range docs {
+			v, err := d.GetByField("a")
+			require.NoError(t, err)
+			got = append(got, v.V.(int64))
+		}
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		for i := range got {
+			require.Equal(t, int64(i*10), got[i])
+		}
+	})
+
+	t.Run("Partial aggregation", func(t *testing.T) {
+		s := stream.New(stream.SeqScan("test")).
+			Pipe(stream.GroupBy(parser.MustParseExpr("b"))).
+			Pipe(stream.HashAggregate(
+				&expr.CountFunc{Wildcard: true},
+				&expr.SumFunc{Expr: parser.MustParseExpr("a")},
+				&expr.MinFunc{Expr: parser.MustParseExpr("a")},
+				&expr.MaxFunc{Expr: parser.MustParseExpr("a")},
+				&expr.AvgFunc{Expr: parser.MustParseExpr("a")},
+			)).
+			Pipe(stream.Gather(4))
+
+		docs := run(t, s)
+		require.Len(t, docs, 3)
+
+		sort.Slice(docs, func(i, j int) bool {
+			vi, _ := docs[i].GetByField("b")
+			vj, _ := docs[j].GetByField("b")
+			return vi.V.(int64) < vj.V.(int64)
+		})
+
+		// compare with the sequential aggregation
+		expected := run(t, stream.New(stream.SeqScan("test")).
+			Pipe(stream.GroupBy(parser.MustParseExpr("b"))).
+			Pipe(stream.HashAggregate(
+				&expr.CountFunc{Wildcard: true},
+				&expr.SumFunc{Expr: parser.MustParseExpr("a")},
+				&expr.MinFunc{Expr: parser.MustParseExpr("a")},
+				&expr.MaxFunc{Expr: parser.MustParseExpr("a")},
+				&expr.AvgFunc{Expr: parser.MustParseExpr("a")},
+			)))
+		require.Len(t, expected, 3)
+
+		for i := range expected {
+			ok, err := document.NewDocumentValue(expected[i]).IsEqual(document.NewDocumentValue(docs[i]))
+			require.NoError(t, err)
+			require.True(t, ok, "expected %v, got %v", expected[i], docs[i])
+		}
+	})
+
+	t.Run("Aggregation of an empty stream", func(t *testing.T) {
+		s := stream.New(stream.SeqScan("test")).
+			Pipe(stream.Filter(parser.MustParseExpr("a > 10000"))).
+			Pipe(stream.HashAggregate(&expr.CountFunc{Wildcard: true})).
+			Pipe(stream.Gather(4))
+
+		docs := run(t, s)
+		require.Len(t, docs, 1)
+		v, err := docs[0].GetByField("COUNT(*)")
+		require.NoError(t, err)
+		require.Equal(t, int64(0), v.V.(int64))
+	})
+
+	t.Run("Early stop", func(t *testing.T) {
+		s := stream.New(stream.SeqScan("test")).
+			Pipe(stream.Gather(4)).
+			Pipe(stream.Take(10))
+
+		docs := run(t, s)
+		require.Len(t, docs, 10)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		s := stream.New(stream.SeqScan("test")).
+			Pipe(stream.Filter(parser.MustParseExpr("a > 10"))).
+			Pipe(stream.Gather(4))
+
+		var in expr.Environment
+		in.Tx = tx.Transaction
+
+		err := s.Iterate(&in, func(out *expr.Environment) error {
+			return stream.ErrInvalidResult
+		})
+		require.Equal(t, stream.ErrInvalidResult, err)
+	})
+
+	t.Run("String", func(t *testing.T) {
+		require.Equal(t, `gather(4)`, stream.Gather(4).String())
+	})
+}
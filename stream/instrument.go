@@ -0,0 +1,146 @@
+package stream
+
+import (
+	"time"
+
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/expr"
+)
+
+// OperatorStatistics holds information about the execution of an operator.
+type OperatorStatistics struct {
+	// String representation of the operator.
+	Operator string
+	// Number of environments received from the previous operator.
+	RowsIn int64
+	// Number of environments sent to the next operator.
+	RowsOut int64
+	// Time spent in the operator, excluding the time spent
+	// in the other operators of the stream.
+	Duration time.Duration
+	// Number of documents read from the tables by the operator.
+	DecodedDocuments int64
+}
+
+// Instrument wraps every operator of the stream with an operator recording
+// statistics about its execution, and returns the statistics of each operator,
+// in the order of the stream.
+// The statistics are updated every time the returned stream is iterated on.
+// The operators of s are modified and s must not be used afterwards.
+func Instrument(s *Stream) (*Stream, []*OperatorStatistics) {
+	return instrument(s, true)
+}
+
+// instrument the stream. If countDecoded is false, the documents decoded
+// by the operators are not recorded, which is required when the transaction
+// is used concurrently by other streams.
+func instrument(s *Stream, countDecoded bool) (*Stream, []*OperatorStatistics) {
+	var stats []*OperatorStatistics
+	var prev *instrumentedOperator
+
+	for op := s.First(); op != nil; {
+		next := op.GetNext()
+
+		iop := instrumentedOperator{
+			Op:           op,
+			stats:        OperatorStatistics{Operator: op.String()},
+			prev:         prev,
+			countDecoded: countDecoded,
+		}
+		op.SetNext(nil)
+		if prev != nil {
+			op.SetPrev(prev)
+			prev.SetNext(&iop)
+			iop.SetPrev(prev)
+		}
+		stats = append(stats, &iop.stats)
+
+		prev = &iop
+		op = next
+	}
+
+	if prev == nil {
+		return s, nil
+	}
+
+	return New(prev), stats
+}
+
+// instrumentedOperator records statistics about the execution of Op.
+// Since every operator calls the previous operator from its own Iterate method,
+// the time measured by the instrumented operator includes the time spent in the previous
+// operators, which is then subtracted to only report the time spent in Op.
+type instrumentedOperator struct {
+	baseOperator
+	Op Operator
+
+	stats        OperatorStatistics
+	prev         *instrumentedOperator
+	countDecoded bool
+
+	// time spent in this operator and the previous ones
+	duration time.Duration
+	// documents decoded by this operator and the previous ones
+	decoded int64
+}
+
+// Iterate calls Op and measures the time spent before sending the
+// environments to the next operator.
+func (op *instrumentedOperator) Iterate(in *expr.Environment, fn func(out *expr.Environment) error) error {
+	var tx *database.Transaction
+	if op.countDecoded {
+		tx = in.GetTx()
+	}
+
+	start := time.Now()
+	decoded := decodedDocuments(tx)
+
+	var nextDuration time.Duration
+	var nextDecoded int64
+
+	err := op.Op.Iterate(in, func(out *expr.Environment) error {
+		op.stats.RowsOut++
+
+		start := time.Now()
+		decoded := decodedDocuments(tx)
+
+		err := fn(out)
+
+		nextDuration += time.Since(start)
+		nextDecoded += decodedDocuments(tx) - decoded
+		return err
+	})
+
+	op.duration += time.Since(start) - nextDuration
+	op.decoded += decodedDocuments(tx) - decoded - nextDecoded
+
+	op.stats.Duration = op.duration
+	op.stats.DecodedDocuments = op.decoded
+	if op.prev != nil {
+		op.stats.RowsIn = op.prev.stats.RowsOut
+		op.stats.Duration -= op.prev.duration
+		op.stats.DecodedDocuments -= op.prev.decoded
+	}
+
+	return err
+}
+
+// add the statistics of a copy of the operator run concurrently.
+func (s *OperatorStatistics) add(o *OperatorStatistics) {
+	s.RowsIn += o.RowsIn
+	s.RowsOut += o.RowsOut
+	s.Duration += o.Duration
+	s.DecodedDocuments += o.DecodedDocuments
+}
+
+func (op *instrumentedOperator) String() string {
+	return op.Op.String()
+}
+
+func decodedDocuments(tx *database.Transaction) int64 {
+	if tx == nil {
+		return 0
+	}
+
+	return tx.DecodedDocuments()
+}
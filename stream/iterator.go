@@ -5,6 +5,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/genjidb/genji/database"
 	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/expr"
 	"github.com/genjidb/genji/stringutil"
@@ -134,7 +135,16 @@ func (it *SeqScanOperator) Iterate(in *expr.Environment, fn func(out *expr.Envir
 		iterator = table.DescendLessOrEqual
 	}
 
+	c := newCanceler(in)
+	budget := in.GetBudget()
 	return iterator(document.Value{}, func(d document.Document) error {
+		if err := c.check(); err != nil {
+			return err
+		}
+		if err := budget.Scan(); err != nil {
+			return err
+		}
+
 		newEnv.SetDocument(d)
 		return fn(&newEnv)
 	})
@@ -153,6 +163,31 @@ type PkScanOperator struct {
 	TableName string
 	Ranges    Ranges
 	Reverse   bool
+	// If set, only the documents located after this position,
+	// in the order of the scan, are returned.
+	After *Position
+}
+
+// A Position identifies the location of a document in a table or in an index.
+// It is used to resume a scan after the last document returned by a previous scan.
+type Position struct {
+	// Primary key of the document, as returned by its Key method.
+	Key document.Value
+	// Name of the index, for index scans.
+	Index string
+	// Indexed value of the document, for index scans.
+	Value document.Value
+	// Raw key of the index entry of the document, for index scans.
+	// The scan resumes from the first entry located after it.
+	Entry []byte
+}
+
+func (p *Position) String() string {
+	if p.Value.Type.IsZero() {
+		return stringutil.Sprintf("after(%v)", p.Key)
+	}
+
+	return stringutil.Sprintf("after(%v, %v)", p.Value, p.Key)
 }
 
 // PkScan creates an iterator that iterates over each document of the given table.
@@ -185,6 +220,10 @@ func (it *PkScanOperator) String() string {
 			}
 		}
 	}
+	if it.After != nil {
+		s.WriteString(", ")
+		s.WriteString(it.After.String())
+	}
 
 	s.WriteString(")")
 
@@ -194,11 +233,18 @@ func (it *PkScanOperator) String() string {
 // Iterate over the documents of the table. Each document is stored in the environment
 // that is passed to the fn function, using SetCurrentValue.
 func (it *PkScanOperator) Iterate(in *expr.Environment, fn func(out *expr.Environment) error) error {
+	ranges := it.Ranges
+
 	// if there are no ranges,  use a simpler and faster iteration function
-	if len(it.Ranges) == 0 {
-		s := SeqScan(it.TableName)
-		s.Reverse = it.Reverse
-		return s.Iterate(in, fn)
+	if len(ranges) == 0 {
+		if it.After == nil {
+			s := SeqScan(it.TableName)
+			s.Reverse = it.Reverse
+			return s.Iterate(in, fn)
+		}
+
+		// iterate over the whole table, starting after the position
+		ranges = Ranges{{}}
 	}
 
 	var newEnv expr.Environment
@@ -209,7 +255,15 @@ func (it *PkScanOperator) Iterate(in *expr.Environment, fn func(out *expr.Enviro
 		return err
 	}
 
-	err = it.Ranges.Encode(table, in)
+	info := table.Info()
+	if pk := info.GetPrimaryKey(); pk != nil {
+		ranges, err = ranges.bind(in, pk.Path, pk.Type, info.FieldConstraints)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ranges.Encode(table, in)
 	if err != nil {
 		return err
 	}
@@ -222,7 +276,17 @@ func (it *PkScanOperator) Iterate(in *expr.Environment, fn func(out *expr.Enviro
 		iterator = table.DescendLessOrEqual
 	}
 
-	for _, rng := range it.Ranges {
+	var encAfter []byte
+	if it.After != nil {
+		encAfter, err = table.EncodeValue(it.After.Key)
+		if err != nil {
+			return err
+		}
+	}
+
+	c := newCanceler(in)
+	budget := in.GetBudget()
+	for _, rng := range ranges {
 		var start, end document.Value
 		if !it.Reverse {
 			start = rng.Min
@@ -240,9 +304,31 @@ func (it *PkScanOperator) Iterate(in *expr.Environment, fn func(out *expr.Enviro
 			}
 		}
 
+		// seek directly to the position if it is located after the start of the range
+		if encAfter != nil {
+			ok, err := isAfterStart(encAfter, start, table, it.Reverse)
+			if err != nil {
+				return err
+			}
+			if ok {
+				start = it.After.Key
+			}
+		}
+
 		err = iterator(start, func(d document.Document) error {
+			if err := c.check(); err != nil {
+				return err
+			}
+			if err := budget.Scan(); err != nil {
+				return err
+			}
+
 			key := d.(document.Keyer).RawKey()
 
+			if encAfter != nil && !isAfter(bytes.Compare(key, encAfter), it.Reverse) {
+				return nil
+			}
+
 			if !rng.IsInRange(key) {
 				// if we reached the end of our range, we can stop iterating.
 				if encEnd == nil {
@@ -271,6 +357,33 @@ func (it *PkScanOperator) Iterate(in *expr.Environment, fn func(out *expr.Enviro
 	return nil
 }
 
+// isAfterStart returns whether the encoded position is located at or after the start of a range,
+// in the order of the scan.
+func isAfterStart(encAfter []byte, start document.Value, encoder ValueEncoder, reverse bool) (bool, error) {
+	if start.Type.IsZero() || start.V == nil {
+		return true, nil
+	}
+
+	encStart, err := encoder.EncodeValue(start)
+	if err != nil {
+		return false, err
+	}
+
+	cmp := bytes.Compare(encAfter, encStart)
+	return cmp == 0 || isAfter(cmp, reverse), nil
+}
+
+// isAfter returns whether the result of the comparison of an entry with
+// a position means that the entry is located after the position,
+// in the order of the scan.
+func isAfter(cmp int, reverse bool) bool {
+	if reverse {
+		return cmp < 0
+	}
+
+	return cmp > 0
+}
+
 // A IndexScanOperator iterates over the documents of an index.
 type IndexScanOperator struct {
 	baseOperator
@@ -278,6 +391,17 @@ type IndexScanOperator struct {
 	IndexName string
 	Ranges    Ranges
 	Reverse   bool
+	// If set to true, documents are built from the content of the index
+	// entries instead of being fetched from the table.
+	// The index must cover every path used by the rest of the stream.
+	Covering bool
+	// If set, only the documents located after the index entry
+	// of this position, in the order of the scan, are returned.
+	After *Position
+
+	// raw key of the index entry of the last document
+	// sent to the next operator
+	lastEntry []byte
 }
 
 // IndexScan creates an iterator that iterates over each document of the given table.
@@ -293,7 +417,11 @@ func IndexScanReverse(name string, ranges ...Range) *IndexScanOperator {
 func (it *IndexScanOperator) String() string {
 	var s strings.Builder
 
-	s.WriteString("indexScan")
+	if it.Covering {
+		s.WriteString("indexOnlyScan")
+	} else {
+		s.WriteString("indexScan")
+	}
 	if it.Reverse {
 		s.WriteString("Reverse")
 	}
@@ -305,12 +433,22 @@ func (it *IndexScanOperator) String() string {
 		s.WriteString(", ")
 		s.WriteString(it.Ranges.String())
 	}
+	if it.After != nil {
+		s.WriteString(", ")
+		s.WriteString(it.After.String())
+	}
 
 	s.WriteString(")")
 
 	return s.String()
 }
 
+// LastEntry returns the raw key of the index entry of the last document
+// sent to the next operator.
+func (it *IndexScanOperator) LastEntry() []byte {
+	return it.lastEntry
+}
+
 // Iterate over the documents of the table. Each document is stored in the environment
 // that is passed to the fn function, using SetCurrentValue.
 func (it *IndexScanOperator) Iterate(in *expr.Environment, fn func(out *expr.Environment) error) error {
@@ -327,33 +465,78 @@ func (it *IndexScanOperator) Iterate(in *expr.Environment, fn func(out *expr.Env
 		return err
 	}
 
-	err = it.Ranges.Encode(index, in)
+	info := table.Info()
+	ranges, err := it.Ranges.bind(in, index.Info.Path, index.Info.Type, info.FieldConstraints)
 	if err != nil {
 		return err
 	}
 
-	var iterator func(pivot document.Value, fn func(val, key []byte) error) error
+	err = ranges.Encode(index, in)
+	if err != nil {
+		return err
+	}
 
-	if !it.Reverse {
-		iterator = index.AscendGreaterOrEqual
+	// the iterator passes either the document built from the index entry,
+	// if the scan is covering, or the key of the document to fetch from the table.
+	// If after is set, it starts right after the index entry whose raw key is after.
+	var iterator func(pivot document.Value, after []byte, fn func(entry, val, key []byte, d document.Document) error) error
+
+	if it.Covering {
+		iterator = func(pivot document.Value, after []byte, fn func(entry, val, key []byte, d document.Document) error) error {
+			return index.IterateAfterCovered(pivot, after, it.Reverse, func(entry, val []byte, d document.Document) error {
+				return fn(entry, val, nil, d)
+			})
+		}
 	} else {
-		iterator = index.DescendLessOrEqual
+		iterator = func(pivot document.Value, after []byte, fn func(entry, val, key []byte, d document.Document) error) error {
+			return index.IterateAfter(pivot, after, it.Reverse, func(entry, val, key []byte) error {
+				return fn(entry, val, key, nil)
+			})
+		}
 	}
 
+	getDocument := func(key []byte, d document.Document) (document.Document, error) {
+		if d != nil {
+			return d, nil
+		}
+
+		return table.GetDocument(key)
+	}
+
+	var after, encAfterVal []byte
+	if it.After != nil {
+		after = it.After.Entry
+		encAfterVal, err = index.EncodeValue(it.After.Value)
+		if err != nil {
+			return err
+		}
+	}
+
+	c := newCanceler(in)
+	budget := in.GetBudget()
+
 	// if there are no ranges use a simpler and faster iteration function
-	if len(it.Ranges) == 0 {
-		return iterator(document.Value{}, func(val, key []byte) error {
-			d, err := table.GetDocument(key)
+	if len(ranges) == 0 {
+		return iterator(document.Value{}, after, func(entry, val, key []byte, d document.Document) error {
+			if err := c.check(); err != nil {
+				return err
+			}
+			if err := budget.Scan(); err != nil {
+				return err
+			}
+
+			d, err := getDocument(key, d)
 			if err != nil {
 				return err
 			}
 
+			it.lastEntry = append(it.lastEntry[:0], entry...)
 			newEnv.SetDocument(d)
 			return fn(&newEnv)
 		})
 	}
 
-	for _, rng := range it.Ranges {
+	for _, rng := range ranges {
 		var start, end document.Value
 		if !it.Reverse {
 			start = rng.Min
@@ -371,7 +554,26 @@ func (it *IndexScanOperator) Iterate(in *expr.Environment, fn func(out *expr.Env
 			}
 		}
 
-		err = iterator(start, func(val, key []byte) error {
+		// seek directly to the position if it is located in the range
+		var rangeAfter []byte
+		if encAfterVal != nil {
+			ok, err := isAfterStart(encAfterVal, start, index, it.Reverse)
+			if err != nil {
+				return err
+			}
+			if ok {
+				rangeAfter = after
+			}
+		}
+
+		err = iterator(start, rangeAfter, func(entry, val, key []byte, d document.Document) error {
+			if err := c.check(); err != nil {
+				return err
+			}
+			if err := budget.Scan(); err != nil {
+				return err
+			}
+
 			if !rng.IsInRange(val) {
 				// if we reached the end of our range, we can stop iterating.
 				if encEnd == nil {
@@ -387,11 +589,12 @@ func (it *IndexScanOperator) Iterate(in *expr.Environment, fn func(out *expr.Env
 				return nil
 			}
 
-			d, err := table.GetDocument(key)
+			d, err := getDocument(key, d)
 			if err != nil {
 				return err
 			}
 
+			it.lastEntry = append(it.lastEntry[:0], entry...)
 			newEnv.SetDocument(d)
 			return fn(&newEnv)
 		})
@@ -408,6 +611,10 @@ func (it *IndexScanOperator) Iterate(in *expr.Environment, fn func(out *expr.Env
 
 type Range struct {
 	Min, Max document.Value
+	// Parameters whose value is bound to Min and Max before reading the range.
+	// They are used by plans that are optimized once and executed
+	// with different parameters.
+	MinParam, MaxParam expr.Expr
 	// Exclude Min and Max from the results.
 	// By default, min and max are inclusive.
 	// Exclusive and Exact cannot be set to true at the same time.
@@ -460,22 +667,43 @@ func (r *Range) encode(encoder ValueEncoder, env *expr.Environment) error {
 }
 
 func (r *Range) String() string {
+	var min, max interface{} = r.Min, r.Max
+	if r.MinParam != nil {
+		min = r.MinParam
+	}
+	if r.MaxParam != nil {
+		max = r.MaxParam
+	}
+
 	if r.Exact {
-		return stringutil.Sprintf("%v", r.Min)
+		return stringutil.Sprintf("%v", min)
 	}
 
-	if r.Min.Type.IsZero() {
-		r.Min = document.NewIntegerValue(-1)
+	if !r.hasMin() {
+		min = document.NewIntegerValue(-1)
 	}
-	if r.Max.Type.IsZero() {
-		r.Max = document.NewIntegerValue(-1)
+	if !r.hasMax() {
+		max = document.NewIntegerValue(-1)
 	}
 
 	if r.Exclusive {
-		return stringutil.Sprintf("[%v, %v, true]", r.Min, r.Max)
+		return stringutil.Sprintf("[%v, %v, true]", min, max)
 	}
 
-	return stringutil.Sprintf("[%v, %v]", r.Min, r.Max)
+	return stringutil.Sprintf("[%v, %v]", min, max)
+}
+
+// HasParams returns whether the value of one of the bounds is a parameter.
+func (r *Range) HasParams() bool {
+	return r.MinParam != nil || r.MaxParam != nil
+}
+
+func (r *Range) hasMin() bool {
+	return r.MinParam != nil || !r.Min.Type.IsZero()
+}
+
+func (r *Range) hasMax() bool {
+	return r.MaxParam != nil || !r.Max.Type.IsZero()
 }
 
 func (r *Range) IsEqual(other *Range) bool {
@@ -491,23 +719,33 @@ func (r *Range) IsEqual(other *Range) bool {
 		return false
 	}
 
-	if r.Min.Type != other.Min.Type {
-		return false
-	}
-	ok, err := r.Min.IsEqual(other.Min)
-	if err != nil || !ok {
+	if !paramsEqual(r.MinParam, other.MinParam) || !paramsEqual(r.MaxParam, other.MaxParam) {
 		return false
 	}
 
-	if r.Max.Type != other.Max.Type {
+	return boundsEqual(r.Min, other.Min) && boundsEqual(r.Max, other.Max)
+}
+
+// boundsEqual returns whether two bounds are equal.
+// Missing bounds have no type and are equal to each other.
+func boundsEqual(a, b document.Value) bool {
+	if a.Type != b.Type {
 		return false
 	}
-	ok, err = r.Max.IsEqual(other.Max)
-	if err != nil || !ok {
-		return false
+	if a.Type.IsZero() {
+		return true
 	}
 
-	return true
+	ok, err := a.IsEqual(b)
+	return err == nil && ok
+}
+
+func paramsEqual(a, b expr.Expr) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	return expr.Equal(a, b)
 }
 
 type Ranges []Range
@@ -531,6 +769,70 @@ func (r Ranges) Append(rng Range) Ranges {
 	return append(r, rng)
 }
 
+// HasParams returns whether one of the ranges has a parameter.
+func (r Ranges) HasParams() bool {
+	for i := range r {
+		if r[i].HasParams() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bind returns a copy of the ranges in which the parameters are replaced by their value,
+// converted to be compared with the values of path, whose type in the index is indexType.
+// A bound whose value cannot be used to read the index is removed from its range.
+// Ranges with parameters are always followed by the filter they were built from,
+// which excludes the documents read because of a missing bound.
+func (r Ranges) bind(env *expr.Environment, path document.Path, indexType document.ValueType, fc database.FieldConstraints) (Ranges, error) {
+	if !r.HasParams() {
+		return r, nil
+	}
+
+	bindParam := func(e expr.Expr) (document.Value, error) {
+		v, err := e.Eval(env)
+		if err != nil {
+			return v, err
+		}
+
+		v, ok, err := fc.ConvertIndexOperand(path, indexType, v)
+		if err != nil || !ok {
+			return document.Value{}, err
+		}
+
+		return v, nil
+	}
+
+	var bound Ranges
+	for _, rng := range r {
+		var err error
+		if rng.MinParam != nil {
+			rng.Min, err = bindParam(rng.MinParam)
+			if err != nil {
+				return nil, err
+			}
+			rng.MinParam = nil
+		}
+		if rng.MaxParam != nil {
+			rng.Max, err = bindParam(rng.MaxParam)
+			if err != nil {
+				return nil, err
+			}
+			rng.MaxParam = nil
+		}
+
+		// the range is not bounded anymore: read the whole index.
+		if rng.Min.Type.IsZero() && rng.Max.Type.IsZero() {
+			return Ranges{{}}, nil
+		}
+
+		bound = bound.Append(rng)
+	}
+
+	return bound, nil
+}
+
 type ValueEncoder interface {
 	EncodeValue(v document.Value) ([]byte, error)
 }
@@ -575,12 +877,12 @@ func (r Ranges) Cost() int {
 		}
 
 		// if there are two boundaries, increment by 50
-		if !rng.Min.Type.IsZero() && !rng.Max.Type.IsZero() {
+		if rng.hasMin() && rng.hasMax() {
 			cost += 50
 		}
 
 		// if there is only one boundary, increment by 100
-		if (!rng.Min.Type.IsZero() && rng.Max.Type.IsZero()) || (rng.Min.Type.IsZero() && !rng.Max.Type.IsZero()) {
+		if rng.hasMin() != rng.hasMax() {
 			cost += 100
 			continue
 		}
@@ -606,6 +908,11 @@ func (r *Range) IsInRange(value []byte) bool {
 		return cmpMin == 0
 	}
 
+	// reverse iterations reach values lower than the lower bound
+	if cmpMin < 0 {
+		return false
+	}
+
 	// if exclusive and the value is equal to the lower bound
 	// we can ignore it
 	if r.Exclusive && cmpMin == 0 {
@@ -270,6 +270,59 @@ func TestPkScan(t *testing.T) {
 		op.Reverse = true
 
 		require.Equal(t, `pkScanReverse("test", [1, 2, true], 10, [100, -1])`, op.String())
+
+		op = stream.PkScan("test")
+		op.After = &stream.Position{Key: document.NewIntegerValue(10)}
+		require.Equal(t, `pkScan("test", after(10))`, op.String())
+	})
+
+	t.Run("After", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test (a INTEGER NOT NULL PRIMARY KEY);
+			INSERT INTO test (a) VALUES (1), (2), (3), (4), (5);
+		`)
+		require.NoError(t, err)
+
+		tx, err := db.Begin(false)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		tests := []struct {
+			ranges   stream.Ranges
+			reverse  bool
+			expected []int64
+		}{
+			{nil, false, []int64{3, 4, 5}},
+			{nil, true, []int64{1}},
+			{stream.Ranges{{Max: document.NewIntegerValue(4)}}, false, []int64{3, 4}},
+			{stream.Ranges{{Min: document.NewIntegerValue(4)}}, false, []int64{4, 5}},
+			{stream.Ranges{{Min: document.NewIntegerValue(4)}}, true, nil},
+		}
+
+		for _, test := range tests {
+			op := stream.PkScan("test", test.ranges...)
+			op.Reverse = test.reverse
+			op.After = &stream.Position{Key: document.NewIntegerValue(2)}
+
+			var env expr.Environment
+			env.Tx = tx.Transaction
+
+			var got []int64
+			err = op.Iterate(&env, func(env *expr.Environment) error {
+				d, ok := env.GetDocument()
+				require.True(t, ok)
+				v, err := d.GetByField("a")
+				require.NoError(t, err)
+				got = append(got, v.V.(int64))
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, test.expected, got, op.String())
+		}
 	})
 }
 
@@ -421,5 +474,95 @@ func TestIndexScan(t *testing.T) {
 		op.Reverse = true
 
 		require.Equal(t, `indexScanReverse("idx_test_a", [1, 2])`, op.String())
+
+		op = stream.IndexScan("idx_test_a")
+		op.After = &stream.Position{Value: document.NewIntegerValue(1), Key: document.NewIntegerValue(10)}
+		require.Equal(t, `indexScan("idx_test_a", after(1, 10))`, op.String())
+	})
+
+	t.Run("After", func(t *testing.T) {
+		db, err := genji.Open(":memory:")
+		require.NoError(t, err)
+		defer db.Close()
+
+		err = db.Exec(`
+			CREATE TABLE test (k INTEGER PRIMARY KEY);
+			CREATE INDEX idx_test_a ON test(a);
+			INSERT INTO test (k, a) VALUES (1, 1), (2, 2), (3, 2), (4, 2), (5, 3);
+			INSERT INTO test (k, a) VALUES (6, 'foo'), (7, NULL);
+		`)
+		require.NoError(t, err)
+
+		tx, err := db.Begin(false)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		table, err := tx.GetTable("test")
+		require.NoError(t, err)
+
+		// numbers are stored as doubles in untyped fields and
+		// entries sharing the same value are ordered by insertion
+		tests := []struct {
+			ranges   stream.Ranges
+			reverse  bool
+			expected []int64
+		}{
+			{nil, false, []int64{4, 5, 6}},
+			{nil, true, []int64{2, 1, 7}},
+			{stream.Ranges{{Max: document.NewDoubleValue(2)}}, false, []int64{4}},
+			{stream.Ranges{{Min: document.NewDoubleValue(3)}}, false, []int64{5}},
+			{stream.Ranges{{Min: document.NewDoubleValue(2), Exact: true}}, true, []int64{2}},
+		}
+
+		// read the raw key of the index entry of the document 3
+		var entry []byte
+		op := stream.IndexScan("idx_test_a")
+		var env expr.Environment
+		env.Tx = tx.Transaction
+		err = op.Iterate(&env, func(env *expr.Environment) error {
+			d, ok := env.GetDocument()
+			require.True(t, ok)
+			k, err := d.GetByField("k")
+			require.NoError(t, err)
+			if k.V.(int64) == 3 {
+				entry = append([]byte(nil), op.LastEntry()...)
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.NotEmpty(t, entry)
+
+		for _, covering := range []bool{false, true} {
+			for _, test := range tests {
+				// ranges are modified when encoded
+				op := stream.IndexScan("idx_test_a", append(stream.Ranges(nil), test.ranges...)...)
+				op.Reverse = test.reverse
+				op.Covering = covering
+				op.After = &stream.Position{
+					Index: "idx_test_a",
+					Value: document.NewDoubleValue(2),
+					Key:   document.NewIntegerValue(3),
+					Entry: entry,
+				}
+
+				var env expr.Environment
+				env.Tx = tx.Transaction
+
+				var got []int64
+				err = op.Iterate(&env, func(env *expr.Environment) error {
+					d, ok := env.GetDocument()
+					require.True(t, ok)
+					// documents built from the index only have a raw key
+					d, err := table.GetDocument(d.(document.Keyer).RawKey())
+					require.NoError(t, err)
+					k, err := d.GetByField("k")
+					require.NoError(t, err)
+					got = append(got, k.V.(int64))
+					return nil
+				})
+				require.NoError(t, err)
+				require.Equal(t, test.expected, got, op.String())
+			}
+		}
 	})
 }
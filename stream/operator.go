@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"container/heap"
 	"container/list"
+	"encoding/binary"
 	"errors"
 	"strings"
 
@@ -261,12 +262,24 @@ func SortReverse(e expr.Expr) *SortOperator {
 }
 
 func (op *SortOperator) Iterate(in *expr.Environment, f func(out *expr.Environment) error) error {
-	h, err := op.sortStream(op.Prev, in)
+	if limit, dir := workMemoryLimit(in); limit > 0 {
+		return op.iterateExternal(in, limit, dir, f)
+	}
+
+	mem := newMemoryTracker(in)
+	defer mem.release()
+
+	h, err := op.sortStream(op.Prev, in, mem)
 	if err != nil {
 		return err
 	}
 
+	c := newCanceler(in)
 	for h.Len() > 0 {
+		if err := c.check(); err != nil {
+			return err
+		}
+
 		node := heap.Pop(h).(heapNode)
 		err := f(node.data)
 		if err != nil {
@@ -277,7 +290,7 @@ func (op *SortOperator) Iterate(in *expr.Environment, f func(out *expr.Environme
 	return nil
 }
 
-func (op *SortOperator) sortStream(prev Operator, in *expr.Environment) (heap.Interface, error) {
+func (op *SortOperator) sortStream(prev Operator, in *expr.Environment, mem *memoryTracker) (heap.Interface, error) {
 	var h heap.Interface
 	if op.Desc {
 		h = new(maxHeap)
@@ -287,47 +300,30 @@ func (op *SortOperator) sortStream(prev Operator, in *expr.Environment) (heap.In
 
 	heap.Init(h)
 
-	getValue := op.Expr.Eval
-	if p, ok := op.Expr.(expr.Path); ok {
-		getValue = func(env *expr.Environment) (document.Value, error) {
-			for env != nil {
-				d, ok := env.GetDocument()
-				if !ok {
-					env = env.Outer
-					continue
-				}
-
-				v, err := document.Path(p).GetValueFromDocument(d)
-				if err == document.ErrFieldNotFound {
-					env = env.Outer
-					continue
-				}
-				return v, err
-			}
+	getValue := sortValueGetter(op.Expr)
+	c := newCanceler(in)
 
-			return document.NewNullValue(), nil
+	return h, prev.Iterate(in, func(env *expr.Environment) error {
+		if err := c.check(); err != nil {
+			return err
 		}
-	}
 
-	return h, prev.Iterate(in, func(env *expr.Environment) error {
-		sortV, err := getValue(env)
+		value, err := encodeSortValue(getValue, env)
 		if err != nil {
 			return err
 		}
 
-		// We need to make sure sort behaviour
-		// is the same with or without indexes.
-		// To achieve that, the value must be encoded using the same method
-		// as what the index package would do.
-		var buf bytes.Buffer
-
-		err = document.NewValueEncoder(&buf).Encode(sortV)
+		size, err := mem.envSize(env, in)
+		if err != nil {
+			return err
+		}
+		err = mem.grow(int64(len(value)) + size)
 		if err != nil {
 			return err
 		}
 
 		node := heapNode{
-			value: buf.Bytes(),
+			value: value,
 		}
 		node.data, err = env.Clone()
 		if err != nil {
@@ -340,6 +336,50 @@ func (op *SortOperator) sortStream(prev Operator, in *expr.Environment) (heap.In
 	})
 }
 
+// iterateExternal sorts the stream using at most limit bytes of memory,
+// writing sorted runs to temporary files created in dir if necessary.
+func (op *SortOperator) iterateExternal(in *expr.Environment, limit int64, dir string, f func(out *expr.Environment) error) error {
+	sorter := newExternalSorter(op.Desc, limit, dir)
+	defer sorter.Close()
+
+	getValue := sortValueGetter(op.Expr)
+	c := newCanceler(in)
+
+	err := op.Prev.Iterate(in, func(env *expr.Environment) error {
+		if err := c.check(); err != nil {
+			return err
+		}
+
+		value, err := encodeSortValue(getValue, env)
+		if err != nil {
+			return err
+		}
+
+		enc, err := encodeEnvironment(nil, env, in)
+		if err != nil {
+			return err
+		}
+
+		return sorter.Add(value, enc)
+	})
+	if err != nil {
+		return err
+	}
+
+	return sorter.Iterate(func(_, data []byte) error {
+		if err := c.check(); err != nil {
+			return err
+		}
+
+		env, err := decodeEnvironment(data, in)
+		if err != nil {
+			return err
+		}
+
+		return f(env)
+	})
+}
+
 func (op *SortOperator) String() string {
 	if op.Desc {
 		return stringutil.Sprintf("sortReverse(%s)", op.Expr)
@@ -348,9 +388,180 @@ func (op *SortOperator) String() string {
 	return stringutil.Sprintf("sort(%s)", op.Expr)
 }
 
+// sortValueGetter returns a function that evaluates e.
+// If e is a path, the value is looked up in every document of the environment,
+// starting with the innermost one.
+func sortValueGetter(e expr.Expr) func(env *expr.Environment) (document.Value, error) {
+	p, ok := e.(expr.Path)
+	if !ok {
+		return e.Eval
+	}
+
+	return func(env *expr.Environment) (document.Value, error) {
+		for env != nil {
+			d, ok := env.GetDocument()
+			if !ok {
+				env = env.Outer
+				continue
+			}
+
+			v, err := document.Path(p).GetValueFromDocument(d)
+			if err == document.ErrFieldNotFound {
+				env = env.Outer
+				continue
+			}
+			return v, err
+		}
+
+		return document.NewNullValue(), nil
+	}
+}
+
+// encodeSortValue evaluates the sort value of env and encodes it.
+func encodeSortValue(getValue func(env *expr.Environment) (document.Value, error), env *expr.Environment) ([]byte, error) {
+	sortV, err := getValue(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// We need to make sure sort behaviour
+	// is the same with or without indexes.
+	// To achieve that, the value must be encoded using the same method
+	// as what the index package would do.
+	var buf bytes.Buffer
+
+	err = document.NewValueEncoder(&buf).Encode(sortV)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// A TopNOperator outputs the N first values of the stream, in order.
+type TopNOperator struct {
+	baseOperator
+	Expr expr.Expr
+	Desc bool
+	N    int64
+}
+
+// TopN consumes every value of the stream and outputs the n smallest ones in ascending order.
+// Unlike Sort, it only keeps n values in memory at any time, using a bounded heap.
+// It is used to replace a Sort operator followed by Take.
+func TopN(e expr.Expr, n int64) *TopNOperator {
+	return &TopNOperator{Expr: e, N: n}
+}
+
+// TopNReverse does the same as TopN but outputs the n largest values in descending order.
+func TopNReverse(e expr.Expr, n int64) *TopNOperator {
+	return &TopNOperator{Expr: e, Desc: true, N: n}
+}
+
+// Iterate implements the Operator interface.
+func (op *TopNOperator) Iterate(in *expr.Environment, f func(out *expr.Environment) error) error {
+	if op.N <= 0 {
+		return nil
+	}
+
+	// the root of the heap is the value that will be evicted first,
+	// which is the largest one in ascending order and the smallest one
+	// in descending order.
+	var h boundedHeap
+	if op.Desc {
+		h = new(minHeap)
+	} else {
+		h = new(maxHeap)
+	}
+
+	getValue := sortValueGetter(op.Expr)
+	c := newCanceler(in)
+	mem := newMemoryTracker(in)
+	defer mem.release()
+
+	err := op.Prev.Iterate(in, func(env *expr.Environment) error {
+		if err := c.check(); err != nil {
+			return err
+		}
+
+		value, err := encodeSortValue(getValue, env)
+		if err != nil {
+			return err
+		}
+
+		if int64(h.Len()) >= op.N {
+			// ignore values that would be evicted right away
+			cmp := bytes.Compare(value, h.root())
+			if (!op.Desc && cmp >= 0) || (op.Desc && cmp <= 0) {
+				return nil
+			}
+
+			evicted := heap.Pop(h).(heapNode)
+			mem.grow(-evicted.size)
+		}
+
+		size, err := mem.envSize(env, in)
+		if err != nil {
+			return err
+		}
+		size += int64(len(value))
+		err = mem.grow(size)
+		if err != nil {
+			return err
+		}
+
+		node := heapNode{
+			value: value,
+			size:  size,
+		}
+		node.data, err = env.Clone()
+		if err != nil {
+			return err
+		}
+
+		heap.Push(h, node)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// popping the heap returns the values in reverse order
+	nodes := make([]heapNode, h.Len())
+	for i := len(nodes) - 1; i >= 0; i-- {
+		nodes[i] = heap.Pop(h).(heapNode)
+	}
+
+	for _, node := range nodes {
+		err = f(node.data)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (op *TopNOperator) String() string {
+	if op.Desc {
+		return stringutil.Sprintf("topNReverse(%s, %d)", op.Expr, op.N)
+	}
+
+	return stringutil.Sprintf("topN(%s, %d)", op.Expr, op.N)
+}
+
+// boundedHeap is a heap whose root can be read without popping it.
+type boundedHeap interface {
+	heap.Interface
+
+	root() []byte
+}
+
 type heapNode struct {
 	value []byte
 	data  *expr.Environment
+	// memory used by the node, if tracked.
+	size int64
 }
 
 type minHeap []heapNode
@@ -363,6 +574,8 @@ func (h *minHeap) Push(x interface{}) {
 	*h = append(*h, x.(heapNode))
 }
 
+func (h minHeap) root() []byte { return h[0].value }
+
 func (h *minHeap) Pop() interface{} {
 	old := *h
 	n := len(old)
@@ -379,10 +592,24 @@ func (h maxHeap) Less(i, j int) bool {
 	return bytes.Compare(h.minHeap[i].value, h.minHeap[j].value) > 0
 }
 
+// A WriteOperator is an operator that inserts, replaces or deletes documents.
+type WriteOperator interface {
+	Operator
+
+	// Affected returns the number of documents written
+	// during the last iteration.
+	Affected() int64
+}
+
 // A TableInsertOperator inserts incoming documents to the table.
 type TableInsertOperator struct {
 	baseOperator
 	Name string
+
+	// set during iteration
+	affected     int64
+	lastInsertID int64
+	hasInsertID  bool
 }
 
 // TableInsert inserts incoming documents to the table.
@@ -394,6 +621,8 @@ func TableInsert(tableName string) *TableInsertOperator {
 func (op *TableInsertOperator) Iterate(in *expr.Environment, f func(out *expr.Environment) error) error {
 	var newEnv expr.Environment
 
+	op.affected, op.lastInsertID, op.hasInsertID = 0, 0, false
+
 	var table *database.Table
 	return op.Prev.Iterate(in, func(env *expr.Environment) error {
 		d, ok := env.GetDocument()
@@ -409,7 +638,13 @@ func (op *TableInsertOperator) Iterate(in *expr.Environment, f func(out *expr.En
 			}
 		}
 
-		_, err := table.Insert(d)
+		inserted, err := table.Insert(d)
+		if err != nil {
+			return err
+		}
+
+		op.affected++
+		op.lastInsertID, op.hasInsertID, err = insertID(table, inserted)
 		if err != nil {
 			return err
 		}
@@ -419,6 +654,46 @@ func (op *TableInsertOperator) Iterate(in *expr.Environment, f func(out *expr.En
 	})
 }
 
+// Affected returns the number of documents inserted during the last iteration.
+func (op *TableInsertOperator) Affected() int64 {
+	return op.affected
+}
+
+// LastInsertID returns the primary key of the last document inserted
+// during the last iteration, if it is an integer. For tables without
+// primary key, it returns the generated document id.
+func (op *TableInsertOperator) LastInsertID() (int64, bool) {
+	return op.lastInsertID, op.hasInsertID
+}
+
+// insertID returns the primary key of the inserted document, if it is an integer.
+func insertID(table *database.Table, d document.Document) (int64, bool, error) {
+	pk := table.Info().GetPrimaryKey()
+	if pk == nil {
+		docid, _ := binary.Uvarint(d.(document.Keyer).RawKey())
+		return int64(docid), true, nil
+	}
+
+	v, err := pk.Path.GetValueFromDocument(d)
+	if err != nil {
+		return 0, false, err
+	}
+
+	// values of typed primary keys are converted before being stored
+	if pk.Type == document.IntegerValue {
+		v, err = v.CastAsInteger()
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	if v.Type != document.IntegerValue {
+		return 0, false, nil
+	}
+
+	return v.V.(int64), true, nil
+}
+
 func (op *TableInsertOperator) String() string {
 	return stringutil.Sprintf("tableInsert('%s')", op.Name)
 }
@@ -427,6 +702,9 @@ func (op *TableInsertOperator) String() string {
 type TableReplaceOperator struct {
 	baseOperator
 	Name string
+
+	// set during iteration
+	affected int64
 }
 
 // TableReplace replaces documents in the table. Incoming documents must implement the document.Keyer interface.
@@ -439,6 +717,8 @@ func (op *TableReplaceOperator) Iterate(in *expr.Environment, f func(out *expr.E
 	var table *database.Table
 	var newEnv expr.Environment
 
+	op.affected = 0
+
 	return op.Prev.Iterate(in, func(out *expr.Environment) error {
 		d, ok := out.GetDocument()
 		if !ok {
@@ -467,12 +747,18 @@ func (op *TableReplaceOperator) Iterate(in *expr.Environment, f func(out *expr.E
 		if err != nil {
 			return err
 		}
+		op.affected++
 
 		newEnv.Outer = out
 		return f(&newEnv)
 	})
 }
 
+// Affected returns the number of documents replaced during the last iteration.
+func (op *TableReplaceOperator) Affected() int64 {
+	return op.affected
+}
+
 func (op *TableReplaceOperator) String() string {
 	return stringutil.Sprintf("tableReplace('%s')", op.Name)
 }
@@ -481,6 +767,9 @@ func (op *TableReplaceOperator) String() string {
 type TableDeleteOperator struct {
 	baseOperator
 	Name string
+
+	// set during iteration
+	affected int64
 }
 
 // TableDelete deletes documents from the table. Incoming documents must implement the document.Keyer interface.
@@ -493,6 +782,8 @@ func (op *TableDeleteOperator) Iterate(in *expr.Environment, f func(out *expr.En
 	var table *database.Table
 	var newEnv expr.Environment
 
+	op.affected = 0
+
 	return op.Prev.Iterate(in, func(out *expr.Environment) error {
 		d, ok := out.GetDocument()
 		if !ok {
@@ -521,12 +812,18 @@ func (op *TableDeleteOperator) Iterate(in *expr.Environment, f func(out *expr.En
 		if err != nil {
 			return err
 		}
+		op.affected++
 
 		newEnv.Outer = out
 		return f(&newEnv)
 	})
 }
 
+// Affected returns the number of documents deleted during the last iteration.
+func (op *TableDeleteOperator) Affected() int64 {
+	return op.affected
+}
+
 func (op *TableDeleteOperator) String() string {
 	return stringutil.Sprintf("tableDelete('%s')", op.Name)
 }
@@ -542,45 +839,109 @@ func Distinct() *DistinctOperator {
 }
 
 // Iterate implements the Operator interface.
+// If the memory used to store the documents already seen reaches the
+// work memory limit of the database, documents that haven't been seen yet
+// are written to temporary partitions and deduplicated once the incoming
+// stream is consumed.
 func (op *DistinctOperator) Iterate(in *expr.Environment, f func(out *expr.Environment) error) error {
 	var buf bytes.Buffer
 	enc := document.NewValueEncoder(&buf)
-	m := make(map[string]struct{})
 
-	return op.Prev.Iterate(in, func(out *expr.Environment) error {
-		buf.Reset()
+	limit, dir := workMemoryLimit(in)
 
-		d, ok := out.GetDocument()
-		if !ok {
-			return errors.New("missing document")
-		}
+	return distinct(in, limit, dir, 0, func(fn func(key []byte, env *expr.Environment) error) error {
+		return op.Prev.Iterate(in, func(out *expr.Environment) error {
+			buf.Reset()
 
-		fields, err := document.Fields(d)
-		if err != nil {
-			return err
-		}
+			d, ok := out.GetDocument()
+			if !ok {
+				return errors.New("missing document")
+			}
 
-		for _, field := range fields {
-			value, err := d.GetByField(field)
+			fields, err := document.Fields(d)
 			if err != nil {
 				return err
 			}
 
-			err = enc.Encode(value)
-			if err != nil {
-				return err
+			for _, field := range fields {
+				value, err := d.GetByField(field)
+				if err != nil {
+					return err
+				}
+
+				err = enc.Encode(value)
+				if err != nil {
+					return err
+				}
 			}
+
+			return fn(buf.Bytes(), out)
+		})
+	}, f)
+}
+
+// distinct calls f for every environment of the source whose key wasn't seen before.
+// Once the keys seen use more than limit bytes, environments with unknown keys are
+// spilled to partitions which are deduplicated afterwards, one level deeper.
+func distinct(in *expr.Environment, limit int64, dir string, level int, source func(fn func(key []byte, env *expr.Environment) error) error, f func(out *expr.Environment) error) error {
+	m := make(map[string]struct{})
+	var size int64
+
+	var partitions *spillPartitions
+	defer func() {
+		partitions.Close()
+	}()
+
+	c := newCanceler(in)
+	mem := newMemoryTracker(in)
+	defer mem.release()
+
+	err := source(func(key []byte, env *expr.Environment) error {
+		if err := c.check(); err != nil {
+			return err
 		}
 
-		_, ok = m[string(buf.Bytes())]
 		// if value already exists, filter it out
-		if ok {
+		if _, ok := m[string(key)]; ok {
 			return nil
 		}
 
-		m[buf.String()] = struct{}{}
+		if limit <= 0 || size < limit || level >= maxSpillLevel {
+			m[string(key)] = struct{}{}
+			size += int64(len(key))
+			err := mem.grow(int64(len(key)))
+			if err != nil {
+				return err
+			}
+			return f(env)
+		}
 
-		return f(out)
+		if partitions == nil {
+			partitions = newSpillPartitions(dir, level)
+		}
+
+		data, err := encodeEnvironment(nil, env, in)
+		if err != nil {
+			return err
+		}
+
+		return partitions.Add(key, data)
+	})
+	if err != nil || partitions == nil {
+		return err
+	}
+
+	return partitions.Iterate(func(p *spillFile) error {
+		return distinct(in, limit, dir, level+1, func(fn func(key []byte, env *expr.Environment) error) error {
+			return p.Iterate(func(key, data []byte) error {
+				env, err := decodeEnvironment(data, in)
+				if err != nil {
+					return err
+				}
+
+				return fn(key, env)
+			})
+		}, f)
 	})
 }
 
@@ -351,6 +351,87 @@ func TestSort(t *testing.T) {
 	})
 }
 
+func TestTopN(t *testing.T) {
+	values := []document.Document{
+		testutil.MakeDocument(t, `{"a": 3}`),
+		testutil.MakeDocument(t, `{"a": 1}`),
+		testutil.MakeDocument(t, `{"a": 4}`),
+		testutil.MakeDocument(t, `{"a": null}`),
+		testutil.MakeDocument(t, `{"a": 2}`),
+	}
+
+	tests := []struct {
+		name string
+		n    int64
+		desc bool
+		want []document.Document
+	}{
+		{
+			"ASC",
+			2,
+			false,
+			[]document.Document{
+				testutil.MakeDocument(t, `{"a": null}`),
+				testutil.MakeDocument(t, `{"a": 1}`),
+			},
+		},
+		{
+			"DESC",
+			3,
+			true,
+			[]document.Document{
+				testutil.MakeDocument(t, `{"a": 4}`),
+				testutil.MakeDocument(t, `{"a": 3}`),
+				testutil.MakeDocument(t, `{"a": 2}`),
+			},
+		},
+		{
+			"N greater than stream",
+			10,
+			false,
+			[]document.Document{
+				testutil.MakeDocument(t, `{"a": null}`),
+				testutil.MakeDocument(t, `{"a": 1}`),
+				testutil.MakeDocument(t, `{"a": 2}`),
+				testutil.MakeDocument(t, `{"a": 3}`),
+				testutil.MakeDocument(t, `{"a": 4}`),
+			},
+		},
+		{
+			"zero",
+			0,
+			false,
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := stream.New(stream.Documents(values...))
+			if test.desc {
+				s = s.Pipe(stream.TopNReverse(parser.MustParseExpr("a"), test.n))
+			} else {
+				s = s.Pipe(stream.TopN(parser.MustParseExpr("a"), test.n))
+			}
+
+			var got []document.Document
+			err := s.Iterate(new(expr.Environment), func(env *expr.Environment) error {
+				d, ok := env.GetDocument()
+				require.True(t, ok)
+				got = append(got, d)
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, test.want, got)
+		})
+	}
+
+	t.Run("String", func(t *testing.T) {
+		require.Equal(t, `topN(a, 10)`, stream.TopN(parser.MustParseExpr("a"), 10).String())
+		require.Equal(t, `topNReverse(a, 10)`, stream.TopNReverse(parser.MustParseExpr("a"), 10).String())
+	})
+}
+
 func TestTableInsert(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -384,7 +465,8 @@ func TestTableInsert(t *testing.T) {
 			in := expr.NewEnvironment(nil)
 			in.Tx = tx.Transaction
 
-			s := stream.New(test.in).Pipe(stream.TableInsert("test"))
+			op := stream.TableInsert("test")
+			s := stream.New(test.in).Pipe(op)
 
 			var i int
 			err = s.Iterate(in, func(out *expr.Environment) error {
@@ -398,9 +480,14 @@ func TestTableInsert(t *testing.T) {
 			})
 			if test.fails {
 				require.Error(t, err)
-			} else {
-				require.NoError(t, err)
+				return
 			}
+			require.NoError(t, err)
+
+			require.EqualValues(t, len(test.out), op.Affected())
+			id, ok := op.LastInsertID()
+			require.True(t, ok)
+			require.EqualValues(t, len(test.out), id)
 		})
 	}
 
@@ -453,7 +540,8 @@ func TestTableReplace(t *testing.T) {
 			var in expr.Environment
 			in.Tx = tx.Transaction
 
-			s := stream.New(stream.Documents(test.in...)).Pipe(stream.TableReplace("test"))
+			op := stream.TableReplace("test")
+			s := stream.New(stream.Documents(test.in...)).Pipe(op)
 
 			var i int
 			err = s.Iterate(&in, func(out *expr.Environment) error {
@@ -473,6 +561,7 @@ func TestTableReplace(t *testing.T) {
 				return
 			}
 			require.NoError(t, err)
+			require.EqualValues(t, len(test.in), op.Affected())
 
 			res, err := tx.Query("SELECT * FROM test")
 			require.NoError(t, err)
@@ -541,7 +630,8 @@ func TestTableDelete(t *testing.T) {
 			require.NoError(t, err)
 			test.in.(*document.FieldBuffer).EncodedKey = k
 
-			s := stream.New(stream.Documents(test.in)).Pipe(stream.TableDelete("test"))
+			op := stream.TableDelete("test")
+			s := stream.New(stream.Documents(test.in)).Pipe(op)
 
 			err = s.Iterate(&env, func(out *expr.Environment) error {
 				d, _ := out.GetDocument()
@@ -552,6 +642,7 @@ func TestTableDelete(t *testing.T) {
 				require.Error(t, err)
 			} else {
 				require.NoError(t, err)
+				require.EqualValues(t, 1, op.Affected())
 			}
 
 			res, err := tx.Query("SELECT * FROM test")
@@ -0,0 +1,676 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/genjidb/genji/document"
+	"github.com/genjidb/genji/expr"
+)
+
+const (
+	envHasDoc byte = 1 << iota
+	envHasKey
+	envHasVars
+)
+
+// encodeEnvironment appends to buf a binary representation of every level of env,
+// up to the outer environment, which is not encoded.
+// Only documents, their keys and variables are encoded, the transaction and
+// the parameters are taken from the outer environment during decoding.
+func encodeEnvironment(buf []byte, env, outer *expr.Environment) ([]byte, error) {
+	var levels []*expr.Environment
+	for e := env; e != nil && e != outer; e = e.Outer {
+		levels = append(levels, e)
+	}
+
+	buf = appendUvarint(buf, uint64(len(levels)))
+
+	var err error
+	for _, e := range levels {
+		var flags byte
+		var k document.Keyer
+		if e.Doc != nil {
+			flags |= envHasDoc
+			var ok bool
+			if k, ok = e.Doc.(document.Keyer); ok && k.RawKey() != nil {
+				flags |= envHasKey
+			}
+		}
+		if e.Vars != nil {
+			flags |= envHasVars
+		}
+
+		buf = append(buf, flags)
+
+		if flags&envHasDoc != 0 {
+			buf, err = appendEncodedValue(buf, document.NewDocumentValue(e.Doc))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if flags&envHasKey != 0 {
+			buf = appendUvarint(buf, uint64(len(k.RawKey())))
+			buf = append(buf, k.RawKey()...)
+
+			v, err := k.Key()
+			if err != nil {
+				return nil, err
+			}
+			if v.Type.IsZero() {
+				v = document.NewNullValue()
+			}
+			buf, err = appendEncodedValue(buf, v)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if flags&envHasVars != 0 {
+			buf, err = appendEncodedValue(buf, document.NewDocumentValue(e.Vars))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return buf, nil
+}
+
+// decodeEnvironment decodes an environment encoded with encodeEnvironment
+// and attaches it to outer.
+func decodeEnvironment(data []byte, outer *expr.Environment) (*expr.Environment, error) {
+	n, data, err := readUvarint(data)
+	if err != nil {
+		return nil, err
+	}
+
+	levels := make([]expr.Environment, n)
+	for i := range levels {
+		if i+1 < len(levels) {
+			levels[i].Outer = &levels[i+1]
+		} else {
+			levels[i].Outer = outer
+		}
+
+		if len(data) == 0 {
+			return nil, errors.New("malformed environment")
+		}
+		flags := data[0]
+		data = data[1:]
+
+		var fb *document.FieldBuffer
+		if flags&envHasDoc != 0 {
+			fb, data, err = readEncodedDocument(data)
+			if err != nil {
+				return nil, err
+			}
+			levels[i].Doc = fb
+		}
+
+		if flags&envHasKey != 0 {
+			var l uint64
+			l, data, err = readUvarint(data)
+			if err != nil {
+				return nil, err
+			}
+			if uint64(len(data)) < l {
+				return nil, io.ErrUnexpectedEOF
+			}
+			fb.EncodedKey = data[:l]
+			data = data[l:]
+
+			var v document.Value
+			v, data, err = readEncodedValue(data)
+			if err != nil {
+				return nil, err
+			}
+			if v.Type != document.NullValue {
+				fb.DecodedKey = v
+			}
+		}
+
+		if flags&envHasVars != 0 {
+			levels[i].Vars, data, err = readEncodedDocument(data)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if len(levels) == 0 {
+		return outer, nil
+	}
+
+	return &levels[0], nil
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return append(buf, tmp[:n]...)
+}
+
+func readUvarint(data []byte) (uint64, []byte, error) {
+	x, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, nil, errors.New("malformed varint")
+	}
+
+	return x, data[n:], nil
+}
+
+// appendEncodedValue appends the length of the encoded value followed by
+// the value encoded with a document.ValueEncoder.
+func appendEncodedValue(buf []byte, v document.Value) ([]byte, error) {
+	var b bytes.Buffer
+	err := document.NewValueEncoder(&b).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+
+	buf = appendUvarint(buf, uint64(b.Len()))
+	return append(buf, b.Bytes()...), nil
+}
+
+func readEncodedValue(data []byte) (document.Value, []byte, error) {
+	l, data, err := readUvarint(data)
+	if err != nil {
+		return document.Value{}, nil, err
+	}
+	if uint64(len(data)) < l {
+		return document.Value{}, nil, io.ErrUnexpectedEOF
+	}
+
+	v, err := document.DecodeValue(data[:l])
+	return v, data[l:], err
+}
+
+func readEncodedDocument(data []byte) (*document.FieldBuffer, []byte, error) {
+	v, data, err := readEncodedValue(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if v.Type != document.DocumentValue {
+		return nil, nil, errors.New("malformed environment")
+	}
+
+	fb, ok := v.V.(*document.FieldBuffer)
+	if !ok {
+		fb = document.NewFieldBuffer()
+		err = fb.Copy(v.V.(document.Document))
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return fb, data, nil
+}
+
+// maxSpillLevel is the number of times the data of a partition
+// can be partitioned again before being processed in memory regardless of the limit.
+const maxSpillLevel = 8
+
+// spillPartitionCount is the number of partitions created every time
+// an operation spills its data.
+const spillPartitionCount = 16
+
+// workMemoryLimit returns the maximum number of bytes an operation can use in memory
+// and the directory where temporary files must be created.
+// A limit of zero means there is no limit.
+func workMemoryLimit(env *expr.Environment) (int64, string) {
+	tx := env.GetTx()
+	if tx == nil {
+		return 0, ""
+	}
+
+	return tx.DB().WorkMemoryLimit, tx.DB().TempDir
+}
+
+// A spillRecord is a key and an encoded environment stored in a spillFile.
+type spillRecord struct {
+	key []byte
+	env []byte
+}
+
+// A spillFile is a temporary file to which records are appended
+// before being read back.
+type spillFile struct {
+	name string
+	// nil once the file is released.
+	f *os.File
+	w *bufio.Writer
+
+	buf []byte
+}
+
+func createSpillFile(dir string) (*spillFile, error) {
+	f, err := os.CreateTemp(dir, "genji-spill-*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &spillFile{
+		name: f.Name(),
+		f:    f,
+		w:    bufio.NewWriter(f),
+	}, nil
+}
+
+// Write appends a record to the file.
+func (s *spillFile) Write(key, env []byte) error {
+	s.buf = appendUvarint(s.buf[:0], uint64(len(key)))
+	s.buf = append(s.buf, key...)
+	s.buf = appendUvarint(s.buf, uint64(len(env)))
+	s.buf = append(s.buf, env...)
+
+	_, err := s.w.Write(s.buf)
+	return err
+}
+
+// Reader flushes the pending writes and returns a reader
+// positioned at the beginning of the file.
+func (s *spillFile) Reader() (*spillReader, error) {
+	if s.f == nil {
+		f, err := os.Open(s.name)
+		if err != nil {
+			return nil, err
+		}
+		s.f = f
+
+		return &spillReader{r: bufio.NewReader(s.f)}, nil
+	}
+
+	err := s.w.Flush()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.f.Seek(0, io.SeekStart)
+	if err != nil {
+		return nil, err
+	}
+
+	return &spillReader{r: bufio.NewReader(s.f)}, nil
+}
+
+// Release flushes the pending writes and closes the file descriptor
+// until the file is read again with Reader.
+// No records can be written to the file afterwards.
+func (s *spillFile) Release() error {
+	err := s.w.Flush()
+	if err != nil {
+		return err
+	}
+
+	f := s.f
+	s.f = nil
+	return f.Close()
+}
+
+// Iterate calls fn for every record of the file, in the order they were written.
+func (s *spillFile) Iterate(fn func(key, env []byte) error) error {
+	r, err := s.Reader()
+	if err != nil {
+		return err
+	}
+
+	for {
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+
+		err = fn(r.cur.key, r.cur.env)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close and remove the file.
+func (s *spillFile) Close() error {
+	var err error
+	if s.f != nil {
+		err = s.f.Close()
+		s.f = nil
+	}
+	if e := os.Remove(s.name); e != nil && err == nil {
+		err = e
+	}
+
+	return err
+}
+
+// A spillReader reads the records of a spillFile one at a time.
+type spillReader struct {
+	r   *bufio.Reader
+	cur spillRecord
+}
+
+func (sr *spillReader) next() (bool, error) {
+	key, err := sr.readBytes()
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	env, err := sr.readBytes()
+	if err == io.EOF {
+		return false, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return false, err
+	}
+
+	sr.cur = spillRecord{key: key, env: env}
+	return true, nil
+}
+
+func (sr *spillReader) readBytes() ([]byte, error) {
+	l, err := binary.ReadUvarint(sr.r)
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, l)
+	_, err = io.ReadFull(sr.r, b)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
+}
+
+// spillPartitions distributes records among a fixed number of spill files,
+// using a hash of their key.
+// Records with the same key always end up in the same partition.
+type spillPartitions struct {
+	dir   string
+	level int
+	files [spillPartitionCount]*spillFile
+}
+
+func newSpillPartitions(dir string, level int) *spillPartitions {
+	return &spillPartitions{
+		dir:   dir,
+		level: level,
+	}
+}
+
+// Add a record to the partition of its key.
+func (p *spillPartitions) Add(key, env []byte) error {
+	// the level is part of the hash so that records of one partition
+	// are spread among all the partitions of the next level.
+	h := fnv.New32a()
+	h.Write([]byte{byte(p.level)})
+	h.Write(key)
+	i := h.Sum32() % spillPartitionCount
+
+	if p.files[i] == nil {
+		f, err := createSpillFile(p.dir)
+		if err != nil {
+			return err
+		}
+		p.files[i] = f
+	}
+
+	return p.files[i].Write(key, env)
+}
+
+// Iterate calls fn for every non-empty partition.
+func (p *spillPartitions) Iterate(fn func(f *spillFile) error) error {
+	for _, f := range p.files {
+		if f == nil {
+			continue
+		}
+
+		err := fn(f)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close and remove every partition.
+func (p *spillPartitions) Close() error {
+	if p == nil {
+		return nil
+	}
+
+	var err error
+	for i, f := range p.files {
+		if f == nil {
+			continue
+		}
+
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+		p.files[i] = nil
+	}
+
+	return err
+}
+
+// maxMergeFanIn is the maximum number of runs an externalSorter merges at once,
+// and so the maximum number of files it keeps open.
+const maxMergeFanIn = 16
+
+// An externalSorter sorts records by key in memory until their total size reaches
+// a limit. Past that limit, records are sorted and written to a temporary file,
+// called a run. Once all the records have been added, runs are merged,
+// in several passes if there are more than maxMergeFanIn runs.
+type externalSorter struct {
+	desc  bool
+	limit int64
+	dir   string
+
+	records []spillRecord
+	size    int64
+	runs    []*spillFile
+}
+
+func newExternalSorter(desc bool, limit int64, dir string) *externalSorter {
+	return &externalSorter{
+		desc:  desc,
+		limit: limit,
+		dir:   dir,
+	}
+}
+
+// Add a record to the sorter. key and env must not be modified afterwards.
+func (s *externalSorter) Add(key, env []byte) error {
+	s.records = append(s.records, spillRecord{key: key, env: env})
+	s.size += int64(len(key) + len(env))
+
+	if s.size < s.limit {
+		return nil
+	}
+
+	return s.spill()
+}
+
+func (s *externalSorter) less(a, b []byte) bool {
+	if s.desc {
+		return bytes.Compare(a, b) > 0
+	}
+
+	return bytes.Compare(a, b) < 0
+}
+
+func (s *externalSorter) sortRecords() {
+	sort.SliceStable(s.records, func(i, j int) bool {
+		return s.less(s.records[i].key, s.records[j].key)
+	})
+}
+
+// spill writes the in-memory records to a new run.
+func (s *externalSorter) spill() error {
+	s.sortRecords()
+
+	f, err := createSpillFile(s.dir)
+	if err != nil {
+		return err
+	}
+	s.runs = append(s.runs, f)
+
+	for _, r := range s.records {
+		err = f.Write(r.key, r.env)
+		if err != nil {
+			return err
+		}
+	}
+
+	s.records = s.records[:0]
+	s.size = 0
+	return f.Release()
+}
+
+// Iterate calls fn for every record, in order.
+func (s *externalSorter) Iterate(fn func(key, env []byte) error) error {
+	if len(s.runs) == 0 {
+		s.sortRecords()
+
+		for _, r := range s.records {
+			err := fn(r.key, r.env)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if len(s.records) > 0 {
+		err := s.spill()
+		if err != nil {
+			return err
+		}
+	}
+
+	// merge the oldest runs into a new one until there are few enough
+	// of them to be merged at once.
+	for len(s.runs) > maxMergeFanIn {
+		f, err := createSpillFile(s.dir)
+		if err != nil {
+			return err
+		}
+		s.runs = append(s.runs, f)
+
+		err = s.merge(s.runs[:maxMergeFanIn], f.Write)
+		if err != nil {
+			return err
+		}
+
+		err = f.Release()
+		if err != nil {
+			return err
+		}
+
+		merged := s.runs[:maxMergeFanIn]
+		s.runs = s.runs[maxMergeFanIn:]
+		for _, r := range merged {
+			if e := r.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.merge(s.runs, fn)
+}
+
+// merge calls fn for every record of the given runs, in order.
+func (s *externalSorter) merge(runs []*spillFile, fn func(key, env []byte) error) error {
+	h := runHeap{less: s.less}
+	for _, f := range runs {
+		r, err := f.Reader()
+		if err != nil {
+			return err
+		}
+
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h.readers = append(h.readers, r)
+		}
+	}
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		r := h.readers[0]
+
+		err := fn(r.cur.key, r.cur.env)
+		if err != nil {
+			return err
+		}
+
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+
+	return nil
+}
+
+// Close removes the temporary files.
+func (s *externalSorter) Close() error {
+	var err error
+
+	for _, f := range s.runs {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	s.runs = nil
+	s.records = nil
+	return err
+}
+
+// runHeap orders the readers of the runs by their current record.
+type runHeap struct {
+	readers []*spillReader
+	less    func(a, b []byte) bool
+}
+
+func (h runHeap) Len() int           { return len(h.readers) }
+func (h runHeap) Less(i, j int) bool { return h.less(h.readers[i].cur.key, h.readers[j].cur.key) }
+func (h runHeap) Swap(i, j int)      { h.readers[i], h.readers[j] = h.readers[j], h.readers[i] }
+
+func (h *runHeap) Push(x interface{}) {
+	h.readers = append(h.readers, x.(*spillReader))
+}
+
+func (h *runHeap) Pop() interface{} {
+	old := h.readers
+	n := len(old)
+	x := old[n-1]
+	h.readers = old[0 : n-1]
+	return x
+}
@@ -1,10 +1,14 @@
 package stream
 
 import (
+	"context"
 	"errors"
 	"strings"
 
+	"github.com/genjidb/genji/database"
+	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/expr"
+	"github.com/genjidb/genji/stringutil"
 )
 
 // ErrStreamClosed is used to indicate that a stream must be closed.
@@ -65,6 +69,115 @@ func (s *Stream) First() Operator {
 	return n
 }
 
+// Clone returns a copy of the stream whose operators can be modified
+// without altering the operators of s.
+// Expressions are shared by both streams and must not be modified.
+func (s *Stream) Clone() *Stream {
+	if s == nil {
+		return nil
+	}
+
+	var clone *Stream
+	for op := s.First(); op != nil; op = op.GetNext() {
+		clone = clone.Pipe(cloneOperator(op))
+	}
+
+	if clone == nil {
+		return &Stream{}
+	}
+
+	return clone
+}
+
+// cloneOperator returns a copy of op, detached from the other
+// operators of its stream.
+func cloneOperator(op Operator) Operator {
+	var c Operator
+
+	switch t := op.(type) {
+	case *DocumentsOperator:
+		cp := *t
+		cp.Docs = append([]document.Document(nil), t.Docs...)
+		c = &cp
+	case *ExprsOperator:
+		cp := *t
+		cp.Exprs = append([]expr.Expr(nil), t.Exprs...)
+		c = &cp
+	case *SeqScanOperator:
+		cp := *t
+		c = &cp
+	case *PkScanOperator:
+		cp := *t
+		cp.Ranges = append(Ranges(nil), t.Ranges...)
+		c = &cp
+	case *IndexScanOperator:
+		cp := *t
+		cp.Ranges = append(Ranges(nil), t.Ranges...)
+		cp.lastEntry = nil
+		c = &cp
+	case *MapOperator:
+		cp := *t
+		c = &cp
+	case *FilterOperator:
+		cp := *t
+		c = &cp
+	case *TakeOperator:
+		cp := *t
+		c = &cp
+	case *SkipOperator:
+		cp := *t
+		c = &cp
+	case *GroupByOperator:
+		cp := *t
+		c = &cp
+	case *SortOperator:
+		cp := *t
+		c = &cp
+	case *TopNOperator:
+		cp := *t
+		c = &cp
+	case *HashAggregateOperator:
+		cp := *t
+		cp.Builders = append([]expr.AggregatorBuilder(nil), t.Builders...)
+		c = &cp
+	case *TableInsertOperator:
+		cp := *t
+		c = &cp
+	case *TableReplaceOperator:
+		cp := *t
+		c = &cp
+	case *TableDeleteOperator:
+		cp := *t
+		c = &cp
+	case *DistinctOperator:
+		cp := *t
+		c = &cp
+	case *SetOperator:
+		cp := *t
+		c = &cp
+	case *UnsetOperator:
+		cp := *t
+		c = &cp
+	case *IterRenameOperator:
+		cp := *t
+		cp.FieldNames = append([]string(nil), t.FieldNames...)
+		c = &cp
+	case *ProjectOperator:
+		cp := *t
+		cp.Exprs = append([]expr.Expr(nil), t.Exprs...)
+		c = &cp
+	case *GatherOperator:
+		cp := *t
+		c = &cp
+	default:
+		panic(stringutil.Sprintf("unknown operator %#v", op))
+	}
+
+	c.SetPrev(nil)
+	c.SetNext(nil)
+	return c
+}
+
 func (s *Stream) String() string {
 	if s.Op == nil {
 		return ""
@@ -112,3 +225,73 @@ func InsertAfter(op, newOp Operator) Operator {
 
 	return newOp
 }
+
+// cancelCheckInterval is the number of values an operator processes
+// between two checks of the context of the environment.
+const cancelCheckInterval = 128
+
+// A canceler periodically checks whether the context of an environment is done,
+// allowing operators that process a lot of values to stop promptly.
+type canceler struct {
+	ctx context.Context
+	n   int
+}
+
+func newCanceler(env *expr.Environment) *canceler {
+	return &canceler{ctx: env.GetContext()}
+}
+
+// check returns the error of the context if it is done.
+// The context is only checked once every cancelCheckInterval calls,
+// starting with the first one.
+func (c *canceler) check() error {
+	c.n++
+	if c.n%cancelCheckInterval != 1 {
+		return nil
+	}
+
+	return c.ctx.Err()
+}
+
+// A memoryTracker reports the memory held by an operator to the budget
+// of the environment, and gives it back once the operator is done.
+type memoryTracker struct {
+	budget *database.Budget
+	size   int64
+	buf    []byte
+}
+
+func newMemoryTracker(env *expr.Environment) *memoryTracker {
+	return &memoryTracker{budget: env.GetBudget()}
+}
+
+// grow records that n more bytes are held by the operator.
+func (m *memoryTracker) grow(n int64) error {
+	if !m.budget.TracksMemory() {
+		return nil
+	}
+
+	m.size += n
+	return m.budget.Grow(n)
+}
+
+// envSize returns the approximate number of bytes used by a copy of env,
+// based on the size of its encoded form.
+// It returns zero if the memory is not tracked.
+func (m *memoryTracker) envSize(env, outer *expr.Environment) (int64, error) {
+	if !m.budget.TracksMemory() {
+		return 0, nil
+	}
+
+	var err error
+	m.buf, err = encodeEnvironment(m.buf[:0], env, outer)
+	return int64(len(m.buf)), err
+}
+
+// release gives back the memory held by the operator.
+func (m *memoryTracker) release() {
+	if m.size != 0 {
+		m.budget.Grow(-m.size)
+		m.size = 0
+	}
+}
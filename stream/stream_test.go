@@ -1,9 +1,12 @@
 package stream_test
 
 import (
+	"context"
 	"fmt"
+	"sync/atomic"
 	"testing"
 
+	"github.com/genjidb/genji"
 	"github.com/genjidb/genji/document"
 	"github.com/genjidb/genji/expr"
 	"github.com/genjidb/genji/sql/parser"
@@ -32,3 +35,118 @@ func TestStream(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, int64(1), count)
 }
+
+// exprFunc is an expression evaluated by calling the function.
+type exprFunc func(env *expr.Environment) (document.Value, error)
+
+func (f exprFunc) Eval(env *expr.Environment) (document.Value, error) {
+	return f(env)
+}
+
+func TestCancel(t *testing.T) {
+	db, err := genji.Open(":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = db.Exec("CREATE TABLE test(a INTEGER PRIMARY KEY, b INTEGER); CREATE INDEX idx_b ON test(b)")
+	require.NoError(t, err)
+	for i := 0; i < 1000; i++ {
+		err = db.Exec("INSERT INTO test (a, b) VALUES (?, ?)", i, i%10)
+		require.NoError(t, err)
+	}
+	// used to split parallel scans
+	err = db.Exec("ANALYZE test")
+	require.NoError(t, err)
+
+	tx, err := db.Begin(false)
+	require.NoError(t, err)
+	defer tx.Rollback()
+
+	tests := []struct {
+		name string
+		s    *stream.Stream
+	}{
+		{"seqScan", stream.New(stream.SeqScan("test"))},
+		{"pkScan", stream.New(stream.PkScan("test", stream.Range{Min: document.NewIntegerValue(10)}))},
+		{"indexScan", stream.New(stream.IndexScan("idx_b"))},
+		{"sort", stream.New(stream.Documents(generateSeqDocs(t, 1000)...)).Pipe(stream.Sort(parser.MustParseExpr("a")))},
+		{"topN", stream.New(stream.Documents(generateSeqDocs(t, 1000)...)).Pipe(stream.TopN(parser.MustParseExpr("a"), 10))},
+		{"distinct", stream.New(stream.Documents(generateSeqDocs(t, 1000)...)).Pipe(stream.Distinct())},
+		{"hashAggregate", stream.New(stream.Documents(generateSeqDocs(t, 1000)...)).Pipe(stream.HashAggregate(&expr.CountFunc{Wildcard: true}))},
+		{"gather", stream.New(stream.SeqScan("test")).Pipe(stream.Gather(4))},
+		{"parallel hashAggregate", stream.New(stream.SeqScan("test")).Pipe(stream.HashAggregate(&expr.CountFunc{Wildcard: true})).Pipe(stream.Gather(4))},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			in := expr.Environment{Ctx: ctx, Tx: tx.Transaction}
+			var count int
+			err := test.s.Iterate(&in, func(env *expr.Environment) error {
+				count++
+				return nil
+			})
+			require.Equal(t, context.Canceled, err)
+			require.Zero(t, count)
+		})
+	}
+
+	t.Run("During iteration", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		in := expr.Environment{Ctx: ctx, Tx: tx.Transaction}
+		var count int
+		err := stream.New(stream.SeqScan("test")).Iterate(&in, func(env *expr.Environment) error {
+			count++
+			cancel()
+			return nil
+		})
+		require.Equal(t, context.Canceled, err)
+		require.Less(t, count, 1000)
+	})
+
+	t.Run("During parallel iteration", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// the workers aggregate every document before sending anything:
+		// cancel the context while they are reading the table.
+		var count int64
+		s := stream.New(stream.SeqScan("test")).
+			Pipe(stream.Filter(exprFunc(func(env *expr.Environment) (document.Value, error) {
+				if atomic.AddInt64(&count, 1) == 10 {
+					cancel()
+				}
+				return document.NewBoolValue(true), nil
+			}))).
+			Pipe(stream.HashAggregate(&expr.CountFunc{Wildcard: true})).
+			Pipe(stream.Gather(4))
+
+		in := expr.Environment{Ctx: ctx, Tx: tx.Transaction}
+		err := s.Iterate(&in, func(env *expr.Environment) error {
+			return nil
+		})
+		require.Equal(t, context.Canceled, err)
+		require.Less(t, atomic.LoadInt64(&count), int64(1000))
+	})
+
+	t.Run("Transaction context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		tx, err := db.WithContext(ctx).Begin(false)
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		// the context of the transaction is used if the environment has none.
+		in := expr.Environment{Tx: tx.Transaction}
+		cancel()
+		err = stream.New(stream.SeqScan("test")).Iterate(&in, func(env *expr.Environment) error {
+			return nil
+		})
+		require.Equal(t, context.Canceled, err)
+	})
+}